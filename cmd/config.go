@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flashcatcloud/flashduty-runner/config"
+	"github.com/flashcatcloud/flashduty-runner/redact"
+)
+
+func configCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect and validate runner configuration",
+	}
+	cmd.AddCommand(configValidateCmd())
+	cmd.AddCommand(configPrintCmd())
+	cmd.AddCommand(configRedactCmd())
+	return cmd
+}
+
+func configValidateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "validate",
+		Short:        "Validate the effective configuration",
+		SilenceUsage: true,
+		Long: `Load the configuration file, environment variables and flags, and report any errors.
+
+Examples:
+  flashduty-runner config validate --config /etc/flashduty-runner/config.yaml`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+			if err := cfg.Validate(); err != nil {
+				return fmt.Errorf("invalid configuration:\n%w", err)
+			}
+			fmt.Println("configuration is valid")
+			return nil
+		},
+	}
+	addConfigFlags(cmd)
+	return cmd
+}
+
+func configPrintCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "print",
+		Short: "Print the effective configuration with secrets redacted",
+		Long: `Print the configuration after applying defaults, the config file, environment
+variables and flags. Secrets such as the token are redacted.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			if path := config.ResolvePath(flagConfig); path != "" {
+				fmt.Printf("# config file: %s\n", path)
+			} else {
+				fmt.Println("# config file: none")
+			}
+
+			out, err := cfg.Redacted().YAML()
+			if err != nil {
+				return fmt.Errorf("failed to render configuration: %w", err)
+			}
+			fmt.Print(string(out))
+
+			if err := cfg.Validate(); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: configuration is invalid:\n%v\n", err)
+			}
+			return nil
+		},
+	}
+	addConfigFlags(cmd)
+	return cmd
+}
+
+func configRedactCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "redact <file>...",
+		Short:        "Print files with secrets masked as they would be sent to Flashduty",
+		SilenceUsage: true,
+		Args:         cobra.MinimumNArgs(1),
+		Long: `Apply the built-in redaction rules and redaction.patterns from the configuration
+to files and print the result, with the number of secrets masked in each file on
+stderr. Use it to check custom patterns against fixture files. The rules are
+applied even when redaction.enabled is false.
+
+Examples:
+  flashduty-runner config redact .env testdata/kubeconfig.yaml`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+			redactor, err := redact.New(cfg.Redaction.Patterns)
+			if err != nil {
+				return err
+			}
+
+			for _, path := range args {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %w", path, err)
+				}
+				out, n := redactor.String(string(data))
+				fmt.Print(out)
+				fmt.Fprintf(os.Stderr, "%s: %d secrets masked\n", path, n)
+			}
+			return nil
+		},
+	}
+	addConfigFlags(cmd)
+	return cmd
+}
@@ -7,14 +7,18 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/flashcatcloud/flashduty-runner/config"
+	"github.com/flashcatcloud/flashduty-runner/db"
+	"github.com/flashcatcloud/flashduty-runner/diag"
+	"github.com/flashcatcloud/flashduty-runner/k8s"
 	"github.com/flashcatcloud/flashduty-runner/log"
 	"github.com/flashcatcloud/flashduty-runner/permission"
+	"github.com/flashcatcloud/flashduty-runner/redact"
 	"github.com/flashcatcloud/flashduty-runner/workspace"
 	"github.com/flashcatcloud/flashduty-runner/ws"
 )
@@ -28,16 +32,18 @@ var (
 
 // Command line flags
 var (
+	flagConfig    string
 	flagToken     string
 	flagURL       string
 	flagWorkspace string
 	flagLogLevel  string
-)
 
-// Default values
-const (
-	defaultURL      = "wss://api.flashcat.cloud/safari/worknode/ws"
-	defaultLogLevel = "info"
+	flagEnvRefreshInterval time.Duration
+	flagLabels             []string
+	flagCapabilities       []string
+	flagMounts             []string
+	flagQuota              string
+	flagSessionKey         string
 )
 
 func main() {
@@ -48,11 +54,14 @@ func main() {
 to execute commands and access resources on behalf of Flashduty platform.
 
 It connects to Flashduty platform via WebSocket and executes workspace operations
-(bash, read, write, list, glob, grep, webfetch) and MCP tool calls.`,
+(bash, read, write, edit, list, glob, grep, tail, watch, stat, mkdir, move, copy,
+delete, upload, download, archive, extract, webfetch) and MCP tool calls.`,
 	}
 
 	// Add subcommands
 	rootCmd.AddCommand(runCmd())
+	rootCmd.AddCommand(configCmd())
+	rootCmd.AddCommand(serviceCmd())
 	rootCmd.AddCommand(versionCmd())
 
 	if err := rootCmd.Execute(); err != nil {
@@ -70,26 +79,43 @@ Examples:
   # Basic usage (token required)
   flashduty-runner run --token wnt_xxx
 
+  # Load settings from a config file
+  flashduty-runner run --config /etc/flashduty-runner/config.yaml
+
   # Specify workspace directory
   flashduty-runner run --token wnt_xxx --workspace ~/projects
 
   # Specify custom API URL
   flashduty-runner run --token wnt_xxx --url wss://custom.example.com/safari/worknode/ws
 
+  # Declare labels and capabilities for task routing
+  flashduty-runner run --token wnt_xxx --label env=prod --label team=sre --capability mysql
+
+  # Allow reading logs outside the workspace as "logs:nginx/error.log"
+  flashduty-runner run --token wnt_xxx --mount logs=/var/log
+
+Settings are resolved with precedence flag > environment > config file > default.
+Labels, capabilities and mounts are merged across these sources instead: a flag
+or environment entry adds to the config file's, replacing a label or mount of the
+same name.
+The config file defaults to ~/.flashduty-runner/config.yaml if it exists.
+
 Environment variables:
+  FLASHDUTY_RUNNER_CONFIG    - Config file path
   FLASHDUTY_RUNNER_TOKEN     - Authentication token (required if --token not provided)
   FLASHDUTY_RUNNER_URL       - WebSocket endpoint URL
-  FLASHDUTY_RUNNER_WORKSPACE - Workspace root directory`,
+  FLASHDUTY_RUNNER_WORKSPACE - Workspace root directory
+  FLASHDUTY_RUNNER_LOG_LEVEL - Log level
+  FLASHDUTY_RUNNER_ENV_REFRESH_INTERVAL - Environment info refresh interval (e.g. 10m, 0 to disable)
+  FLASHDUTY_RUNNER_LABELS    - Comma-separated labels, e.g. "env=prod,team=sre"
+  FLASHDUTY_RUNNER_CAPABILITIES - Comma-separated capability tags
+  FLASHDUTY_RUNNER_MOUNTS    - Comma-separated read-only mounts, e.g. "logs=/var/log,nginx=/etc/nginx"`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runRunner()
+			return runRunner(cmd)
 		},
 	}
 
-	// Flags with environment variable fallback
-	cmd.Flags().StringVar(&flagToken, "token", "", "Authentication token (required, env: FLASHDUTY_RUNNER_TOKEN)")
-	cmd.Flags().StringVar(&flagURL, "url", "", "WebSocket endpoint URL (env: FLASHDUTY_RUNNER_URL)")
-	cmd.Flags().StringVar(&flagWorkspace, "workspace", "", "Workspace root directory (env: FLASHDUTY_RUNNER_WORKSPACE)")
-	cmd.Flags().StringVar(&flagLogLevel, "log-level", "", "Log level: debug, info, warn, error (env: FLASHDUTY_RUNNER_LOG_LEVEL)")
+	addConfigFlags(cmd)
 
 	return cmd
 }
@@ -106,77 +132,97 @@ func versionCmd() *cobra.Command {
 	}
 }
 
-// Config holds the runtime configuration
-type Config struct {
-	Token         string
-	URL           string
-	WorkspaceRoot string
-	LogLevel      string
+// addConfigFlags registers flags that override configuration settings.
+func addConfigFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&flagConfig, "config", "", "Config file path (env: FLASHDUTY_RUNNER_CONFIG, default: ~/.flashduty-runner/config.yaml)")
+	cmd.Flags().StringVar(&flagToken, "token", "", "Authentication token (required, env: FLASHDUTY_RUNNER_TOKEN)")
+	cmd.Flags().StringVar(&flagURL, "url", "", "WebSocket endpoint URL (env: FLASHDUTY_RUNNER_URL)")
+	cmd.Flags().StringVar(&flagWorkspace, "workspace", "", "Workspace root directory (env: FLASHDUTY_RUNNER_WORKSPACE)")
+	cmd.Flags().StringVar(&flagLogLevel, "log-level", "", "Log level: debug, info, warn, error (env: FLASHDUTY_RUNNER_LOG_LEVEL)")
+	cmd.Flags().DurationVar(&flagEnvRefreshInterval, "env-refresh-interval", config.DefaultEnvRefreshInterval,
+		"How often to re-send environment info, 0 to disable (env: FLASHDUTY_RUNNER_ENV_REFRESH_INTERVAL)")
+	cmd.Flags().StringArrayVar(&flagLabels, "label", nil, "Label in key=value form, repeatable (env: FLASHDUTY_RUNNER_LABELS)")
+	cmd.Flags().StringArrayVar(&flagCapabilities, "capability", nil, "Capability tag, repeatable (env: FLASHDUTY_RUNNER_CAPABILITIES)")
+	cmd.Flags().StringArrayVar(&flagMounts, "mount", nil, "Read-only mount in name=/abs/path form, repeatable (env: FLASHDUTY_RUNNER_MOUNTS)")
+	cmd.Flags().StringVar(&flagQuota, "quota", "", "Workspace disk quota such as 10GB, 0 for no limit (env: FLASHDUTY_RUNNER_QUOTA_MAX_SIZE)")
+	cmd.Flags().StringVar(&flagSessionKey, "session-key", "", "Give each source_instance or trace its own workspace directory (env: FLASHDUTY_RUNNER_SESSION_KEY)")
 }
 
-func loadConfig() (*Config, error) {
-	cfg := &Config{}
+// loadConfig loads the configuration file and environment, then applies flags
+// explicitly set on the command line.
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	cfg, err := config.Load(config.ResolvePath(flagConfig))
+	if err != nil {
+		return nil, err
+	}
 
-	// Token: flag > env
-	cfg.Token = flagToken
-	if cfg.Token == "" {
-		cfg.Token = os.Getenv("FLASHDUTY_RUNNER_TOKEN")
+	flags := cmd.Flags()
+	if flags.Changed("token") {
+		cfg.Token = flagToken
 	}
-	if cfg.Token == "" {
-		return nil, fmt.Errorf("token is required: use --token flag or set FLASHDUTY_RUNNER_TOKEN environment variable")
+	if flags.Changed("url") {
+		cfg.URL = flagURL
 	}
-
-	// URL: flag > env > default
-	cfg.URL = flagURL
-	if cfg.URL == "" {
-		cfg.URL = os.Getenv("FLASHDUTY_RUNNER_URL")
+	if flags.Changed("workspace") {
+		cfg.WorkspaceRoot = flagWorkspace
 	}
-	if cfg.URL == "" {
-		cfg.URL = defaultURL
+	if flags.Changed("log-level") {
+		cfg.Log.Level = flagLogLevel
 	}
-
-	// Workspace: flag > env > default
-	cfg.WorkspaceRoot = flagWorkspace
-	if cfg.WorkspaceRoot == "" {
-		cfg.WorkspaceRoot = os.Getenv("FLASHDUTY_RUNNER_WORKSPACE")
+	if flags.Changed("env-refresh-interval") {
+		cfg.EnvRefreshInterval = flagEnvRefreshInterval
 	}
-	if cfg.WorkspaceRoot == "" {
-		homeDir, err := os.UserHomeDir()
+	if flags.Changed("label") {
+		labels, err := config.ParseLabels(flagLabels)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get home directory: %w", err)
+			return nil, err
 		}
-		cfg.WorkspaceRoot = filepath.Join(homeDir, ".flashduty-runner", "workspace")
+		cfg.MergeLabels(labels)
 	}
-
-	// Log level: flag > env > default
-	cfg.LogLevel = flagLogLevel
-	if cfg.LogLevel == "" {
-		cfg.LogLevel = os.Getenv("FLASHDUTY_RUNNER_LOG_LEVEL")
+	if flags.Changed("capability") {
+		cfg.MergeCapabilities(flagCapabilities)
+	}
+	if flags.Changed("mount") {
+		mounts, err := config.ParseMounts(flagMounts)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MergeMounts(mounts)
+	}
+	if flags.Changed("quota") {
+		size, err := config.ParseByteSize(flagQuota)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Quota.MaxSize = size
 	}
-	if cfg.LogLevel == "" {
-		cfg.LogLevel = defaultLogLevel
+	if flags.Changed("session-key") {
+		cfg.Sessions.Key = flagSessionKey
 	}
 
 	return cfg, nil
 }
 
-func runRunner() error {
+func runRunner(cmd *cobra.Command) error {
 	// Load configuration
-	cfg, err := loadConfig()
+	cfg, err := loadConfig(cmd)
 	if err != nil {
 		return err
 	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
 
 	// Setup logging
-	setupLogging(cfg.LogLevel)
+	setupLogging(cfg.Log.Level)
 
 	slog.Info("starting flashduty-runner",
 		"version", Version,
 		"workspace", cfg.WorkspaceRoot,
 	)
 
-	// Create permission checker with default deny-all policy
-	checker := permission.NewChecker(map[string]string{"*": "deny"})
+	// Create permission checker from configured rules (deny-all by default)
+	checker := permission.NewChecker(cfg.Permission.Bash)
 
 	// Create workspace
 	wspace, err := workspace.New(cfg.WorkspaceRoot, checker)
@@ -184,21 +230,96 @@ func runRunner() error {
 		return fmt.Errorf("failed to create workspace: %w", err)
 	}
 
+	if err := wspace.SetMounts(cfg.Mounts); err != nil {
+		return fmt.Errorf("failed to configure mounts: %w", err)
+	}
+
+	err = wspace.SetQuota(workspace.QuotaConfig{
+		MaxSize:        int64(cfg.Quota.MaxSize),
+		OutputsTTL:     cfg.Quota.OutputsTTL,
+		OutputsMaxSize: int64(cfg.Quota.OutputsMaxSize),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to configure quota: %w", err)
+	}
+
+	err = wspace.SetSessions(workspace.SessionConfig{
+		Key:     cfg.Sessions.Key,
+		Shared:  cfg.Sessions.Shared,
+		IdleTTL: cfg.Sessions.IdleTTL,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to configure sessions: %w", err)
+	}
+
 	slog.Info("workspace initialized",
 		"root", wspace.Root(),
+		"mounts", len(cfg.Mounts),
+		"quota", cfg.Quota.MaxSize,
+		"sessions", cfg.Sessions.Key,
 	)
 
 	// Create message handler
 	handler := ws.NewHandler(wspace)
+	if cfg.Redaction.Enabled {
+		redactor, err := redact.New(cfg.Redaction.Patterns)
+		if err != nil {
+			return fmt.Errorf("failed to configure redaction: %w", err)
+		}
+		handler.SetRedactor(redactor)
+	} else {
+		slog.Warn("redaction is disabled, secrets in task results are sent as is")
+	}
+	diagnostics, err := diag.New(cfg.Permission.Diagnostics)
+	if err != nil {
+		return fmt.Errorf("failed to configure diagnostics: %w", err)
+	}
+	handler.SetDiagnostics(diagnostics)
+	if enabled := diagnostics.Enabled(); len(enabled) > 0 {
+		slog.Info("diagnostics enabled", "diagnostics", enabled)
+	}
+	if len(cfg.Permission.Kubernetes.Resources) > 0 {
+		kube, err := k8s.New(
+			k8s.Config{Kubeconfig: cfg.Kubernetes.Kubeconfig, Context: cfg.Kubernetes.Context},
+			k8s.Policy{Resources: cfg.Permission.Kubernetes.Resources, Namespaces: cfg.Permission.Kubernetes.Namespaces},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to configure kubernetes: %w", err)
+		}
+		handler.SetKubernetes(kube)
+		slog.Info("kubernetes operations enabled",
+			"server", kube.Server(),
+			"resources", cfg.Permission.Kubernetes.Resources,
+		)
+	}
+	if len(cfg.Databases) > 0 {
+		profiles := make(map[string]db.Profile, len(cfg.Databases))
+		for name, d := range cfg.Databases {
+			profiles[name] = db.Profile{Driver: d.Driver, DSN: d.DSN, Timeout: d.Timeout, MaxRows: d.MaxRows}
+		}
+		databases, err := db.New(profiles)
+		if err != nil {
+			return fmt.Errorf("failed to configure databases: %w", err)
+		}
+		defer func() { _ = databases.Close() }()
+		handler.SetDatabases(databases)
+		slog.Info("database queries enabled", "databases", databases.Names())
+	}
 
 	// Create WebSocket client
 	client := ws.NewClient(cfg.Token, cfg.URL, cfg.WorkspaceRoot, handler.Handle, Version)
+	client.SetEnvRefreshInterval(cfg.EnvRefreshInterval)
+	client.SetLocalLabels(cfg.Labels, cfg.Capabilities)
+	client.SetWorkspaceUsage(wspace.Usage)
 	handler.SetClient(client)
 
 	// Setup signal handling
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Delete expired saved outputs and idle sessions, and keep disk usage current
+	go wspace.RunCleanup(ctx, cfg.Quota.CleanupInterval)
+
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
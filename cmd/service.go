@@ -0,0 +1,700 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Service defaults
+const (
+	serviceName         = "flashduty-runner"
+	defaultServiceUser  = "flashduty-runner"
+	defaultServiceState = "/var/lib/flashduty-runner"
+	serviceConfigDir    = "/etc/flashduty-runner"
+	serviceEnvFile      = serviceConfigDir + "/runner.env"
+	serviceConfigFile   = serviceConfigDir + "/config.yaml"
+	systemdUnitPath     = "/etc/systemd/system/" + serviceName + ".service"
+	sysvScriptPath      = "/etc/init.d/" + serviceName
+	sysvPIDFile         = "/var/run/" + serviceName + ".pid"
+	sysvLogFile         = "/var/log/" + serviceName + ".log"
+)
+
+// Service command flags
+var (
+	flagServiceUser      string
+	flagServiceWorkspace string
+	flagServiceBinary    string
+	flagServiceInit      string
+	flagServicePurge     bool
+)
+
+// serviceOptions holds the settings used to render service files.
+type serviceOptions struct {
+	User       string
+	Group      string
+	Binary     string
+	StateDir   string
+	Workspace  string
+	ConfigPath string
+	EnvFile    string
+	PIDFile    string
+	LogFile    string
+}
+
+// serviceManager installs and controls the runner under an init system.
+type serviceManager interface {
+	Name() string
+	Install(opts *serviceOptions) error
+	Uninstall() error
+	Start() error
+	Stop() error
+	Status() error
+}
+
+func serviceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "service",
+		Short: "Install and control the runner as a system service (Linux)",
+		Long: `Install and control the runner as a system service on Linux.
+
+Uses systemd when available, otherwise a generic SysV init script.
+
+Examples:
+  # Install with a token, creating the service user and workspace
+  sudo flashduty-runner service install --token wnt_xxx
+
+  # Install using an existing config file
+  sudo flashduty-runner service install --config /etc/flashduty-runner/config.yaml
+
+  sudo flashduty-runner service start
+  sudo flashduty-runner service status`,
+	}
+	cmd.PersistentFlags().StringVar(&flagServiceInit, "init", "auto", "Init system: auto, systemd, sysv")
+
+	cmd.AddCommand(serviceInstallCmd())
+	cmd.AddCommand(serviceUninstallCmd())
+	cmd.AddCommand(serviceActionCmd("start", "Start the runner service", serviceManager.Start))
+	cmd.AddCommand(serviceActionCmd("stop", "Stop the runner service", serviceManager.Stop))
+	cmd.AddCommand(serviceActionCmd("status", "Show the runner service status", serviceManager.Status))
+	return cmd
+}
+
+func serviceInstallCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "Install the runner as a system service",
+		Long: `Create a dedicated unprivileged user and workspace directory, store the token in an
+environment file readable only by that user, and register the runner with the init system.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := resolveServiceManager()
+			if err != nil {
+				return err
+			}
+			return installService(mgr, cmd.Flags().Changed("workspace"))
+		},
+	}
+	cmd.Flags().StringVar(&flagToken, "token", "", "Authentication token (env: FLASHDUTY_RUNNER_TOKEN)")
+	cmd.Flags().StringVar(&flagURL, "url", "", "WebSocket endpoint URL (env: FLASHDUTY_RUNNER_URL)")
+	cmd.Flags().StringVar(&flagConfig, "config", "", "Config file to run the service with, copied to "+serviceConfigFile)
+	cmd.Flags().StringVar(&flagServiceUser, "user", defaultServiceUser, "System user to run the service as (created if missing)")
+	cmd.Flags().StringVar(&flagServiceWorkspace, "workspace", filepath.Join(defaultServiceState, "workspace"), "Workspace root directory")
+	cmd.Flags().StringVar(&flagServiceBinary, "binary", "", "Runner binary path (default: this executable)")
+	return cmd
+}
+
+func serviceUninstallCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "uninstall",
+		Short:        "Stop and remove the runner service",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := resolveServiceManager()
+			if err != nil {
+				return err
+			}
+			if err := mgr.Uninstall(); err != nil {
+				return err
+			}
+			if err := os.Remove(serviceEnvFile); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove env file: %w", err)
+			}
+			if flagServicePurge {
+				if err := os.RemoveAll(defaultServiceState); err != nil {
+					return fmt.Errorf("failed to remove state directory: %w", err)
+				}
+				// Only removed when empty so user-provided config files are kept
+				_ = os.Remove(serviceConfigDir)
+				if err := runCommand("userdel", flagServiceUser); err != nil {
+					fmt.Fprintf(os.Stderr, "warning: failed to remove user %s: %v\n", flagServiceUser, err)
+				}
+			}
+			fmt.Printf("%s service uninstalled (%s)\n", serviceName, mgr.Name())
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&flagServicePurge, "purge", false, "Also remove the service user and "+defaultServiceState)
+	cmd.Flags().StringVar(&flagServiceUser, "user", defaultServiceUser, "Service user to remove with --purge")
+	return cmd
+}
+
+func serviceActionCmd(use, short string, action func(serviceManager) error) *cobra.Command {
+	return &cobra.Command{
+		Use:          use,
+		Short:        short,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := resolveServiceManager()
+			if err != nil {
+				return err
+			}
+			return action(mgr)
+		},
+	}
+}
+
+// resolveServiceManager checks the platform and privileges and picks the init system.
+func resolveServiceManager() (serviceManager, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("service management is only supported on Linux")
+	}
+	if os.Geteuid() != 0 {
+		return nil, fmt.Errorf("service management requires root privileges (try sudo)")
+	}
+
+	switch flagServiceInit {
+	case "systemd":
+		return &systemdManager{}, nil
+	case "sysv":
+		return &sysvManager{}, nil
+	case "auto", "":
+		// sd_booted(3): systemd is running if this directory exists
+		if _, err := os.Stat("/run/systemd/system"); err == nil {
+			return &systemdManager{}, nil
+		}
+		return &sysvManager{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported init system %q: use auto, systemd or sysv", flagServiceInit)
+	}
+}
+
+// installService prepares the user, directories and env file, then registers the service.
+// The workspace of a config file is kept unless --workspace was given.
+func installService(mgr serviceManager, workspaceSet bool) error {
+	token := flagToken
+	if token == "" {
+		token = os.Getenv("FLASHDUTY_RUNNER_TOKEN")
+	}
+	if token == "" && flagConfig == "" {
+		return fmt.Errorf("token is required: use --token, set FLASHDUTY_RUNNER_TOKEN, or pass --config with a token")
+	}
+
+	binary := flagServiceBinary
+	if binary == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to resolve executable path: %w", err)
+		}
+		binary = exe
+	}
+	binary, err := filepath.Abs(binary)
+	if err != nil {
+		return fmt.Errorf("failed to resolve binary path: %w", err)
+	}
+
+	// The env file overrides the config file, so only set the workspace there
+	// when it was asked for or the config file does not set one
+	workspace, envWorkspace := flagServiceWorkspace, flagServiceWorkspace
+	if flagConfig != "" && !workspaceSet {
+		root, err := configWorkspaceRoot(flagConfig)
+		if err != nil {
+			return err
+		}
+		if root != "" {
+			workspace, envWorkspace = root, ""
+		}
+	}
+
+	opts := &serviceOptions{
+		User:      flagServiceUser,
+		Group:     flagServiceUser,
+		Binary:    binary,
+		StateDir:  defaultServiceState,
+		Workspace: workspace,
+		EnvFile:   serviceEnvFile,
+		PIDFile:   sysvPIDFile,
+		LogFile:   sysvLogFile,
+	}
+
+	uid, gid, err := ensureServiceUser(opts.User, opts.StateDir)
+	if err != nil {
+		return err
+	}
+
+	// State and workspace are private to the service user
+	for _, dir := range []string{opts.StateDir, opts.Workspace} {
+		if err := ensureOwnedDir(dir, 0o750, uid, gid); err != nil {
+			return err
+		}
+	}
+
+	// Config directory is owned by root but traversable by the service group
+	if err := ensureOwnedDir(serviceConfigDir, 0o750, 0, gid); err != nil {
+		return err
+	}
+
+	// The config file may not be readable by the service user where it is
+	if flagConfig != "" {
+		if err := installConfigFile(flagConfig, serviceConfigFile, uid, gid); err != nil {
+			return err
+		}
+		opts.ConfigPath = serviceConfigFile
+	}
+
+	url := flagURL
+	if url == "" {
+		url = os.Getenv("FLASHDUTY_RUNNER_URL")
+	}
+	if err := writeEnvFile(opts.EnvFile, serviceEnv(token, url, envWorkspace), uid, gid); err != nil {
+		return err
+	}
+
+	if err := mgr.Install(opts); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s service installed (%s)\n", serviceName, mgr.Name())
+	fmt.Printf("  user:      %s\n", opts.User)
+	fmt.Printf("  workspace: %s\n", opts.Workspace)
+	fmt.Printf("  env file:  %s\n", opts.EnvFile)
+	if opts.ConfigPath != "" {
+		fmt.Printf("  config:    %s (copied from %s, reinstall to apply changes)\n", opts.ConfigPath, flagConfig)
+	}
+	fmt.Printf("Start it with: sudo %s service start\n", serviceName)
+	return nil
+}
+
+// configWorkspaceRoot returns the workspace_root a config file sets, or "".
+func configWorkspaceRoot(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read config file: %w", err)
+	}
+	var cfg struct {
+		WorkspaceRoot string `yaml:"workspace_root"`
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return "", fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if cfg.WorkspaceRoot != "" && !filepath.IsAbs(cfg.WorkspaceRoot) {
+		return "", fmt.Errorf("workspace_root in %s must be an absolute path for the service", path)
+	}
+	return cfg.WorkspaceRoot, nil
+}
+
+// installConfigFile copies a config file to dst, readable only by the service
+// user as it may hold the token. The service group may be shared, e.g.
+// nogroup where BusyBox adduser creates the user.
+func installConfigFile(src, dst string, uid, gid int) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := os.WriteFile(dst, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	// WriteFile keeps the mode of an existing file, so enforce it explicitly
+	if err := os.Chmod(dst, 0o600); err != nil {
+		return fmt.Errorf("failed to set permissions on config file: %w", err)
+	}
+	if err := os.Chown(dst, uid, gid); err != nil {
+		return fmt.Errorf("failed to set owner on config file: %w", err)
+	}
+	return nil
+}
+
+// serviceEnv returns the variables of the env file. Empty values are left out.
+func serviceEnv(token, url, workspace string) map[string]string {
+	env := make(map[string]string)
+	for k, v := range map[string]string{
+		"FLASHDUTY_RUNNER_TOKEN":     token,
+		"FLASHDUTY_RUNNER_URL":       url,
+		"FLASHDUTY_RUNNER_WORKSPACE": workspace,
+	} {
+		if v != "" {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// ensureServiceUser creates a system user without login shell if it does not exist.
+func ensureServiceUser(name, home string) (uid, gid int, err error) {
+	if _, lookupErr := user.Lookup(name); lookupErr != nil {
+		nologin := "/usr/sbin/nologin"
+		if _, statErr := os.Stat(nologin); statErr != nil {
+			nologin = "/sbin/nologin"
+		}
+
+		if _, pathErr := exec.LookPath("useradd"); pathErr == nil {
+			err = runCommand("useradd", "--system", "--user-group", "--no-create-home",
+				"--home-dir", home, "--shell", nologin, name)
+		} else {
+			// BusyBox (e.g., Alpine) provides adduser instead
+			err = runCommand("adduser", "-S", "-D", "-H", "-h", home, "-s", nologin, name)
+			if err == nil {
+				err = runCommand("addgroup", "-S", name)
+				if err == nil {
+					err = runCommand("addgroup", name, name)
+				}
+			}
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to create user %s: %w", name, err)
+		}
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to look up user %s: %w", name, err)
+	}
+	if uid, err = strconv.Atoi(u.Uid); err != nil {
+		return 0, 0, fmt.Errorf("invalid uid for %s: %w", name, err)
+	}
+	if gid, err = strconv.Atoi(u.Gid); err != nil {
+		return 0, 0, fmt.Errorf("invalid gid for %s: %w", name, err)
+	}
+	return uid, gid, nil
+}
+
+// ensureOwnedDir creates a directory and sets its mode and ownership.
+func ensureOwnedDir(dir string, mode os.FileMode, uid, gid int) error {
+	if err := os.MkdirAll(dir, mode); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	if err := os.Chmod(dir, mode); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", dir, err)
+	}
+	if err := os.Chown(dir, uid, gid); err != nil {
+		return fmt.Errorf("failed to set owner on %s: %w", dir, err)
+	}
+	return nil
+}
+
+// writeEnvFile writes KEY=value lines readable only by the service user.
+func writeEnvFile(path string, env map[string]string, uid, gid int) error {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var buf bytes.Buffer
+	buf.WriteString("# Managed by flashduty-runner service install\n")
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s=%s\n", k, shellQuote(env[k]))
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("failed to write env file: %w", err)
+	}
+	// WriteFile keeps the mode of an existing file, so enforce it explicitly
+	if err := os.Chmod(path, 0o600); err != nil {
+		return fmt.Errorf("failed to set permissions on env file: %w", err)
+	}
+	if err := os.Chown(path, uid, gid); err != nil {
+		return fmt.Errorf("failed to set owner on env file: %w", err)
+	}
+	return nil
+}
+
+// shellQuote single-quotes a value so it is read literally by both systemd and sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// systemdQuote double-quotes a value for a systemd command line, escaping
+// specifiers and variable references.
+func systemdQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(s)
+	return `"` + s + `"`
+}
+
+// Command returns the command line the service runs.
+func (o *serviceOptions) Command() []string {
+	args := []string{o.Binary, "run"}
+	if o.ConfigPath != "" {
+		args = append(args, "--config", o.ConfigPath)
+	}
+	return args
+}
+
+// templateFuncs quote values in service files.
+var templateFuncs = template.FuncMap{
+	"shellQuote": shellQuote,
+	"shellJoin": func(args []string) string {
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			quoted[i] = shellQuote(arg)
+		}
+		return strings.Join(quoted, " ")
+	},
+	"systemdJoin": func(args []string) string {
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			quoted[i] = systemdQuote(arg)
+		}
+		return strings.Join(quoted, " ")
+	},
+}
+
+// runCommand runs a command, returning its combined output in the error on failure.
+func runCommand(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// runInteractive runs a command attached to the current terminal.
+func runInteractive(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// renderTemplate renders a service file template and writes it with the given mode.
+func renderTemplate(path, tmpl string, mode os.FileMode, opts *serviceOptions) error {
+	data, err := render(tmpl, opts)
+	if err != nil {
+		return fmt.Errorf("failed to render %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, data, mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return os.Chmod(path, mode)
+}
+
+// render renders a service file template.
+func render(tmpl string, opts *serviceOptions) ([]byte, error) {
+	t, err := template.New("service").Funcs(templateFuncs).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// systemdUnitTemplate is the systemd unit for the runner.
+const systemdUnitTemplate = `[Unit]
+Description=Flashduty Runner
+Documentation=https://github.com/flashcatcloud/flashduty-runner
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+User={{.User}}
+Group={{.Group}}
+EnvironmentFile={{.EnvFile}}
+WorkingDirectory={{.StateDir}}
+ExecStart={{systemdJoin .Command}}
+Restart=always
+RestartSec=5
+NoNewPrivileges=true
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// systemdManager manages the runner as a systemd unit.
+type systemdManager struct{}
+
+func (m *systemdManager) Name() string { return "systemd" }
+
+func (m *systemdManager) Install(opts *serviceOptions) error {
+	if err := renderTemplate(systemdUnitPath, systemdUnitTemplate, 0o644, opts); err != nil {
+		return err
+	}
+	if err := runCommand("systemctl", "daemon-reload"); err != nil {
+		return err
+	}
+	return runCommand("systemctl", "enable", serviceName)
+}
+
+func (m *systemdManager) Uninstall() error {
+	// Stop and disable may fail if the unit is already gone; removal is what matters
+	_ = runCommand("systemctl", "disable", "--now", serviceName)
+	if err := os.Remove(systemdUnitPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove unit file: %w", err)
+	}
+	return runCommand("systemctl", "daemon-reload")
+}
+
+func (m *systemdManager) Start() error {
+	return runCommand("systemctl", "start", serviceName)
+}
+
+func (m *systemdManager) Stop() error {
+	return runCommand("systemctl", "stop", serviceName)
+}
+
+func (m *systemdManager) Status() error {
+	return runInteractive("systemctl", "status", "--no-pager", serviceName)
+}
+
+// sysvScriptTemplate is a generic POSIX init script for systems without systemd.
+// The env file is sourced as the service user, which is the only user allowed to read it.
+const sysvScriptTemplate = `#!/bin/sh
+### BEGIN INIT INFO
+# Provides:          flashduty-runner
+# Required-Start:    $network $remote_fs
+# Required-Stop:     $network $remote_fs
+# Default-Start:     2 3 4 5
+# Default-Stop:      0 1 6
+# Short-Description: Flashduty Runner
+### END INIT INFO
+
+PIDFILE="{{.PIDFile}}"
+LOGFILE="{{.LogFile}}"
+
+is_running() {
+	[ -f "$PIDFILE" ] && kill -0 "$(cat "$PIDFILE")" 2>/dev/null
+}
+
+start() {
+	if is_running; then
+		echo "flashduty-runner is already running"
+		return 0
+	fi
+	touch "$LOGFILE" && chown {{.User}}:{{.Group}} "$LOGFILE"
+	{{- $run := printf "cd %s && set -a && . %s && set +a && exec %s >>%s 2>&1" (shellQuote .StateDir) (shellQuote .EnvFile) (shellJoin .Command) (shellQuote .LogFile)}}
+	if command -v start-stop-daemon >/dev/null 2>&1; then
+		start-stop-daemon --start --quiet --background --make-pidfile --pidfile "$PIDFILE" \
+			--chuid {{.User}}:{{.Group}} --startas /bin/sh -- -c {{shellQuote $run}}
+	else
+		# The shell started by su records its own pid, which the runner keeps through exec
+		touch "$PIDFILE" && chown {{.User}}:{{.Group}} "$PIDFILE"
+		su -s /bin/sh {{.User}} -c {{shellQuote (printf "echo $$ >%s && %s" (shellQuote .PIDFile) $run)}} &
+	fi
+	echo "flashduty-runner started"
+}
+
+stop() {
+	if ! is_running; then
+		echo "flashduty-runner is not running"
+		rm -f "$PIDFILE"
+		return 0
+	fi
+	kill "$(cat "$PIDFILE")"
+	i=0
+	while is_running && [ $i -lt 35 ]; do
+		sleep 1
+		i=$((i + 1))
+	done
+	rm -f "$PIDFILE"
+	echo "flashduty-runner stopped"
+}
+
+status() {
+	if is_running; then
+		echo "flashduty-runner is running (pid $(cat "$PIDFILE"))"
+		return 0
+	fi
+	echo "flashduty-runner is not running"
+	return 3
+}
+
+case "$1" in
+	start) start ;;
+	stop) stop ;;
+	restart) stop; start ;;
+	status) status ;;
+	*) echo "Usage: $0 {start|stop|restart|status}"; exit 1 ;;
+esac
+`
+
+// sysvManager manages the runner with a generic init script.
+type sysvManager struct{}
+
+func (m *sysvManager) Name() string { return "sysv" }
+
+func (m *sysvManager) Install(opts *serviceOptions) error {
+	if err := renderTemplate(sysvScriptPath, sysvScriptTemplate, 0o755, opts); err != nil {
+		return err
+	}
+
+	// Register for boot if a known tool is available; otherwise the script can still be run manually
+	switch {
+	case commandExists("update-rc.d"):
+		return runCommand("update-rc.d", serviceName, "defaults")
+	case commandExists("chkconfig"):
+		return runCommand("chkconfig", "--add", serviceName)
+	case commandExists("rc-update"):
+		return runCommand("rc-update", "add", serviceName, "default")
+	}
+	fmt.Fprintf(os.Stderr, "warning: no boot registration tool found; %s will not start on boot\n", sysvScriptPath)
+	return nil
+}
+
+func (m *sysvManager) Uninstall() error {
+	_ = m.Stop()
+	switch {
+	case commandExists("update-rc.d"):
+		_ = runCommand("update-rc.d", "-f", serviceName, "remove")
+	case commandExists("chkconfig"):
+		_ = runCommand("chkconfig", "--del", serviceName)
+	case commandExists("rc-update"):
+		_ = runCommand("rc-update", "del", serviceName, "default")
+	}
+	if err := os.Remove(sysvScriptPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove init script: %w", err)
+	}
+	return nil
+}
+
+func (m *sysvManager) Start() error {
+	return m.run("start")
+}
+
+func (m *sysvManager) Stop() error {
+	return m.run("stop")
+}
+
+func (m *sysvManager) Status() error {
+	return m.run("status")
+}
+
+func (m *sysvManager) run(action string) error {
+	if _, err := os.Stat(sysvScriptPath); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("service is not installed: %s not found", sysvScriptPath)
+	}
+	return runInteractive(sysvScriptPath, action)
+}
+
+// commandExists reports whether a command is on PATH.
+func commandExists(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
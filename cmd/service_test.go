@@ -0,0 +1,269 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// skipOnWindows skips tests that need a POSIX shell and file ownership, which
+// the Linux service relies on.
+func skipOnWindows(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("service files target Linux")
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "''"},
+		{"wnt_abc", "'wnt_abc'"},
+		{"/opt/my runner/bin", "'/opt/my runner/bin'"},
+		{"it's", `'it'\''s'`},
+		{`$HOME "x" \n`, `'$HOME "x" \n'`},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, shellQuote(tt.in), tt.in)
+	}
+
+	// The shell reads the quoted value back verbatim
+	if runtime.GOOS != "windows" {
+		for _, tt := range tests {
+			out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(tt.in)).Output()
+			require.NoError(t, err)
+			assert.Equal(t, tt.in, string(out))
+		}
+	}
+}
+
+func TestSystemdQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"/usr/local/bin/flashduty-runner", `"/usr/local/bin/flashduty-runner"`},
+		{"/opt/my runner/bin", `"/opt/my runner/bin"`},
+		{`a"b\c`, `"a\"b\\c"`},
+		{"50%$USER", `"50%%$$USER"`},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, systemdQuote(tt.in), tt.in)
+	}
+}
+
+func TestServiceEnv(t *testing.T) {
+	tests := []struct {
+		name                  string
+		token, url, workspace string
+		want                  map[string]string
+	}{
+		{
+			name:  "token only",
+			token: "wnt_abc", workspace: "/var/lib/flashduty-runner/workspace",
+			want: map[string]string{
+				"FLASHDUTY_RUNNER_TOKEN":     "wnt_abc",
+				"FLASHDUTY_RUNNER_WORKSPACE": "/var/lib/flashduty-runner/workspace",
+			},
+		},
+		{
+			name: "workspace from the config file",
+			url:  "wss://example.com/ws",
+			want: map[string]string{"FLASHDUTY_RUNNER_URL": "wss://example.com/ws"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, serviceEnv(tt.token, tt.url, tt.workspace))
+		})
+	}
+}
+
+func TestWriteEnvFile(t *testing.T) {
+	skipOnWindows(t)
+	path := filepath.Join(t.TempDir(), "runner.env")
+	// An existing file keeps its mode on write, so it is reset explicitly
+	require.NoError(t, os.WriteFile(path, nil, 0o644))
+
+	env := map[string]string{
+		"FLASHDUTY_RUNNER_URL":   "wss://example.com/ws?a=1&b=2",
+		"FLASHDUTY_RUNNER_TOKEN": "wnt_it's",
+	}
+	require.NoError(t, writeEnvFile(path, env, os.Getuid(), os.Getgid()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `# Managed by flashduty-runner service install
+FLASHDUTY_RUNNER_TOKEN='wnt_it'\''s'
+FLASHDUTY_RUNNER_URL='wss://example.com/ws?a=1&b=2'
+`, string(data))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// Sourcing the file as the init script does yields the values
+	out, err := exec.Command("sh", "-c", `set -a && . "$0" && printf %s "$FLASHDUTY_RUNNER_TOKEN"`, path).Output()
+	require.NoError(t, err)
+	assert.Equal(t, "wnt_it's", string(out))
+}
+
+func TestInstallConfigFile(t *testing.T) {
+	skipOnWindows(t)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(src, []byte("token: wnt_abc\n"), 0o644))
+	// An existing file keeps its mode on write, so it is reset explicitly
+	dst := filepath.Join(dir, "installed.yaml")
+	require.NoError(t, os.WriteFile(dst, nil, 0o644))
+
+	require.NoError(t, installConfigFile(src, dst, os.Getuid(), os.Getgid()))
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "token: wnt_abc\n", string(data))
+	info, err := os.Stat(dst)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestConfigWorkspaceRoot(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{"set", "token: wnt_abc\nworkspace_root: /srv/runner\n", "/srv/runner", false},
+		{"unset", "token: wnt_abc\n", "", false},
+		{"relative", "workspace_root: runner\n", "", true},
+		{"invalid", "workspace_root: [\n", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+			got, err := configWorkspaceRoot(path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRenderServiceFiles(t *testing.T) {
+	opts := &serviceOptions{
+		User:       "flashduty-runner",
+		Group:      "flashduty-runner",
+		Binary:     "/opt/flash duty/runner's bin",
+		StateDir:   "/var/lib/flashduty-runner",
+		Workspace:  "/var/lib/flashduty-runner/workspace",
+		ConfigPath: serviceConfigFile,
+		EnvFile:    serviceEnvFile,
+		PIDFile:    sysvPIDFile,
+		LogFile:    sysvLogFile,
+	}
+
+	tests := []struct {
+		name     string
+		tmpl     string
+		opts     *serviceOptions
+		contains []string
+	}{
+		{
+			name: "systemd unit",
+			tmpl: systemdUnitTemplate,
+			opts: opts,
+			contains: []string{
+				"User=flashduty-runner\n",
+				"EnvironmentFile=/etc/flashduty-runner/runner.env\n",
+				`ExecStart="/opt/flash duty/runner's bin" "run" "--config" "/etc/flashduty-runner/config.yaml"` + "\n",
+			},
+		},
+		{
+			name:     "systemd unit without config",
+			tmpl:     systemdUnitTemplate,
+			opts:     &serviceOptions{User: "u", Group: "u", Binary: "/usr/bin/flashduty-runner"},
+			contains: []string{`ExecStart="/usr/bin/flashduty-runner" "run"` + "\n"},
+		},
+		{
+			name: "sysv script",
+			tmpl: sysvScriptTemplate,
+			opts: opts,
+			contains: []string{
+				`PIDFILE="/var/run/flashduty-runner.pid"`,
+				`start-stop-daemon --start --quiet --background --make-pidfile --pidfile "$PIDFILE" \` + "\n" +
+					`			--chuid flashduty-runner:flashduty-runner --startas /bin/sh -- -c 'cd '\''/var/lib/flashduty-runner'\'' && set -a && . '\''/etc/flashduty-runner/runner.env'\'' && set +a && exec '\''/opt/flash duty/runner'\''\'\'''\''s bin'\'' '\''run'\'' '\''--config'\'' '\''/etc/flashduty-runner/config.yaml'\'' >>'\''/var/log/flashduty-runner.log'\'' 2>&1'` + "\n",
+				`su -s /bin/sh flashduty-runner -c 'echo $$ >'\''/var/run/flashduty-runner.pid'\'' && cd '\''/var/lib/flashduty-runner'\'' && set -a && . '\''/etc/flashduty-runner/runner.env'\'' && set +a && exec '\''/opt/flash duty/runner'\''\'\'''\''s bin'\'' '\''run'\'' '\''--config'\'' '\''/etc/flashduty-runner/config.yaml'\'' >>'\''/var/log/flashduty-runner.log'\'' 2>&1' &` + "\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := render(tt.tmpl, tt.opts)
+			require.NoError(t, err)
+			for _, s := range tt.contains {
+				assert.Contains(t, string(data), s)
+			}
+		})
+	}
+}
+
+func TestSysvScriptRunsCommand(t *testing.T) {
+	skipOnWindows(t)
+	// The commands the script passes to start-stop-daemon and su exec the
+	// binary with its arguments intact, keeping the pid the script records
+	dir := filepath.Join(t.TempDir(), "it's here")
+	require.NoError(t, os.Mkdir(dir, 0o755))
+	binary := filepath.Join(dir, "fake runner")
+	require.NoError(t, os.WriteFile(binary, []byte("#!/bin/sh\nprintf '%s|' \"$$\" \"$PWD\" \"$RUNNER_VAR\" \"$@\"\n"), 0o755))
+	envFile := filepath.Join(dir, "runner.env")
+	require.NoError(t, os.WriteFile(envFile, []byte("RUNNER_VAR='x y'\n"), 0o600))
+
+	opts := &serviceOptions{
+		User: "nobody", Group: "nogroup", Binary: binary, StateDir: dir, EnvFile: envFile,
+		ConfigPath: filepath.Join(dir, "config.yaml"),
+		PIDFile:    filepath.Join(dir, "runner.pid"),
+		LogFile:    filepath.Join(dir, "runner.log"),
+	}
+	data, err := render(sysvScriptTemplate, opts)
+	require.NoError(t, err)
+	var daemonCommand, suCommand string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if rest, ok := strings.CutPrefix(line, "--chuid nobody:nogroup --startas /bin/sh -- -c "); ok {
+			daemonCommand = rest
+		}
+		if rest, ok := strings.CutPrefix(line, "su -s /bin/sh nobody -c "); ok {
+			suCommand, _ = strings.CutSuffix(rest, " &")
+		}
+	}
+	require.NotEmpty(t, daemonCommand)
+	require.NotEmpty(t, suCommand)
+
+	want := "|" + dir + "|x y|run|--config|" + opts.ConfigPath + "|"
+	require.NoError(t, exec.Command("sh", "-c", "sh -c "+daemonCommand).Run())
+	log, err := os.ReadFile(opts.LogFile)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(log), want), string(log))
+
+	require.NoError(t, os.Remove(opts.LogFile))
+	require.NoError(t, exec.Command("sh", "-c", "sh -c "+suCommand).Run())
+	log, err = os.ReadFile(opts.LogFile)
+	require.NoError(t, err)
+	pid, err := os.ReadFile(opts.PIDFile)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(string(pid))+want, string(log))
+}
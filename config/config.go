@@ -0,0 +1,592 @@
+// Package config loads and validates runner configuration.
+//
+// Settings are resolved with the precedence flag > environment > file > default.
+// This package handles the file, environment and default layers; command-line
+// flags are applied on top by the caller.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Default values
+const (
+	DefaultURL                = "wss://api.flashcat.cloud/safari/worknode/ws"
+	DefaultLogLevel           = "info"
+	DefaultEnvRefreshInterval = 10 * time.Minute
+	DefaultOutputsTTL         = 24 * time.Hour
+	DefaultOutputsMaxSize     = ByteSize(1 << 30)
+	DefaultCleanupInterval    = 10 * time.Minute
+	DefaultSessionIdleTTL     = 24 * time.Hour
+
+	// EnvPrefix is the prefix for all environment variables
+	EnvPrefix = "FLASHDUTY_RUNNER_"
+)
+
+// Config holds the runtime configuration.
+type Config struct {
+	// Authentication token from Flashduty console (required)
+	Token string `yaml:"token"`
+	// WebSocket endpoint URL
+	URL string `yaml:"url"`
+	// Workspace root directory
+	WorkspaceRoot string `yaml:"workspace_root"`
+	// How often environment info is re-sent on a live connection, 0 disables
+	EnvRefreshInterval time.Duration `yaml:"env_refresh_interval"`
+	// Labels for task routing, merged with cloud-managed and auto-detected labels
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// Free-form capability tags for task routing
+	Capabilities []string `yaml:"capabilities,omitempty"`
+	// Read-only directories outside the workspace, addressed as "name:path"
+	Mounts map[string]string `yaml:"mounts,omitempty"`
+
+	Log        LogConfig        `yaml:"log"`
+	Permission PermissionConfig `yaml:"permission"`
+	Quota      QuotaConfig      `yaml:"quota"`
+	Sessions   SessionsConfig   `yaml:"sessions"`
+	Redaction  RedactionConfig  `yaml:"redaction"`
+	Kubernetes KubernetesConfig `yaml:"kubernetes,omitempty"`
+	// Connection profiles for db_query, by name
+	Databases map[string]DatabaseConfig `yaml:"databases,omitempty"`
+}
+
+// LogConfig holds logging settings.
+type LogConfig struct {
+	// Log level: debug, info, warn, error
+	Level string `yaml:"level"`
+}
+
+// QuotaConfig limits the disk space used by the workspace.
+type QuotaConfig struct {
+	// Disk space the workspace may use, 0 for no limit; writes beyond it are refused
+	MaxSize ByteSize `yaml:"max_size"`
+	// Saved large outputs older than this are deleted, 0 keeps them
+	OutputsTTL time.Duration `yaml:"outputs_ttl"`
+	// Oldest saved outputs are deleted beyond this total, 0 for no limit
+	OutputsMaxSize ByteSize `yaml:"outputs_max_size"`
+	// How often saved outputs are cleaned up and disk usage is rescanned
+	CleanupInterval time.Duration `yaml:"cleanup_interval"`
+}
+
+// SessionsConfig holds settings for per-session workspaces.
+type SessionsConfig struct {
+	// What tasks are grouped into sessions by: source_instance or trace, empty disables sessions
+	Key string `yaml:"key"`
+	// Top-level workspace directories sessions can read but not modify
+	Shared []string `yaml:"shared"`
+	// Sessions unused for this long are deleted, 0 keeps them
+	IdleTTL time.Duration `yaml:"idle_ttl"`
+}
+
+// RedactionConfig controls masking of secrets in results sent to Flashduty.
+type RedactionConfig struct {
+	// Mask tokens, private keys, cloud credentials and passwords in results
+	Enabled bool `yaml:"enabled"`
+	// Extra regular expressions to mask; with capture groups only the groups are masked
+	Patterns []string `yaml:"patterns,omitempty"`
+}
+
+// KubernetesConfig selects the cluster the k8s_* operations read.
+type KubernetesConfig struct {
+	// Kubeconfig file; default: the pod's service account in a cluster, then $KUBECONFIG, then ~/.kube/config
+	Kubeconfig string `yaml:"kubeconfig,omitempty"`
+	// Kubeconfig context; default: the current context
+	Context string `yaml:"context,omitempty"`
+}
+
+// DatabaseConfig is a connection profile db_query tasks refer to by name.
+// Credentials stay here and are never sent by the cloud.
+type DatabaseConfig struct {
+	// Driver: postgres or mysql (also for MariaDB)
+	Driver string `yaml:"driver"`
+	// Connection string, e.g. postgres://reader:${PGPASSWORD}@db:5432/app or
+	// reader:${MYSQL_PASSWORD}@tcp(db:3306)/app; ${VAR} is read from the environment
+	DSN string `yaml:"dsn"`
+	// Statement timeout; default 30s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Rows a query returns at most; default 1000
+	MaxRows int `yaml:"max_rows,omitempty"`
+}
+
+// KubernetesPermission limits what the k8s_* operations may read.
+type KubernetesPermission struct {
+	// Glob patterns of resources, e.g. pods, deployments.apps, pods/log or "*"; empty disables the operations
+	Resources []string `yaml:"resources,omitempty"`
+	// Glob patterns of namespaces; empty allows all
+	Namespaces []string `yaml:"namespaces,omitempty"`
+}
+
+// PermissionConfig holds permission rules.
+type PermissionConfig struct {
+	// Glob pattern to action ("allow" or "deny") for bash commands
+	Bash map[string]string `yaml:"bash"`
+	// Native diagnostics to enable: processes, sockets, disks, memory,
+	// kernel_log, systemd, or "*" for all (default: none). systemd runs
+	// systemctl without checking the bash rules.
+	Diagnostics []string `yaml:"diagnostics,omitempty"`
+	// Resources and namespaces the k8s_* operations may read
+	Kubernetes KubernetesPermission `yaml:"kubernetes,omitempty"`
+}
+
+// Default returns the configuration with default values applied.
+func Default() *Config {
+	cfg := &Config{
+		URL:                DefaultURL,
+		EnvRefreshInterval: DefaultEnvRefreshInterval,
+		Log:                LogConfig{Level: DefaultLogLevel},
+		Permission:         PermissionConfig{Bash: map[string]string{"*": "deny"}},
+		Quota: QuotaConfig{
+			OutputsTTL:      DefaultOutputsTTL,
+			OutputsMaxSize:  DefaultOutputsMaxSize,
+			CleanupInterval: DefaultCleanupInterval,
+		},
+		Sessions: SessionsConfig{
+			Shared:  []string{"skills"},
+			IdleTTL: DefaultSessionIdleTTL,
+		},
+		Redaction: RedactionConfig{Enabled: true},
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		cfg.WorkspaceRoot = filepath.Join(homeDir, ".flashduty-runner", "workspace")
+	}
+	return cfg
+}
+
+// DefaultPath returns the default configuration file path.
+func DefaultPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".flashduty-runner", "config.yaml")
+}
+
+// ResolvePath returns the configuration file to load.
+// An explicit path wins, then FLASHDUTY_RUNNER_CONFIG, then the default path
+// if it exists. Returns "" when no file should be loaded.
+func ResolvePath(explicit string) string {
+	if explicit != "" {
+		return explicit
+	}
+	if p := os.Getenv(EnvPrefix + "CONFIG"); p != "" {
+		return p
+	}
+	if p := DefaultPath(); p != "" {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+// Load builds a configuration from defaults, the given file (if non-empty)
+// and environment variables.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// loadFile merges a YAML configuration file into cfg. Unknown keys are rejected
+// so typos do not silently fall back to defaults.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overrides settings from FLASHDUTY_RUNNER_* environment variables.
+func (c *Config) applyEnv() error {
+	setString := func(name string, dst *string) {
+		if v := os.Getenv(EnvPrefix + name); v != "" {
+			*dst = v
+		}
+	}
+
+	setString("TOKEN", &c.Token)
+	setString("URL", &c.URL)
+	setString("WORKSPACE", &c.WorkspaceRoot)
+	setString("LOG_LEVEL", &c.Log.Level)
+	setString("SESSION_KEY", &c.Sessions.Key)
+	setString("KUBECONFIG", &c.Kubernetes.Kubeconfig)
+	setString("KUBE_CONTEXT", &c.Kubernetes.Context)
+
+	if v := os.Getenv(EnvPrefix + "ENV_REFRESH_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %sENV_REFRESH_INTERVAL: %w", EnvPrefix, err)
+		}
+		c.EnvRefreshInterval = d
+	}
+
+	if v := os.Getenv(EnvPrefix + "REDACTION"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %sREDACTION: %w", EnvPrefix, err)
+		}
+		c.Redaction.Enabled = enabled
+	}
+
+	if v := os.Getenv(EnvPrefix + "QUOTA_MAX_SIZE"); v != "" {
+		size, err := ParseByteSize(v)
+		if err != nil {
+			return fmt.Errorf("invalid %sQUOTA_MAX_SIZE: %w", EnvPrefix, err)
+		}
+		c.Quota.MaxSize = size
+	}
+
+	if v := os.Getenv(EnvPrefix + "OUTPUTS_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %sOUTPUTS_TTL: %w", EnvPrefix, err)
+		}
+		c.Quota.OutputsTTL = d
+	}
+
+	if v := os.Getenv(EnvPrefix + "OUTPUTS_MAX_SIZE"); v != "" {
+		size, err := ParseByteSize(v)
+		if err != nil {
+			return fmt.Errorf("invalid %sOUTPUTS_MAX_SIZE: %w", EnvPrefix, err)
+		}
+		c.Quota.OutputsMaxSize = size
+	}
+
+	if v := os.Getenv(EnvPrefix + "LABELS"); v != "" {
+		labels, err := ParseLabels(SplitList(v))
+		if err != nil {
+			return fmt.Errorf("invalid %sLABELS: %w", EnvPrefix, err)
+		}
+		c.MergeLabels(labels)
+	}
+
+	if v := os.Getenv(EnvPrefix + "CAPABILITIES"); v != "" {
+		c.MergeCapabilities(SplitList(v))
+	}
+
+	if v := os.Getenv(EnvPrefix + "DIAGNOSTICS"); v != "" {
+		c.Permission.Diagnostics = SplitList(v)
+	}
+
+	if v := os.Getenv(EnvPrefix + "MOUNTS"); v != "" {
+		mounts, err := ParseMounts(SplitList(v))
+		if err != nil {
+			return fmt.Errorf("invalid %sMOUNTS: %w", EnvPrefix, err)
+		}
+		c.MergeMounts(mounts)
+	}
+
+	return nil
+}
+
+// MergeLabels overrides labels with the same key and adds new ones.
+func (c *Config) MergeLabels(labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	if c.Labels == nil {
+		c.Labels = make(map[string]string, len(labels))
+	}
+	for k, v := range labels {
+		c.Labels[k] = v
+	}
+}
+
+// MergeCapabilities adds capabilities not already declared.
+func (c *Config) MergeCapabilities(capabilities []string) {
+	for _, capability := range capabilities {
+		if capability != "" && !slices.Contains(c.Capabilities, capability) {
+			c.Capabilities = append(c.Capabilities, capability)
+		}
+	}
+}
+
+// MergeMounts overrides mounts with the same name and adds new ones.
+func (c *Config) MergeMounts(mounts map[string]string) {
+	if len(mounts) == 0 {
+		return
+	}
+	if c.Mounts == nil {
+		c.Mounts = make(map[string]string, len(mounts))
+	}
+	for k, v := range mounts {
+		c.Mounts[k] = v
+	}
+}
+
+// Validate checks the configuration for errors. All problems are reported together.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Token == "" {
+		errs = append(errs, fmt.Errorf("token is required: use --token flag, set %sTOKEN or token in config file", EnvPrefix))
+	}
+
+	if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("url must be a ws:// or wss:// URL: %q", c.URL))
+	}
+
+	if c.WorkspaceRoot == "" {
+		errs = append(errs, fmt.Errorf("workspace_root is required"))
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level must be one of debug, info, warn, error: %q", c.Log.Level))
+	}
+
+	if c.EnvRefreshInterval < 0 {
+		errs = append(errs, fmt.Errorf("env_refresh_interval must not be negative"))
+	}
+
+	if c.Quota.MaxSize < 0 {
+		errs = append(errs, fmt.Errorf("quota.max_size must not be negative"))
+	}
+	if c.Quota.OutputsTTL < 0 {
+		errs = append(errs, fmt.Errorf("quota.outputs_ttl must not be negative"))
+	}
+	if c.Quota.OutputsMaxSize < 0 {
+		errs = append(errs, fmt.Errorf("quota.outputs_max_size must not be negative"))
+	}
+	if c.Quota.CleanupInterval < 0 {
+		errs = append(errs, fmt.Errorf("quota.cleanup_interval must not be negative"))
+	}
+
+	switch c.Sessions.Key {
+	case "", "source_instance", "trace":
+	default:
+		errs = append(errs, fmt.Errorf("sessions.key must be source_instance or trace: %q", c.Sessions.Key))
+	}
+	for _, name := range c.Sessions.Shared {
+		if name == "" || name == "." || name == ".." || name == ".work" || strings.ContainsAny(name, `/\`) {
+			errs = append(errs, fmt.Errorf("sessions.shared must be top-level directory names: %q", name))
+		}
+	}
+	if c.Sessions.IdleTTL < 0 {
+		errs = append(errs, fmt.Errorf("sessions.idle_ttl must not be negative"))
+	}
+
+	for _, pattern := range c.Redaction.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("redaction.patterns: invalid pattern %q: %w", pattern, err))
+		}
+	}
+
+	for key := range c.Labels {
+		if !labelKeyPattern.MatchString(key) {
+			errs = append(errs, fmt.Errorf("invalid label key %q", key))
+		}
+	}
+
+	for name, dir := range c.Mounts {
+		if !mountNamePattern.MatchString(name) {
+			errs = append(errs, fmt.Errorf("invalid mount name %q: use at least two letters, digits, '-' or '_'", name))
+		}
+		if !filepath.IsAbs(dir) {
+			errs = append(errs, fmt.Errorf("mounts[%q] must be an absolute path: %q", name, dir))
+		}
+	}
+
+	for pattern, action := range c.Permission.Bash {
+		switch strings.ToLower(action) {
+		case "allow", "deny":
+		default:
+			errs = append(errs, fmt.Errorf("permission.bash[%q] must be allow or deny: %q", pattern, action))
+		}
+	}
+
+	for _, name := range c.Permission.Diagnostics {
+		switch name {
+		case "*", "processes", "sockets", "disks", "memory", "kernel_log", "systemd":
+		default:
+			errs = append(errs, fmt.Errorf("permission.diagnostics: unknown diagnostic %q", name))
+		}
+	}
+
+	for field, patterns := range map[string][]string{
+		"permission.kubernetes.resources":  c.Permission.Kubernetes.Resources,
+		"permission.kubernetes.namespaces": c.Permission.Kubernetes.Namespaces,
+	} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid pattern %q: %w", field, pattern, err))
+			}
+		}
+	}
+
+	for name, db := range c.Databases {
+		if !databaseNamePattern.MatchString(name) {
+			errs = append(errs, fmt.Errorf("invalid database name %q: use letters, digits, '-' or '_'", name))
+		}
+		switch db.Driver {
+		case "postgres", "mysql":
+		default:
+			errs = append(errs, fmt.Errorf("databases[%q].driver must be postgres or mysql: %q", name, db.Driver))
+		}
+		if db.DSN == "" {
+			errs = append(errs, fmt.Errorf("databases[%q].dsn is required", name))
+		}
+		if db.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("databases[%q].timeout must not be negative", name))
+		}
+		if db.MaxRows < 0 {
+			errs = append(errs, fmt.Errorf("databases[%q].max_rows must not be negative", name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy of the configuration with secrets masked, safe for printing.
+func (c *Config) Redacted() *Config {
+	cp := *c
+	cp.Token = redactSecret(c.Token)
+	if c.Databases != nil {
+		cp.Databases = make(map[string]DatabaseConfig, len(c.Databases))
+		for name, db := range c.Databases {
+			db.DSN = redactDSN(db.DSN)
+			cp.Databases[name] = db
+		}
+	}
+	return &cp
+}
+
+// YAML renders the configuration as YAML.
+func (c *Config) YAML() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// redactSecret keeps a short prefix of a secret for identification.
+func redactSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	if len(s) <= 8 {
+		return "****"
+	}
+	return s[:4] + "****"
+}
+
+// DSN password patterns: scheme://user:password@ in URLs, user:password@
+// in MySQL DSNs, where the password may contain @, and password=... in
+// PostgreSQL key/value strings and URL parameters.
+var (
+	dsnURLPasswordPattern   = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.-]*://[^:/@]*):[^@/]*@`)
+	dsnMySQLPasswordPattern = regexp.MustCompile(`^([^:/@]*):.*@`)
+	dsnPasswordPattern      = regexp.MustCompile(`(password=)[^&\s]*`)
+)
+
+// redactDSN masks the password in a database connection string.
+func redactDSN(dsn string) string {
+	if strings.Contains(dsn, "://") {
+		dsn = dsnURLPasswordPattern.ReplaceAllString(dsn, "$1:****@")
+	} else {
+		dsn = dsnMySQLPasswordPattern.ReplaceAllString(dsn, "$1:****@")
+	}
+	return dsnPasswordPattern.ReplaceAllString(dsn, "${1}****")
+}
+
+// labelKeyPattern restricts label keys to characters safe for routing expressions.
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+
+// mountNamePattern restricts mount names; two characters minimum so a name is
+// never mistaken for a Windows drive letter. Kept in sync with workspace.ValidMountName.
+var mountNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]+$`)
+
+// databaseNamePattern restricts database profile names.
+var databaseNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// ParseMounts parses "name=path" strings into a mount map.
+func ParseMounts(items []string) (map[string]string, error) {
+	mounts := make(map[string]string, len(items))
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, dir, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid mount %q: expected name=path", item)
+		}
+		name, dir = strings.TrimSpace(name), strings.TrimSpace(dir)
+		if !mountNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid mount name %q", name)
+		}
+		mounts[name] = dir
+	}
+	return mounts, nil
+}
+
+// ParseLabels parses "key=value" strings into a label map.
+// A bare "key" is treated as "key=true".
+func ParseLabels(items []string) (map[string]string, error) {
+	labels := make(map[string]string, len(items))
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if !ok {
+			value = "true"
+		}
+		if !labelKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid label key %q", key)
+		}
+		labels[key] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
+
+// SplitList splits a comma-separated list, dropping empty items.
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
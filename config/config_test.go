@@ -0,0 +1,206 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+
+	assert.Equal(t, DefaultURL, cfg.URL)
+	assert.Equal(t, DefaultLogLevel, cfg.Log.Level)
+	assert.Equal(t, DefaultEnvRefreshInterval, cfg.EnvRefreshInterval)
+	assert.Equal(t, map[string]string{"*": "deny"}, cfg.Permission.Bash)
+	assert.Empty(t, cfg.Permission.Diagnostics)
+	assert.Equal(t, QuotaConfig{OutputsTTL: DefaultOutputsTTL, OutputsMaxSize: DefaultOutputsMaxSize, CleanupInterval: DefaultCleanupInterval}, cfg.Quota)
+	assert.Equal(t, SessionsConfig{Shared: []string{"skills"}, IdleTTL: DefaultSessionIdleTTL}, cfg.Sessions)
+	assert.Equal(t, RedactionConfig{Enabled: true}, cfg.Redaction)
+	assert.NotEmpty(t, cfg.WorkspaceRoot)
+}
+
+func TestLoad_FileAndEnvPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+token: wnt_from_file
+url: wss://file.example.com/ws
+workspace_root: /srv/runner
+env_refresh_interval: 5m
+labels:
+  env: staging
+  team: sre
+capabilities: [mysql]
+log:
+  level: debug
+permission:
+  bash:
+    "cat *": allow
+  diagnostics: [processes, memory]
+  kubernetes:
+    resources: [pods, pods/log, events, deployments.apps]
+    namespaces: [default, "prod-*"]
+kubernetes:
+  kubeconfig: /etc/runner/kubeconfig
+  context: prod
+databases:
+  orders:
+    driver: postgres
+    dsn: postgres://reader:${PGPASSWORD}@db:5432/orders
+    timeout: 10s
+    max_rows: 500
+quota:
+  max_size: 10GB
+  outputs_max_size: 512MiB
+sessions:
+  key: trace
+  shared: [skills, runbooks]
+redaction:
+  patterns: ['ACME-[0-9]{6}']
+`)
+
+	t.Setenv("FLASHDUTY_RUNNER_URL", "wss://env.example.com/ws")
+	t.Setenv("FLASHDUTY_RUNNER_LABELS", "env=prod")
+	t.Setenv("FLASHDUTY_RUNNER_CAPABILITIES", "redis,mysql")
+	t.Setenv("FLASHDUTY_RUNNER_OUTPUTS_TTL", "1h")
+	t.Setenv("FLASHDUTY_RUNNER_SESSION_KEY", "source_instance")
+	t.Setenv("FLASHDUTY_RUNNER_REDACTION", "false")
+	t.Setenv("FLASHDUTY_RUNNER_DIAGNOSTICS", "disks, kernel_log")
+	t.Setenv("FLASHDUTY_RUNNER_KUBE_CONTEXT", "staging")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, "wnt_from_file", cfg.Token)
+	assert.Equal(t, "wss://env.example.com/ws", cfg.URL) // env overrides file
+	assert.Equal(t, "/srv/runner", cfg.WorkspaceRoot)
+	assert.Equal(t, 5*time.Minute, cfg.EnvRefreshInterval)
+	assert.Equal(t, map[string]string{"env": "prod", "team": "sre"}, cfg.Labels)
+	assert.Equal(t, []string{"mysql", "redis"}, cfg.Capabilities) // env adds to file
+	assert.Equal(t, "debug", cfg.Log.Level)
+	assert.Equal(t, map[string]string{"*": "deny", "cat *": "allow"}, cfg.Permission.Bash)
+	assert.Equal(t, []string{"disks", "kernel_log"}, cfg.Permission.Diagnostics)
+	assert.Equal(t, KubernetesPermission{Resources: []string{"pods", "pods/log", "events", "deployments.apps"}, Namespaces: []string{"default", "prod-*"}}, cfg.Permission.Kubernetes)
+	assert.Equal(t, KubernetesConfig{Kubeconfig: "/etc/runner/kubeconfig", Context: "staging"}, cfg.Kubernetes)
+	assert.Equal(t, map[string]DatabaseConfig{"orders": {Driver: "postgres", DSN: "postgres://reader:${PGPASSWORD}@db:5432/orders", Timeout: 10 * time.Second, MaxRows: 500}}, cfg.Databases)
+	assert.Equal(t, ByteSize(10_000_000_000), cfg.Quota.MaxSize)
+	assert.Equal(t, ByteSize(512<<20), cfg.Quota.OutputsMaxSize)
+	assert.Equal(t, time.Hour, cfg.Quota.OutputsTTL)
+	assert.Equal(t, SessionsConfig{Key: "source_instance", Shared: []string{"skills", "runbooks"}, IdleTTL: DefaultSessionIdleTTL}, cfg.Sessions)
+	assert.Equal(t, RedactionConfig{Enabled: false, Patterns: []string{"ACME-[0-9]{6}"}}, cfg.Redaction)
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestLoad_UnknownField(t *testing.T) {
+	path := writeConfigFile(t, "tokn: typo\n")
+	_, err := Load(path)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "tokn")
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.URL = "http://example.com"
+	cfg.Log.Level = "verbose"
+	cfg.Labels = map[string]string{"bad key": "x"}
+	cfg.Mounts = map[string]string{"c": "/var/log", "logs": "var/log"}
+	cfg.Permission.Bash["ls *"] = "maybe"
+	cfg.Permission.Diagnostics = []string{"netstat"}
+	cfg.Permission.Kubernetes.Namespaces = []string{"prod-["}
+	cfg.Databases = map[string]DatabaseConfig{"orders db": {Driver: "oracle", MaxRows: -1}}
+	cfg.Quota.MaxSize = -1
+	cfg.Sessions.Key = "user"
+	cfg.Sessions.Shared = []string{"../skills"}
+	cfg.Redaction.Patterns = []string{"("}
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	for _, want := range []string{"token is required", "url must be", "log.level", "invalid label key", "invalid mount name", "must be an absolute path", "permission.bash", "permission.diagnostics", "permission.kubernetes.namespaces", "invalid database name", ".driver", ".dsn", ".max_rows", "quota.max_size", "sessions.key", "sessions.shared", "redaction.patterns"} {
+		assert.Contains(t, err.Error(), want)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Token = "wnt_secret_token_value"
+
+	out, err := cfg.Redacted().YAML()
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "secret_token_value")
+	assert.Contains(t, string(out), "wnt_****")
+	assert.Equal(t, "wnt_secret_token_value", cfg.Token) // original untouched
+}
+
+func TestRedactDSN(t *testing.T) {
+	tests := map[string]string{
+		"postgres://reader:s3cret@db:5432/app?sslmode=require": "postgres://reader:****@db:5432/app?sslmode=require",
+		"postgres://reader:${PGPASSWORD}@db/app":               "postgres://reader:****@db/app",
+		"postgres://reader@db/app?password=s3cret&x=1":         "postgres://reader@db/app?password=****&x=1",
+		"host=db user=reader password=s3cret dbname=app":       "host=db user=reader password=**** dbname=app",
+		"reader:s3c@ret@tcp(db:3306)/app":                      "reader:****@tcp(db:3306)/app",
+		"reader@tcp(db:3306)/app":                              "reader@tcp(db:3306)/app",
+		"reader:${MYSQL_PASSWORD}@unix(/run/mysqld.sock)/app":  "reader:****@unix(/run/mysqld.sock)/app",
+	}
+	for dsn, want := range tests {
+		assert.Equal(t, want, redactDSN(dsn), dsn)
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels([]string{"env=prod", " team = sre ", "gpu", ""})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod", "team": "sre", "gpu": "true"}, labels)
+
+	_, err = ParseLabels([]string{"bad key=x"})
+	assert.Error(t, err)
+
+	_, err = ParseLabels([]string{"=value"})
+	assert.Error(t, err)
+}
+
+func TestParseMounts(t *testing.T) {
+	mounts, err := ParseMounts([]string{"logs=/var/log", " nginx = /etc/nginx ", ""})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"logs": "/var/log", "nginx": "/etc/nginx"}, mounts)
+
+	_, err = ParseMounts([]string{"logs"})
+	assert.Error(t, err)
+
+	_, err = ParseMounts([]string{"c=/data"})
+	assert.Error(t, err)
+}
+
+func TestParseByteSize(t *testing.T) {
+	for in, want := range map[string]ByteSize{
+		"0":       0,
+		"1024":    1024,
+		"500MB":   500_000_000,
+		"1.5 GB":  1_500_000_000,
+		"2GiB":    2 << 30,
+		"64k":     64 << 10,
+		" 10tb ":  10_000_000_000_000,
+		"100 mib": 100 << 20,
+	} {
+		got, err := ParseByteSize(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	for _, in := range []string{"", "GB", "-1", "10XB", "1.2.3MB"} {
+		_, err := ParseByteSize(in)
+		assert.Error(t, err, in)
+	}
+
+	assert.Equal(t, "1GiB", ByteSize(1<<30).String())
+	assert.Equal(t, "1500", ByteSize(1500).String())
+}
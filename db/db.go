@@ -0,0 +1,265 @@
+// Package db runs read-only SQL queries against MySQL and PostgreSQL.
+//
+// Databases are configured locally as named connection profiles, so
+// credentials never leave the runner: a task names a profile and never
+// carries a connection string. Every query runs as a single statement in a
+// read-only transaction, with a statement timeout and a row limit.
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// Supported drivers. MySQL also covers MariaDB.
+const (
+	Postgres = "postgres"
+	MySQL    = "mysql"
+)
+
+const (
+	// DefaultTimeout is the statement timeout of profiles without one.
+	DefaultTimeout = 30 * time.Second
+	// DefaultMaxRows is the row limit of profiles without one.
+	DefaultMaxRows = 1000
+
+	// timeoutGrace is how long the client waits past the statement timeout
+	// for the server to abort the statement before dropping the connection.
+	timeoutGrace = 5 * time.Second
+	// maxOpenConns bounds the connections of a profile.
+	maxOpenConns = 4
+)
+
+// envPattern matches ${VAR} references in connection strings.
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Profile is a database connection profile.
+type Profile struct {
+	// Driver is Postgres or MySQL.
+	Driver string
+	// DSN is a connection string as the driver accepts it. ${VAR}
+	// references are replaced from the environment, to keep passwords out
+	// of the configuration file.
+	DSN string
+	// Timeout of a statement. Default: DefaultTimeout.
+	Timeout time.Duration
+	// MaxRows is the most rows a query returns. Default: DefaultMaxRows.
+	MaxRows int
+}
+
+// database is an opened connection profile.
+type database struct {
+	name    string
+	driver  string
+	pool    *sql.DB
+	timeout time.Duration
+	maxRows int
+}
+
+// Client runs queries against the configured databases.
+type Client struct {
+	databases map[string]*database
+}
+
+// New returns a client for the given connection profiles. Connections are
+// made when a query first needs them, so a database that is down does not
+// keep the runner from starting.
+func New(profiles map[string]Profile) (*Client, error) {
+	c := &Client{databases: make(map[string]*database, len(profiles))}
+	for name, p := range profiles {
+		dsn, err := expandEnv(p.DSN)
+		if err != nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("database %q: %w", name, err)
+		}
+		connector, err := newConnector(p.Driver, dsn)
+		if err != nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("database %q: %w", name, err)
+		}
+		c.databases[name] = newDatabase(name, p, connector)
+	}
+	return c, nil
+}
+
+func newDatabase(name string, p Profile, connector driver.Connector) *database {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	maxRows := p.MaxRows
+	if maxRows <= 0 {
+		maxRows = DefaultMaxRows
+	}
+	pool := sql.OpenDB(connector)
+	pool.SetMaxOpenConns(maxOpenConns)
+	pool.SetMaxIdleConns(1)
+	pool.SetConnMaxIdleTime(5 * time.Minute)
+	return &database{name: name, driver: p.Driver, pool: pool, timeout: timeout, maxRows: maxRows}
+}
+
+// newConnector returns a connector for a connection string. MySQL
+// connections never allow several statements in one query.
+func newConnector(driverName, dsn string) (driver.Connector, error) {
+	switch driverName {
+	case Postgres:
+		cfg, err := pgx.ParseConfig(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dsn: %w", err)
+		}
+		return stdlib.GetConnector(*cfg), nil
+	case MySQL:
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dsn: %w", err)
+		}
+		cfg.MultiStatements = false
+		return mysql.NewConnector(cfg)
+	default:
+		return nil, fmt.Errorf("unknown driver %q: use %s or %s", driverName, Postgres, MySQL)
+	}
+}
+
+// expandEnv replaces ${VAR} references with environment variables.
+func expandEnv(dsn string) (string, error) {
+	var missing []string
+	expanded := envPattern.ReplaceAllStringFunc(dsn, func(ref string) string {
+		name := envPattern.FindStringSubmatch(ref)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("dsn refers to unset environment variables: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// Names returns the names of the profiles, sorted.
+func (c *Client) Names() []string {
+	names := make([]string, 0, len(c.databases))
+	for name := range c.databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close closes the connections of all profiles.
+func (c *Client) Close() error {
+	for _, d := range c.databases {
+		_ = d.pool.Close()
+	}
+	return nil
+}
+
+// Query runs a read-only statement against a profile and returns the rows.
+func (c *Client) Query(ctx context.Context, args *protocol.DBQueryArgs) (*protocol.DBQueryResult, error) {
+	d, ok := c.databases[args.Database]
+	if !ok {
+		if args.Database == "" {
+			return nil, fmt.Errorf("database is required: use one of %s", strings.Join(c.Names(), ", "))
+		}
+		return nil, fmt.Errorf("unknown database %q: use one of %s", args.Database, strings.Join(c.Names(), ", "))
+	}
+	query, err := checkStatement(d.driver, args.Query)
+	if err != nil {
+		return nil, err
+	}
+	params, err := queryArgs(args.Args)
+	if err != nil {
+		return nil, err
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = d.maxRows
+	}
+	limit = min(limit, d.maxRows)
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout+timeoutGrace)
+	defer cancel()
+	conn, err := d.pool.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database %q: %w", d.name, err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	tx, err := d.begin(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	// Nothing a query does is ever kept
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	return readRows(rows, limit)
+}
+
+// begin starts a read-only transaction with the statement timeout of the
+// profile.
+func (d *database) begin(ctx context.Context, conn *sql.Conn) (*sql.Tx, error) {
+	ms := d.timeout.Milliseconds()
+	if d.driver == MySQL {
+		// Set for the session, as MySQL has no transaction-scoped variables.
+		// MySQL limits SELECT statements, MariaDB names it differently and
+		// limits all statements.
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET SESSION max_execution_time = %d", ms)); err != nil {
+			if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET SESSION max_statement_time = %.3f", d.timeout.Seconds())); err != nil {
+				return nil, fmt.Errorf("failed to set statement timeout: %w", err)
+			}
+		}
+	}
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin read-only transaction: %w", err)
+	}
+	if d.driver == Postgres {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", ms)); err != nil {
+			_ = tx.Rollback()
+			return nil, fmt.Errorf("failed to set statement timeout: %w", err)
+		}
+	}
+	return tx, nil
+}
+
+// queryArgs converts placeholder values decoded from JSON. Whole numbers
+// are passed as integers, so they can be compared with integer columns.
+func queryArgs(args []any) ([]any, error) {
+	params := make([]any, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case nil, string, bool:
+			params[i] = v
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) <= 1<<53 {
+				params[i] = int64(v)
+			} else {
+				params[i] = v
+			}
+		default:
+			return nil, fmt.Errorf("args[%d]: must be a string, number, boolean or null", i)
+		}
+	}
+	return params, nil
+}
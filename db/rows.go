@@ -0,0 +1,127 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// maxValueSize caps a text or binary value in a result.
+const maxValueSize = 16 << 10
+
+// Type names the drivers report, as ints and floats MySQL returns as text.
+var (
+	intTypes = map[string]bool{
+		"int": true, "integer": true, "tinyint": true, "smallint": true, "mediumint": true, "bigint": true,
+		"int2": true, "int4": true, "int8": true, "year": true,
+	}
+	floatTypes = map[string]bool{
+		"float": true, "double": true, "real": true, "float4": true, "float8": true,
+	}
+	jsonTypes = map[string]bool{"json": true, "jsonb": true}
+)
+
+// readRows reads at most limit rows.
+func readRows(rows *sql.Rows, limit int) (*protocol.DBQueryResult, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	result := &protocol.DBQueryResult{
+		Columns: make([]protocol.DBColumn, len(types)),
+		Rows:    [][]any{},
+	}
+	for i, t := range types {
+		result.Columns[i] = protocol.DBColumn{Name: t.Name(), Type: strings.ToLower(t.DatabaseTypeName())}
+	}
+
+	values := make([]any, len(types))
+	dest := make([]any, len(types))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if len(result.Rows) == limit {
+			result.Truncated = true
+			break
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to read row: %w", err)
+		}
+		row := make([]any, len(values))
+		for i, v := range values {
+			row[i] = convertValue(v, result.Columns[i].Type)
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return result, nil
+}
+
+// convertValue converts a value scanned from a driver to one that encodes
+// to JSON as the column type suggests.
+func convertValue(v any, typ string) any {
+	switch v := v.(type) {
+	case nil, bool, int64, uint64:
+		return v
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case string:
+		return truncateValue(v)
+	case []byte:
+		return convertBytes(v, typ)
+	default:
+		return truncateValue(fmt.Sprint(v))
+	}
+}
+
+// convertBytes converts a value a driver returned as bytes, as MySQL does
+// for every type in query results.
+func convertBytes(b []byte, typ string) any {
+	s := string(b)
+	name := strings.TrimPrefix(typ, "unsigned ")
+	switch {
+	case intTypes[name]:
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+		if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return n
+		}
+	case floatTypes[name]:
+		if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f
+		}
+	case jsonTypes[name]:
+		if len(b) <= maxValueSize && json.Valid(b) {
+			return json.RawMessage(s)
+		}
+	}
+	if !utf8.Valid(b) {
+		s = `\x` + hex.EncodeToString(b)
+	}
+	return truncateValue(s)
+}
+
+// truncateValue cuts text longer than maxValueSize.
+func truncateValue(s string) string {
+	if len(s) <= maxValueSize {
+		return s
+	}
+	return strings.ToValidUTF8(s[:maxValueSize], "") + "... [value truncated]"
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertValue(t *testing.T) {
+	loc := time.FixedZone("", 8*3600)
+	tests := []struct {
+		value any
+		typ   string
+		want  any
+	}{
+		{nil, "text", nil},
+		{true, "bool", true},
+		{int64(42), "int8", int64(42)},
+		{1.5, "float8", 1.5},
+		{math.NaN(), "float8", "NaN"},
+		{math.Inf(1), "float8", "+Inf"},
+		{time.Date(2024, 5, 1, 12, 0, 0, 500, loc), "timestamptz", "2024-05-01T12:00:00.0000005+08:00"},
+		{"12.50", "numeric", "12.50"},
+		{[]byte("-7"), "int", int64(-7)},
+		{[]byte("2024"), "year", int64(2024)},
+		{[]byte("18446744073709551615"), "unsigned bigint", uint64(18446744073709551615)},
+		{[]byte("2.5"), "double", 2.5},
+		{[]byte("12.50"), "decimal", "12.50"},
+		{[]byte("2024-05-01 12:00:00"), "datetime", "2024-05-01 12:00:00"},
+		{[]byte(`{"a": [1, 2]}`), "jsonb", json.RawMessage(`{"a": [1, 2]}`)},
+		{[]byte(`not json`), "json", "not json"},
+		{[]byte{0xde, 0xad, 0xbe, 0xef}, "bytea", `\xdeadbeef`},
+		{[]byte("text in a blob"), "blob", "text in a blob"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, convertValue(tt.value, tt.typ), "%v (%s)", tt.value, tt.typ)
+	}
+}
+
+func TestConvertValueTruncates(t *testing.T) {
+	v := convertValue(strings.Repeat("é", maxValueSize), "text")
+	s, ok := v.(string)
+	assert.True(t, ok)
+	assert.True(t, strings.HasSuffix(s, "... [value truncated]"))
+	assert.LessOrEqual(t, len(s), maxValueSize+len("... [value truncated]"))
+
+	// JSON too large to embed is cut as text
+	big := []byte(`"` + strings.Repeat("a", maxValueSize) + `"`)
+	_, isString := convertValue(big, "json").(string)
+	assert.True(t, isString)
+}
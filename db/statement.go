@@ -0,0 +1,164 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// readOnlyStatements are the statements a query may start with. The
+// read-only transaction is what keeps queries from writing; the check keeps
+// out statements that act outside it, such as SET TRANSACTION or DDL, which
+// commits implicitly in MySQL.
+var readOnlyStatements = map[string]bool{
+	"select":   true,
+	"with":     true,
+	"show":     true,
+	"explain":  true,
+	"values":   true,
+	"table":    true,
+	"describe": true,
+	"desc":     true,
+}
+
+// intoFilePattern matches MySQL's SELECT ... INTO OUTFILE, which writes a
+// file on the server despite the read-only transaction.
+var intoFilePattern = regexp.MustCompile(`(?i)\binto\s+(outfile|dumpfile)\b`)
+
+// dollarTagPattern matches the tag opening a PostgreSQL dollar-quoted string.
+var dollarTagPattern = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// checkStatement returns the query without trailing semicolons and
+// comments, or an error unless it is a single read-only statement.
+func checkStatement(driverName, query string) (string, error) {
+	code, err := blankLiterals(driverName, query)
+	if err != nil {
+		return "", err
+	}
+	end := len(strings.TrimRight(code, " \t\r\n;"))
+	if end == 0 {
+		return "", fmt.Errorf("query is required")
+	}
+	if strings.Contains(code[:end], ";") {
+		return "", fmt.Errorf("only a single statement is allowed")
+	}
+
+	first := strings.TrimLeft(code, " \t\r\n(")
+	if i := strings.IndexFunc(first, func(r rune) bool { return !isLetter(r) }); i >= 0 {
+		first = first[:i]
+	}
+	if !readOnlyStatements[strings.ToLower(first)] {
+		return "", fmt.Errorf("%q statements are not allowed: use SELECT, WITH, SHOW, EXPLAIN, VALUES or TABLE", first)
+	}
+	if driverName == MySQL && intoFilePattern.MatchString(code) {
+		return "", fmt.Errorf("INTO OUTFILE and INTO DUMPFILE are not allowed")
+	}
+	return query[:end], nil
+}
+
+// blankLiterals returns the query with the contents of quoted strings and
+// identifiers and of comments replaced by spaces, so that keywords and
+// semicolons are only found in SQL code. Offsets are kept.
+func blankLiterals(driverName, query string) (string, error) {
+	b := []byte(query)
+	isMySQL := driverName == MySQL
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c == '\'' || c == '"' || (c == '`' && isMySQL):
+			// MySQL strings and PostgreSQL E'' strings have backslash escapes
+			escapes := isMySQL || (c == '\'' && i > 0 && (b[i-1] == 'E' || b[i-1] == 'e'))
+			end := closingQuote(b, i, escapes)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated quoted string")
+			}
+			blank(b, i+1, end)
+			i = end + 1
+
+		case c == '-' && i+1 < len(b) && b[i+1] == '-' && (!isMySQL || i+2 >= len(b) || isSpace(b[i+2])):
+			// MySQL requires a space after --, so 1--1 is a subtraction
+			end := lineEnd(b, i)
+			blank(b, i, end)
+			i = end
+
+		case c == '#' && isMySQL:
+			end := lineEnd(b, i)
+			blank(b, i, end)
+			i = end
+
+		case c == '/' && i+1 < len(b) && b[i+1] == '*':
+			if isMySQL && i+2 < len(b) && b[i+2] == '!' {
+				// The contents of /*! ... */ are executed by MySQL
+				return "", fmt.Errorf("executable comments are not allowed")
+			}
+			end := strings.Index(string(b[i+2:]), "*/")
+			if end < 0 {
+				return "", fmt.Errorf("unterminated comment")
+			}
+			end += i + 4
+			blank(b, i, end)
+			i = end
+
+		case c == '$' && !isMySQL && (i == 0 || !isIdentChar(b[i-1])):
+			// Dollar-quoted string, unless a $1 placeholder
+			tag := dollarTagPattern.Find(b[i:])
+			if tag == nil {
+				i++
+				continue
+			}
+			start := i + len(tag)
+			end := strings.Index(string(b[start:]), string(tag))
+			if end < 0 {
+				return "", fmt.Errorf("unterminated dollar-quoted string")
+			}
+			blank(b, start, start+end)
+			i = start + end + len(tag)
+
+		default:
+			i++
+		}
+	}
+	return string(b), nil
+}
+
+// closingQuote returns the index of the quote closing the one at start, or
+// -1. A doubled quote stands for itself.
+func closingQuote(b []byte, start int, escapes bool) int {
+	q := b[start]
+	for j := start + 1; j < len(b); j++ {
+		switch {
+		case escapes && b[j] == '\\':
+			j++
+		case b[j] == q && j+1 < len(b) && b[j+1] == q:
+			j++
+		case b[j] == q:
+			return j
+		}
+	}
+	return -1
+}
+
+func lineEnd(b []byte, start int) int {
+	if i := strings.IndexByte(string(b[start:]), '\n'); i >= 0 {
+		return start + i
+	}
+	return len(b)
+}
+
+func blank(b []byte, start, end int) {
+	for i := start; i < end; i++ {
+		b[i] = ' '
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isLetter(rune(c)) || (c >= '0' && c <= '9') || c == '_' || c >= 0x80
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckStatement(t *testing.T) {
+	tests := []struct {
+		driver string
+		query  string
+		want   string // Empty when the query is rejected
+	}{
+		{Postgres, "SELECT 1", "SELECT 1"},
+		{Postgres, "  select 1 ;\n ", "  select 1"},
+		{Postgres, "WITH x AS (SELECT 1) SELECT * FROM x", "WITH x AS (SELECT 1) SELECT * FROM x"},
+		{Postgres, "(SELECT 1) UNION (SELECT 2)", "(SELECT 1) UNION (SELECT 2)"},
+		{Postgres, "-- recent errors\nSELECT * FROM errors", "-- recent errors\nSELECT * FROM errors"},
+		{Postgres, "EXPLAIN SELECT 1", "EXPLAIN SELECT 1"},
+		{Postgres, "SHOW max_connections", "SHOW max_connections"},
+		{Postgres, "SELECT 'a;b', \"c;d\" FROM t", "SELECT 'a;b', \"c;d\" FROM t"},
+		{Postgres, "SELECT 'it''s; fine'", "SELECT 'it''s; fine'"},
+		{Postgres, "SELECT $$a;b$$, $tag$c;d$tag$", "SELECT $$a;b$$, $tag$c;d$tag$"},
+		{Postgres, "SELECT * FROM t WHERE a = $1", "SELECT * FROM t WHERE a = $1"},
+		{Postgres, "SELECT /* ; */ 1", "SELECT /* ; */ 1"},
+		{MySQL, "SELECT 'a\\';b'", "SELECT 'a\\';b'"},
+		{MySQL, "SELECT `a;b` FROM t; # trailing", "SELECT `a;b` FROM t"},
+		{MySQL, "DESCRIBE orders", "DESCRIBE orders"},
+		{MySQL, "SELECT /*+ MAX_EXECUTION_TIME(100) */ 1", "SELECT /*+ MAX_EXECUTION_TIME(100) */ 1"},
+
+		{Postgres, "", ""},
+		{Postgres, " ; ", ""},
+		{Postgres, "-- only a comment", ""},
+		{Postgres, "DELETE FROM users", ""},
+		{Postgres, "SET TRANSACTION READ WRITE", ""},
+		{Postgres, "COMMIT", ""},
+		{Postgres, "SELECT 1; DROP TABLE users", ""},
+		{Postgres, "/* SELECT */ UPDATE t SET a = 1", ""},
+		{Postgres, "SELECT 'unterminated", ""},
+		{Postgres, "SELECT $$unterminated", ""},
+		// A backslash does not escape a quote in standard PostgreSQL strings
+		{Postgres, "SELECT 'a\\'; DROP TABLE t; --'", ""},
+		{Postgres, "SELECT E'a\\'; b'", "SELECT E'a\\'; b'"},
+		{MySQL, "SELECT 1--1; DROP TABLE t", ""},
+		{MySQL, "/*!50000 DROP TABLE t */ SELECT 1", ""},
+		{MySQL, "SELECT * FROM t INTO OUTFILE '/tmp/x'", ""},
+		{MySQL, "SELECT 'into outfile'", "SELECT 'into outfile'"},
+		{MySQL, "CREATE TABLE t (a int)", ""},
+	}
+	for _, tt := range tests {
+		got, err := checkStatement(tt.driver, tt.query)
+		if tt.want == "" {
+			assert.Error(t, err, "%s: %q", tt.driver, tt.query)
+			continue
+		}
+		require.NoError(t, err, "%s: %q", tt.driver, tt.query)
+		assert.Equal(t, tt.want, got, "%s: %q", tt.driver, tt.query)
+	}
+}
@@ -0,0 +1,177 @@
+// Package diag implements read-only host diagnostics natively in Go.
+//
+// With the default deny-all bash policy the agent cannot run ps, ss, df or
+// dmesg. These operations read the same information from /proc and /sys and
+// return it as structured results, without a shell or the tools installed.
+// Each diagnostic is enabled individually in permission.diagnostics.
+package diag
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Diagnostic names, matching the task operations that run them.
+const (
+	Processes = "processes"
+	Sockets   = "sockets"
+	Disks     = "disks"
+	Memory    = "memory"
+	KernelLog = "kernel_log"
+	Systemd   = "systemd"
+)
+
+// Names lists all diagnostics.
+var Names = []string{Processes, Sockets, Disks, Memory, KernelLog, Systemd}
+
+// Diagnostics runs the enabled diagnostics.
+type Diagnostics struct {
+	enabled map[string]bool
+
+	// Roots of the proc and sys filesystems, the clock and the systemctl
+	// runner, replaced in tests
+	procRoot  string
+	sysRoot   string
+	now       func() time.Time
+	systemctl func(ctx context.Context, args ...string) ([]byte, error)
+}
+
+// New returns Diagnostics with the given diagnostics enabled. "*" enables
+// all of them.
+func New(enabled []string) (*Diagnostics, error) {
+	d := &Diagnostics{
+		enabled:   make(map[string]bool),
+		procRoot:  "/proc",
+		sysRoot:   "/sys",
+		now:       time.Now,
+		systemctl: runSystemctl,
+	}
+	for _, name := range enabled {
+		switch {
+		case name == "*":
+			for _, n := range Names {
+				d.enabled[n] = true
+			}
+		case isName(name):
+			d.enabled[name] = true
+		default:
+			return nil, fmt.Errorf("unknown diagnostic %q: use %s", name, strings.Join(Names, ", "))
+		}
+	}
+	return d, nil
+}
+
+func isName(name string) bool {
+	for _, n := range Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Enabled returns the names of the enabled diagnostics.
+func (d *Diagnostics) Enabled() []string {
+	var names []string
+	for _, n := range Names {
+		if d.enabled[n] {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// check returns an error if the diagnostic is not enabled.
+func (d *Diagnostics) check(name string) error {
+	if d == nil || !d.enabled[name] {
+		return fmt.Errorf("diagnostic %q is not enabled: add it to permission.diagnostics", name)
+	}
+	return nil
+}
+
+func (d *Diagnostics) proc(elem ...string) string {
+	return filepath.Join(append([]string{d.procRoot}, elem...)...)
+}
+
+func (d *Diagnostics) sys(elem ...string) string {
+	return filepath.Join(append([]string{d.sysRoot}, elem...)...)
+}
+
+// bootTime reads the boot time from /proc/stat.
+func (d *Diagnostics) bootTime() (time.Time, error) {
+	data, err := os.ReadFile(d.proc("stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "btime "); ok {
+			sec, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid btime %q: %w", v, err)
+			}
+			return time.Unix(sec, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("btime not found in /proc/stat")
+}
+
+// CPUTimes are the aggregate CPU counters of /proc/stat, in clock ticks.
+type CPUTimes struct {
+	Total uint64
+	Idle  uint64 // Idle and iowait
+}
+
+// ParseCPUTimes parses the aggregate "cpu" line of /proc/stat.
+// Fields: user nice system idle iowait irq softirq steal [guest guest_nice].
+// Guest time is already included in user/nice, so only the first 8 are summed.
+func ParseCPUTimes(data string) (CPUTimes, error) {
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+
+		var times CPUTimes
+		for i, f := range fields[1:min(len(fields), 9)] {
+			v, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return CPUTimes{}, fmt.Errorf("invalid cpu field %q: %w", f, err)
+			}
+			times.Total += v
+			if i == 3 || i == 4 { // idle, iowait
+				times.Idle += v
+			}
+		}
+		return times, nil
+	}
+	return CPUTimes{}, fmt.Errorf("cpu line not found in /proc/stat")
+}
+
+// parseKeyValues parses files such as /proc/meminfo and /proc/vmstat into
+// a map of names to the first number after them.
+func parseKeyValues(data string) map[string]int64 {
+	values := make(map[string]int64)
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if v, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			values[strings.TrimSuffix(fields[0], ":")] = v
+		}
+	}
+	return values
+}
+
+// percent returns part as a percentage of total, rounded to one decimal.
+func percent(part, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(int64(part/total*1000+0.5)) / 10
+}
@@ -0,0 +1,102 @@
+package diag
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDiagnostics returns Diagnostics with all diagnostics enabled,
+// reading the given proc and sys files, keyed by path, from a temporary
+// directory.
+func newTestDiagnostics(t *testing.T, proc, sys map[string]string) *Diagnostics {
+	t.Helper()
+	d, err := New([]string{"*"})
+	require.NoError(t, err)
+	d.procRoot = writeTree(t, proc)
+	d.sysRoot = writeTree(t, sys)
+	d.now = func() time.Time { return time.Date(2024, 5, 14, 12, 0, 0, 0, time.UTC) }
+	return d
+}
+
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	return root
+}
+
+// procStatFile holds a boot time of 2024-05-14T00:00:00Z.
+const procStatFile = "cpu  100 0 50 1000 0 0 0 0 0 0\nbtime 1715644800\n"
+
+func TestNew(t *testing.T) {
+	d, err := New([]string{"memory", "disks"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"disks", "memory"}, d.Enabled())
+	require.NoError(t, d.check(Memory))
+	assert.ErrorContains(t, d.check(Processes), `diagnostic "processes" is not enabled`)
+
+	d, err = New([]string{"*"})
+	require.NoError(t, err)
+	assert.Equal(t, Names, d.Enabled())
+
+	_, err = New([]string{"netstat"})
+	assert.ErrorContains(t, err, `unknown diagnostic "netstat"`)
+
+	// Nothing is enabled by default
+	d, err = New(nil)
+	require.NoError(t, err)
+	assert.Empty(t, d.Enabled())
+	var none *Diagnostics
+	assert.Error(t, none.check(Memory))
+}
+
+func TestDisabled(t *testing.T) {
+	d, err := New([]string{"memory"})
+	require.NoError(t, err)
+	_, err = d.Disks(nil)
+	assert.ErrorContains(t, err, "permission.diagnostics")
+	_, err = d.Processes(context.Background(), nil)
+	assert.ErrorContains(t, err, "permission.diagnostics")
+}
+
+func TestParseCPUTimes(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want CPUTimes
+	}{
+		{
+			name: "with guest time",
+			data: "cpu  100 5 50 800 20 1 2 3 40 0\ncpu0 50 2 25 400 10 0 1 1 20 0\nintr 12345\nbtime 1715600000\n",
+			// Guest time is part of user time and not counted twice
+			want: CPUTimes{Total: 981, Idle: 820},
+		},
+		{
+			name: "old kernel",
+			data: "cpu 10 0 10 80\n",
+			want: CPUTimes{Total: 100, Idle: 80},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCPUTimes(tt.data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := ParseCPUTimes("cpu0 1 2 3 4 5\n")
+	assert.ErrorContains(t, err, "cpu line not found")
+	_, err = ParseCPUTimes("cpu 1 2 x 4 5\n")
+	assert.ErrorContains(t, err, "invalid cpu field")
+}
@@ -0,0 +1,143 @@
+package diag
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// pseudoFilesystems have no disk behind them and are skipped unless all
+// mounts are requested.
+var pseudoFilesystems = map[string]bool{
+	"autofs": true, "binfmt_misc": true, "bpf": true, "cgroup": true, "cgroup2": true,
+	"configfs": true, "debugfs": true, "devpts": true, "efivarfs": true, "fusectl": true,
+	"hugetlbfs": true, "mqueue": true, "nsfs": true, "proc": true, "pstore": true,
+	"rpc_pipefs": true, "securityfs": true, "selinuxfs": true, "squashfs": true,
+	"sysfs": true, "tracefs": true,
+}
+
+// mountEntry is a mount read from /proc/self/mountinfo.
+type mountEntry struct {
+	device     string
+	mountPoint string
+	fsType     string
+	readOnly   bool
+}
+
+// parseMountinfo parses /proc/self/mountinfo. When a mount point is mounted
+// over, only the last mount is visible and kept.
+func parseMountinfo(data string) []mountEntry {
+	var mounts []mountEntry
+	index := make(map[string]int)
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 0 || sep+2 >= len(fields) {
+			continue
+		}
+		m := mountEntry{
+			device:     unescapeMount(fields[sep+2]),
+			mountPoint: unescapeMount(fields[4]),
+			fsType:     fields[sep+1],
+		}
+		for _, opt := range strings.Split(fields[5], ",") {
+			if opt == "ro" {
+				m.readOnly = true
+			}
+		}
+		if i, ok := index[m.mountPoint]; ok {
+			mounts[i] = m
+			continue
+		}
+		index[m.mountPoint] = len(mounts)
+		mounts = append(mounts, m)
+	}
+	return mounts
+}
+
+// unescapeMount decodes the octal escapes mountinfo uses for spaces, tabs,
+// newlines and backslashes in paths.
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// Disks reports the usage of mounted filesystems, as df does.
+func (d *Diagnostics) Disks(args *protocol.DisksArgs) (*protocol.DisksResult, error) {
+	if err := d.check(Disks); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(d.proc("self", "mountinfo"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mounts: %w", err)
+	}
+
+	disks := make([]protocol.DiskInfo, 0)
+	for _, m := range parseMountinfo(string(data)) {
+		if !args.All && pseudoFilesystems[m.fsType] {
+			continue
+		}
+		info := protocol.DiskInfo{
+			Device:     m.device,
+			MountPoint: m.mountPoint,
+			FSType:     m.fsType,
+			ReadOnly:   m.readOnly,
+		}
+		usage, err := statFS(m.mountPoint)
+		if err != nil || usage.blocks == 0 {
+			// Inaccessible mounts and empty pseudo filesystems have no usage
+			if !args.All {
+				continue
+			}
+		} else {
+			usage.fill(&info)
+		}
+		disks = append(disks, info)
+	}
+	return &protocol.DisksResult{Disks: disks}, nil
+}
+
+// fsUsage holds statfs counters, with blocks in units of blockSize.
+type fsUsage struct {
+	blockSize int64
+	blocks    int64
+	free      int64 // Free blocks, including those reserved for root
+	available int64 // Free blocks available to unprivileged users
+	files     int64
+	filesFree int64
+}
+
+// fill sets the usage fields of info, computed the way df does.
+func (u fsUsage) fill(info *protocol.DiskInfo) {
+	info.TotalBytes = u.blocks * u.blockSize
+	info.UsedBytes = (u.blocks - u.free) * u.blockSize
+	info.AvailableBytes = u.available * u.blockSize
+	info.UsedPercent = percent(float64(info.UsedBytes), float64(info.UsedBytes+info.AvailableBytes))
+	if u.files > 0 {
+		info.Inodes = u.files
+		info.InodesUsed = u.files - u.filesFree
+		info.InodesUsedPercent = percent(float64(info.InodesUsed), float64(u.files))
+	}
+}
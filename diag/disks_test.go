@@ -0,0 +1,64 @@
+package diag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const mountinfo = `22 28 0:21 / /sys rw,nosuid,nodev,noexec,relatime shared:7 - sysfs sysfs rw
+28 1 259:2 / / rw,relatime shared:1 - ext4 /dev/nvme0n1p2 rw,errors=remount-ro
+31 28 259:1 / /boot/efi rw,relatime shared:2 - vfat /dev/nvme0n1p1 rw,fmask=0077
+40 28 0:35 / /mnt/backup\040disk ro,relatime - xfs /dev/sdb1 ro,attr2
+45 28 0:40 / /data rw,relatime - ext4 /dev/sdc1 rw
+46 28 0:41 / /data rw,relatime - ext4 /dev/sdd1 rw
+`
+
+func TestParseMountinfo(t *testing.T) {
+	mounts := parseMountinfo(mountinfo)
+	require.Len(t, mounts, 5)
+	assert.Equal(t, mountEntry{device: "sysfs", mountPoint: "/sys", fsType: "sysfs"}, mounts[0])
+	assert.Equal(t, mountEntry{device: "/dev/nvme0n1p2", mountPoint: "/", fsType: "ext4"}, mounts[1])
+	assert.Equal(t, mountEntry{device: "/dev/sdb1", mountPoint: "/mnt/backup disk", fsType: "xfs", readOnly: true}, mounts[3])
+	// The mount on top hides the one below
+	assert.Equal(t, "/dev/sdd1", mounts[4].device)
+}
+
+func TestUnescapeMount(t *testing.T) {
+	assert.Equal(t, "/mnt/a b", unescapeMount(`/mnt/a\040b`))
+	assert.Equal(t, `/mnt/a\b`, unescapeMount(`/mnt/a\134b`))
+	assert.Equal(t, `/mnt/tab\`, unescapeMount(`/mnt/tab\`))
+	assert.Equal(t, "/mnt/end\t", unescapeMount(`/mnt/end\011`))
+}
+
+func TestFSUsage(t *testing.T) {
+	var info protocol.DiskInfo
+	fsUsage{blockSize: 4096, blocks: 1000, free: 300, available: 250, files: 200, filesFree: 150}.fill(&info)
+	assert.Equal(t, int64(4096000), info.TotalBytes)
+	assert.Equal(t, int64(2867200), info.UsedBytes)
+	assert.Equal(t, int64(1024000), info.AvailableBytes)
+	// Space reserved for root counts as neither used nor available
+	assert.Equal(t, 73.7, info.UsedPercent)
+	assert.Equal(t, int64(50), info.InodesUsed)
+	assert.Equal(t, 25.0, info.InodesUsedPercent)
+}
+
+func TestDisks(t *testing.T) {
+	d := newTestDiagnostics(t, map[string]string{
+		"self/mountinfo": "22 28 0:21 / /sys rw - sysfs sysfs rw\n" +
+			"28 1 259:2 / / rw,relatime - ext4 /dev/root rw\n",
+	}, nil)
+
+	result, err := d.Disks(&protocol.DisksArgs{})
+	require.NoError(t, err)
+	require.Len(t, result.Disks, 1)
+	assert.Equal(t, "/", result.Disks[0].MountPoint)
+	assert.Positive(t, result.Disks[0].TotalBytes)
+
+	result, err = d.Disks(&protocol.DisksArgs{All: true})
+	require.NoError(t, err)
+	assert.Len(t, result.Disks, 2)
+}
@@ -0,0 +1,138 @@
+package diag
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const (
+	// DefaultKernelLogLines is the default number of kernel messages returned.
+	DefaultKernelLogLines = 100
+	// MaxKernelLogLines caps the number of kernel messages returned.
+	MaxKernelLogLines = 1000
+)
+
+// kernelLevels are the syslog severities, indexed by level.
+var kernelLevels = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// kmsgRecord is a record read from /dev/kmsg.
+type kmsgRecord struct {
+	level   int
+	sinceUS int64 // Microseconds after boot
+	message string
+}
+
+// parseKmsgRecord parses a /dev/kmsg record such as
+// "6,339,5140900,-;NET: Registered protocol family 10". Lines after the
+// first carry device metadata and are dropped.
+func parseKmsgRecord(record string) (kmsgRecord, bool) {
+	prefix, message, ok := strings.Cut(record, ";")
+	if !ok {
+		return kmsgRecord{}, false
+	}
+	message, _, _ = strings.Cut(message, "\n")
+	fields := strings.Split(prefix, ",")
+	if len(fields) < 3 {
+		return kmsgRecord{}, false
+	}
+	priority, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return kmsgRecord{}, false
+	}
+	us, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return kmsgRecord{}, false
+	}
+	// The facility is in the upper bits; user space messages have one too
+	return kmsgRecord{level: priority & 7, sinceUS: us, message: message}, true
+}
+
+// parseLevel returns the index of a severity name.
+func parseLevel(name string) (int, error) {
+	if name == "" {
+		return len(kernelLevels) - 1, nil
+	}
+	for i, level := range kernelLevels {
+		if level == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid level %q: use %s", name, strings.Join(kernelLevels, ", "))
+}
+
+// parseSince parses an RFC3339 time or a duration before now.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since %q: expected RFC3339 time or duration like 1h", s)
+	}
+	return t, nil
+}
+
+// KernelLog returns recent kernel messages, as dmesg does. Reading them
+// requires root or CAP_SYSLOG on hosts that restrict dmesg.
+func (d *Diagnostics) KernelLog(ctx context.Context, args *protocol.KernelLogArgs) (*protocol.KernelLogResult, error) {
+	if err := d.check(KernelLog); err != nil {
+		return nil, err
+	}
+	maxLevel, err := parseLevel(args.Level)
+	if err != nil {
+		return nil, err
+	}
+	since, err := parseSince(args.Since, d.now())
+	if err != nil {
+		return nil, err
+	}
+	lines := args.Lines
+	if lines <= 0 {
+		lines = DefaultKernelLogLines
+	}
+	lines = min(lines, MaxKernelLogLines)
+
+	bootTime, err := d.bootTime()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read boot time: %w", err)
+	}
+	records, err := readKmsg(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return filterKernelLog(records, maxLevel, since, lines, bootTime), nil
+}
+
+// filterKernelLog returns the last records at or above a severity and after
+// since, with times computed from the boot time.
+func filterKernelLog(records []string, maxLevel int, since time.Time, lines int, bootTime time.Time) *protocol.KernelLogResult {
+	result := &protocol.KernelLogResult{Entries: make([]protocol.KernelLogEntry, 0)}
+	for _, record := range records {
+		r, ok := parseKmsgRecord(record)
+		if !ok || r.level > maxLevel {
+			continue
+		}
+		t := bootTime.Add(time.Duration(r.sinceUS) * time.Microsecond)
+		if !since.IsZero() && t.Before(since) {
+			continue
+		}
+		result.Entries = append(result.Entries, protocol.KernelLogEntry{
+			Time:    t.UTC().Format(time.RFC3339),
+			Level:   kernelLevels[r.level],
+			Message: r.message,
+		})
+	}
+	if len(result.Entries) > lines {
+		result.Entries = result.Entries[len(result.Entries)-lines:]
+		result.Truncated = true
+	}
+	return result
+}
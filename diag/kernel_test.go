@@ -0,0 +1,80 @@
+package diag
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var kmsgRecords = []string{
+	"6,1,0,-;Linux version 6.8.0-31-generic (buildd@lcy02-amd64-080)\n",
+	"4,120,1500000,-;ACPI: \\_SB.PCI0: _OSC failed\n",
+	"6,339,5140900,-,caller=T1;NET: Registered PF_INET6 protocol family\n SUBSYSTEM=net\n DEVICE=+net:lo\n",
+	"3,900,3600000000,-;Out of memory: Killed process 812 (java) total-vm:4194304kB\n",
+	"30,901,3600500000,-;systemd[1]: Started Daily apt upgrade.\n",
+	"malformed",
+}
+
+func TestParseKmsgRecord(t *testing.T) {
+	r, ok := parseKmsgRecord(kmsgRecords[2])
+	require.True(t, ok)
+	assert.Equal(t, kmsgRecord{level: 6, sinceUS: 5140900, message: "NET: Registered PF_INET6 protocol family"}, r)
+
+	// User space messages carry a facility
+	r, ok = parseKmsgRecord(kmsgRecords[4])
+	require.True(t, ok)
+	assert.Equal(t, 6, r.level)
+
+	_, ok = parseKmsgRecord(kmsgRecords[5])
+	assert.False(t, ok)
+	_, ok = parseKmsgRecord("x,1,0,-;text")
+	assert.False(t, ok)
+}
+
+func TestFilterKernelLog(t *testing.T) {
+	boot := time.Date(2024, 5, 14, 0, 0, 0, 0, time.UTC)
+
+	result := filterKernelLog(kmsgRecords, 7, time.Time{}, 100, boot)
+	require.Len(t, result.Entries, 5)
+	assert.False(t, result.Truncated)
+	assert.Equal(t, "2024-05-14T00:00:01Z", result.Entries[1].Time)
+	assert.Equal(t, "warning", result.Entries[1].Level)
+
+	// Warnings and worse
+	result = filterKernelLog(kmsgRecords, 4, time.Time{}, 100, boot)
+	require.Len(t, result.Entries, 2)
+	assert.Equal(t, "err", result.Entries[1].Level)
+	assert.Equal(t, "2024-05-14T01:00:00Z", result.Entries[1].Time)
+
+	// The most recent messages are kept
+	result = filterKernelLog(kmsgRecords, 7, time.Time{}, 2, boot)
+	require.Len(t, result.Entries, 2)
+	assert.True(t, result.Truncated)
+	assert.Equal(t, "systemd[1]: Started Daily apt upgrade.", result.Entries[1].Message)
+
+	result = filterKernelLog(kmsgRecords, 7, boot.Add(30*time.Minute), 100, boot)
+	assert.Len(t, result.Entries, 2)
+}
+
+func TestKernelLogArgs(t *testing.T) {
+	level, err := parseLevel("")
+	require.NoError(t, err)
+	assert.Equal(t, 7, level)
+	level, err = parseLevel("warning")
+	require.NoError(t, err)
+	assert.Equal(t, 4, level)
+	_, err = parseLevel("warn")
+	assert.ErrorContains(t, err, "invalid level")
+
+	now := time.Date(2024, 5, 14, 12, 0, 0, 0, time.UTC)
+	since, err := parseSince("1h", now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-time.Hour), since)
+	since, err = parseSince("2024-05-14T08:00:00Z", now)
+	require.NoError(t, err)
+	assert.Equal(t, 8, since.Hour())
+	_, err = parseSince("yesterday", now)
+	assert.Error(t, err)
+}
@@ -0,0 +1,48 @@
+//go:build linux
+
+package diag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// kmsgPath is the kernel log device. Each read returns one record.
+const kmsgPath = "/dev/kmsg"
+
+// readKmsg reads the records in the kernel log buffer without blocking for
+// new ones.
+func readKmsg(ctx context.Context) ([]string, error) {
+	fd, err := syscall.Open(kmsgPath, syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) {
+		return nil, fmt.Errorf("reading the kernel log requires root or CAP_SYSLOG: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open kernel log: %w", err)
+	}
+	defer func() { _ = syscall.Close(fd) }()
+
+	var records []string
+	buf := make([]byte, 8192)
+	for ctx.Err() == nil {
+		n, err := syscall.Read(fd, buf)
+		switch {
+		case errors.Is(err, syscall.EAGAIN):
+			// No more records
+			return records, nil
+		case errors.Is(err, syscall.EPIPE):
+			// The record was overwritten while reading; continue with the next
+			continue
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case err != nil:
+			return nil, fmt.Errorf("failed to read kernel log: %w", err)
+		case n == 0:
+			return records, nil
+		}
+		records = append(records, string(buf[:n]))
+	}
+	return nil, ctx.Err()
+}
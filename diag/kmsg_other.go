@@ -0,0 +1,13 @@
+//go:build !linux
+
+package diag
+
+import (
+	"context"
+	"errors"
+)
+
+// readKmsg is only implemented on Linux.
+func readKmsg(context.Context) ([]string, error) {
+	return nil, errors.New("kernel log is only available on Linux")
+}
@@ -0,0 +1,139 @@
+package diag
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// unlimitedCgroup is the smallest cgroup v1 memory limit treated as no
+// limit; an unlimited cgroup reports a page-aligned maximum int64.
+const unlimitedCgroup = 1 << 60
+
+// ParseMeminfo builds a memory breakdown from /proc/meminfo, in which values
+// are in kB.
+func ParseMeminfo(data string) (*protocol.MemoryResult, error) {
+	kb := parseKeyValues(data)
+	bytes := func(key string) int64 { return kb[key] * 1024 }
+
+	total := bytes("MemTotal")
+	if total == 0 {
+		return nil, fmt.Errorf("MemTotal not found in /proc/meminfo")
+	}
+	available, ok := kb["MemAvailable"]
+	if !ok {
+		// Kernels before 3.14
+		available = kb["MemFree"] + kb["Buffers"] + kb["Cached"]
+	}
+	availableBytes := min(available*1024, total)
+
+	return &protocol.MemoryResult{
+		TotalBytes:             total,
+		UsedBytes:              total - availableBytes,
+		AvailableBytes:         availableBytes,
+		FreeBytes:              bytes("MemFree"),
+		UsedPercent:            percent(float64(total-availableBytes), float64(total)),
+		BuffersBytes:           bytes("Buffers"),
+		CachedBytes:            bytes("Cached"),
+		ShmemBytes:             bytes("Shmem"),
+		AnonBytes:              bytes("AnonPages"),
+		SlabReclaimableBytes:   bytes("SReclaimable"),
+		SlabUnreclaimableBytes: bytes("SUnreclaim"),
+		DirtyBytes:             bytes("Dirty"),
+		SwapTotalBytes:         bytes("SwapTotal"),
+		SwapUsedBytes:          bytes("SwapTotal") - bytes("SwapFree"),
+	}, nil
+}
+
+// Memory reports a breakdown of system memory, OOM kills since boot and the
+// memory limit of the runner's cgroup, as free and the cgroup files show.
+func (d *Diagnostics) Memory() (*protocol.MemoryResult, error) {
+	if err := d.check(Memory); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(d.proc("meminfo"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memory: %w", err)
+	}
+	result, err := ParseMeminfo(string(data))
+	if err != nil {
+		return nil, err
+	}
+	if data, err := os.ReadFile(d.proc("vmstat")); err == nil {
+		result.OOMKills = parseKeyValues(string(data))["oom_kill"]
+	}
+	result.Cgroup = d.memoryCgroup()
+	return result, nil
+}
+
+// memoryCgroup returns the memory limit of the runner's cgroup, or nil when
+// it is not limited or cgroups are not readable.
+func (d *Diagnostics) memoryCgroup() *protocol.Cgroup {
+	data, err := os.ReadFile(d.proc("self", "cgroup"))
+	if err != nil {
+		return nil
+	}
+
+	// Lines are hierarchy-ID:controllers:path; cgroup v2 has the single
+	// line 0::path, v1 a line per hierarchy. On hybrid hosts both are
+	// present and the memory controller is the v1 one.
+	var v1Path, v2Path string
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			v2Path = parts[2]
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller == "memory" {
+				v1Path = parts[2]
+			}
+		}
+	}
+
+	var limitFile, usageFile, cgroupPath string
+	switch {
+	case v1Path != "":
+		cgroupPath = v1Path
+		limitFile = d.sys("fs", "cgroup", "memory", cgroupPath, "memory.limit_in_bytes")
+		usageFile = d.sys("fs", "cgroup", "memory", cgroupPath, "memory.usage_in_bytes")
+	case v2Path != "":
+		cgroupPath = v2Path
+		limitFile = d.sys("fs", "cgroup", cgroupPath, "memory.max")
+		usageFile = d.sys("fs", "cgroup", cgroupPath, "memory.current")
+	default:
+		return nil
+	}
+
+	limit, ok := readCgroupValue(limitFile)
+	if !ok || limit >= unlimitedCgroup {
+		return nil
+	}
+	usage, _ := readCgroupValue(usageFile)
+	return &protocol.Cgroup{
+		Path:        path.Clean(cgroupPath),
+		LimitBytes:  limit,
+		UsageBytes:  usage,
+		UsedPercent: percent(float64(usage), float64(limit)),
+	}
+}
+
+// readCgroupValue reads a cgroup file holding a number. "max" means no
+// limit and is reported as not ok.
+func readCgroupValue(file string) (int64, bool) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
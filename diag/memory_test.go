@@ -0,0 +1,114 @@
+package diag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const meminfo = `MemTotal:        8000000 kB
+MemFree:          500000 kB
+MemAvailable:    2000000 kB
+Buffers:          100000 kB
+Cached:          1800000 kB
+SwapCached:            0 kB
+AnonPages:       5000000 kB
+Shmem:            200000 kB
+SReclaimable:     150000 kB
+SUnreclaim:        80000 kB
+Dirty:              1200 kB
+SwapTotal:       2000000 kB
+SwapFree:        1500000 kB
+HugePages_Total:       0
+`
+
+func TestParseMeminfo(t *testing.T) {
+	result, err := ParseMeminfo(meminfo)
+	require.NoError(t, err)
+	assert.Equal(t, &protocol.MemoryResult{
+		TotalBytes:             8192000000,
+		UsedBytes:              6144000000,
+		AvailableBytes:         2048000000,
+		FreeBytes:              512000000,
+		UsedPercent:            75,
+		BuffersBytes:           102400000,
+		CachedBytes:            1843200000,
+		ShmemBytes:             204800000,
+		AnonBytes:              5120000000,
+		SlabReclaimableBytes:   153600000,
+		SlabUnreclaimableBytes: 81920000,
+		DirtyBytes:             1228800,
+		SwapTotalBytes:         2048000000,
+		SwapUsedBytes:          512000000,
+	}, result)
+
+	// Kernels without MemAvailable
+	result, err = ParseMeminfo("MemTotal: 1000 kB\nMemFree: 100 kB\nBuffers: 50 kB\nCached: 250 kB\n")
+	require.NoError(t, err)
+	assert.Equal(t, int64(400*1024), result.AvailableBytes)
+
+	_, err = ParseMeminfo("MemFree: 100 kB\n")
+	assert.Error(t, err)
+}
+
+func TestMemoryCgroupV2(t *testing.T) {
+	d := newTestDiagnostics(t, map[string]string{
+		"meminfo":     meminfo,
+		"vmstat":      "pgfault 123\noom_kill 3\n",
+		"self/cgroup": "0::/system.slice/flashduty-runner.service\n",
+	}, map[string]string{
+		"fs/cgroup/system.slice/flashduty-runner.service/memory.max":     "536870912\n",
+		"fs/cgroup/system.slice/flashduty-runner.service/memory.current": "134217728\n",
+	})
+
+	result, err := d.Memory()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), result.OOMKills)
+	assert.Equal(t, &protocol.Cgroup{
+		Path:        "/system.slice/flashduty-runner.service",
+		LimitBytes:  536870912,
+		UsageBytes:  134217728,
+		UsedPercent: 25,
+	}, result.Cgroup)
+}
+
+func TestMemoryCgroupV1(t *testing.T) {
+	d := newTestDiagnostics(t, map[string]string{
+		"meminfo":     meminfo,
+		"self/cgroup": "12:cpu,cpuacct:/docker/abc\n11:memory:/docker/abc\n0::/\n",
+	}, map[string]string{
+		"fs/cgroup/memory/docker/abc/memory.limit_in_bytes": "1073741824\n",
+		"fs/cgroup/memory/docker/abc/memory.usage_in_bytes": "268435456\n",
+	})
+
+	result, err := d.Memory()
+	require.NoError(t, err)
+	require.NotNil(t, result.Cgroup)
+	assert.Equal(t, "/docker/abc", result.Cgroup.Path)
+	assert.Equal(t, int64(1073741824), result.Cgroup.LimitBytes)
+}
+
+func TestMemoryCgroupUnlimited(t *testing.T) {
+	d := newTestDiagnostics(t, map[string]string{
+		"meminfo":     meminfo,
+		"self/cgroup": "0::/user.slice\n",
+	}, map[string]string{
+		"fs/cgroup/user.slice/memory.max": "max\n",
+	})
+	result, err := d.Memory()
+	require.NoError(t, err)
+	assert.Nil(t, result.Cgroup)
+
+	d = newTestDiagnostics(t, map[string]string{
+		"meminfo":     meminfo,
+		"self/cgroup": "4:memory:/\n",
+	}, map[string]string{
+		"fs/cgroup/memory/memory.limit_in_bytes": "9223372036854771712\n",
+	})
+	result, err = d.Memory()
+	require.NoError(t, err)
+	assert.Nil(t, result.Cgroup)
+}
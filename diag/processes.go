@@ -0,0 +1,275 @@
+package diag
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const (
+	// DefaultProcessLimit is the default number of processes returned.
+	DefaultProcessLimit = 50
+	// MaxProcessLimit caps the number of processes returned.
+	MaxProcessLimit = 1000
+	// DefaultSampleMS is the default CPU usage sampling interval.
+	DefaultSampleMS = 500
+	// MaxSampleMS caps the CPU usage sampling interval.
+	MaxSampleMS = 5000
+
+	// clockTicks is USER_HZ, the unit of CPU times in /proc. It is 100 on
+	// all architectures Linux supports.
+	clockTicks = 100
+	// maxCommandLength caps the command line reported for a process.
+	maxCommandLength = 4096
+)
+
+// procStat holds the fields of /proc/<pid>/stat used here.
+type procStat struct {
+	name      string
+	state     string
+	ppid      int
+	ticks     uint64 // utime + stime
+	threads   int
+	startTime uint64 // Ticks after boot
+	rssPages  int64
+}
+
+// parsePIDStat parses /proc/<pid>/stat. The name is in parentheses and may
+// contain spaces and parentheses itself, so fields are split after the last
+// closing parenthesis.
+func parsePIDStat(data string) (procStat, error) {
+	open := strings.IndexByte(data, '(')
+	end := strings.LastIndexByte(data, ')')
+	if open < 0 || end < open {
+		return procStat{}, fmt.Errorf("invalid stat format")
+	}
+	// Fields from state on; field N of proc(5) is at index N-3
+	fields := strings.Fields(data[end+1:])
+	if len(fields) < 22 {
+		return procStat{}, fmt.Errorf("invalid stat format: %d fields", len(fields)+2)
+	}
+
+	nums := make(map[int]int64)
+	for _, i := range []int{1, 11, 12, 17, 19, 21} {
+		v, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil {
+			return procStat{}, fmt.Errorf("invalid stat field %d %q: %w", i+3, fields[i], err)
+		}
+		nums[i] = v
+	}
+	return procStat{
+		name:      data[open+1 : end],
+		state:     fields[0],
+		ppid:      int(nums[1]),
+		ticks:     uint64(nums[11] + nums[12]),
+		threads:   int(nums[17]),
+		startTime: uint64(nums[19]),
+		rssPages:  nums[21],
+	}, nil
+}
+
+// parseStatusUID returns the real user ID from /proc/<pid>/status.
+func parseStatusUID(data string) string {
+	for _, line := range strings.Split(data, "\n") {
+		if rest, ok := strings.CutPrefix(line, "Uid:"); ok {
+			if fields := strings.Fields(rest); len(fields) > 0 {
+				return fields[0]
+			}
+		}
+	}
+	return ""
+}
+
+// parseCmdline joins the NUL-separated arguments of /proc/<pid>/cmdline.
+func parseCmdline(data []byte) string {
+	cmd := strings.TrimRight(string(data), "\x00")
+	cmd = strings.ReplaceAll(cmd, "\x00", " ")
+	if len(cmd) > maxCommandLength {
+		cmd = cmd[:maxCommandLength] + "..."
+	}
+	return cmd
+}
+
+// pids lists the process IDs in /proc.
+func (d *Diagnostics) pids() ([]int, error) {
+	entries, err := os.ReadDir(d.procRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+	var pids []int
+	for _, e := range entries {
+		if pid, err := strconv.Atoi(e.Name()); err == nil && e.IsDir() {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// sampleTicks reads the CPU ticks of every process, keyed by PID and start
+// time so a reused PID is not mistaken for the same process.
+func (d *Diagnostics) sampleTicks(pids []int) map[[2]uint64]uint64 {
+	ticks := make(map[[2]uint64]uint64, len(pids))
+	for _, pid := range pids {
+		data, err := os.ReadFile(d.proc(strconv.Itoa(pid), "stat"))
+		if err != nil {
+			continue
+		}
+		if st, err := parsePIDStat(string(data)); err == nil {
+			ticks[[2]uint64{uint64(pid), st.startTime}] = st.ticks
+		}
+	}
+	return ticks
+}
+
+// Processes lists processes with their CPU and memory usage. CPU usage is
+// measured over a short sampling interval, as top does.
+func (d *Diagnostics) Processes(ctx context.Context, args *protocol.ProcessesArgs) (*protocol.ProcessesResult, error) {
+	if err := d.check(Processes); err != nil {
+		return nil, err
+	}
+	switch args.SortBy {
+	case "", "cpu", "memory", "pid":
+	default:
+		return nil, fmt.Errorf("invalid sort_by %q: use cpu, memory or pid", args.SortBy)
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = DefaultProcessLimit
+	}
+	limit = min(limit, MaxProcessLimit)
+	sampleMS := args.SampleMS
+	if sampleMS <= 0 {
+		sampleMS = DefaultSampleMS
+	}
+	sample := time.Duration(min(sampleMS, MaxSampleMS)) * time.Millisecond
+
+	bootTime, err := d.bootTime()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read boot time: %w", err)
+	}
+	var memTotal int64
+	if data, err := os.ReadFile(d.proc("meminfo")); err == nil {
+		memTotal = parseKeyValues(string(data))["MemTotal"] * 1024
+	}
+	pageSize := int64(os.Getpagesize())
+
+	pids, err := d.pids()
+	if err != nil {
+		return nil, err
+	}
+	before := d.sampleTicks(pids)
+	start := time.Now()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(sample):
+	}
+	if pids, err = d.pids(); err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(start).Seconds() * clockTicks
+
+	filter := strings.ToLower(args.Filter)
+	users := make(map[string]string)
+	processes := make([]protocol.ProcessInfo, 0, len(pids))
+	for _, pid := range pids {
+		dir := strconv.Itoa(pid)
+		data, err := os.ReadFile(d.proc(dir, "stat"))
+		if err != nil {
+			// The process exited
+			continue
+		}
+		st, err := parsePIDStat(string(data))
+		if err != nil {
+			continue
+		}
+		var command string
+		if data, err := os.ReadFile(d.proc(dir, "cmdline")); err == nil {
+			command = parseCmdline(data)
+		}
+		if filter != "" && !strings.Contains(strings.ToLower(st.name), filter) &&
+			!strings.Contains(strings.ToLower(command), filter) {
+			continue
+		}
+
+		var uid string
+		if data, err := os.ReadFile(d.proc(dir, "status")); err == nil {
+			uid = parseStatusUID(string(data))
+		}
+
+		// A process started during the sample used all its ticks in it
+		delta := st.ticks
+		if prev, ok := before[[2]uint64{uint64(pid), st.startTime}]; ok && prev <= st.ticks {
+			delta = st.ticks - prev
+		}
+		rss := st.rssPages * pageSize
+
+		processes = append(processes, protocol.ProcessInfo{
+			PID:           pid,
+			PPID:          st.ppid,
+			User:          lookupUser(users, uid),
+			Name:          st.name,
+			State:         st.state,
+			Command:       command,
+			Threads:       st.threads,
+			CPUPercent:    percent(float64(delta), elapsed),
+			CPUSeconds:    float64(st.ticks) / clockTicks,
+			RSSBytes:      rss,
+			MemoryPercent: percent(float64(rss), float64(memTotal)),
+			StartedAt:     bootTime.Add(time.Duration(st.startTime) * time.Second / clockTicks).UTC().Format(time.RFC3339),
+		})
+	}
+
+	sortProcesses(processes, args.SortBy)
+	total := len(processes)
+	if len(processes) > limit {
+		processes = processes[:limit]
+	}
+	return &protocol.ProcessesResult{Processes: processes, Total: total}, nil
+}
+
+// sortProcesses orders processes by CPU usage, memory usage or PID.
+func sortProcesses(processes []protocol.ProcessInfo, sortBy string) {
+	sort.SliceStable(processes, func(i, j int) bool {
+		a, b := processes[i], processes[j]
+		switch sortBy {
+		case "pid":
+		case "memory":
+			if a.RSSBytes != b.RSSBytes {
+				return a.RSSBytes > b.RSSBytes
+			}
+		default:
+			if a.CPUPercent != b.CPUPercent {
+				return a.CPUPercent > b.CPUPercent
+			}
+			if a.RSSBytes != b.RSSBytes {
+				return a.RSSBytes > b.RSSBytes
+			}
+		}
+		return a.PID < b.PID
+	})
+}
+
+// lookupUser returns the name of a user ID, caching lookups. Unknown users
+// are reported by ID.
+func lookupUser(cache map[string]string, uid string) string {
+	if uid == "" {
+		return ""
+	}
+	if name, ok := cache[uid]; ok {
+		return name
+	}
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	cache[uid] = name
+	return name
+}
@@ -0,0 +1,112 @@
+package diag
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+func TestParsePIDStat(t *testing.T) {
+	st, err := parsePIDStat("1234 (tmux: server (1)) S 1 1234 1234 0 -1 4194560 500 0 0 0 250 130 0 0 20 0 3 0 4500 12345678 2048 18446744073709551615")
+	require.NoError(t, err)
+	assert.Equal(t, procStat{
+		name:      "tmux: server (1)",
+		state:     "S",
+		ppid:      1,
+		ticks:     380,
+		threads:   3,
+		startTime: 4500,
+		rssPages:  2048,
+	}, st)
+
+	_, err = parsePIDStat("1234 (bash) S 1")
+	assert.Error(t, err)
+}
+
+func TestParseCmdline(t *testing.T) {
+	assert.Equal(t, "nginx: worker process", parseCmdline([]byte("nginx: worker process\x00\x00")))
+	assert.Equal(t, "/usr/bin/python3 -m http.server 8080", parseCmdline([]byte("/usr/bin/python3\x00-m\x00http.server\x008080\x00")))
+	assert.Empty(t, parseCmdline(nil))
+}
+
+func TestProcesses(t *testing.T) {
+	d := newTestDiagnostics(t, map[string]string{
+		"stat":         procStatFile,
+		"meminfo":      "MemTotal:        1000000 kB\n",
+		"1/stat":       "1 (systemd) S 0 1 1 0 -1 4194560 0 0 0 0 150 50 0 0 20 0 1 0 5 0 100 0",
+		"1/cmdline":    "/sbin/init\x00splash\x00",
+		"1/status":     "Name:\tsystemd\nUid:\t0\t0\t0\t0\n",
+		"812/stat":     "812 (java) S 1 812 812 0 -1 0 0 0 0 0 90000 10000 0 0 20 0 48 0 360000 0 50000 0",
+		"812/cmdline":  "java\x00-Xmx512m\x00-jar\x00app.jar\x00",
+		"812/status":   "Name:\tjava\nUid:\t4242\t4242\t4242\t4242\n",
+		"2/stat":       "2 (kthreadd) S 0 0 0 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 5 0 0 0",
+		"not-a-pid/x":  "",
+		"999/stat":     "garbage",
+		"999/cmdline":  "",
+		"1000/cmdline": "exited before stat was read",
+	}, nil)
+	pageSize := int64(os.Getpagesize())
+
+	result, err := d.Processes(context.Background(), &protocol.ProcessesArgs{SortBy: "memory", SampleMS: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Total)
+	require.Len(t, result.Processes, 3)
+
+	java := result.Processes[0]
+	assert.Equal(t, 812, java.PID)
+	assert.Equal(t, 1, java.PPID)
+	assert.Equal(t, "4242", java.User)
+	assert.Equal(t, "java -Xmx512m -jar app.jar", java.Command)
+	assert.Equal(t, 48, java.Threads)
+	assert.Equal(t, 1000.0, java.CPUSeconds)
+	assert.Equal(t, 50000*pageSize, java.RSSBytes)
+	assert.Equal(t, percent(float64(50000*pageSize), 1024000000), java.MemoryPercent)
+	// Started an hour after boot
+	assert.Equal(t, "2024-05-14T01:00:00Z", java.StartedAt)
+
+	// Kernel threads have no command line
+	assert.Equal(t, 2, result.Processes[2].PID)
+	assert.Empty(t, result.Processes[2].Command)
+
+	result, err = d.Processes(context.Background(), &protocol.ProcessesArgs{SortBy: "pid", Limit: 1, SampleMS: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Total)
+	require.Len(t, result.Processes, 1)
+	assert.Equal(t, 1, result.Processes[0].PID)
+
+	// Filters match the name or the command line
+	result, err = d.Processes(context.Background(), &protocol.ProcessesArgs{Filter: "APP.JAR", SampleMS: 1})
+	require.NoError(t, err)
+	require.Len(t, result.Processes, 1)
+	assert.Equal(t, "java", result.Processes[0].Name)
+
+	_, err = d.Processes(context.Background(), &protocol.ProcessesArgs{SortBy: "name"})
+	assert.ErrorContains(t, err, "invalid sort_by")
+}
+
+func TestSortProcesses(t *testing.T) {
+	processes := []protocol.ProcessInfo{
+		{PID: 3, CPUPercent: 5, RSSBytes: 10},
+		{PID: 1, CPUPercent: 50, RSSBytes: 1},
+		{PID: 2, CPUPercent: 5, RSSBytes: 20},
+	}
+	sortProcesses(processes, "cpu")
+	assert.Equal(t, []int{1, 2, 3}, pidsOf(processes))
+	sortProcesses(processes, "memory")
+	assert.Equal(t, []int{2, 3, 1}, pidsOf(processes))
+	sortProcesses(processes, "pid")
+	assert.Equal(t, []int{1, 2, 3}, pidsOf(processes))
+}
+
+func pidsOf(processes []protocol.ProcessInfo) []int {
+	pids := make([]int, len(processes))
+	for i, p := range processes {
+		pids[i] = p.PID
+	}
+	return pids
+}
@@ -0,0 +1,163 @@
+package diag
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// Socket states in /proc/net/*: TCP_LISTEN, and TCP_CLOSE which unconnected
+// UDP sockets report.
+const (
+	stateListen = "0A"
+	stateClose  = "07"
+)
+
+// socketEntry is a listening socket read from /proc/net.
+type socketEntry struct {
+	protocol.SocketInfo
+	uid   string
+	inode string
+}
+
+// parseNetSockets parses a /proc/net/{tcp,tcp6,udp,udp6} table and returns
+// the sockets in the given state.
+func parseNetSockets(data, proto, state string) ([]socketEntry, error) {
+	var sockets []socketEntry
+	for i, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) < 10 || fields[3] != state {
+			continue
+		}
+		ip, port, err := parseHexAddr(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s address %q: %w", proto, fields[1], err)
+		}
+		sockets = append(sockets, socketEntry{
+			SocketInfo: protocol.SocketInfo{Protocol: proto, Address: ip.String(), Port: port},
+			uid:        fields[7],
+			inode:      fields[9],
+		})
+	}
+	return sockets, nil
+}
+
+// parseHexAddr parses an address such as "0100007F:1F90". The kernel prints
+// the address as 32-bit words in host byte order, little-endian on the
+// architectures the runner is built for.
+func parseHexAddr(s string) (net.IP, int, error) {
+	addr, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, 0, fmt.Errorf("missing port")
+	}
+	b, err := hex.DecodeString(addr)
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("invalid address")
+	}
+	for i := 0; i < len(b); i += 4 {
+		b[i], b[i+1], b[i+2], b[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid port: %w", err)
+	}
+	return net.IP(b), int(port), nil
+}
+
+// socketOwners maps socket inodes to the processes holding them. Processes
+// of other users are only visible when the runner is privileged.
+func (d *Diagnostics) socketOwners(ctx context.Context) map[string]int {
+	owners := make(map[string]int)
+	pids, err := d.pids()
+	if err != nil {
+		return owners
+	}
+	for _, pid := range pids {
+		if ctx.Err() != nil {
+			break
+		}
+		dir := d.proc(strconv.Itoa(pid), "fd")
+		fds, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(dir, fd.Name()))
+			if err != nil {
+				continue
+			}
+			if inode, ok := strings.CutPrefix(link, "socket:["); ok {
+				owners[strings.TrimSuffix(inode, "]")] = pid
+			}
+		}
+	}
+	return owners
+}
+
+// Sockets lists listening TCP sockets and bound UDP sockets with the
+// processes that own them, as ss -tulpn does.
+func (d *Diagnostics) Sockets(ctx context.Context, args *protocol.SocketsArgs) (*protocol.SocketsResult, error) {
+	if err := d.check(Sockets); err != nil {
+		return nil, err
+	}
+	var tables []string
+	switch args.Protocol {
+	case "":
+		tables = []string{"tcp", "tcp6", "udp", "udp6"}
+	case "tcp", "udp":
+		tables = []string{args.Protocol, args.Protocol + "6"}
+	default:
+		return nil, fmt.Errorf("invalid protocol %q: use tcp or udp", args.Protocol)
+	}
+
+	var entries []socketEntry
+	for _, table := range tables {
+		data, err := os.ReadFile(d.proc("net", table))
+		if os.IsNotExist(err) {
+			// IPv6 disabled
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sockets: %w", err)
+		}
+		state := stateListen
+		if strings.HasPrefix(table, "udp") {
+			state = stateClose
+		}
+		sockets, err := parseNetSockets(string(data), table, state)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, sockets...)
+	}
+
+	owners := d.socketOwners(ctx)
+	users := make(map[string]string)
+	sockets := make([]protocol.SocketInfo, 0, len(entries))
+	for _, e := range entries {
+		info := e.SocketInfo
+		info.User = lookupUser(users, e.uid)
+		if pid, ok := owners[e.inode]; ok {
+			info.PID = pid
+			if data, err := os.ReadFile(d.proc(strconv.Itoa(pid), "comm")); err == nil {
+				info.Process = strings.TrimSpace(string(data))
+			}
+		}
+		sockets = append(sockets, info)
+	}
+	sort.SliceStable(sockets, func(i, j int) bool {
+		if sockets[i].Protocol != sockets[j].Protocol {
+			return sockets[i].Protocol < sockets[j].Protocol
+		}
+		return sockets[i].Port < sockets[j].Port
+	})
+	return &protocol.SocketsResult{Sockets: sockets}, nil
+}
@@ -0,0 +1,83 @@
+package diag
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const procNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 21345 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  4242        0 21346 1 0000000000000000 100 0 0 10 0
+   2: 0A00020F:0050 0B00020F:C350 01 00000000:00000000 02:000A7B3C 00000000     0        0 21347 2 0000000000000000 20 4 30 10 -1
+`
+
+const procNetTCP6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000001000000:0277 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 31001 1 0000000000000000 100 0 0 10 0
+`
+
+const procNetUDP = `   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  512: 3500007F:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000   101        0 18001 2 0000000000000000 0
+`
+
+func TestParseHexAddr(t *testing.T) {
+	ip, port, err := parseHexAddr("0100007F:1F90")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", ip.String())
+	assert.Equal(t, 8080, port)
+
+	ip, port, err = parseHexAddr("B80D0120000000000000000001000000:01BB")
+	require.NoError(t, err)
+	assert.Equal(t, "2001:db8::1", ip.String())
+	assert.Equal(t, 443, port)
+
+	_, _, err = parseHexAddr("0100007F")
+	assert.Error(t, err)
+	_, _, err = parseHexAddr("01007F:0050")
+	assert.Error(t, err)
+}
+
+func TestParseNetSockets(t *testing.T) {
+	sockets, err := parseNetSockets(procNetTCP, "tcp", stateListen)
+	require.NoError(t, err)
+	require.Len(t, sockets, 2)
+	assert.Equal(t, protocol.SocketInfo{Protocol: "tcp", Address: "0.0.0.0", Port: 80}, sockets[0].SocketInfo)
+	assert.Equal(t, "21345", sockets[0].inode)
+	assert.Equal(t, "4242", sockets[1].uid)
+}
+
+func TestSockets(t *testing.T) {
+	d := newTestDiagnostics(t, map[string]string{
+		"net/tcp":    procNetTCP,
+		"net/tcp6":   procNetTCP6,
+		"net/udp":    procNetUDP,
+		"812/comm":   "nginx\n",
+		"812/fd/.ok": "",
+	}, nil)
+	fd := filepath.Join(d.procRoot, "812", "fd")
+	require.NoError(t, os.Symlink("socket:[21345]", filepath.Join(fd, "6")))
+	require.NoError(t, os.Symlink("/var/log/nginx/access.log", filepath.Join(fd, "7")))
+
+	result, err := d.Sockets(context.Background(), &protocol.SocketsArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, []protocol.SocketInfo{
+		{Protocol: "tcp", Address: "0.0.0.0", Port: 80, User: lookupUser(map[string]string{}, "0"), PID: 812, Process: "nginx"},
+		{Protocol: "tcp", Address: "127.0.0.1", Port: 8080, User: "4242"},
+		{Protocol: "tcp6", Address: "::1", Port: 631, User: lookupUser(map[string]string{}, "0")},
+		{Protocol: "udp", Address: "127.0.0.53", Port: 53, User: lookupUser(map[string]string{}, "101")},
+	}, result.Sockets)
+
+	// udp6 is missing when IPv6 is disabled
+	result, err = d.Sockets(context.Background(), &protocol.SocketsArgs{Protocol: "udp"})
+	require.NoError(t, err)
+	require.Len(t, result.Sockets, 1)
+
+	_, err = d.Sockets(context.Background(), &protocol.SocketsArgs{Protocol: "sctp"})
+	assert.ErrorContains(t, err, "invalid protocol")
+}
@@ -0,0 +1,21 @@
+//go:build linux
+
+package diag
+
+import "syscall"
+
+// statFS returns the usage of the filesystem mounted at path.
+func statFS(path string) (fsUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return fsUsage{}, err
+	}
+	return fsUsage{
+		blockSize: int64(st.Bsize),
+		blocks:    int64(st.Blocks),
+		free:      int64(st.Bfree),
+		available: int64(st.Bavail),
+		files:     int64(st.Files),
+		filesFree: int64(st.Ffree),
+	}, nil
+}
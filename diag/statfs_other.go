@@ -0,0 +1,10 @@
+//go:build !linux
+
+package diag
+
+import "errors"
+
+// statFS is only implemented on Linux.
+func statFS(path string) (fsUsage, error) {
+	return fsUsage{}, errors.New("disk usage is only available on Linux")
+}
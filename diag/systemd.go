@@ -0,0 +1,199 @@
+package diag
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// MaxSystemdUnits caps the number of units shown.
+const MaxSystemdUnits = 200
+
+// unitPattern matches unit names passed to systemctl, so they cannot be
+// read as options.
+var unitPattern = regexp.MustCompile(`^[A-Za-z0-9:_.\\@][A-Za-z0-9:_.\\@-]*$`)
+
+// statePattern matches unit states, or a comma-separated list of them.
+var statePattern = regexp.MustCompile(`^[a-z][a-z-]*(?:,[a-z][a-z-]*)*$`)
+
+// unitProperties are the properties read with systemctl show.
+var unitProperties = []string{
+	"Id", "Description", "LoadState", "ActiveState", "SubState", "Result", "MainPID",
+	"ExecMainStatus", "NRestarts", "ActiveEnterTimestamp", "MemoryCurrent",
+	"CPUUsageNSec", "TasksCurrent", "ControlGroup",
+}
+
+// runSystemctl runs systemctl with the given arguments and returns its output.
+// It is not checked against the bash permission rules: enabling the systemd
+// diagnostic allows the read-only list-units and show queries made here.
+func runSystemctl(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "systemctl", append([]string{"--no-pager"}, args...)...)
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("systemctl failed: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("systemctl failed: %w", err)
+	}
+	return out, nil
+}
+
+// Systemd reports the state of systemd units with the CPU, memory and task
+// usage of their cgroups, as systemctl status does.
+func (d *Diagnostics) Systemd(ctx context.Context, args *protocol.SystemdArgs) (*protocol.SystemdResult, error) {
+	if err := d.check(Systemd); err != nil {
+		return nil, err
+	}
+	for _, unit := range args.Units {
+		if !unitPattern.MatchString(unit) {
+			return nil, fmt.Errorf("invalid unit name %q", unit)
+		}
+	}
+	if args.State != "" && !statePattern.MatchString(args.State) {
+		return nil, fmt.Errorf("invalid state %q", args.State)
+	}
+	if len(args.Units) > MaxSystemdUnits {
+		return nil, fmt.Errorf("too many units: %d (max %d)", len(args.Units), MaxSystemdUnits)
+	}
+
+	units := args.Units
+	if len(units) == 0 {
+		state := args.State
+		if state == "" {
+			state = "active,failed"
+		}
+		out, err := d.systemctl(ctx, "list-units", "--type=service", "--all", "--plain", "--no-legend", "--state="+state)
+		if err != nil {
+			return nil, err
+		}
+		units = parseUnitList(string(out))
+		if len(units) > MaxSystemdUnits {
+			units = units[:MaxSystemdUnits]
+		}
+	}
+	result := &protocol.SystemdResult{Units: make([]protocol.SystemdUnit, 0, len(units))}
+	if len(units) == 0 {
+		return result, nil
+	}
+
+	out, err := d.systemctl(ctx, append([]string{"show", "--property=" + strings.Join(unitProperties, ","), "--"}, units...)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, props := range parseUnitProperties(string(out)) {
+		result.Units = append(result.Units, d.systemdUnit(props))
+	}
+	return result, nil
+}
+
+// parseUnitList returns the unit names in systemctl list-units output.
+func parseUnitList(data string) []string {
+	var units []string
+	for _, line := range strings.Split(data, "\n") {
+		// Older versions mark failed units even in plain output
+		fields := strings.Fields(strings.TrimLeft(line, "●* "))
+		if len(fields) > 0 && unitPattern.MatchString(fields[0]) {
+			units = append(units, fields[0])
+		}
+	}
+	return units
+}
+
+// parseUnitProperties parses systemctl show output, in which units are
+// separated by blank lines.
+func parseUnitProperties(data string) []map[string]string {
+	var units []map[string]string
+	var props map[string]string
+	for _, line := range strings.Split(data, "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			props = nil
+			continue
+		}
+		if props == nil {
+			props = make(map[string]string)
+			units = append(units, props)
+		}
+		props[key] = value
+	}
+	return units
+}
+
+// systemdUnit builds a unit from its properties. Usage systemd does not
+// account is read from the unit's cgroup.
+func (d *Diagnostics) systemdUnit(props map[string]string) protocol.SystemdUnit {
+	unit := protocol.SystemdUnit{
+		Name:        props["Id"],
+		Description: props["Description"],
+		LoadState:   props["LoadState"],
+		ActiveState: props["ActiveState"],
+		SubState:    props["SubState"],
+		Result:      props["Result"],
+		MainPID:     int(parseUnitNumber(props["MainPID"])),
+		ExitStatus:  int(parseUnitNumber(props["ExecMainStatus"])),
+		Restarts:    int(parseUnitNumber(props["NRestarts"])),
+		ActiveSince: parseUnitTime(props["ActiveEnterTimestamp"]),
+		MemoryBytes: parseUnitNumber(props["MemoryCurrent"]),
+		CPUSeconds:  float64(parseUnitNumber(props["CPUUsageNSec"])) / 1e9,
+		Tasks:       int(parseUnitNumber(props["TasksCurrent"])),
+	}
+	if unit.Result == "success" {
+		unit.Result = ""
+	}
+
+	cgroup := props["ControlGroup"]
+	if cgroup == "" || unit.ActiveState != "active" {
+		return unit
+	}
+	dir := d.sys("fs", "cgroup", cgroup)
+	if unit.MemoryBytes == 0 {
+		unit.MemoryBytes, _ = readCgroupValue(filepath.Join(dir, "memory.current"))
+	}
+	if unit.CPUSeconds == 0 {
+		if data, err := os.ReadFile(filepath.Join(dir, "cpu.stat")); err == nil {
+			unit.CPUSeconds = float64(parseKeyValues(string(data))["usage_usec"]) / 1e6
+		}
+	}
+	if unit.Tasks == 0 {
+		tasks, _ := readCgroupValue(filepath.Join(dir, "pids.current"))
+		unit.Tasks = int(tasks)
+	}
+	return unit
+}
+
+// parseUnitNumber parses a numeric property. Unset values are reported by
+// systemd as "[not set]" or the maximum uint64, and parse as 0.
+func parseUnitNumber(s string) int64 {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v
+}
+
+// parseUnitTime converts a systemd timestamp such as
+// "Tue 2024-05-14 10:21:33 UTC" to RFC3339. systemd prints times in the
+// local zone; a zone other than that, UTC or GMT has no known offset, and the
+// timestamp is kept as is.
+func parseUnitTime(s string) string {
+	if s == "" || s == "n/a" {
+		return ""
+	}
+	t, err := time.ParseInLocation("Mon 2006-01-02 15:04:05 MST", s, time.Local)
+	if err != nil {
+		return s
+	}
+	// Unknown abbreviations parse in a made-up zone at offset 0
+	if zone, _ := t.Zone(); t.Location() != time.Local && zone != "UTC" && zone != "GMT" {
+		return s
+	}
+	return t.UTC().Format(time.RFC3339)
+}
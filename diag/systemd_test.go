@@ -0,0 +1,134 @@
+package diag
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const unitList = `cron.service          loaded active running Regular background program processing daemon
+● nginx.service       loaded failed failed  A high performance web server
+ssh.service           loaded active running OpenBSD Secure Shell server
+`
+
+const unitShow = `Id=cron.service
+Description=Regular background program processing daemon
+LoadState=loaded
+ActiveState=active
+SubState=running
+Result=success
+MainPID=612
+ExecMainStatus=0
+NRestarts=0
+ActiveEnterTimestamp=Tue 2024-05-14 10:21:33 UTC
+MemoryCurrent=[not set]
+CPUUsageNSec=[not set]
+TasksCurrent=18446744073709551615
+ControlGroup=/system.slice/cron.service
+
+Id=nginx.service
+Description=A high performance web server
+LoadState=loaded
+ActiveState=failed
+SubState=failed
+Result=exit-code
+MainPID=0
+ExecMainStatus=1
+NRestarts=5
+ActiveEnterTimestamp=
+MemoryCurrent=[not set]
+CPUUsageNSec=1500000000
+TasksCurrent=[not set]
+ControlGroup=
+`
+
+func TestParseUnitList(t *testing.T) {
+	assert.Equal(t, []string{"cron.service", "nginx.service", "ssh.service"}, parseUnitList(unitList))
+	assert.Empty(t, parseUnitList(""))
+}
+
+func TestParseUnitTime(t *testing.T) {
+	saved := time.Local
+	time.Local = time.FixedZone("CEST", 2*60*60)
+	t.Cleanup(func() { time.Local = saved })
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Tue 2024-05-14 10:21:33 UTC", "2024-05-14T10:21:33Z"},
+		{"Tue 2024-05-14 10:21:33 GMT", "2024-05-14T10:21:33Z"},
+		{"Tue 2024-05-14 10:21:33 CEST", "2024-05-14T08:21:33Z"},
+		// A zone without a known offset is not read as UTC
+		{"Tue 2024-05-14 10:21:33 JST", "Tue 2024-05-14 10:21:33 JST"},
+		{"n/a", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, parseUnitTime(tt.in), tt.in)
+	}
+}
+
+func TestSystemd(t *testing.T) {
+	d := newTestDiagnostics(t, nil, map[string]string{
+		"fs/cgroup/system.slice/cron.service/memory.current": "2097152\n",
+		"fs/cgroup/system.slice/cron.service/cpu.stat":       "usage_usec 2500000\nuser_usec 2000000\n",
+		"fs/cgroup/system.slice/cron.service/pids.current":   "1\n",
+	})
+	var calls []string
+	d.systemctl = func(_ context.Context, args ...string) ([]byte, error) {
+		calls = append(calls, strings.Join(args, " "))
+		if args[0] == "list-units" {
+			return []byte(unitList), nil
+		}
+		return []byte(unitShow), nil
+	}
+
+	result, err := d.Systemd(context.Background(), &protocol.SystemdArgs{})
+	require.NoError(t, err)
+	require.Len(t, calls, 2)
+	assert.Equal(t, "list-units --type=service --all --plain --no-legend --state=active,failed", calls[0])
+	assert.True(t, strings.HasSuffix(calls[1], "-- cron.service nginx.service ssh.service"))
+
+	require.Len(t, result.Units, 2)
+	assert.Equal(t, protocol.SystemdUnit{
+		Name:        "cron.service",
+		Description: "Regular background program processing daemon",
+		LoadState:   "loaded",
+		ActiveState: "active",
+		SubState:    "running",
+		MainPID:     612,
+		ActiveSince: "2024-05-14T10:21:33Z",
+		MemoryBytes: 2097152,
+		CPUSeconds:  2.5,
+		Tasks:       1,
+	}, result.Units[0])
+	assert.Equal(t, protocol.SystemdUnit{
+		Name:        "nginx.service",
+		Description: "A high performance web server",
+		LoadState:   "loaded",
+		ActiveState: "failed",
+		SubState:    "failed",
+		Result:      "exit-code",
+		ExitStatus:  1,
+		Restarts:    5,
+		CPUSeconds:  1.5,
+	}, result.Units[1])
+
+	calls = nil
+	_, err = d.Systemd(context.Background(), &protocol.SystemdArgs{Units: []string{"nginx.service"}})
+	require.NoError(t, err)
+	require.Len(t, calls, 1)
+	assert.True(t, strings.HasPrefix(calls[0], "show --property=Id,"))
+
+	_, err = d.Systemd(context.Background(), &protocol.SystemdArgs{Units: []string{"--root=/tmp"}})
+	assert.ErrorContains(t, err, "invalid unit name")
+	_, err = d.Systemd(context.Background(), &protocol.SystemdArgs{State: "failed; reboot"})
+	assert.ErrorContains(t, err, "invalid state")
+}
@@ -0,0 +1,134 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// tokenFileRefresh is how often a token file is read again. Projected
+	// service account tokens are rotated well before they expire.
+	tokenFileRefresh = time.Minute
+	// execTimeout bounds a credential plugin run.
+	execTimeout = 30 * time.Second
+)
+
+// authenticator adds credentials to API requests.
+type authenticator interface {
+	authorize(ctx context.Context, req *http.Request) error
+}
+
+// staticToken is a bearer token from the kubeconfig.
+type staticToken string
+
+func (t staticToken) authorize(_ context.Context, req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
+
+// basicAuth is a username and password from the kubeconfig.
+type basicAuth struct {
+	username string
+	password string
+}
+
+func (b basicAuth) authorize(_ context.Context, req *http.Request) error {
+	req.SetBasicAuth(b.username, b.password)
+	return nil
+}
+
+// fileToken is a bearer token read from a file, such as the token of the
+// pod's service account.
+type fileToken struct {
+	path string
+
+	mu     sync.Mutex
+	token  string
+	readAt time.Time
+}
+
+func (t *fileToken) authorize(_ context.Context, req *http.Request) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token == "" || time.Since(t.readAt) > tokenFileRefresh {
+		data, err := os.ReadFile(t.path)
+		if err != nil {
+			return fmt.Errorf("failed to read token: %w", err)
+		}
+		t.token, t.readAt = strings.TrimSpace(string(data)), time.Now()
+	}
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return nil
+}
+
+// execToken is a bearer token from a credential plugin, kept until it
+// expires.
+type execToken struct {
+	config execConfig
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time // Zero when the token does not expire
+}
+
+// execCredential is the output of a credential plugin.
+type execCredential struct {
+	Status *struct {
+		Token               string    `json:"token"`
+		ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+	} `json:"status"`
+}
+
+func (t *execToken) authorize(ctx context.Context, req *http.Request) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token == "" || (!t.expires.IsZero() && time.Now().After(t.expires)) {
+		if err := t.refresh(ctx); err != nil {
+			return err
+		}
+	}
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return nil
+}
+
+// refresh runs the credential plugin.
+func (t *execToken) refresh(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, execTimeout)
+	defer cancel()
+
+	apiVersion := t.config.APIVersion
+	if apiVersion == "" {
+		apiVersion = "client.authentication.k8s.io/v1"
+	}
+	info := fmt.Sprintf(`{"apiVersion":%q,"kind":"ExecCredential","spec":{"interactive":false}}`, apiVersion)
+
+	cmd := exec.CommandContext(ctx, t.config.Command, t.config.Args...)
+	cmd.Env = append(os.Environ(), "KUBERNETES_EXEC_INFO="+info)
+	for _, env := range t.config.Env {
+		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("credential plugin %s failed: %w: %s", t.config.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var cred execCredential
+	if err := json.Unmarshal(out, &cred); err != nil {
+		return fmt.Errorf("invalid credential plugin output: %w", err)
+	}
+	if cred.Status == nil || cred.Status.Token == "" {
+		return fmt.Errorf("credential plugin %s returned no token: client certificates from plugins are not supported", t.config.Command)
+	}
+	t.token, t.expires = cred.Status.Token, cred.Status.ExpirationTimestamp
+	return nil
+}
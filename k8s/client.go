@@ -0,0 +1,235 @@
+// Package k8s implements read-only Kubernetes operations against the API
+// server, without kubectl.
+//
+// A Client reads objects, logs and events with the credentials of a
+// kubeconfig or of the pod's service account. Every request is checked
+// against a Policy of allowed resources and namespaces, and secret values
+// are always masked before results leave the package.
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// requestTimeout bounds a request to the API server.
+	requestTimeout = time.Minute
+	// maxResponseSize caps a response read from the API server.
+	maxResponseSize = 32 << 20
+)
+
+// namePattern matches object names and namespaces, so they cannot change
+// the API path they are placed in. RBAC names such as system:node contain
+// colons.
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._:-]*[A-Za-z0-9])?$`)
+
+// Config selects the cluster to connect to.
+type Config struct {
+	// Kubeconfig file. Default: the pod's service account in a cluster,
+	// then $KUBECONFIG, then ~/.kube/config.
+	Kubeconfig string
+	// Kubeconfig context. Default: the current context.
+	Context string
+}
+
+// Policy limits what the operations may read. Patterns are globs as
+// path.Match accepts them, and "*" matches everything.
+type Policy struct {
+	// Resources such as pods, deployments.apps or pods/log. Empty allows none.
+	Resources []string
+	// Namespaces. Empty allows all.
+	Namespaces []string
+}
+
+// Client reads from a Kubernetes API server.
+type Client struct {
+	server    string
+	namespace string // Default namespace
+	http      *http.Client
+	auth      authenticator
+	policy    Policy
+
+	// Resources found by discovery, for names not in the built-in table
+	discoveryMu sync.Mutex
+	discovered  []resource
+	discoveryAt time.Time
+}
+
+// New returns a client for the cluster selected by cfg.
+func New(cfg Config, policy Policy) (*Client, error) {
+	rc, err := loadConfig(cfg.Kubeconfig, cfg.Context)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(rc, policy), nil
+}
+
+func newClient(rc *restConfig, policy Policy) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = rc.tls
+	return &Client{
+		server:    rc.server,
+		namespace: rc.namespace,
+		http:      &http.Client{Transport: transport, Timeout: requestTimeout},
+		auth:      rc.auth,
+		policy:    policy,
+	}
+}
+
+// Server returns the URL of the API server.
+func (c *Client) Server() string {
+	return c.server
+}
+
+// apiStatus is the error body of the API server.
+type apiStatus struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+}
+
+// get requests path from the API server and returns the response body.
+func (c *Client) get(ctx context.Context, apiPath string, query url.Values, accept string) ([]byte, error) {
+	body, err := c.open(ctx, apiPath, query, accept)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = body.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(body, maxResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if len(data) > maxResponseSize {
+		return nil, fmt.Errorf("response exceeds %d MiB: use a selector or a lower limit", maxResponseSize>>20)
+	}
+	return data, nil
+}
+
+// open requests path from the API server and returns the response body for
+// streaming.
+func (c *Client) open(ctx context.Context, apiPath string, query url.Values, accept string) (io.ReadCloser, error) {
+	u := c.server + apiPath
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if accept == "" {
+		accept = "application/json"
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", "flashduty-runner")
+	if c.auth != nil {
+		if err := c.auth.authorize(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes API request failed: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		defer func() { _ = resp.Body.Close() }()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		var status apiStatus
+		if json.Unmarshal(data, &status) == nil && status.Message != "" {
+			return nil, fmt.Errorf("kubernetes API error (%d %s): %s", resp.StatusCode, status.Reason, status.Message)
+		}
+		return nil, fmt.Errorf("kubernetes API error (%s): %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return resp.Body, nil
+}
+
+// checkResource returns an error unless the policy allows reading the
+// resource, or its subresource when sub is not empty.
+func (c *Client) checkResource(r resource, sub string) error {
+	names := []string{r.name, r.String()}
+	if sub != "" {
+		names = []string{r.name + "/" + sub, r.String() + "/" + sub}
+	}
+	for _, pattern := range c.policy.Resources {
+		for _, name := range names {
+			if matchPattern(pattern, name) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("resource %q is not allowed: add it to permission.kubernetes.resources", names[0])
+}
+
+// allowsNamespace reports whether the policy allows reading a namespace.
+func (c *Client) allowsNamespace(namespace string) bool {
+	if len(c.policy.Namespaces) == 0 {
+		return true
+	}
+	for _, pattern := range c.policy.Namespaces {
+		if matchPattern(pattern, namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// allNamespaces reports whether the policy allows every namespace.
+func (c *Client) allNamespaces() bool {
+	for _, pattern := range c.policy.Namespaces {
+		if pattern == "*" {
+			return true
+		}
+	}
+	return len(c.policy.Namespaces) == 0
+}
+
+// checkName returns an error unless s is a valid object name.
+func checkName(field, s string) error {
+	if !namePattern.MatchString(s) {
+		return fmt.Errorf("invalid %s %q", field, s)
+	}
+	return nil
+}
+
+// checkNamespace returns an error unless the policy allows a namespace.
+func (c *Client) checkNamespace(namespace string) error {
+	if err := checkName("namespace", namespace); err != nil {
+		return err
+	}
+	if !c.allowsNamespace(namespace) {
+		return fmt.Errorf("namespace %q is not allowed: add it to permission.kubernetes.namespaces", namespace)
+	}
+	return nil
+}
+
+// resolveNamespace returns the namespace a request reads: the requested
+// one, or the default namespace of the kubeconfig context.
+func (c *Client) resolveNamespace(namespace string) (string, error) {
+	if namespace == "" {
+		namespace = c.namespace
+	}
+	if err := c.checkNamespace(namespace); err != nil {
+		return "", err
+	}
+	return namespace, nil
+}
+
+// matchPattern matches a policy pattern. "*" also matches subresources.
+func matchPattern(pattern, name string) bool {
+	if pattern == "*" {
+		return true
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
@@ -0,0 +1,65 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// Describe returns an object with the events about it, as kubectl describe
+// shows them. Events are included when the policy allows reading them.
+func (c *Client) Describe(ctx context.Context, args *protocol.K8sDescribeArgs) (*protocol.K8sDescribeResult, error) {
+	if args.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if err := checkName("name", args.Name); err != nil {
+		return nil, err
+	}
+	r, err := c.resolve(ctx, args.Resource)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkResource(r, ""); err != nil {
+		return nil, err
+	}
+	var namespace string
+	if r.namespaced {
+		if namespace, err = c.resolveNamespace(args.Namespace); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := c.get(ctx, r.path(namespace, args.Name), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	obj, err := decodeObject(data)
+	if err != nil {
+		return nil, err
+	}
+	cleanObject(obj, r)
+	result := &protocol.K8sDescribeResult{Object: obj, Events: make([]protocol.K8sEvent, 0)}
+
+	// Events about cluster-scoped objects such as nodes are recorded in the
+	// default namespace
+	eventNamespace := namespace
+	if !r.namespaced {
+		eventNamespace = "default"
+	}
+	if c.checkResource(eventsResource, "") != nil || !c.allowsNamespace(eventNamespace) {
+		return result, nil
+	}
+	selectors := []string{"involvedObject.kind=" + r.kind, "involvedObject.name=" + args.Name}
+	if r.namespaced {
+		selectors = append(selectors, "involvedObject.namespace="+namespace)
+	}
+	events, err := c.listEvents(ctx, eventNamespace, selectors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	for _, e := range events {
+		result.Events = append(result.Events, e.toProtocol())
+	}
+	return result, nil
+}
@@ -0,0 +1,204 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const (
+	// DefaultEventLimit is the default number of events returned.
+	DefaultEventLimit = 100
+	// MaxEventLimit caps the number of events returned.
+	MaxEventLimit = 1000
+)
+
+// eventsResource is the core/v1 events resource.
+var eventsResource, _ = findResource(builtinResources, "events", "", false)
+
+// event is the part of a core/v1 Event the runner reports.
+type event struct {
+	Metadata struct {
+		Namespace         string    `json:"namespace"`
+		CreationTimestamp time.Time `json:"creationTimestamp"`
+	} `json:"metadata"`
+	InvolvedObject struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	} `json:"involvedObject"`
+	Type           string    `json:"type"`
+	Reason         string    `json:"reason"`
+	Message        string    `json:"message"`
+	Count          int       `json:"count"`
+	FirstTimestamp time.Time `json:"firstTimestamp"`
+	LastTimestamp  time.Time `json:"lastTimestamp"`
+	EventTime      time.Time `json:"eventTime"`
+	Series         *struct {
+		Count            int       `json:"count"`
+		LastObservedTime time.Time `json:"lastObservedTime"`
+	} `json:"series"`
+	Source struct {
+		Component string `json:"component"`
+	} `json:"source"`
+	ReportingComponent string `json:"reportingComponent"`
+}
+
+// lastSeen returns when an event last occurred. Events recorded with the
+// events.k8s.io API set eventTime and series instead of timestamps.
+func (e *event) lastSeen() time.Time {
+	switch {
+	case e.Series != nil && !e.Series.LastObservedTime.IsZero():
+		return e.Series.LastObservedTime
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp
+	case !e.EventTime.IsZero():
+		return e.EventTime
+	}
+	return e.Metadata.CreationTimestamp
+}
+
+func (e *event) toProtocol() protocol.K8sEvent {
+	firstSeen := e.FirstTimestamp
+	if firstSeen.IsZero() {
+		firstSeen = e.EventTime
+	}
+	count := e.Count
+	if e.Series != nil && e.Series.Count > count {
+		count = e.Series.Count
+	}
+	source := e.Source.Component
+	if source == "" {
+		source = e.ReportingComponent
+	}
+	return protocol.K8sEvent{
+		Namespace: e.Metadata.Namespace,
+		Type:      e.Type,
+		Reason:    e.Reason,
+		Object:    e.InvolvedObject.Kind + "/" + e.InvolvedObject.Name,
+		Message:   strings.TrimSpace(e.Message),
+		Count:     max(count, 1),
+		FirstSeen: formatTime(firstSeen),
+		LastSeen:  formatTime(e.lastSeen()),
+		Source:    source,
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Events lists events, most recent last, as kubectl events does.
+func (c *Client) Events(ctx context.Context, args *protocol.K8sEventsArgs) (*protocol.K8sEventsResult, error) {
+	if err := c.checkResource(eventsResource, ""); err != nil {
+		return nil, err
+	}
+	if args.Type != "" && args.Type != "Normal" && args.Type != "Warning" {
+		return nil, fmt.Errorf("invalid type %q: use Normal or Warning", args.Type)
+	}
+	since, err := parseSince(args.Since, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = DefaultEventLimit
+	}
+	limit = min(limit, MaxEventLimit)
+
+	var namespace string
+	if !args.AllNamespaces {
+		if namespace, err = c.resolveNamespace(args.Namespace); err != nil {
+			return nil, err
+		}
+	}
+
+	for field, value := range map[string]string{"kind": args.Kind, "name": args.Name} {
+		if value != "" {
+			if err := checkName(field, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var selectors []string
+	if args.Kind != "" {
+		selectors = append(selectors, "involvedObject.kind="+args.Kind)
+	}
+	if args.Name != "" {
+		selectors = append(selectors, "involvedObject.name="+args.Name)
+	}
+	if args.Type != "" {
+		selectors = append(selectors, "type="+args.Type)
+	}
+	events, err := c.listEvents(ctx, namespace, selectors)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &protocol.K8sEventsResult{Events: make([]protocol.K8sEvent, 0)}
+	for _, e := range events {
+		if !since.IsZero() && e.lastSeen().Before(since) {
+			continue
+		}
+		result.Events = append(result.Events, e.toProtocol())
+	}
+	if len(result.Events) > limit {
+		result.Events = result.Events[len(result.Events)-limit:]
+		result.Truncated = true
+	}
+	return result, nil
+}
+
+// listEvents lists the events in a namespace, or in all allowed namespaces
+// when namespace is empty, sorted by when they last occurred.
+func (c *Client) listEvents(ctx context.Context, namespace string, selectors []string) ([]*event, error) {
+	query := url.Values{}
+	if len(selectors) > 0 {
+		query.Set("fieldSelector", strings.Join(selectors, ","))
+	}
+	data, err := c.get(ctx, eventsResource.path(namespace, ""), query, "")
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Items []*event `json:"items"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("invalid API response: %w", err)
+	}
+
+	events := list.Items[:0]
+	for _, e := range list.Items {
+		if namespace != "" || c.allowsNamespace(e.Metadata.Namespace) {
+			events = append(events, e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].lastSeen().Before(events[j].lastSeen())
+	})
+	return events, nil
+}
+
+// parseSince parses an RFC3339 time or a duration before now.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since %q: expected RFC3339 time or duration like 15m", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,291 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const (
+	// DefaultGetLimit is the default number of objects listed.
+	DefaultGetLimit = 100
+	// MaxGetLimit caps the number of objects listed.
+	MaxGetLimit = 500
+
+	// maxFilteredPages caps the pages fetched for a list filtered by namespace.
+	maxFilteredPages = 20
+
+	// tableAccept asks the API server for the columns kubectl get prints.
+	tableAccept = "application/json;as=Table;v=v1;g=meta.k8s.io,application/json"
+)
+
+// table is a meta.k8s.io/v1 Table. Rows include object metadata to filter
+// them by namespace.
+type table struct {
+	Kind              string `json:"kind"`
+	ColumnDefinitions []struct {
+		Name     string `json:"name"`
+		Priority int    `json:"priority"`
+	} `json:"columnDefinitions"`
+	Rows     []tableRow `json:"rows"`
+	Metadata struct {
+		Continue string `json:"continue"`
+	} `json:"metadata"`
+}
+
+type tableRow struct {
+	Cells  []any `json:"cells"`
+	Object struct {
+		Metadata struct {
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+	} `json:"object"`
+}
+
+// Get lists objects of a resource, or gets one by name, as kubectl get
+// does. Listing all namespaces only returns objects in allowed namespaces.
+func (c *Client) Get(ctx context.Context, args *protocol.K8sGetArgs) (*protocol.K8sGetResult, error) {
+	r, err := c.resolve(ctx, args.Resource)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkResource(r, ""); err != nil {
+		return nil, err
+	}
+	output := args.Output
+	if output == "" {
+		output = "table"
+		if args.Name != "" {
+			output = "object"
+		}
+	}
+	if output != "table" && output != "object" {
+		return nil, fmt.Errorf("invalid output %q: use table or object", args.Output)
+	}
+	if args.Name != "" {
+		if err := checkName("name", args.Name); err != nil {
+			return nil, err
+		}
+	}
+	if args.Name != "" && args.AllNamespaces {
+		return nil, fmt.Errorf("name cannot be combined with all_namespaces")
+	}
+
+	var namespace string
+	filter := false // Whether listed objects are filtered by namespace
+	allNamespaces := r.namespaced && args.AllNamespaces
+	if r.namespaced && !allNamespaces {
+		if namespace, err = c.resolveNamespace(args.Namespace); err != nil {
+			return nil, err
+		}
+	} else if allNamespaces {
+		filter = !c.allNamespaces()
+	}
+
+	limit := args.Limit
+	if limit <= 0 {
+		limit = DefaultGetLimit
+	}
+	limit = min(limit, MaxGetLimit)
+
+	query := url.Values{}
+	if args.Name == "" {
+		if args.LabelSelector != "" {
+			query.Set("labelSelector", args.LabelSelector)
+		}
+		if args.FieldSelector != "" {
+			query.Set("fieldSelector", args.FieldSelector)
+		}
+		if filter {
+			// Filtered lists are paged and limited after filtering
+			query.Set("limit", strconv.Itoa(MaxGetLimit))
+		} else {
+			query.Set("limit", strconv.Itoa(limit))
+		}
+	}
+	accept := ""
+	if output == "table" {
+		accept = tableAccept
+		query.Set("includeObject", "Metadata")
+	}
+
+	apiPath := r.path(namespace, args.Name)
+	data, err := c.get(ctx, apiPath, query, accept)
+	if err != nil {
+		return nil, err
+	}
+	var t table
+	if output == "table" && json.Unmarshal(data, &t) == nil && t.Kind == "Table" {
+		if filter {
+			if err := c.pageTable(ctx, apiPath, query, accept, &t, limit); err != nil {
+				return nil, err
+			}
+		}
+		return c.tableResult(r, &t, allNamespaces, filter, limit), nil
+	}
+
+	// Object output, or an API server that does not serve tables
+	obj, err := decodeObject(data)
+	if err != nil {
+		return nil, err
+	}
+	if filter {
+		if err := c.pageObjects(ctx, apiPath, query, accept, obj, limit); err != nil {
+			return nil, err
+		}
+	}
+	result := &protocol.K8sGetResult{Kind: r.kind}
+	if args.Name != "" {
+		cleanObject(obj, r)
+		result.Objects = []any{obj}
+		return result, nil
+	}
+	items, _ := obj["items"].([]any)
+	for _, item := range items {
+		o, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		if filter && !c.allowsNamespace(objectNamespace(o)) {
+			continue
+		}
+		if len(result.Objects) == limit {
+			result.Truncated = true
+			break
+		}
+		cleanObject(o, r)
+		result.Objects = append(result.Objects, o)
+	}
+	if listContinue(obj) != "" {
+		result.Truncated = true
+	}
+	return result, nil
+}
+
+// pageTable fetches the pages following t until it holds more than limit rows
+// in allowed namespaces or the list ends. Other rows are dropped as pages
+// arrive.
+func (c *Client) pageTable(ctx context.Context, apiPath string, query url.Values, accept string, t *table, limit int) error {
+	for pages := 1; ; pages++ {
+		t.Rows = slices.DeleteFunc(t.Rows, func(row tableRow) bool {
+			return !c.allowsNamespace(row.Object.Metadata.Namespace)
+		})
+		if t.Metadata.Continue == "" || len(t.Rows) > limit || pages == maxFilteredPages {
+			return nil
+		}
+
+		query.Set("continue", t.Metadata.Continue)
+		data, err := c.get(ctx, apiPath, query, accept)
+		if err != nil {
+			return err
+		}
+		var page table
+		if err := json.Unmarshal(data, &page); err != nil {
+			return fmt.Errorf("invalid API response: %w", err)
+		}
+		t.Rows = append(t.Rows, page.Rows...)
+		t.Metadata.Continue = page.Metadata.Continue
+	}
+}
+
+// pageObjects is pageTable for a list of objects.
+func (c *Client) pageObjects(ctx context.Context, apiPath string, query url.Values, accept string, obj map[string]any, limit int) error {
+	for pages := 1; ; pages++ {
+		items, _ := obj["items"].([]any)
+		items = slices.DeleteFunc(items, func(item any) bool {
+			o, ok := item.(map[string]any)
+			return !ok || !c.allowsNamespace(objectNamespace(o))
+		})
+		obj["items"] = items
+		token := listContinue(obj)
+		if token == "" || len(items) > limit || pages == maxFilteredPages {
+			return nil
+		}
+
+		query.Set("continue", token)
+		data, err := c.get(ctx, apiPath, query, accept)
+		if err != nil {
+			return err
+		}
+		page, err := decodeObject(data)
+		if err != nil {
+			return err
+		}
+		next, _ := page["items"].([]any)
+		obj["items"] = append(items, next...)
+		obj["metadata"] = page["metadata"]
+	}
+}
+
+// tableResult returns the columns kubectl get prints by default, with the
+// namespace first when listing all namespaces.
+func (c *Client) tableResult(r resource, t *table, allNamespaces, filter bool, limit int) *protocol.K8sGetResult {
+	result := &protocol.K8sGetResult{Kind: r.kind, Rows: make([][]any, 0, len(t.Rows))}
+	var columns []int
+	if allNamespaces {
+		result.Columns = append(result.Columns, "Namespace")
+	}
+	for i, col := range t.ColumnDefinitions {
+		// Higher priorities are shown by kubectl get -o wide
+		if col.Priority == 0 {
+			columns = append(columns, i)
+			result.Columns = append(result.Columns, col.Name)
+		}
+	}
+
+	for _, row := range t.Rows {
+		namespace := row.Object.Metadata.Namespace
+		if filter && !c.allowsNamespace(namespace) {
+			continue
+		}
+		if len(result.Rows) == limit {
+			result.Truncated = true
+			break
+		}
+		var cells []any
+		if allNamespaces {
+			cells = append(cells, namespace)
+		}
+		for _, i := range columns {
+			if i < len(row.Cells) {
+				cells = append(cells, row.Cells[i])
+			}
+		}
+		result.Rows = append(result.Rows, cells)
+	}
+	if t.Metadata.Continue != "" {
+		result.Truncated = true
+	}
+	return result
+}
+
+// decodeObject decodes a JSON object, keeping numbers as they are.
+func decodeObject(data []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("invalid API response: %w", err)
+	}
+	return obj, nil
+}
+
+// listContinue returns the token for the next page of a list.
+func listContinue(obj map[string]any) string {
+	metadata, _ := obj["metadata"].(map[string]any)
+	token, _ := metadata["continue"].(string)
+	return token
+}
+
+// objectNamespace returns the namespace in an object's metadata.
+func objectNamespace(obj map[string]any) string {
+	metadata, _ := obj["metadata"].(map[string]any)
+	namespace, _ := metadata["namespace"].(string)
+	return namespace
+}
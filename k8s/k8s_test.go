@@ -0,0 +1,402 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const testToken = "test-token"
+
+// fakeAPIServer serves canned responses keyed by path, and a Table for
+// paths in tables when the client asks for one.
+type fakeAPIServer struct {
+	objects  map[string]string
+	tables   map[string]string
+	requests []*http.Request
+}
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests = append(f.requests, r)
+	// Later pages of a list are keyed by path and continue token
+	key := r.URL.Path
+	if token := r.URL.Query().Get("continue"); token != "" {
+		key += "?continue=" + token
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"kind":"Status","reason":"Unauthorized","message":"Unauthorized"}`))
+		return
+	}
+	if body, ok := f.tables[key]; ok && strings.Contains(r.Header.Get("Accept"), "as=Table") {
+		_, _ = w.Write([]byte(body))
+		return
+	}
+	body, ok := f.objects[key]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"kind":"Status","reason":"NotFound","message":"the server could not find the requested resource"}`))
+		return
+	}
+	_, _ = w.Write([]byte(body))
+}
+
+// lastQuery returns the query of the last request to path.
+func (f *fakeAPIServer) lastQuery(path string) map[string]string {
+	for i := len(f.requests) - 1; i >= 0; i-- {
+		if f.requests[i].URL.Path == path {
+			query := make(map[string]string)
+			for k, v := range f.requests[i].URL.Query() {
+				query[k] = v[0]
+			}
+			return query
+		}
+	}
+	return nil
+}
+
+func newFakeAPIServer() *fakeAPIServer {
+	return &fakeAPIServer{
+		objects: map[string]string{
+			"/api/v1/namespaces/default/pods": `{"kind":"PodList","apiVersion":"v1","metadata":{},"items":[
+				{"metadata":{"name":"web-1","namespace":"default","managedFields":[{"manager":"kubectl"}]},"status":{"phase":"Running"}},
+				{"metadata":{"name":"web-2","namespace":"default"},"status":{"phase":"Pending"}}]}`,
+			"/api/v1/namespaces/default/pods/web-1": `{"kind":"Pod","apiVersion":"v1","metadata":{"name":"web-1","namespace":"default","uid":"u1"},
+				"spec":{"containers":[{"name":"web","resources":{"limits":{"memory":"536870912"}}}]},"status":{"phase":"Running","restartCount":12345678901234}}`,
+			"/api/v1/pods": `{"kind":"PodList","apiVersion":"v1","metadata":{},"items":[
+				{"metadata":{"name":"web-1","namespace":"default"}},
+				{"metadata":{"name":"etcd-0","namespace":"kube-system"}},
+				{"metadata":{"name":"api-0","namespace":"prod-eu"}}]}`,
+			"/api/v1/namespaces/default/secrets/db": `{"kind":"Secret","apiVersion":"v1","type":"Opaque",
+				"metadata":{"name":"db","namespace":"default","annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{\"data\":{\"password\":\"aHVudGVyMg==\"}}","team":"sre"}},
+				"data":{"password":"aHVudGVyMg==","username":"YWRtaW4="},"stringData":{"token":"plain"}}`,
+			"/api/v1/namespaces/default/secrets": `{"kind":"SecretList","apiVersion":"v1","metadata":{},"items":[
+				{"metadata":{"name":"db","namespace":"default"},"data":{"password":"aHVudGVyMg=="}}]}`,
+			"/api/v1/nodes/node-1":                      `{"kind":"Node","apiVersion":"v1","metadata":{"name":"node-1"}}`,
+			"/api/v1/namespaces/default/pods/web-1/log": "line 1\nline 2\nline 3\n",
+			"/api/v1/namespaces/default/events": `{"kind":"EventList","apiVersion":"v1","metadata":{},"items":[
+				{"metadata":{"namespace":"default","creationTimestamp":"2024-05-14T10:00:00Z"},"involvedObject":{"kind":"Pod","name":"web-1"},
+				 "type":"Warning","reason":"BackOff","message":"Back-off restarting failed container\n","count":12,
+				 "firstTimestamp":"2024-05-14T09:00:00Z","lastTimestamp":"2024-05-14T10:00:00Z","source":{"component":"kubelet"}},
+				{"metadata":{"namespace":"default","creationTimestamp":"2024-05-14T08:00:00Z"},"involvedObject":{"kind":"Pod","name":"web-1"},
+				 "type":"Normal","reason":"Scheduled","message":"Successfully assigned default/web-1 to node-1",
+				 "eventTime":"2024-05-14T08:00:00.000000Z","reportingComponent":"default-scheduler"}]}`,
+			"/apis": `{"kind":"APIGroupList","groups":[{"name":"monitoring.coreos.com","preferredVersion":{"groupVersion":"monitoring.coreos.com/v1","version":"v1"}}]}`,
+			"/apis/monitoring.coreos.com/v1": `{"kind":"APIResourceList","resources":[
+				{"name":"prometheusrules","singularName":"prometheusrule","namespaced":true,"kind":"PrometheusRule","shortNames":["promrule"]},
+				{"name":"prometheusrules/status","namespaced":true,"kind":"PrometheusRule"}]}`,
+			"/apis/monitoring.coreos.com/v1/namespaces/default/prometheusrules": `{"kind":"PrometheusRuleList","metadata":{"continue":"abc"},"items":[
+				{"metadata":{"name":"alerts","namespace":"default"}}]}`,
+		},
+		tables: map[string]string{
+			"/api/v1/namespaces/default/pods": `{"kind":"Table","apiVersion":"meta.k8s.io/v1","metadata":{},
+				"columnDefinitions":[{"name":"Name","priority":0},{"name":"Ready","priority":0},{"name":"Status","priority":0},{"name":"IP","priority":1}],
+				"rows":[{"cells":["web-1","1/1","Running","10.0.0.1"],"object":{"metadata":{"name":"web-1","namespace":"default"}}},
+				        {"cells":["web-2","0/1","Pending","10.0.0.2"],"object":{"metadata":{"name":"web-2","namespace":"default"}}}]}`,
+			"/api/v1/pods": `{"kind":"Table","apiVersion":"meta.k8s.io/v1","metadata":{},
+				"columnDefinitions":[{"name":"Name","priority":0},{"name":"Status","priority":0}],
+				"rows":[{"cells":["web-1","Running"],"object":{"metadata":{"namespace":"default"}}},
+				        {"cells":["etcd-0","Running"],"object":{"metadata":{"namespace":"kube-system"}}},
+				        {"cells":["api-0","Running"],"object":{"metadata":{"namespace":"prod-eu"}}}]}`,
+		},
+	}
+}
+
+// newTestClient returns a client of a fake API server with the given policy.
+func newTestClient(t *testing.T, policy Policy) (*Client, *fakeAPIServer) {
+	t.Helper()
+	fake := newFakeAPIServer()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	c := newClient(&restConfig{server: srv.URL, namespace: "default", auth: staticToken(testToken)}, policy)
+	return c, fake
+}
+
+var allowAll = Policy{Resources: []string{"*"}}
+
+// toJSON marshals v for comparing results as the cloud receives them.
+func toJSON(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestGetTable(t *testing.T) {
+	c, fake := newTestClient(t, allowAll)
+
+	result, err := c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "po", LabelSelector: "app=web"})
+	require.NoError(t, err)
+	assert.Equal(t, "Pod", result.Kind)
+	// Columns shown only by -o wide are dropped
+	assert.Equal(t, []string{"Name", "Ready", "Status"}, result.Columns)
+	assert.Equal(t, [][]any{{"web-1", "1/1", "Running"}, {"web-2", "0/1", "Pending"}}, result.Rows)
+	assert.Equal(t, map[string]string{"labelSelector": "app=web", "limit": "100", "includeObject": "Metadata"},
+		fake.lastQuery("/api/v1/namespaces/default/pods"))
+
+	result, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods", Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, result.Rows, 1)
+	assert.True(t, result.Truncated)
+}
+
+func TestGetAllNamespaces(t *testing.T) {
+	c, fake := newTestClient(t, Policy{Resources: []string{"pods"}, Namespaces: []string{"default", "prod-*"}})
+
+	result, err := c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods", AllNamespaces: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Namespace", "Name", "Status"}, result.Columns)
+	// kube-system is not allowed
+	assert.Equal(t, [][]any{{"default", "web-1", "Running"}, {"prod-eu", "api-0", "Running"}}, result.Rows)
+	// Filtered lists are paged and limited after filtering
+	assert.Equal(t, "500", fake.lastQuery("/api/v1/pods")["limit"])
+
+	result, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods", AllNamespaces: true, Output: "object"})
+	require.NoError(t, err)
+	require.Len(t, result.Objects, 2)
+	assert.Equal(t, "prod-eu", objectNamespace(result.Objects[1].(map[string]any)))
+
+	_, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods", Namespace: "kube-system"})
+	assert.ErrorContains(t, err, `namespace "kube-system" is not allowed`)
+}
+
+func TestGetAllNamespacesPaged(t *testing.T) {
+	c, fake := newTestClient(t, Policy{Resources: []string{"pods"}, Namespaces: []string{"default", "prod-*"}})
+	row := func(name, namespace string) string {
+		return `{"cells":["` + name + `"],"object":{"metadata":{"namespace":"` + namespace + `"}}}`
+	}
+	page := func(token string, rows ...string) string {
+		return `{"kind":"Table","metadata":{"continue":"` + token + `"},"columnDefinitions":[{"name":"Name","priority":0}],"rows":[` + strings.Join(rows, ",") + `]}`
+	}
+	fake.tables["/api/v1/pods"] = page("p2", row("etcd-0", "kube-system"), row("dns-0", "kube-system"))
+	fake.tables["/api/v1/pods?continue=p2"] = page("p3", row("web-1", "default"))
+	fake.tables["/api/v1/pods?continue=p3"] = page("", row("proxy-0", "kube-system"), row("api-0", "prod-eu"))
+
+	result, err := c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods", AllNamespaces: true})
+	require.NoError(t, err)
+	assert.Equal(t, [][]any{{"default", "web-1"}, {"prod-eu", "api-0"}}, result.Rows)
+	assert.False(t, result.Truncated)
+	assert.Len(t, fake.requests, 3)
+
+	// Paging stops once more rows than the limit are allowed
+	fake.requests = nil
+	result, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods", AllNamespaces: true, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, [][]any{{"default", "web-1"}}, result.Rows)
+	assert.True(t, result.Truncated)
+	assert.Len(t, fake.requests, 3)
+
+	fake.objects["/api/v1/pods"] = `{"kind":"PodList","metadata":{"continue":"p2"},"items":[{"metadata":{"name":"etcd-0","namespace":"kube-system"}}]}`
+	fake.objects["/api/v1/pods?continue=p2"] = `{"kind":"PodList","metadata":{},"items":[{"metadata":{"name":"web-1","namespace":"default"}}]}`
+	result, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods", AllNamespaces: true, Output: "object"})
+	require.NoError(t, err)
+	require.Len(t, result.Objects, 1)
+	assert.Equal(t, "default", objectNamespace(result.Objects[0].(map[string]any)))
+	assert.False(t, result.Truncated)
+}
+
+func TestGetObject(t *testing.T) {
+	c, _ := newTestClient(t, allowAll)
+
+	result, err := c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pod", Name: "web-1"})
+	require.NoError(t, err)
+	require.Len(t, result.Objects, 1)
+	// Large numbers are kept exactly
+	assert.Contains(t, toJSON(t, result.Objects[0]), `"restartCount":12345678901234`)
+
+	result, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods", Output: "object"})
+	require.NoError(t, err)
+	require.Len(t, result.Objects, 2)
+	assert.NotContains(t, toJSON(t, result.Objects), "managedFields")
+
+	// Cluster-scoped resources ignore the namespace
+	result, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "nodes", Name: "node-1", Namespace: "kube-system"})
+	require.NoError(t, err)
+	assert.Equal(t, "Node", result.Kind)
+
+	_, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods", Name: "web-9"})
+	assert.ErrorContains(t, err, "kubernetes API error (404 NotFound)")
+	_, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods", Name: "../secrets/db"})
+	assert.ErrorContains(t, err, "invalid name")
+	_, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods", Output: "yaml"})
+	assert.ErrorContains(t, err, "invalid output")
+}
+
+func TestGetSecretRedacted(t *testing.T) {
+	c, _ := newTestClient(t, allowAll)
+
+	result, err := c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "secret", Name: "db"})
+	require.NoError(t, err)
+	out := toJSON(t, result.Objects)
+	assert.NotContains(t, out, "aHVudGVyMg==")
+	assert.NotContains(t, out, "plain")
+	assert.Contains(t, out, `"password":"[REDACTED:secret]"`)
+	assert.Contains(t, out, `"username":"[REDACTED:secret]"`)
+	assert.Contains(t, out, `"team":"sre"`)
+
+	result, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "secrets", Output: "object"})
+	require.NoError(t, err)
+	assert.NotContains(t, toJSON(t, result.Objects), "aHVudGVyMg==")
+}
+
+func TestResourcePolicy(t *testing.T) {
+	c, _ := newTestClient(t, Policy{Resources: []string{"pods", "deployments.apps"}})
+
+	_, err := c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods"})
+	require.NoError(t, err)
+	require.NoError(t, c.checkResource(mustResolve(t, c, "deploy"), ""))
+	_, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "secrets"})
+	assert.ErrorContains(t, err, `resource "secrets" is not allowed`)
+	// Logs are allowed separately
+	_, err = c.Logs(context.Background(), &protocol.K8sLogsArgs{Pod: "web-1"})
+	assert.ErrorContains(t, err, `resource "pods/log" is not allowed`)
+
+	c, _ = newTestClient(t, Policy{})
+	_, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods"})
+	assert.ErrorContains(t, err, "permission.kubernetes.resources")
+}
+
+func mustResolve(t *testing.T, c *Client, name string) resource {
+	t.Helper()
+	r, err := c.resolve(context.Background(), name)
+	require.NoError(t, err)
+	return r
+}
+
+func TestResolve(t *testing.T) {
+	c, _ := newTestClient(t, allowAll)
+
+	r := mustResolve(t, c, "deploy")
+	assert.Equal(t, "deployments.apps", r.String())
+	assert.Equal(t, "/apis/apps/v1/namespaces/prod/deployments/web", r.path("prod", "web"))
+	assert.Equal(t, "/api/v1/nodes", mustResolve(t, c, "Nodes").path("prod", ""))
+	assert.Equal(t, "ingresses.networking.k8s.io", mustResolve(t, c, "ingresses.networking.k8s.io").String())
+
+	// Custom resources are discovered
+	r = mustResolve(t, c, "promrule")
+	assert.Equal(t, "prometheusrules.monitoring.coreos.com", r.String())
+	assert.True(t, r.namespaced)
+	result, err := c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "prometheusrule", Output: "object"})
+	require.NoError(t, err)
+	assert.Len(t, result.Objects, 1)
+	assert.True(t, result.Truncated)
+
+	_, err = c.resolve(context.Background(), "widgets")
+	assert.ErrorContains(t, err, `unknown resource "widgets"`)
+	_, err = c.resolve(context.Background(), "deployments.extensions")
+	assert.Error(t, err)
+}
+
+func TestDescribe(t *testing.T) {
+	c, fake := newTestClient(t, allowAll)
+
+	result, err := c.Describe(context.Background(), &protocol.K8sDescribeArgs{Resource: "pods", Name: "web-1"})
+	require.NoError(t, err)
+	assert.Contains(t, toJSON(t, result.Object), `"name":"web-1"`)
+	require.Len(t, result.Events, 2)
+	assert.Equal(t, "Scheduled", result.Events[0].Reason)
+	assert.Equal(t, map[string]string{"fieldSelector": "involvedObject.kind=Pod,involvedObject.name=web-1,involvedObject.namespace=default"},
+		fake.lastQuery("/api/v1/namespaces/default/events"))
+
+	// Events are left out when they are not allowed
+	c, _ = newTestClient(t, Policy{Resources: []string{"pods"}})
+	result, err = c.Describe(context.Background(), &protocol.K8sDescribeArgs{Resource: "pods", Name: "web-1"})
+	require.NoError(t, err)
+	assert.Empty(t, result.Events)
+
+	_, err = c.Describe(context.Background(), &protocol.K8sDescribeArgs{Resource: "pods"})
+	assert.ErrorContains(t, err, "name is required")
+}
+
+func TestLogs(t *testing.T) {
+	c, fake := newTestClient(t, Policy{Resources: []string{"pods/log"}})
+
+	result, err := c.Logs(context.Background(), &protocol.K8sLogsArgs{Pod: "web-1", Container: "web", Previous: true, Since: "15m"})
+	require.NoError(t, err)
+	assert.Equal(t, &protocol.K8sLogsResult{Output: "line 1\nline 2\nline 3\n", Lines: 3}, result)
+	assert.Equal(t, map[string]string{"tailLines": "200", "container": "web", "previous": "true", "sinceSeconds": "900"},
+		fake.lastQuery("/api/v1/namespaces/default/pods/web-1/log"))
+
+	_, err = c.Logs(context.Background(), &protocol.K8sLogsArgs{Pod: "web-1", Since: "recently"})
+	assert.ErrorContains(t, err, "invalid since")
+}
+
+func TestReadTail(t *testing.T) {
+	out, truncated, err := readTail(strings.NewReader("first line\nsecond line\nthird\n"), 14)
+	require.NoError(t, err)
+	assert.True(t, truncated)
+	assert.Equal(t, "third\n", out)
+
+	long := strings.Repeat("0123456789\n", 10000)
+	out, truncated, err = readTail(strings.NewReader(long), 1000)
+	require.NoError(t, err)
+	assert.True(t, truncated)
+	assert.LessOrEqual(t, len(out), 1000)
+	assert.True(t, strings.HasPrefix(out, "0123456789\n"))
+
+	out, truncated, err = readTail(strings.NewReader("short\n"), 1000)
+	require.NoError(t, err)
+	assert.False(t, truncated)
+	assert.Equal(t, "short\n", out)
+}
+
+func TestEvents(t *testing.T) {
+	c, fake := newTestClient(t, Policy{Resources: []string{"events"}})
+
+	result, err := c.Events(context.Background(), &protocol.K8sEventsArgs{})
+	require.NoError(t, err)
+	require.Len(t, result.Events, 2)
+	assert.Equal(t, protocol.K8sEvent{
+		Namespace: "default",
+		Type:      "Normal",
+		Reason:    "Scheduled",
+		Object:    "Pod/web-1",
+		Message:   "Successfully assigned default/web-1 to node-1",
+		Count:     1,
+		FirstSeen: "2024-05-14T08:00:00Z",
+		LastSeen:  "2024-05-14T08:00:00Z",
+		Source:    "default-scheduler",
+	}, result.Events[0])
+	assert.Equal(t, protocol.K8sEvent{
+		Namespace: "default",
+		Type:      "Warning",
+		Reason:    "BackOff",
+		Object:    "Pod/web-1",
+		Message:   "Back-off restarting failed container",
+		Count:     12,
+		FirstSeen: "2024-05-14T09:00:00Z",
+		LastSeen:  "2024-05-14T10:00:00Z",
+		Source:    "kubelet",
+	}, result.Events[1])
+
+	result, err = c.Events(context.Background(), &protocol.K8sEventsArgs{Type: "Warning", Kind: "Pod", Name: "web-1", Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"fieldSelector": "involvedObject.kind=Pod,involvedObject.name=web-1,type=Warning"},
+		fake.lastQuery("/api/v1/namespaces/default/events"))
+	assert.Len(t, result.Events, 1)
+	assert.True(t, result.Truncated)
+
+	result, err = c.Events(context.Background(), &protocol.K8sEventsArgs{Since: "2024-05-14T09:30:00Z"})
+	require.NoError(t, err)
+	require.Len(t, result.Events, 1)
+	assert.Equal(t, "BackOff", result.Events[0].Reason)
+
+	_, err = c.Events(context.Background(), &protocol.K8sEventsArgs{Type: "Error"})
+	assert.ErrorContains(t, err, "invalid type")
+}
+
+func TestUnauthorized(t *testing.T) {
+	c, _ := newTestClient(t, allowAll)
+	c.auth = staticToken("wrong")
+	_, err := c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods"})
+	assert.ErrorContains(t, err, "kubernetes API error (401 Unauthorized): Unauthorized")
+}
@@ -0,0 +1,285 @@
+package k8s
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// serviceAccountDir holds the service account files mounted into every pod.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeconfig is the part of a kubeconfig file the runner uses.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+			TLSServerName            string `yaml:"tls-server-name"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string   `yaml:"name"`
+		User authInfo `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// authInfo holds the credentials of a kubeconfig user.
+type authInfo struct {
+	Token                 string      `yaml:"token"`
+	TokenFile             string      `yaml:"tokenFile"`
+	ClientCertificate     string      `yaml:"client-certificate"`
+	ClientCertificateData string      `yaml:"client-certificate-data"`
+	ClientKey             string      `yaml:"client-key"`
+	ClientKeyData         string      `yaml:"client-key-data"`
+	Username              string      `yaml:"username"`
+	Password              string      `yaml:"password"`
+	Exec                  *execConfig `yaml:"exec"`
+	AuthProvider          *struct {
+		Name   string            `yaml:"name"`
+		Config map[string]string `yaml:"config"`
+	} `yaml:"auth-provider"`
+}
+
+// execConfig runs a credential plugin, such as aws eks get-token or
+// gke-gcloud-auth-plugin, to get a token.
+type execConfig struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Command    string   `yaml:"command"`
+	Args       []string `yaml:"args"`
+	Env        []struct {
+		Name  string `yaml:"name"`
+		Value string `yaml:"value"`
+	} `yaml:"env"`
+}
+
+// restConfig describes how to reach and authenticate to an API server.
+type restConfig struct {
+	server    string
+	namespace string // Default namespace
+	tls       *tls.Config
+	auth      authenticator
+}
+
+// loadConfig returns the API server configuration from a kubeconfig file,
+// or from the service account of the pod the runner runs in when path is
+// empty and the runner runs in a cluster. Otherwise the file defaults to
+// $KUBECONFIG, then ~/.kube/config.
+func loadConfig(path, context string) (*restConfig, error) {
+	if path == "" {
+		if host := os.Getenv("KUBERNETES_SERVICE_HOST"); host != "" && context == "" {
+			return inClusterConfig(host, os.Getenv("KUBERNETES_SERVICE_PORT"), serviceAccountDir)
+		}
+		path = os.Getenv("KUBECONFIG")
+		if i := strings.IndexRune(path, filepath.ListSeparator); i >= 0 {
+			// Merging several files is not supported; use the first
+			path = path[:i]
+		}
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("no kubeconfig: %w", err)
+		}
+		path = filepath.Join(home, ".kube", "config")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+	var kc kubeconfig
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig %s: %w", path, err)
+	}
+	return kc.restConfig(context, filepath.Dir(path))
+}
+
+// restConfig resolves a context of the kubeconfig. Relative file paths are
+// relative to dir, the directory of the kubeconfig.
+func (kc *kubeconfig) restConfig(context, dir string) (*restConfig, error) {
+	if context == "" {
+		context = kc.CurrentContext
+	}
+	if context == "" {
+		return nil, fmt.Errorf("kubeconfig has no current context")
+	}
+
+	var clusterName, userName, namespace string
+	found := false
+	for _, c := range kc.Contexts {
+		if c.Name == context {
+			clusterName, userName, namespace = c.Context.Cluster, c.Context.User, c.Context.Namespace
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("context %q not found in kubeconfig", context)
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	cfg := &restConfig{namespace: namespace, tls: &tls.Config{MinVersion: tls.VersionTLS12}}
+	resolve := func(file string) string {
+		if file == "" || filepath.IsAbs(file) {
+			return file
+		}
+		return filepath.Join(dir, file)
+	}
+
+	found = false
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		found = true
+		cfg.server = strings.TrimSuffix(c.Cluster.Server, "/")
+		cfg.tls.ServerName = c.Cluster.TLSServerName
+		cfg.tls.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		ca, err := readData(c.Cluster.CertificateAuthorityData, resolve(c.Cluster.CertificateAuthority))
+		if err != nil {
+			return nil, fmt.Errorf("cluster %q: certificate authority: %w", clusterName, err)
+		}
+		if ca != nil {
+			if cfg.tls.RootCAs, err = certPool(ca); err != nil {
+				return nil, fmt.Errorf("cluster %q: %w", clusterName, err)
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("cluster %q not found in kubeconfig", clusterName)
+	}
+	if cfg.server == "" {
+		return nil, fmt.Errorf("cluster %q has no server", clusterName)
+	}
+
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		auth, cert, err := u.User.credentials(resolve)
+		if err != nil {
+			return nil, fmt.Errorf("user %q: %w", userName, err)
+		}
+		cfg.auth = auth
+		if cert != nil {
+			cfg.tls.Certificates = []tls.Certificate{*cert}
+		}
+	}
+	return cfg, nil
+}
+
+// credentials returns the authenticator and client certificate of a user.
+func (u *authInfo) credentials(resolve func(string) string) (authenticator, *tls.Certificate, error) {
+	var cert *tls.Certificate
+	certData, err := readData(u.ClientCertificateData, resolve(u.ClientCertificate))
+	if err != nil {
+		return nil, nil, fmt.Errorf("client certificate: %w", err)
+	}
+	keyData, err := readData(u.ClientKeyData, resolve(u.ClientKey))
+	if err != nil {
+		return nil, nil, fmt.Errorf("client key: %w", err)
+	}
+	if certData != nil || keyData != nil {
+		c, err := tls.X509KeyPair(certData, keyData)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		cert = &c
+	}
+
+	switch {
+	case u.Token != "":
+		return staticToken(u.Token), cert, nil
+	case u.TokenFile != "":
+		return &fileToken{path: resolve(u.TokenFile)}, cert, nil
+	case u.Exec != nil:
+		if u.Exec.Command == "" {
+			return nil, nil, fmt.Errorf("exec plugin has no command")
+		}
+		return &execToken{config: *u.Exec}, cert, nil
+	case u.AuthProvider != nil:
+		// Legacy OIDC and GCP providers keep the token they last obtained
+		for _, key := range []string{"id-token", "access-token"} {
+			if token := u.AuthProvider.Config[key]; token != "" {
+				return staticToken(token), cert, nil
+			}
+		}
+		return nil, nil, fmt.Errorf("auth provider %q is not supported: use an exec plugin", u.AuthProvider.Name)
+	case u.Username != "":
+		return basicAuth{username: u.Username, password: u.Password}, cert, nil
+	}
+	return nil, cert, nil
+}
+
+// inClusterConfig returns the configuration of the pod's service account.
+func inClusterConfig(host, port, dir string) (*restConfig, error) {
+	if port == "" {
+		port = "443"
+	}
+	ca, err := os.ReadFile(filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account: %w", err)
+	}
+	pool, err := certPool(ca)
+	if err != nil {
+		return nil, err
+	}
+	namespace := "default"
+	if data, err := os.ReadFile(filepath.Join(dir, "namespace")); err == nil {
+		namespace = strings.TrimSpace(string(data))
+	}
+	if strings.Contains(host, ":") {
+		// IPv6
+		host = "[" + host + "]"
+	}
+	return &restConfig{
+		server:    "https://" + host + ":" + port,
+		namespace: namespace,
+		tls:       &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pool},
+		// The token is rotated by the kubelet, so it is read again as it expires
+		auth: &fileToken{path: filepath.Join(dir, "token")},
+	}, nil
+}
+
+// readData returns base64-encoded inline data, or the contents of file.
+func readData(data, file string) ([]byte, error) {
+	if data != "" {
+		b, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 data: %w", err)
+		}
+		return b, nil
+	}
+	if file == "" {
+		return nil, nil
+	}
+	return os.ReadFile(file)
+}
+
+func certPool(pem []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in certificate authority")
+	}
+	return pool, nil
+}
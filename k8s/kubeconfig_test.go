@@ -0,0 +1,164 @@
+package k8s
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// newTLSAPIServer returns a TLS fake API server and its CA certificate.
+func newTLSAPIServer(t *testing.T) (*httptest.Server, []byte) {
+	t.Helper()
+	srv := httptest.NewTLSServer(newFakeAPIServer())
+	t.Cleanup(srv.Close)
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	return srv, ca
+}
+
+func writeKubeconfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, "config")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestKubeconfig(t *testing.T) {
+	srv, ca := newTLSAPIServer(t)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ca.crt"), ca, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte(testToken+"\n"), 0o600))
+	path := writeKubeconfig(t, dir, `
+apiVersion: v1
+kind: Config
+current-context: prod
+clusters:
+- name: prod
+  cluster:
+    server: `+srv.URL+`/
+    certificate-authority-data: `+base64.StdEncoding.EncodeToString(ca)+`
+- name: staging
+  cluster:
+    server: `+srv.URL+`
+    certificate-authority: ca.crt
+contexts:
+- name: prod
+  context: {cluster: prod, user: admin}
+- name: staging
+  context: {cluster: staging, user: reader, namespace: staging}
+- name: broken
+  context: {cluster: missing, user: admin}
+users:
+- name: admin
+  user:
+    token: `+testToken+`
+- name: reader
+  user:
+    tokenFile: token
+`)
+
+	c, err := New(Config{Kubeconfig: path}, allowAll)
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL, c.Server())
+	assert.Equal(t, "default", c.namespace)
+	_, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods"})
+	require.NoError(t, err)
+
+	// Relative files are relative to the kubeconfig
+	c, err = New(Config{Kubeconfig: path, Context: "staging"}, allowAll)
+	require.NoError(t, err)
+	assert.Equal(t, "staging", c.namespace)
+	_, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods", Namespace: "default"})
+	require.NoError(t, err)
+
+	_, err = New(Config{Kubeconfig: path, Context: "dev"}, allowAll)
+	assert.ErrorContains(t, err, `context "dev" not found`)
+	_, err = New(Config{Kubeconfig: path, Context: "broken"}, allowAll)
+	assert.ErrorContains(t, err, `cluster "missing" not found`)
+	_, err = New(Config{Kubeconfig: filepath.Join(dir, "missing")}, allowAll)
+	assert.ErrorContains(t, err, "failed to read kubeconfig")
+}
+
+func TestKubeconfigUntrustedServer(t *testing.T) {
+	srv, _ := newTLSAPIServer(t)
+	path := writeKubeconfig(t, t.TempDir(), `
+current-context: prod
+clusters:
+- name: prod
+  cluster: {server: `+srv.URL+`}
+contexts:
+- name: prod
+  context: {cluster: prod, user: admin}
+users:
+- name: admin
+  user: {token: `+testToken+`}
+`)
+	c, err := New(Config{Kubeconfig: path}, allowAll)
+	require.NoError(t, err)
+	_, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods"})
+	assert.ErrorContains(t, err, "certificate")
+}
+
+func TestExecCredentials(t *testing.T) {
+	srv, ca := newTLSAPIServer(t)
+	path := writeKubeconfig(t, t.TempDir(), `
+current-context: eks
+clusters:
+- name: eks
+  cluster:
+    server: `+srv.URL+`
+    certificate-authority-data: `+base64.StdEncoding.EncodeToString(ca)+`
+contexts:
+- name: eks
+  context: {cluster: eks, user: eks}
+users:
+- name: eks
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: sh
+      args: ["-c", "echo \"{\\\"kind\\\":\\\"ExecCredential\\\",\\\"status\\\":{\\\"token\\\":\\\"$TOKEN\\\"}}\""]
+      env:
+      - {name: TOKEN, value: `+testToken+`}
+`)
+	c, err := New(Config{Kubeconfig: path}, allowAll)
+	require.NoError(t, err)
+	_, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods"})
+	require.NoError(t, err)
+
+	auth := &execToken{config: execConfig{Command: "sh", Args: []string{"-c", "echo failed >&2; exit 1"}}}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	assert.ErrorContains(t, auth.authorize(context.Background(), req), "failed")
+}
+
+func TestInClusterConfig(t *testing.T) {
+	srv, ca := newTLSAPIServer(t)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ca.crt"), ca, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte(testToken), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "namespace"), []byte("monitoring\n"), 0o600))
+
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+	rc, err := inClusterConfig(host, port, dir)
+	require.NoError(t, err)
+	assert.Equal(t, "monitoring", rc.namespace)
+
+	c := newClient(rc, allowAll)
+	// The test certificate is issued for 127.0.0.1 and example.com
+	_, err = c.Get(context.Background(), &protocol.K8sGetArgs{Resource: "pods", Namespace: "default"})
+	require.NoError(t, err)
+
+	_, err = inClusterConfig(host, port, t.TempDir())
+	assert.ErrorContains(t, err, "service account")
+}
@@ -0,0 +1,122 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const (
+	// DefaultLogLines is the default number of log lines returned.
+	DefaultLogLines = 200
+	// MaxLogLines caps the number of log lines returned.
+	MaxLogLines = 5000
+	// MaxLogSize caps the size of the logs returned. Longer logs keep their
+	// most recent lines.
+	MaxLogSize = 1 << 20
+)
+
+// podsResource is the core/v1 pods resource.
+var podsResource, _ = findResource(builtinResources, "pods", "", false)
+
+// Logs returns the last lines logged by a container, as kubectl logs does.
+// Reading logs must be allowed as pods/log.
+func (c *Client) Logs(ctx context.Context, args *protocol.K8sLogsArgs) (*protocol.K8sLogsResult, error) {
+	if args.Pod == "" {
+		return nil, fmt.Errorf("pod is required")
+	}
+	if err := checkName("pod", args.Pod); err != nil {
+		return nil, err
+	}
+	if err := c.checkResource(podsResource, "log"); err != nil {
+		return nil, err
+	}
+	namespace, err := c.resolveNamespace(args.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	lines := args.TailLines
+	if lines <= 0 {
+		lines = DefaultLogLines
+	}
+	lines = min(lines, MaxLogLines)
+
+	query := url.Values{"tailLines": {strconv.Itoa(lines)}}
+	if args.Container != "" {
+		query.Set("container", args.Container)
+	}
+	if args.Previous {
+		query.Set("previous", "true")
+	}
+	if args.Timestamps {
+		query.Set("timestamps", "true")
+	}
+	if args.Since != "" {
+		if d, err := time.ParseDuration(args.Since); err == nil {
+			query.Set("sinceSeconds", strconv.Itoa(max(int(d.Seconds()), 1)))
+		} else if t, err := time.Parse(time.RFC3339, args.Since); err == nil {
+			query.Set("sinceTime", t.UTC().Format(time.RFC3339))
+		} else {
+			return nil, fmt.Errorf("invalid since %q: expected RFC3339 time or duration like 15m", args.Since)
+		}
+	}
+
+	body, err := c.open(ctx, podsResource.path(namespace, args.Pod)+"/log", query, "")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = body.Close() }()
+	output, truncated, err := readTail(body, MaxLogSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logs: %w", err)
+	}
+	count := strings.Count(output, "\n")
+	if output != "" && !strings.HasSuffix(output, "\n") {
+		count++
+	}
+	return &protocol.K8sLogsResult{Output: output, Lines: count, Truncated: truncated}, nil
+}
+
+// readTail reads r and returns at most the last size bytes, starting at a
+// line, and whether anything was dropped.
+func readTail(r io.Reader, size int) (string, bool, error) {
+	var buf bytes.Buffer
+	chunk := make([]byte, 32<<10)
+	truncated := false
+	for {
+		n, err := r.Read(chunk)
+		buf.Write(chunk[:n])
+		if buf.Len() > 2*size {
+			// Keep memory bounded while reading
+			tail := append([]byte(nil), buf.Bytes()[buf.Len()-size:]...)
+			buf.Reset()
+			buf.Write(tail)
+			truncated = true
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", false, err
+		}
+	}
+
+	data := buf.Bytes()
+	if len(data) > size {
+		data = data[len(data)-size:]
+		truncated = true
+	}
+	if truncated {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+	return string(data), truncated, nil
+}
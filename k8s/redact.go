@@ -0,0 +1,35 @@
+package k8s
+
+// secretMarker replaces the values of secrets. It matches the markers of
+// the redact package.
+const secretMarker = "[REDACTED:secret]"
+
+// lastAppliedAnnotation holds the object as last applied by kubectl, which
+// for a secret includes its data.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// cleanObject prepares an object for a result: the values of secrets are
+// masked, whatever the redaction settings, and managed fields, which only
+// repeat the object for server-side apply, are dropped.
+func cleanObject(obj map[string]any, r resource) {
+	metadata, _ := obj["metadata"].(map[string]any)
+	if metadata != nil {
+		delete(metadata, "managedFields")
+	}
+	if r.group != "" || r.name != "secrets" {
+		return
+	}
+
+	for _, field := range []string{"data", "stringData"} {
+		if data, ok := obj[field].(map[string]any); ok {
+			for key := range data {
+				data[key] = secretMarker
+			}
+		}
+	}
+	if annotations, ok := metadata["annotations"].(map[string]any); ok {
+		if _, ok := annotations[lastAppliedAnnotation]; ok {
+			annotations[lastAppliedAnnotation] = secretMarker
+		}
+	}
+}
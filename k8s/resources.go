@@ -0,0 +1,201 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// discoveryTTL is how long discovered resources are used before a name not
+// found among them triggers discovery again, to pick up new CRDs.
+const discoveryTTL = 5 * time.Minute
+
+// resource is a type of object served by the API server.
+type resource struct {
+	group      string // Empty for the core group
+	version    string
+	name       string // Plural name used in paths, e.g. deployments
+	kind       string
+	namespaced bool
+	shortNames []string
+}
+
+// String returns the name as kubectl accepts it, qualified with the group
+// outside the core group, e.g. deployments.apps.
+func (r resource) String() string {
+	if r.group == "" {
+		return r.name
+	}
+	return r.name + "." + r.group
+}
+
+// path returns the API path of the objects of the resource in a namespace,
+// or of one object when name is not empty. An empty namespace lists all
+// namespaces.
+func (r resource) path(namespace, name string) string {
+	p := "/apis/" + r.group + "/" + r.version
+	if r.group == "" {
+		p = "/api/" + r.version
+	}
+	if r.namespaced && namespace != "" {
+		p += "/namespaces/" + namespace
+	}
+	p += "/" + r.name
+	if name != "" {
+		p += "/" + name
+	}
+	return p
+}
+
+// matches reports whether name refers to the resource, by plural, singular
+// or short name.
+func (r resource) matches(name string) bool {
+	if name == r.name || name == strings.ToLower(r.kind) {
+		return true
+	}
+	for _, short := range r.shortNames {
+		if name == short {
+			return true
+		}
+	}
+	return false
+}
+
+// builtinResources are resolved without discovery.
+var builtinResources = []resource{
+	{"", "v1", "pods", "Pod", true, []string{"po"}},
+	{"", "v1", "services", "Service", true, []string{"svc"}},
+	{"", "v1", "endpoints", "Endpoints", true, []string{"ep"}},
+	{"", "v1", "configmaps", "ConfigMap", true, []string{"cm"}},
+	{"", "v1", "secrets", "Secret", true, nil},
+	{"", "v1", "events", "Event", true, []string{"ev"}},
+	{"", "v1", "serviceaccounts", "ServiceAccount", true, []string{"sa"}},
+	{"", "v1", "persistentvolumeclaims", "PersistentVolumeClaim", true, []string{"pvc"}},
+	{"", "v1", "replicationcontrollers", "ReplicationController", true, []string{"rc"}},
+	{"", "v1", "resourcequotas", "ResourceQuota", true, []string{"quota"}},
+	{"", "v1", "limitranges", "LimitRange", true, []string{"limits"}},
+	{"", "v1", "nodes", "Node", false, []string{"no"}},
+	{"", "v1", "namespaces", "Namespace", false, []string{"ns"}},
+	{"", "v1", "persistentvolumes", "PersistentVolume", false, []string{"pv"}},
+	{"apps", "v1", "deployments", "Deployment", true, []string{"deploy"}},
+	{"apps", "v1", "statefulsets", "StatefulSet", true, []string{"sts"}},
+	{"apps", "v1", "daemonsets", "DaemonSet", true, []string{"ds"}},
+	{"apps", "v1", "replicasets", "ReplicaSet", true, []string{"rs"}},
+	{"batch", "v1", "jobs", "Job", true, nil},
+	{"batch", "v1", "cronjobs", "CronJob", true, []string{"cj"}},
+	{"autoscaling", "v2", "horizontalpodautoscalers", "HorizontalPodAutoscaler", true, []string{"hpa"}},
+	{"policy", "v1", "poddisruptionbudgets", "PodDisruptionBudget", true, []string{"pdb"}},
+	{"networking.k8s.io", "v1", "ingresses", "Ingress", true, []string{"ing"}},
+	{"networking.k8s.io", "v1", "networkpolicies", "NetworkPolicy", true, []string{"netpol"}},
+	{"discovery.k8s.io", "v1", "endpointslices", "EndpointSlice", true, nil},
+	{"coordination.k8s.io", "v1", "leases", "Lease", true, nil},
+	{"storage.k8s.io", "v1", "storageclasses", "StorageClass", false, []string{"sc"}},
+	{"rbac.authorization.k8s.io", "v1", "roles", "Role", true, nil},
+	{"rbac.authorization.k8s.io", "v1", "rolebindings", "RoleBinding", true, nil},
+	{"rbac.authorization.k8s.io", "v1", "clusterroles", "ClusterRole", false, nil},
+	{"rbac.authorization.k8s.io", "v1", "clusterrolebindings", "ClusterRoleBinding", false, nil},
+	{"apiextensions.k8s.io", "v1", "customresourcedefinitions", "CustomResourceDefinition", false, []string{"crd", "crds"}},
+}
+
+// findResource returns the resource a name refers to, optionally qualified
+// with its group as in deployments.apps.
+func findResource(resources []resource, name, group string, qualified bool) (resource, bool) {
+	for _, r := range resources {
+		if (!qualified || r.group == group) && r.matches(name) {
+			return r, true
+		}
+	}
+	return resource{}, false
+}
+
+// resolve returns the resource a name refers to, as kubectl accepts it:
+// plural, singular or short name, optionally qualified with the group.
+// Custom resources are found by discovery.
+func (c *Client) resolve(ctx context.Context, name string) (resource, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return resource{}, fmt.Errorf("resource is required")
+	}
+	short, group, qualified := strings.Cut(name, ".")
+	if r, ok := findResource(builtinResources, short, group, qualified); ok {
+		return r, nil
+	}
+
+	c.discoveryMu.Lock()
+	defer c.discoveryMu.Unlock()
+	if r, ok := findResource(c.discovered, short, group, qualified); ok {
+		return r, nil
+	}
+	if c.discovered == nil || time.Since(c.discoveryAt) > discoveryTTL {
+		discovered, err := c.discover(ctx)
+		if err != nil {
+			return resource{}, err
+		}
+		c.discovered, c.discoveryAt = discovered, time.Now()
+		if r, ok := findResource(c.discovered, short, group, qualified); ok {
+			return r, nil
+		}
+	}
+	return resource{}, fmt.Errorf("unknown resource %q", name)
+}
+
+// discover lists the resources of the preferred version of every API group.
+func (c *Client) discover(ctx context.Context) ([]resource, error) {
+	data, err := c.get(ctx, "/apis", nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover resources: %w", err)
+	}
+	var groups struct {
+		Groups []struct {
+			Name             string `json:"name"`
+			PreferredVersion struct {
+				Version string `json:"version"`
+			} `json:"preferredVersion"`
+		} `json:"groups"`
+	}
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return nil, fmt.Errorf("invalid discovery response: %w", err)
+	}
+
+	var resources []resource
+	for _, g := range groups.Groups {
+		data, err := c.get(ctx, "/apis/"+g.Name+"/"+g.PreferredVersion.Version, nil, "")
+		if err != nil {
+			// Aggregated APIs that are down should not hide the others
+			continue
+		}
+		var list struct {
+			Resources []struct {
+				Name         string   `json:"name"`
+				SingularName string   `json:"singularName"`
+				Namespaced   bool     `json:"namespaced"`
+				Kind         string   `json:"kind"`
+				ShortNames   []string `json:"shortNames"`
+			} `json:"resources"`
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			continue
+		}
+		for _, r := range list.Resources {
+			if strings.Contains(r.Name, "/") {
+				// Subresource
+				continue
+			}
+			shortNames := r.ShortNames
+			if r.SingularName != "" {
+				shortNames = append(shortNames, r.SingularName)
+			}
+			resources = append(resources, resource{
+				group:      g.Name,
+				version:    g.PreferredVersion.Version,
+				name:       r.Name,
+				kind:       r.Kind,
+				namespaced: r.Namespaced,
+				shortNames: shortNames,
+			})
+		}
+	}
+	return resources, nil
+}
@@ -63,13 +63,15 @@ type WelcomePayload struct {
 }
 
 // HeartbeatPayload is the payload for heartbeat messages.
+// Labels are the merged set of auto-detected, cloud-managed and locally declared labels.
 type HeartbeatPayload struct {
-	WorknodeID  string            `json:"worknode_id"`
-	Name        string            `json:"name"`
-	Labels      []string          `json:"labels"`
-	Version     string            `json:"version"`
-	Environment *EnvironmentInfo  `json:"environment,omitempty"`
-	Metrics     *HeartbeatMetrics `json:"metrics,omitempty"`
+	WorknodeID   string            `json:"worknode_id"`
+	Name         string            `json:"name"`
+	Labels       []string          `json:"labels"`
+	Capabilities []string          `json:"capabilities,omitempty"` // Free-form capability tags declared locally
+	Version      string            `json:"version"`
+	Environment  *EnvironmentInfo  `json:"environment,omitempty"`
+	Metrics      *HeartbeatMetrics `json:"metrics,omitempty"`
 }
 
 // EnvironmentInfo contains detailed environment information for LLM context.
@@ -88,13 +90,56 @@ type EnvironmentInfo struct {
 	CurrentTime   string `json:"current_time"`    // Current time in RFC3339 format
 	Timezone      string `json:"timezone"`        // Timezone name, e.g., "Asia/Shanghai"
 	UTCOffset     string `json:"utc_offset"`      // UTC offset, e.g., "+08:00"
+
+	IPAddresses []string        `json:"ip_addresses,omitempty"` // Non-loopback interface addresses
+	Tools       []ToolInfo      `json:"tools,omitempty"`        // Installed CLI tools found on PATH
+	Container   *ContainerInfo  `json:"container,omitempty"`    // Set when running inside a container
+	Kubernetes  *KubernetesInfo `json:"kubernetes,omitempty"`   // Set when running inside a Kubernetes pod
+	Cloud       *CloudInfo      `json:"cloud,omitempty"`        // Cloud instance metadata, when available
+}
+
+// ToolInfo describes an installed command-line tool.
+type ToolInfo struct {
+	Name    string `json:"name"`              // e.g., "kubectl"
+	Path    string `json:"path"`              // Resolved executable path
+	Version string `json:"version,omitempty"` // First line of the tool's version output
+}
+
+// ContainerInfo describes the container the runner is running in.
+type ContainerInfo struct {
+	Runtime string `json:"runtime"` // e.g., "docker", "containerd", "podman", "lxc"
+}
+
+// KubernetesInfo describes the pod the runner is running in.
+type KubernetesInfo struct {
+	Namespace string `json:"namespace,omitempty"`
+	PodName   string `json:"pod_name,omitempty"`
+	NodeName  string `json:"node_name,omitempty"`
+}
+
+// CloudInfo contains cloud instance metadata.
+type CloudInfo struct {
+	Provider     string `json:"provider"` // e.g., "aws", "gcp", "azure", "alibaba"
+	InstanceID   string `json:"instance_id,omitempty"`
+	InstanceType string `json:"instance_type,omitempty"`
+	Region       string `json:"region,omitempty"`
+	Zone         string `json:"zone,omitempty"`
 }
 
 // HeartbeatMetrics contains system metrics.
 type HeartbeatMetrics struct {
-	CPUPercent    float64 `json:"cpu_percent,omitempty"`
-	MemoryPercent float64 `json:"memory_percent,omitempty"`
-	DiskPercent   float64 `json:"disk_percent,omitempty"`
+	CPUPercent    *float64 `json:"cpu_percent,omitempty"`    // Host CPU usage since the previous sample, unset before a second sample
+	MemoryPercent *float64 `json:"memory_percent,omitempty"` // Host memory in use (excluding reclaimable cache)
+	DiskPercent   *float64 `json:"disk_percent,omitempty"`   // Usage of the filesystem holding the workspace root
+	LoadAvg1      float64  `json:"load_avg_1,omitempty"`     // 1-minute load average
+	LoadAvg5      float64  `json:"load_avg_5,omitempty"`     // 5-minute load average
+	LoadAvg15     float64  `json:"load_avg_15,omitempty"`    // 15-minute load average
+
+	ProcessRSSBytes int64 `json:"process_rss_bytes,omitempty"` // Resident memory of the runner process
+
+	WorkspaceUsedBytes  int64 `json:"workspace_used_bytes,omitempty"`  // Disk space used by files in the workspace
+	WorkspaceQuotaBytes int64 `json:"workspace_quota_bytes,omitempty"` // Configured workspace quota, unset if unlimited
+	OutputsBytes        int64 `json:"outputs_bytes,omitempty"`         // Disk space used by saved large outputs
 }
 
 // TaskOperation defines the type of workspace operation.
@@ -103,14 +148,50 @@ type TaskOperation string
 const (
 	TaskOpRead         TaskOperation = "read"
 	TaskOpWrite        TaskOperation = "write"
+	TaskOpEdit         TaskOperation = "edit"
+	TaskOpRestore      TaskOperation = "restore"
 	TaskOpList         TaskOperation = "list"
 	TaskOpGlob         TaskOperation = "glob"
 	TaskOpGrep         TaskOperation = "grep"
+	TaskOpTail         TaskOperation = "tail"
+	TaskOpWatch        TaskOperation = "watch"
+	TaskOpUploadBegin  TaskOperation = "upload_begin"
+	TaskOpUploadChunk  TaskOperation = "upload_chunk"
+	TaskOpUploadCommit TaskOperation = "upload_commit"
+	TaskOpDownload     TaskOperation = "download"
+	TaskOpArchive      TaskOperation = "archive"
+	TaskOpExtract      TaskOperation = "extract"
+	TaskOpStat         TaskOperation = "stat"
+	TaskOpMkdir        TaskOperation = "mkdir"
+	TaskOpMove         TaskOperation = "move"
+	TaskOpCopy         TaskOperation = "copy"
+	TaskOpDelete       TaskOperation = "delete"
 	TaskOpBash         TaskOperation = "bash"
 	TaskOpWebFetch     TaskOperation = "webfetch"
 	TaskOpMCPCall      TaskOperation = "mcp_call"
 	TaskOpMCPListTools TaskOperation = "mcp_list_tools"
 	TaskOpSyncSkill    TaskOperation = "sync_skill"
+	TaskOpEndSession   TaskOperation = "end_session"
+
+	// Diagnostics read host state natively from /proc and /sys. Each is
+	// enabled individually in permission.diagnostics under the same name.
+	TaskOpProcesses TaskOperation = "processes"
+	TaskOpSockets   TaskOperation = "sockets"
+	TaskOpDisks     TaskOperation = "disks"
+	TaskOpMemory    TaskOperation = "memory"
+	TaskOpKernelLog TaskOperation = "kernel_log"
+	TaskOpSystemd   TaskOperation = "systemd"
+
+	// Kubernetes operations call the API server directly, limited to the
+	// resources and namespaces in permission.kubernetes.
+	TaskOpK8sGet      TaskOperation = "k8s_get"
+	TaskOpK8sDescribe TaskOperation = "k8s_describe"
+	TaskOpK8sLogs     TaskOperation = "k8s_logs"
+	TaskOpK8sEvents   TaskOperation = "k8s_events"
+
+	// db_query runs a read-only statement against a database connection
+	// profile configured locally under databases.
+	TaskOpDBQuery TaskOperation = "db_query"
 )
 
 // TaskRequestPayload is the payload for task request messages.
@@ -122,35 +203,224 @@ type TaskRequestPayload struct {
 	Args             json.RawMessage `json:"args"`
 }
 
+// Read modes
+const (
+	ReadModeBytes = "bytes" // Byte range, base64 encoded (default)
+	ReadModeLines = "lines" // Line range, UTF-8 text with line numbers
+)
+
 // ReadArgs are the arguments for read operation.
 type ReadArgs struct {
 	Path   string `json:"path"`
-	Offset int64  `json:"offset,omitempty"`
-	Limit  int64  `json:"limit,omitempty"`
+	Mode   string `json:"mode,omitempty"`   // bytes, lines (default: bytes)
+	Offset int64  `json:"offset,omitempty"` // bytes mode: byte offset
+	Limit  int64  `json:"limit,omitempty"`  // bytes mode: byte count, 0 reads up to the maximum read size
+
+	StartLine  int  `json:"start_line,omitempty"`  // lines mode: 1-based first line (default: 1)
+	LineCount  int  `json:"line_count,omitempty"`  // lines mode: number of lines (default: 2000)
+	CountLines bool `json:"count_lines,omitempty"` // lines mode: read on to the end of the file to report TotalLines
 }
 
 // WriteArgs are the arguments for write operation.
 type WriteArgs struct {
 	Path    string `json:"path"`
-	Content string `json:"content"` // base64 encoded
+	Content string `json:"content"`          // base64 encoded
+	Append  bool   `json:"append,omitempty"` // Append to the file instead of replacing it
+}
+
+// EditArgs are the arguments for edit operation.
+// Either OldString/NewString or Patch must be set.
+type EditArgs struct {
+	Path         string `json:"path"`
+	OldString    string `json:"old_string,omitempty"`    // Exact text to replace; empty with a missing file creates it
+	NewString    string `json:"new_string,omitempty"`    // Replacement text
+	ReplaceAll   bool   `json:"replace_all,omitempty"`   // Replace every occurrence instead of requiring a unique match
+	Patch        string `json:"patch,omitempty"`         // Unified diff for a single file
+	ExpectedHash string `json:"expected_hash,omitempty"` // SHA-256 (hex) the file must have, as returned by read
 }
 
+// RestoreArgs are the arguments for restore operation.
+type RestoreArgs struct {
+	Count int    `json:"count,omitempty"` // Number of modifications to undo, newest first (default: 1)
+	Path  string `json:"path,omitempty"`  // Only undo modifications of this file
+}
+
+// List and glob sort orders
+const (
+	ListSortName  = "name"  // Path name ascending; list keeps directory order (default)
+	ListSortMtime = "mtime" // Most recently modified first
+	ListSortSize  = "size"  // Largest first
+)
+
 // ListArgs are the arguments for list operation.
 type ListArgs struct {
-	Path      string   `json:"path"`
-	Recursive bool     `json:"recursive,omitempty"`
-	Ignore    []string `json:"ignore,omitempty"`
+	Path       string   `json:"path"`
+	Recursive  bool     `json:"recursive,omitempty"`
+	Ignore     []string `json:"ignore,omitempty"`
+	MaxDepth   int      `json:"max_depth,omitempty"`   // Recursive only: levels below path to descend, 0 for no limit
+	MaxResults int      `json:"max_results,omitempty"` // Maximum entries (default: 1000)
+	Sort       string   `json:"sort,omitempty"`        // name, mtime, size (default: name)
+	Gitignore  bool     `json:"gitignore,omitempty"`   // Skip entries ignored by .gitignore files
+	Details    bool     `json:"details,omitempty"`     // Include modification time and mode
 }
 
 // GlobArgs are the arguments for glob operation.
 type GlobArgs struct {
-	Pattern string `json:"pattern"`
+	Pattern    string `json:"pattern"`
+	MaxResults int    `json:"max_results,omitempty"` // Maximum matches (default: 1000)
+	Sort       string `json:"sort,omitempty"`        // name, mtime, size (default: name)
+	Gitignore  bool   `json:"gitignore,omitempty"`   // Skip matches ignored by .gitignore files
 }
 
+// Grep case modes
+const (
+	GrepCaseSmart       = "smart"       // Insensitive unless the pattern has an uppercase literal (default)
+	GrepCaseSensitive   = "sensitive"   // Always case sensitive
+	GrepCaseInsensitive = "insensitive" // Always case insensitive
+)
+
+// Grep output modes
+const (
+	GrepOutputContent = "content"            // Matching lines with context (default)
+	GrepOutputFiles   = "files_with_matches" // Paths of files with at least one match
+	GrepOutputCount   = "count"              // Number of matches per file
+)
+
 // GrepArgs are the arguments for grep operation.
+// The pattern is a regular expression unless FixedStrings is set.
 type GrepArgs struct {
-	Pattern string   `json:"pattern"`
-	Include []string `json:"include,omitempty"`
+	Pattern      string   `json:"pattern"`
+	Path         string   `json:"path,omitempty"`          // File or directory to search (default: workspace root)
+	Include      []string `json:"include,omitempty"`       // Globs of files to search; without "/" they match the file name
+	Exclude      []string `json:"exclude,omitempty"`       // Globs of files and directories to skip
+	Case         string   `json:"case,omitempty"`          // smart, sensitive, insensitive (default: smart)
+	FixedStrings bool     `json:"fixed_strings,omitempty"` // Treat the pattern as a literal string
+	Multiline    bool     `json:"multiline,omitempty"`     // Allow matches to span lines
+	Context      int      `json:"context,omitempty"`       // Lines of context before and after each match
+	Before       int      `json:"before,omitempty"`        // Lines of context before each match, overrides Context
+	After        int      `json:"after,omitempty"`         // Lines of context after each match, overrides Context
+	MaxCount     int      `json:"max_count,omitempty"`     // Maximum matches per file
+	MaxResults   int      `json:"max_results,omitempty"`   // Maximum matches overall (files in files/count mode)
+	OutputMode   string   `json:"output_mode,omitempty"`   // content, files_with_matches, count (default: content)
+
+	Truncate  string `json:"truncate,omitempty"`   // One of the Truncate* strategies
+	MaxTokens int    `json:"max_tokens,omitempty"` // Output limit in estimated tokens, see the Truncate* strategies
+}
+
+// TailArgs are the arguments for tail operation.
+// With Since or Until set, only lines with a timestamp in that window are returned;
+// lines without a timestamp belong to the closest timestamped line above them.
+type TailArgs struct {
+	Path           string `json:"path"`
+	Lines          int    `json:"lines,omitempty"`           // Number of lines from the end (default: 100)
+	Since          string `json:"since,omitempty"`           // Window start: RFC3339 time or duration before now, e.g. "15m"
+	Until          string `json:"until,omitempty"`           // Window end: RFC3339 time or duration before now
+	IncludeRotated bool   `json:"include_rotated,omitempty"` // Also read rotated siblings such as app.log.1 and app.log.2.gz
+	Follow         bool   `json:"follow,omitempty"`          // Stream lines appended to the file as task.output
+	FollowSeconds  int    `json:"follow_seconds,omitempty"`  // How long to follow (default: 30, max: 300)
+
+	Truncate  string `json:"truncate,omitempty"`   // One of the Truncate* strategies
+	MaxTokens int    `json:"max_tokens,omitempty"` // Output limit in estimated tokens, see the Truncate* strategies
+}
+
+// WatchArgs are the arguments for watch operation.
+// Events are streamed as task.output messages on the event stream.
+type WatchArgs struct {
+	Paths     []string `json:"paths"`                // Files or directories to watch; mount prefixes allowed
+	Recursive bool     `json:"recursive,omitempty"`  // Also watch subdirectories
+	Duration  int      `json:"duration,omitempty"`   // Seconds to watch (default: 60, max: 600)
+	Debounce  int      `json:"debounce,omitempty"`   // Milliseconds a path must be quiet before its event is sent (default: 500)
+	MaxEvents int      `json:"max_events,omitempty"` // Stop after this many events (default: 1000)
+	Poll      bool     `json:"poll,omitempty"`       // Poll for changes instead of using inotify, e.g. on network filesystems
+}
+
+// UploadBeginArgs are the arguments for upload_begin operation.
+// Beginning the same upload again resumes it.
+type UploadBeginArgs struct {
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`               // Hash of the whole file
+	ChunkSize int    `json:"chunk_size,omitempty"` // Bytes per chunk (default: 1 MiB, max: 8 MiB)
+}
+
+// UploadChunkArgs are the arguments for upload_chunk operation.
+type UploadChunkArgs struct {
+	UploadID string `json:"upload_id"`
+	Index    int    `json:"index"`  // 0-based chunk index
+	Data     string `json:"data"`   // base64 encoded
+	SHA256   string `json:"sha256"` // Hash of the decoded chunk
+}
+
+// UploadCommitArgs are the arguments for upload_commit operation.
+type UploadCommitArgs struct {
+	UploadID string `json:"upload_id"`
+}
+
+// DownloadArgs are the arguments for download operation.
+// Chunks are streamed as task.output messages on the chunk stream.
+type DownloadArgs struct {
+	Path       string `json:"path"`
+	ChunkSize  int    `json:"chunk_size,omitempty"`  // Bytes per chunk (default: 1 MiB, max: 8 MiB)
+	StartChunk int    `json:"start_chunk,omitempty"` // First chunk to send, to resume an interrupted download
+}
+
+// Archive formats
+const (
+	ArchiveFormatTarGz = "tar.gz"
+	ArchiveFormatTar   = "tar" // Extract only
+	ArchiveFormatZip   = "zip"
+)
+
+// ArchiveArgs are the arguments for archive operation.
+type ArchiveArgs struct {
+	Output  string   `json:"output"`             // Archive path in the workspace
+	Paths   []string `json:"paths"`              // Globs of files and directories to include; mount prefixes allowed
+	Exclude []string `json:"exclude,omitempty"`  // Globs of files and directories to skip; without "/" they match the name
+	Format  string   `json:"format,omitempty"`   // tar.gz, zip (default: from the output extension, else tar.gz)
+	MaxSize int64    `json:"max_size,omitempty"` // Maximum total bytes of included files (default: 1 GiB)
+}
+
+// ExtractArgs are the arguments for extract operation.
+type ExtractArgs struct {
+	Path      string `json:"path"`                // Archive to extract; mount prefixes allowed
+	Dest      string `json:"dest"`                // Destination directory in the workspace
+	Format    string `json:"format,omitempty"`    // tar, tar.gz, zip (default: detected from the content)
+	MaxSize   int64  `json:"max_size,omitempty"`  // Maximum total bytes extracted (default: 1 GiB)
+	Overwrite bool   `json:"overwrite,omitempty"` // Replace existing files instead of failing
+}
+
+// StatArgs are the arguments for stat operation.
+type StatArgs struct {
+	Path string `json:"path"` // Mount prefixes allowed
+}
+
+// MkdirArgs are the arguments for mkdir operation.
+// Missing parent directories are created.
+type MkdirArgs struct {
+	Path string `json:"path"`
+}
+
+// MoveArgs are the arguments for move operation.
+type MoveArgs struct {
+	Source    string `json:"source"`
+	Dest      string `json:"dest"`                // New path of the source, not a directory to move into
+	Overwrite bool   `json:"overwrite,omitempty"` // Replace an existing destination file
+}
+
+// CopyArgs are the arguments for copy operation.
+type CopyArgs struct {
+	Source    string `json:"source"`              // Mount prefixes allowed
+	Dest      string `json:"dest"`                // Path of the copy, not a directory to copy into
+	Recursive bool   `json:"recursive,omitempty"` // Required to copy a directory
+	Overwrite bool   `json:"overwrite,omitempty"` // Replace existing destination files
+}
+
+// DeleteArgs are the arguments for delete operation.
+// Deleting a non-empty directory requires both Recursive and Confirm.
+type DeleteArgs struct {
+	Path      string `json:"path"`
+	Recursive bool   `json:"recursive,omitempty"`
+	Confirm   bool   `json:"confirm,omitempty"`
 }
 
 // BashArgs are the arguments for bash operation.
@@ -158,12 +428,48 @@ type BashArgs struct {
 	Command string `json:"command"`
 	Workdir string `json:"workdir,omitempty"`
 	Timeout int    `json:"timeout,omitempty"` // seconds
+
+	Truncate  string `json:"truncate,omitempty"`   // One of the Truncate* strategies
+	MaxTokens int    `json:"max_tokens,omitempty"` // Output limit in estimated tokens, see the Truncate* strategies
+	Parse     string `json:"parse,omitempty"`      // Convert stdout to JSON: auto, json, jsonl, table, kv (default: none)
 }
 
+// Output formats bash stdout can be parsed from.
+const (
+	ParseAuto  = "auto"  // Detect the format
+	ParseJSON  = "json"  // A single JSON value
+	ParseJSONL = "jsonl" // A JSON value per line, or concatenated JSON values
+	ParseTable = "table" // Columns with a header line, as printed by ps, df, ss and kubectl get
+	ParseKV    = "kv"    // A key=value or key: value pair per line, as in env or /proc/meminfo
+)
+
+// Truncation strategies choose which lines of an oversized output are shown,
+// as the Truncate argument of grep, tail, bash, web_fetch and mcp_call. The
+// full output is saved to a file either way. Output is oversized beyond
+// workspace.DefaultMaxOutputTokens estimated tokens or
+// workspace.DefaultMaxOutputSize bytes; a MaxTokens argument replaces both.
+// Tail defaults to TruncateTail, bash to TruncateHeadTail and the others to
+// TruncateHead.
+const (
+	TruncateHead        = "head"        // First lines
+	TruncateTail        = "tail"        // Last lines
+	TruncateHeadTail    = "head_tail"   // First and last lines
+	TruncateInteresting = "interesting" // Lines matching error, warning and exception patterns, with context
+)
+
+// Task output streams
+const (
+	TaskStreamStdout   = "stdout"
+	TaskStreamStderr   = "stderr"
+	TaskStreamProgress = "progress" // Human-readable progress of a long transfer
+	TaskStreamChunk    = "chunk"    // JSON-encoded DownloadChunk
+	TaskStreamEvent    = "event"    // JSON-encoded WatchEvent
+)
+
 // TaskOutputPayload is the payload for streaming task output.
 type TaskOutputPayload struct {
 	TaskID string `json:"task_id"`
-	Stream string `json:"stream"` // stdout, stderr
+	Stream string `json:"stream"` // stdout, stderr, progress, chunk, event
 	Data   string `json:"data"`
 }
 
@@ -174,46 +480,279 @@ type TaskResultPayload struct {
 	Success          bool            `json:"success"`
 	Result           json.RawMessage `json:"result,omitempty"`
 	Error            string          `json:"error,omitempty"`
+	ErrorCode        string          `json:"error_code,omitempty"` // One of the ErrorCode* constants, when known
 	ExitCode         int             `json:"exit_code,omitempty"`
+	Redactions       int             `json:"redactions,omitempty"` // Secrets masked in the result, error and streamed output
 }
 
+// Task error codes
+const (
+	ErrorCodeNotFound        = "not_found"
+	ErrorCodeExists          = "already_exists"
+	ErrorCodeNotDir          = "not_a_directory"
+	ErrorCodeIsDir           = "is_a_directory"
+	ErrorCodeNotEmpty        = "not_empty"
+	ErrorCodePermission      = "permission_denied"
+	ErrorCodeInvalidPath     = "invalid_path"          // Outside the workspace, or a read-only mount
+	ErrorCodeProtected       = "protected_path"        // Workspace root or runner working files
+	ErrorCodeConfirmRequired = "confirmation_required" // Recursive delete without confirm
+	ErrorCodeQuotaExceeded   = "quota_exceeded"        // The write would exceed the workspace disk quota
+)
+
 // ReadResult is the result of a read operation.
 type ReadResult struct {
-	Content   string `json:"content"` // base64 encoded
+	Content   string `json:"content"` // bytes mode: base64 encoded; lines mode: numbered UTF-8 text
 	TotalSize int64  `json:"total_size"`
+	Truncated bool   `json:"truncated,omitempty"` // Whether the read stopped at the maximum read size
+
+	// Lines mode only
+	StartLine  int  `json:"start_line,omitempty"`  // First line returned
+	EndLine    int  `json:"end_line,omitempty"`    // Last line returned
+	TotalLines int  `json:"total_lines,omitempty"` // Number of lines in the file, when the read reached its end
+	More       bool `json:"more,omitempty"`        // Lines follow EndLine that were not read
+	IsBinary   bool `json:"is_binary,omitempty"`   // File looks binary; no content is returned
+
+	SHA256 string `json:"sha256,omitempty"` // Hash of the content read, for edit preconditions; set only when it is the whole file
+}
+
+// WriteResult is the result of a write operation.
+type WriteResult struct {
+	Success     bool   `json:"success"`
+	BackupError string `json:"backup_error,omitempty"` // Why the previous content was not backed up; restore cannot undo the write
+}
+
+// EditHunkResult reports how a patch hunk was applied.
+type EditHunkResult struct {
+	Hunk   int `json:"hunk"`             // 1-based hunk index
+	Line   int `json:"line"`             // 1-based line in the original file where the hunk was applied
+	Offset int `json:"offset,omitempty"` // Lines between the header position and where the hunk matched
+	Fuzz   int `json:"fuzz,omitempty"`   // Context lines ignored at each end to make the hunk match
+}
+
+// EditResult is the result of an edit operation.
+type EditResult struct {
+	Replacements int              `json:"replacements,omitempty"` // String replacements made
+	Hunks        []EditHunkResult `json:"hunks,omitempty"`        // Patch hunks applied
+	SHA256       string           `json:"sha256"`                 // Hash of the file after the edit
+	BackupError  string           `json:"backup_error,omitempty"` // Why the previous content was not backed up; restore cannot undo the edit
+}
+
+// RestoredFile is a single undone modification.
+type RestoredFile struct {
+	Path   string    `json:"path"`
+	Op     string    `json:"op"`     // Operation that made the modification
+	Action string    `json:"action"` // restored, deleted (the file did not exist before)
+	Time   time.Time `json:"time"`   // When the modification was made
+}
+
+// RestoreResult is the result of a restore operation.
+type RestoreResult struct {
+	Restored []RestoredFile `json:"restored"`
 }
 
 // ListEntry is a single entry in a list result.
 type ListEntry struct {
-	Path  string `json:"path"`
-	IsDir bool   `json:"is_dir"`
-	Size  int64  `json:"size"`
+	Path    string     `json:"path"`
+	IsDir   bool       `json:"is_dir"`
+	Size    int64      `json:"size"`
+	ModTime *time.Time `json:"mod_time,omitempty"` // With details only
+	Mode    string     `json:"mode,omitempty"`     // With details only, e.g. -rw-r--r--
 }
 
 // ListResult is the result of a list operation.
 type ListResult struct {
-	Entries []ListEntry `json:"entries"`
+	Entries   []ListEntry `json:"entries"`
+	Truncated bool        `json:"truncated,omitempty"` // More entries exist than MaxResults
 }
 
 // GlobResult is the result of a glob operation.
 type GlobResult struct {
-	Matches []string `json:"matches"`
+	Matches   []string `json:"matches"`
+	Truncated bool     `json:"truncated,omitempty"` // More matches exist than MaxResults
 }
 
 // GrepMatch is a single match in a grep result.
 type GrepMatch struct {
 	Path       string `json:"path"`
-	LineNumber int    `json:"line_number"`
-	Content    string `json:"content"`
+	LineNumber int    `json:"line_number"`          // First line of the match
+	Content    string `json:"content"`              // Matched lines, several for multiline matches
+	IsContext  bool   `json:"is_context,omitempty"` // Context line rather than a match
+}
+
+// GrepFileCount is the number of matches in one file.
+type GrepFileCount struct {
+	Path  string `json:"path"`
+	Count int    `json:"count"`
 }
 
 // GrepResult is the result of a grep operation.
 type GrepResult struct {
-	Matches   []GrepMatch `json:"matches"`
-	Content   string      `json:"content"`              // Formatted content (may be truncated)
-	Truncated bool        `json:"truncated,omitempty"`  // Whether content was truncated
-	FilePath  string      `json:"file_path,omitempty"`  // Path to full content if truncated
-	TotalSize int64       `json:"total_size,omitempty"` // Original content size
+	Matches   []GrepMatch     `json:"matches"`
+	Files     []string        `json:"files,omitempty"`      // files_with_matches mode
+	Counts    []GrepFileCount `json:"counts,omitempty"`     // count mode
+	Limited   bool            `json:"limited,omitempty"`    // Stopped at MaxResults
+	Skipped   []string        `json:"skipped,omitempty"`    // Files too large to search (without ripgrep only)
+	Content   string          `json:"content"`              // Formatted content (may be truncated)
+	Truncated bool            `json:"truncated,omitempty"`  // Whether content was truncated
+	FilePath  string          `json:"file_path,omitempty"`  // Path to full content if truncated
+	TotalSize int64           `json:"total_size,omitempty"` // Original content size
+
+	TotalLines      int `json:"total_lines,omitempty"`      // Lines in the original content
+	PreviewLines    int `json:"preview_lines,omitempty"`    // Lines shown when truncated
+	TotalTokens     int `json:"total_tokens,omitempty"`     // Estimated tokens of the original content
+	EstimatedTokens int `json:"estimated_tokens,omitempty"` // Estimated tokens of the content returned
+}
+
+// TailResult is the result of a tail operation.
+type TailResult struct {
+	Content   string   `json:"content"`              // Selected lines, oldest first (may be truncated)
+	Lines     int      `json:"lines"`                // Number of lines in content
+	Omitted   int      `json:"omitted,omitempty"`    // Earlier lines in the time window dropped by the line limit
+	Files     []string `json:"files"`                // Files read, oldest first
+	Followed  int      `json:"followed,omitempty"`   // Lines streamed while following
+	Truncated bool     `json:"truncated,omitempty"`  // Whether content was truncated
+	FilePath  string   `json:"file_path,omitempty"`  // Path to full content if truncated
+	TotalSize int64    `json:"total_size,omitempty"` // Original content size
+
+	TotalLines      int `json:"total_lines,omitempty"`      // Lines in the original content
+	PreviewLines    int `json:"preview_lines,omitempty"`    // Lines shown when truncated
+	TotalTokens     int `json:"total_tokens,omitempty"`     // Estimated tokens of the original content
+	EstimatedTokens int `json:"estimated_tokens,omitempty"` // Estimated tokens of the content returned
+}
+
+// Watch event operations
+const (
+	WatchOpCreate = "create"
+	WatchOpModify = "modify"
+	WatchOpDelete = "delete"
+)
+
+// WatchEvent is a debounced change of one path, streamed by watch.
+type WatchEvent struct {
+	Path  string    `json:"path"`
+	Op    string    `json:"op"` // create, modify, delete
+	IsDir bool      `json:"is_dir,omitempty"`
+	Size  int64     `json:"size,omitempty"` // Size after the change, files only
+	Time  time.Time `json:"time"`           // Time of the last change in the burst
+}
+
+// WatchResult is the result of a watch operation.
+type WatchResult struct {
+	Events    int    `json:"events"`              // Number of events streamed
+	Backend   string `json:"backend"`             // inotify or poll
+	Truncated bool   `json:"truncated,omitempty"` // Whether watching stopped at MaxEvents
+	Overflow  bool   `json:"overflow,omitempty"`  // Whether the kernel dropped events; some changes may be missing
+}
+
+// UploadBeginResult is the result of an upload_begin operation.
+type UploadBeginResult struct {
+	UploadID  string `json:"upload_id"`
+	ChunkSize int    `json:"chunk_size"`
+	Chunks    int    `json:"chunks"`   // Number of chunks in the file
+	Received  []int  `json:"received"` // Chunks already received by an earlier attempt
+}
+
+// UploadChunkResult is the result of an upload_chunk operation.
+type UploadChunkResult struct {
+	Received int `json:"received"` // Number of chunks received so far
+	Chunks   int `json:"chunks"`
+}
+
+// UploadCommitResult is the result of an upload_commit operation.
+type UploadCommitResult struct {
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	BackupError string `json:"backup_error,omitempty"` // Why the replaced file was not backed up; restore cannot undo the upload
+}
+
+// DownloadChunk is a piece of a downloaded file, sent on the chunk stream.
+type DownloadChunk struct {
+	Index  int    `json:"index"`
+	Offset int64  `json:"offset"`
+	Data   string `json:"data"`   // base64 encoded
+	SHA256 string `json:"sha256"` // Hash of the decoded chunk
+}
+
+// DownloadResult is the result of a download operation.
+type DownloadResult struct {
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"` // Hash of the whole file
+	ChunkSize int    `json:"chunk_size"`
+	Chunks    int    `json:"chunks"`             // Number of chunks in the file
+	Sent      int    `json:"sent"`               // Chunks streamed by this call
+	Redacted  bool   `json:"redacted,omitempty"` // Secrets were masked in chunks, SHA256 is then empty
+}
+
+// ArchiveResult is the result of an archive operation.
+type ArchiveResult struct {
+	Path      string `json:"path"`
+	Format    string `json:"format"`
+	Files     int    `json:"files"`      // Number of files included
+	TotalSize int64  `json:"total_size"` // Bytes of the included files
+	Size      int64  `json:"size"`       // Bytes of the archive
+	SHA256    string `json:"sha256"`     // Hash of the archive
+
+	BackupError string `json:"backup_error,omitempty"` // Why the replaced output was not backed up; restore cannot undo the archive
+}
+
+// ExtractResult is the result of an extract operation.
+type ExtractResult struct {
+	Files     int      `json:"files"`             // Number of files extracted
+	TotalSize int64    `json:"total_size"`        // Bytes extracted
+	Skipped   []string `json:"skipped,omitempty"` // Entries not extracted: links and special files
+}
+
+// File types reported by stat
+const (
+	FileTypeFile    = "file"
+	FileTypeDir     = "dir"
+	FileTypeSymlink = "symlink"
+	FileTypeOther   = "other"
+)
+
+// StatResult is the result of a stat operation.
+// A missing path is not an error: Exists is false and the other fields are empty.
+type StatResult struct {
+	Path       string     `json:"path"`
+	Exists     bool       `json:"exists"`
+	Type       string     `json:"type,omitempty"` // file, dir, symlink, other
+	Size       int64      `json:"size,omitempty"`
+	Mode       string     `json:"mode,omitempty"`
+	ModTime    *time.Time `json:"mod_time,omitempty"`
+	LinkTarget string     `json:"link_target,omitempty"` // Symlinks only
+}
+
+// MkdirResult is the result of a mkdir operation.
+type MkdirResult struct {
+	Path    string `json:"path"`
+	Created bool   `json:"created"` // False if the directory already existed
+}
+
+// MoveResult is the result of a move operation.
+type MoveResult struct {
+	Source      string `json:"source"`
+	Dest        string `json:"dest"`
+	Overwritten bool   `json:"overwritten,omitempty"`
+	BackupError string `json:"backup_error,omitempty"` // Why the source or the replaced destination was not backed up; restore cannot undo the move
+}
+
+// CopyResult is the result of a copy operation.
+type CopyResult struct {
+	Files     int      `json:"files"`             // Number of files copied
+	TotalSize int64    `json:"total_size"`        // Bytes copied
+	Skipped   []string `json:"skipped,omitempty"` // Symlinks and special files not copied
+
+	BackupError string `json:"backup_error,omitempty"` // Why the replaced destination was not backed up; restore cannot undo the copy
+}
+
+// DeleteResult is the result of a delete operation.
+type DeleteResult struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"` // Number of files and links removed
+	Dirs  int    `json:"dirs"`  // Number of directories removed
+
+	BackupError string `json:"backup_error,omitempty"` // Why the deleted file was not backed up; restore cannot undo the deletion
 }
 
 // BashResult is the result of a bash operation.
@@ -224,6 +763,28 @@ type BashResult struct {
 	Truncated bool   `json:"truncated,omitempty"`  // Whether content was truncated
 	FilePath  string `json:"file_path,omitempty"`  // Path to full content if truncated
 	TotalSize int64  `json:"total_size,omitempty"` // Original content size
+
+	TotalLines      int `json:"total_lines,omitempty"`      // Lines in the original content
+	PreviewLines    int `json:"preview_lines,omitempty"`    // Lines shown when truncated
+	TotalTokens     int `json:"total_tokens,omitempty"`     // Estimated tokens of the original content
+	EstimatedTokens int `json:"estimated_tokens,omitempty"` // Estimated tokens of the content returned
+
+	// When stdout was parsed, it is returned as Parsed, or as ParsedSummary
+	// if too large, instead of as Stdout
+	Parsed        json.RawMessage `json:"parsed,omitempty"`
+	ParsedFormat  string          `json:"parsed_format,omitempty"`  // Format stdout was parsed from
+	ParsedSummary *ParsedSummary  `json:"parsed_summary,omitempty"` // Replaces Parsed when it exceeds the output limits
+	ParseError    string          `json:"parse_error,omitempty"`    // Why stdout could not be parsed; it is returned as Stdout
+}
+
+// ParsedSummary describes parsed output too large to return: its structure
+// and a sample of the items of its largest array.
+type ParsedSummary struct {
+	Schema        any    `json:"schema"`                   // The value with strings, numbers, booleans and nulls replaced by their type names and arrays by the merged schema of their items
+	ItemsPath     string `json:"items_path,omitempty"`     // Dot-separated path of the sampled array, empty for the value itself
+	Items         int    `json:"items"`                    // Number of items in the array
+	Sample        []any  `json:"sample,omitempty"`         // Items spread evenly over the array
+	SampleIndexes []int  `json:"sample_indexes,omitempty"` // Indexes of the sampled items
 }
 
 // WebFetchArgs are the arguments for webfetch operation.
@@ -231,6 +792,9 @@ type WebFetchArgs struct {
 	URL     string `json:"url"`
 	Format  string `json:"format,omitempty"`  // markdown, text, html (default: markdown)
 	Timeout int    `json:"timeout,omitempty"` // seconds (default: 30, max: 120)
+
+	Truncate  string `json:"truncate,omitempty"`   // One of the Truncate* strategies
+	MaxTokens int    `json:"max_tokens,omitempty"` // Output limit in estimated tokens, see the Truncate* strategies
 }
 
 // WebFetchResult is the result of a webfetch operation.
@@ -240,6 +804,11 @@ type WebFetchResult struct {
 	Truncated bool   `json:"truncated,omitempty"`  // Whether content was truncated
 	FilePath  string `json:"file_path,omitempty"`  // Path to full content if truncated
 	TotalSize int64  `json:"total_size,omitempty"` // Original content size
+
+	TotalLines      int `json:"total_lines,omitempty"`      // Lines in the original content
+	PreviewLines    int `json:"preview_lines,omitempty"`    // Lines shown when truncated
+	TotalTokens     int `json:"total_tokens,omitempty"`     // Estimated tokens of the original content
+	EstimatedTokens int `json:"estimated_tokens,omitempty"` // Estimated tokens of the content returned
 }
 
 // MCPCallArgs are the arguments for mcp_call operation.
@@ -248,6 +817,9 @@ type MCPCallArgs struct {
 	ToolName string          `json:"tool_name"`
 	Args     json.RawMessage `json:"args"`
 	Timeout  int             `json:"timeout,omitempty"` // seconds
+
+	Truncate  string `json:"truncate,omitempty"`   // One of the Truncate* strategies
+	MaxTokens int    `json:"max_tokens,omitempty"` // Output limit in estimated tokens, see the Truncate* strategies
 }
 
 // MCPCallResult is the result of an mcp_call operation.
@@ -257,6 +829,11 @@ type MCPCallResult struct {
 	Truncated bool   `json:"truncated,omitempty"`  // Whether content was truncated
 	FilePath  string `json:"file_path,omitempty"`  // Path to full content if truncated
 	TotalSize int64  `json:"total_size,omitempty"` // Original content size
+
+	TotalLines      int `json:"total_lines,omitempty"`      // Lines in the original content
+	PreviewLines    int `json:"preview_lines,omitempty"`    // Lines shown when truncated
+	TotalTokens     int `json:"total_tokens,omitempty"`     // Estimated tokens of the original content
+	EstimatedTokens int `json:"estimated_tokens,omitempty"` // Estimated tokens of the content returned
 }
 
 // MCPListToolsArgs are the arguments for mcp_list_tools operation.
@@ -283,6 +860,273 @@ type SyncSkillResult struct {
 	Path    string `json:"path"` // Local path where skill was extracted
 }
 
+// EndSessionResult is the result of an end_session operation. The session is
+// the one the task belongs to, by source instance or trace ID.
+type EndSessionResult struct {
+	Session string `json:"session"`
+	Removed bool   `json:"removed"` // False if the session had no directory
+}
+
+// ProcessesArgs are the arguments for processes operation.
+type ProcessesArgs struct {
+	SortBy   string `json:"sort_by,omitempty"`   // cpu, memory, pid (default: cpu)
+	Limit    int    `json:"limit,omitempty"`     // Maximum processes returned (default: 50, max: 1000)
+	Filter   string `json:"filter,omitempty"`    // Only processes whose name or command line contains this
+	SampleMS int    `json:"sample_ms,omitempty"` // CPU usage sampling interval in milliseconds (default: 500, max: 5000)
+}
+
+// ProcessInfo describes a process.
+type ProcessInfo struct {
+	PID           int     `json:"pid"`
+	PPID          int     `json:"ppid"`
+	User          string  `json:"user"`
+	Name          string  `json:"name"`
+	State         string  `json:"state"`             // R running, S sleeping, D disk sleep, Z zombie, T stopped...
+	Command       string  `json:"command,omitempty"` // Command line, empty for kernel threads
+	Threads       int     `json:"threads"`
+	CPUPercent    float64 `json:"cpu_percent"`    // CPU usage during the sample, 100 is one full CPU
+	CPUSeconds    float64 `json:"cpu_seconds"`    // CPU time used since the process started
+	RSSBytes      int64   `json:"rss_bytes"`      // Resident memory
+	MemoryPercent float64 `json:"memory_percent"` // Resident memory as a share of total memory
+	StartedAt     string  `json:"started_at,omitempty"`
+}
+
+// ProcessesResult is the result of a processes operation.
+type ProcessesResult struct {
+	Processes []ProcessInfo `json:"processes"`
+	Total     int           `json:"total"` // Processes matching the filter, before Limit
+}
+
+// SocketsArgs are the arguments for sockets operation.
+type SocketsArgs struct {
+	Protocol string `json:"protocol,omitempty"` // tcp, udp (default: both)
+}
+
+// SocketInfo describes a listening socket.
+type SocketInfo struct {
+	Protocol string `json:"protocol"` // tcp, tcp6, udp, udp6
+	Address  string `json:"address"`  // Local address, e.g. "0.0.0.0" or "::1"
+	Port     int    `json:"port"`
+	User     string `json:"user,omitempty"`
+	PID      int    `json:"pid,omitempty"`     // Owning process, when visible to the runner
+	Process  string `json:"process,omitempty"` // Name of the owning process
+}
+
+// SocketsResult is the result of a sockets operation.
+type SocketsResult struct {
+	Sockets []SocketInfo `json:"sockets"`
+}
+
+// DisksArgs are the arguments for disks operation.
+type DisksArgs struct {
+	All bool `json:"all,omitempty"` // Include pseudo filesystems such as proc, sysfs and cgroup
+}
+
+// DiskInfo describes the usage of a mounted filesystem.
+type DiskInfo struct {
+	Device            string  `json:"device"`
+	MountPoint        string  `json:"mount_point"`
+	FSType            string  `json:"fs_type"`
+	ReadOnly          bool    `json:"read_only,omitempty"`
+	TotalBytes        int64   `json:"total_bytes"`
+	UsedBytes         int64   `json:"used_bytes"`
+	AvailableBytes    int64   `json:"available_bytes"` // Available to unprivileged users
+	UsedPercent       float64 `json:"used_percent"`    // As df reports it: used / (used + available)
+	Inodes            int64   `json:"inodes,omitempty"`
+	InodesUsed        int64   `json:"inodes_used,omitempty"`
+	InodesUsedPercent float64 `json:"inodes_used_percent,omitempty"`
+}
+
+// DisksResult is the result of a disks operation.
+type DisksResult struct {
+	Disks []DiskInfo `json:"disks"`
+}
+
+// MemoryResult is the result of a memory operation. It takes no arguments.
+type MemoryResult struct {
+	TotalBytes             int64   `json:"total_bytes"`
+	UsedBytes              int64   `json:"used_bytes"`      // Total minus available
+	AvailableBytes         int64   `json:"available_bytes"` // Free plus memory the kernel can reclaim
+	FreeBytes              int64   `json:"free_bytes"`
+	UsedPercent            float64 `json:"used_percent"`
+	BuffersBytes           int64   `json:"buffers_bytes"`
+	CachedBytes            int64   `json:"cached_bytes"`
+	ShmemBytes             int64   `json:"shmem_bytes"` // Shared memory and tmpfs, counted in cached but not reclaimable
+	AnonBytes              int64   `json:"anon_bytes"`  // Process memory not backed by files
+	SlabReclaimableBytes   int64   `json:"slab_reclaimable_bytes"`
+	SlabUnreclaimableBytes int64   `json:"slab_unreclaimable_bytes"`
+	DirtyBytes             int64   `json:"dirty_bytes"`
+	SwapTotalBytes         int64   `json:"swap_total_bytes"`
+	SwapUsedBytes          int64   `json:"swap_used_bytes"`
+	OOMKills               int64   `json:"oom_kills"`        // Processes killed by the OOM killer since boot
+	Cgroup                 *Cgroup `json:"cgroup,omitempty"` // Memory limit of the runner's cgroup, when limited
+}
+
+// Cgroup describes the memory limit and usage of a cgroup.
+type Cgroup struct {
+	Path        string  `json:"path"`
+	LimitBytes  int64   `json:"limit_bytes"`
+	UsageBytes  int64   `json:"usage_bytes"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// KernelLogArgs are the arguments for kernel_log operation.
+type KernelLogArgs struct {
+	Lines int    `json:"lines,omitempty"` // Most recent messages returned (default: 100, max: 1000)
+	Level string `json:"level,omitempty"` // Minimum severity: emerg, alert, crit, err, warning, notice, info, debug (default: debug)
+	Since string `json:"since,omitempty"` // Only messages after this: RFC3339 time or duration before now, e.g. "1h"
+}
+
+// KernelLogEntry is a kernel log message.
+type KernelLogEntry struct {
+	Time    string `json:"time"`  // RFC3339 time computed from the boot time, as dmesg -T does
+	Level   string `json:"level"` // emerg, alert, crit, err, warning, notice, info, debug
+	Message string `json:"message"`
+}
+
+// KernelLogResult is the result of a kernel_log operation.
+type KernelLogResult struct {
+	Entries   []KernelLogEntry `json:"entries"`
+	Truncated bool             `json:"truncated,omitempty"` // More messages matched than Lines
+}
+
+// SystemdArgs are the arguments for systemd operation.
+type SystemdArgs struct {
+	Units []string `json:"units,omitempty"` // Units to show, e.g. nginx.service (default: service units that are active or failed)
+	State string   `json:"state,omitempty"` // Without units, only service units in this state, e.g. failed or running
+}
+
+// SystemdUnit describes the state of a systemd unit, with resource usage
+// from its cgroup when it is running.
+type SystemdUnit struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	LoadState   string  `json:"load_state"`       // loaded, not-found, masked...
+	ActiveState string  `json:"active_state"`     // active, inactive, failed, activating...
+	SubState    string  `json:"sub_state"`        // running, exited, dead, auto-restart...
+	Result      string  `json:"result,omitempty"` // success, exit-code, signal, timeout, oom-kill...
+	MainPID     int     `json:"main_pid,omitempty"`
+	ExitStatus  int     `json:"exit_status,omitempty"` // Exit status of the last main process
+	Restarts    int     `json:"restarts,omitempty"`    // Automatic restarts since the unit was started
+	ActiveSince string  `json:"active_since,omitempty"`
+	MemoryBytes int64   `json:"memory_bytes,omitempty"`
+	CPUSeconds  float64 `json:"cpu_seconds,omitempty"`
+	Tasks       int     `json:"tasks,omitempty"`
+}
+
+// SystemdResult is the result of a systemd operation.
+type SystemdResult struct {
+	Units []SystemdUnit `json:"units"`
+}
+
+// K8sGetArgs are the arguments for k8s_get operation.
+type K8sGetArgs struct {
+	Resource      string `json:"resource"`                 // Resource type as kubectl accepts it, e.g. pods, deploy, ingresses.networking.k8s.io
+	Name          string `json:"name,omitempty"`           // Get one object instead of listing
+	Namespace     string `json:"namespace,omitempty"`      // Default: the namespace of the kubeconfig context
+	AllNamespaces bool   `json:"all_namespaces,omitempty"` // List in all allowed namespaces
+	LabelSelector string `json:"label_selector,omitempty"` // e.g. "app=nginx,tier!=cache"
+	FieldSelector string `json:"field_selector,omitempty"` // e.g. "status.phase=Running"
+	Output        string `json:"output,omitempty"`         // table or object (default: table when listing, object with name)
+	Limit         int    `json:"limit,omitempty"`          // Maximum objects listed (default: 100, max: 500)
+}
+
+// K8sGetResult is the result of a k8s_get operation. Table output has the
+// columns kubectl get prints, object output the objects themselves.
+type K8sGetResult struct {
+	Kind      string   `json:"kind"`
+	Columns   []string `json:"columns,omitempty"`
+	Rows      [][]any  `json:"rows,omitempty"`
+	Objects   []any    `json:"objects,omitempty"`
+	Truncated bool     `json:"truncated,omitempty"` // More objects matched than Limit
+}
+
+// K8sDescribeArgs are the arguments for k8s_describe operation.
+type K8sDescribeArgs struct {
+	Resource  string `json:"resource"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// K8sDescribeResult is the result of a k8s_describe operation: the object
+// and the events about it, as kubectl describe shows them.
+type K8sDescribeResult struct {
+	Object any        `json:"object"`
+	Events []K8sEvent `json:"events"` // Empty when events are not allowed
+}
+
+// K8sLogsArgs are the arguments for k8s_logs operation.
+type K8sLogsArgs struct {
+	Pod        string `json:"pod"`
+	Namespace  string `json:"namespace,omitempty"`
+	Container  string `json:"container,omitempty"`  // Required when the pod has several containers
+	Previous   bool   `json:"previous,omitempty"`   // Logs of the previous, crashed instance of the container
+	TailLines  int    `json:"tail_lines,omitempty"` // Lines from the end (default: 200, max: 5000)
+	Since      string `json:"since,omitempty"`      // Only lines after this: RFC3339 time or duration before now, e.g. "15m"
+	Timestamps bool   `json:"timestamps,omitempty"` // Prefix lines with their time
+}
+
+// K8sLogsResult is the result of a k8s_logs operation.
+type K8sLogsResult struct {
+	Output    string `json:"output"`
+	Lines     int    `json:"lines"`
+	Truncated bool   `json:"truncated,omitempty"` // Output exceeded the size limit and was cut at the start
+}
+
+// K8sEventsArgs are the arguments for k8s_events operation.
+type K8sEventsArgs struct {
+	Namespace     string `json:"namespace,omitempty"`
+	AllNamespaces bool   `json:"all_namespaces,omitempty"`
+	Kind          string `json:"kind,omitempty"`  // Only events about objects of this kind, e.g. Pod
+	Name          string `json:"name,omitempty"`  // Only events about objects with this name
+	Type          string `json:"type,omitempty"`  // Normal or Warning
+	Since         string `json:"since,omitempty"` // Only events seen after this: RFC3339 time or duration before now
+	Limit         int    `json:"limit,omitempty"` // Most recent events returned (default: 100, max: 1000)
+}
+
+// K8sEvent is a Kubernetes event.
+type K8sEvent struct {
+	Namespace string `json:"namespace,omitempty"`
+	Type      string `json:"type"`   // Normal or Warning
+	Reason    string `json:"reason"` // e.g. BackOff, FailedScheduling, OOMKilling
+	Object    string `json:"object"` // Kind/name of the object, e.g. Pod/web-7d9c
+	Message   string `json:"message"`
+	Count     int    `json:"count"`
+	FirstSeen string `json:"first_seen,omitempty"`
+	LastSeen  string `json:"last_seen,omitempty"`
+	Source    string `json:"source,omitempty"` // Component that reported it, e.g. kubelet
+}
+
+// K8sEventsResult is the result of a k8s_events operation.
+type K8sEventsResult struct {
+	Events    []K8sEvent `json:"events"`
+	Truncated bool       `json:"truncated,omitempty"` // More events matched than Limit
+}
+
+// DBQueryArgs are the arguments for db_query operation.
+type DBQueryArgs struct {
+	Database string `json:"database"`        // Connection profile name from the runner's databases config
+	Query    string `json:"query"`           // A single SELECT, WITH, SHOW, EXPLAIN, VALUES or TABLE statement
+	Args     []any  `json:"args,omitempty"`  // Placeholder values: $1, $2 for postgres, ? for mysql
+	Limit    int    `json:"limit,omitempty"` // Maximum rows returned (default and max: the profile's max_rows)
+}
+
+// DBColumn describes a column of a query result.
+type DBColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // Database type name, e.g. int8, varchar, jsonb
+}
+
+// DBQueryResult is the result of a db_query operation. Values are JSON
+// numbers, booleans, strings or null; JSON columns are embedded as is,
+// times are RFC3339, decimals are strings to keep their precision, and
+// binary values that are not text are hex strings prefixed with \x.
+type DBQueryResult struct {
+	Columns   []DBColumn `json:"columns"`
+	Rows      [][]any    `json:"rows"`
+	Truncated bool       `json:"truncated,omitempty"` // More rows matched than Limit
+}
+
 // MCPToolInfo represents metadata for an MCP tool.
 type MCPToolInfo struct {
 	Name        string `json:"name"`
@@ -318,8 +1162,9 @@ type MCPCallPayload struct {
 
 // MCPResultPayload is the payload for MCP call results.
 type MCPResultPayload struct {
-	CallID  string          `json:"call_id"`
-	Success bool            `json:"success"`
-	Result  json.RawMessage `json:"result,omitempty"`
-	Error   string          `json:"error,omitempty"`
+	CallID     string          `json:"call_id"`
+	Success    bool            `json:"success"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Redactions int             `json:"redactions,omitempty"` // Secrets masked in the result and error
 }
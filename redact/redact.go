@@ -0,0 +1,189 @@
+// Package redact masks credentials in output before it leaves the host.
+//
+// Command output, file contents, search results and MCP content are sent to
+// the cloud and read by an LLM, so a stray "cat .env" or "env" would leak
+// tokens and passwords. A Redactor replaces secrets it recognizes with a
+// marker naming what was removed, such as "[REDACTED:aws_access_key_id]".
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// markerPrefix starts the text that replaces a secret.
+const markerPrefix = "[REDACTED"
+
+// Rule masks the matches of a pattern. If the pattern has capture groups,
+// only the text they match is masked, so a rule can keep the name of a
+// setting and mask its value.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// secretKeywords name settings that hold secrets, as in DB_PASSWORD,
+// client_secret, GITHUB_TOKEN or the client-key-data of a kubeconfig.
+const secretKeywords = `(?:password|passwd|secret|token|api[_-]?key|access[_-]?key|private[_-]?key|key[_-]?data|credentials?)`
+
+// DefaultRules are the built-in rules. Rules for whole blocks come first so
+// later rules do not mask parts of them.
+var DefaultRules = []Rule{
+	// A key cut off by truncation is masked to the end of the text
+	{"private_key", regexp.MustCompile(`-----BEGIN[A-Z ]* PRIVATE KEY(?: BLOCK)?-----(?:[\s\S]*?-----END[A-Z ]* PRIVATE KEY(?: BLOCK)?-----|[\s\S]*)`)},
+	{"aws_access_key_id", regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b`)},
+	{"aws_secret_access_key", regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})`)},
+	{"aws_session_token", regexp.MustCompile(`(?i)aws_?session_?token["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{100,})`)},
+	{"gcp_api_key", regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{"gcp_oauth_token", regexp.MustCompile(`\bya29\.[0-9A-Za-z_\-]{20,}`)},
+	{"github_token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{50,})\b`)},
+	{"gitlab_token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_\-]{20,}`)},
+	{"slack_token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"api_key", regexp.MustCompile(`\b(?:sk-(?:proj-|ant-)?[A-Za-z0-9_\-]{20,}|[rs]k_live_[A-Za-z0-9]{20,})`)},
+	// Kubernetes service account tokens and most OIDC tokens are JWTs
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{"authorization", regexp.MustCompile(`(?i)\b(?:authorization\s*:\s*(?:bearer|basic|token)|bearer)\s+([A-Za-z0-9\-._~+/]{16,}=*)`)},
+	{"url_password", regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.\-]*://[^/\s:@]+:([^@\s/]+)@`)},
+	// Settings such as DB_PASSWORD=x, "client_secret": "x" or token: x. A
+	// value starting with "=" is code such as token := x or password == "",
+	// not an assignment.
+	{"secret", regexp.MustCompile(`(?i)\b[A-Za-z0-9_.\-]*` + secretKeywords + `["']?\s*[:=]\s*(?:"([^"\n]+)"|'([^'\n]+)'|([^\s"',;=][^\s"',;]*))`)},
+}
+
+// secretKeyPattern matches JSON object keys whose string values are secrets.
+var secretKeyPattern = regexp.MustCompile(`(?i)` + secretKeywords + `$`)
+
+// HasMarker reports whether s contains the text that replaces a secret, as
+// content read through a Redactor and written back would.
+func HasMarker(s string) bool {
+	return strings.Contains(s, markerPrefix+":")
+}
+
+// Redactor masks secrets in text and JSON.
+type Redactor struct {
+	rules []Rule
+}
+
+// New returns a Redactor with the default rules and rules for the given
+// user-defined patterns.
+func New(patterns []string) (*Redactor, error) {
+	rules := append([]Rule(nil), DefaultRules...)
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		rules = append(rules, Rule{Name: "custom", Pattern: re})
+	}
+	return &Redactor{rules: rules}, nil
+}
+
+// String masks secrets in s and returns the result and the number of
+// secrets masked.
+func (r *Redactor) String(s string) (string, int) {
+	count := 0
+	for _, rule := range r.rules {
+		var n int
+		s, n = maskRule(s, rule)
+		count += n
+	}
+	return s, count
+}
+
+// maskRule masks the matches of rule in s.
+func maskRule(s string, rule Rule) (string, int) {
+	matches := rule.Pattern.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s, 0
+	}
+	marker := markerPrefix + ":" + rule.Name + "]"
+
+	var sb strings.Builder
+	count, last := 0, 0
+	for _, m := range matches {
+		// Mask the groups that matched, or the whole match without groups
+		spans := [][2]int{{m[0], m[1]}}
+		if len(m) > 2 {
+			spans = spans[:0]
+			for i := 2; i+1 < len(m); i += 2 {
+				if m[i] >= 0 && m[i+1] > m[i] {
+					spans = append(spans, [2]int{m[i], m[i+1]})
+				}
+			}
+		}
+		for _, span := range spans {
+			if span[0] < last || strings.HasPrefix(s[span[0]:span[1]], markerPrefix) {
+				continue
+			}
+			sb.WriteString(s[last:span[0]])
+			sb.WriteString(marker)
+			last = span[1]
+			count++
+		}
+	}
+	if count == 0 {
+		return s, 0
+	}
+	sb.WriteString(s[last:])
+	return sb.String(), count
+}
+
+// JSON masks secrets in the string values of a JSON document, and masks
+// string values of keys such as "password" entirely. It returns the document
+// unchanged when nothing was masked.
+func (r *Redactor) JSON(data []byte) ([]byte, int) {
+	if len(data) == 0 {
+		return data, 0
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		// Not JSON: mask it as text
+		s, n := r.String(string(data))
+		return []byte(s), n
+	}
+
+	v, count := r.value(v, "")
+	if count == 0 {
+		return data, 0
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return data, 0
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), count
+}
+
+// value masks secrets in v, the value of key in its enclosing object.
+func (r *Redactor) value(v any, key string) (any, int) {
+	switch v := v.(type) {
+	case map[string]any:
+		count := 0
+		for k, child := range v {
+			masked, n := r.value(child, k)
+			v[k] = masked
+			count += n
+		}
+		return v, count
+	case []any:
+		count := 0
+		for i, item := range v {
+			masked, n := r.value(item, key)
+			v[i] = masked
+			count += n
+		}
+		return v, count
+	case string:
+		if v != "" && secretKeyPattern.MatchString(key) && !strings.HasPrefix(v, markerPrefix) {
+			return markerPrefix + ":secret]", 1
+		}
+		return r.String(v)
+	}
+	return v, 0
+}
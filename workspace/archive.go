@@ -0,0 +1,573 @@
+package workspace
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// DefaultArchiveMaxSize caps the bytes archived or extracted when no limit is given
+const DefaultArchiveMaxSize = 1024 * 1024 * 1024
+
+// archiveFile is a file to add to an archive.
+type archiveFile struct {
+	path string // Real path
+	name string // Entry name in the archive
+	info fs.FileInfo
+}
+
+// Archive creates a tar.gz or zip archive of the files matched by a set of globs.
+func (w *Workspace) Archive(ctx context.Context, args *protocol.ArchiveArgs) (*protocol.ArchiveResult, error) {
+	if len(args.Paths) == 0 {
+		return nil, fmt.Errorf("paths is required")
+	}
+
+	format := args.Format
+	switch {
+	case format == "" && strings.HasSuffix(args.Output, ".zip"):
+		format = protocol.ArchiveFormatZip
+	case format == "":
+		format = protocol.ArchiveFormatTarGz
+	case format != protocol.ArchiveFormatTarGz && format != protocol.ArchiveFormatZip:
+		return nil, fmt.Errorf("invalid format %q: must be %s or %s", format, protocol.ArchiveFormatTarGz, protocol.ArchiveFormatZip)
+	}
+
+	outPath, err := w.safePath(args.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	maxSize := args.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultArchiveMaxSize
+	}
+
+	files, total, err := w.collectArchiveFiles(ctx, args.Paths, args.Exclude, outPath, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files match %s", strings.Join(args.Paths, ", "))
+	}
+
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	dir := filepath.Dir(outPath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(outPath)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tmp.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	h := sha256.New()
+	out := bufio.NewWriter(io.MultiWriter(tmp, h))
+	if format == protocol.ArchiveFormatZip {
+		err = writeZip(ctx, out, files)
+	} else {
+		err = writeTarGz(ctx, out, files)
+	}
+	if err == nil {
+		err = out.Flush()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close temp file: %w", err)
+	}
+	info, err := os.Stat(tmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat archive: %w", err)
+	}
+
+	if err := w.disk.reserveReplace("archive", args.Output, outPath, info.Size()); err != nil {
+		return nil, err
+	}
+	backupErr := w.backup(outPath, "archive")
+	if err := installFile(tmpPath, outPath, 0o644); err != nil {
+		return nil, err
+	}
+	committed = true
+
+	return &protocol.ArchiveResult{
+		Path:        args.Output,
+		Format:      format,
+		Files:       len(files),
+		TotalSize:   total,
+		Size:        info.Size(),
+		SHA256:      hex.EncodeToString(h.Sum(nil)),
+		BackupError: backupErr,
+	}, nil
+}
+
+// collectArchiveFiles expands the globs into regular files, sorted by entry
+// name. Matched directories are included recursively; symlinks are skipped so
+// an archive cannot pick up files outside the workspace or mount.
+func (w *Workspace) collectArchiveFiles(ctx context.Context, patterns, exclude []string, output string, maxSize int64) ([]archiveFile, int64, error) {
+	seen := make(map[string]bool)
+	var files []archiveFile
+	var total int64
+
+	add := func(path, name string, info fs.FileInfo) error {
+		if !info.Mode().IsRegular() || path == output || seen[path] {
+			return nil
+		}
+		seen[path] = true
+		total += info.Size()
+		if total > maxSize {
+			return fmt.Errorf("files exceed the maximum archive size of %d bytes", maxSize)
+		}
+		files = append(files, archiveFile{path: path, name: name, info: info})
+		return nil
+	}
+
+	for _, pattern := range patterns {
+		root, glob, prefix, err := w.globRoot(pattern)
+		if err != nil {
+			return nil, 0, err
+		}
+		// Mount names become top-level directories in the archive
+		namePrefix := strings.TrimSuffix(prefix, MountSeparator)
+		if namePrefix != "" {
+			namePrefix += "/"
+		}
+
+		err = doublestar.GlobWalk(os.DirFS(root), glob, func(match string, d fs.DirEntry) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if matchesAnyGlob(exclude, match) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			full := filepath.Join(root, filepath.FromSlash(match))
+			if !d.IsDir() {
+				info, err := os.Lstat(full)
+				if err != nil {
+					return err
+				}
+				return add(full, namePrefix+match, info)
+			}
+
+			err := filepath.WalkDir(full, func(p string, e fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				rel, err := filepath.Rel(root, p)
+				if err != nil {
+					return err
+				}
+				rel = filepath.ToSlash(rel)
+				if p != full && matchesAnyGlob(exclude, rel) {
+					if e.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if e.IsDir() {
+					return nil
+				}
+				info, err := e.Info()
+				if err != nil {
+					return err
+				}
+				return add(p, namePrefix+rel, info)
+			})
+			if err != nil {
+				return err
+			}
+			// Already walked
+			return filepath.SkipDir
+		}, doublestar.WithNoFollow())
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, 0, ctxErr
+			}
+			return nil, 0, fmt.Errorf("failed to collect %s: %w", pattern, err)
+		}
+	}
+
+	slices.SortFunc(files, func(a, b archiveFile) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return files, total, nil
+}
+
+// writeTarGz writes files as a gzip compressed tar archive.
+func writeTarGz(ctx context.Context, w io.Writer, files []archiveFile) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(f.info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = f.name
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if err := copyArchiveFile(tw, f); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeZip writes files as a zip archive.
+func writeZip(ctx context.Context, w io.Writer, files []archiveFile) error {
+	zw := zip.NewWriter(w)
+
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := zip.FileInfoHeader(f.info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = f.name
+		hdr.Method = zip.Deflate
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if err := copyArchiveFile(fw, f); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// copyArchiveFile copies exactly the size recorded when the file was collected.
+func copyArchiveFile(w io.Writer, f archiveFile) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	if _, err := io.CopyN(w, file, f.info.Size()); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s changed while archiving", f.name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Extract extracts a tar, tar.gz or zip archive into a workspace directory.
+// Entries may not escape the destination, links and special files are
+// skipped, and the total extracted size is capped.
+func (w *Workspace) Extract(ctx context.Context, args *protocol.ExtractArgs) (*protocol.ExtractResult, error) {
+	loc, err := w.resolveRead(args.Path)
+	if err != nil {
+		return nil, err
+	}
+	dest, err := w.safePath(args.Dest)
+	if err != nil {
+		return nil, err
+	}
+
+	format := args.Format
+	switch format {
+	case "":
+		if format, err = detectArchiveFormat(loc.path); err != nil {
+			return nil, err
+		}
+	case protocol.ArchiveFormatTar, protocol.ArchiveFormatTarGz, protocol.ArchiveFormatZip:
+	default:
+		return nil, fmt.Errorf("invalid format %q: must be %s, %s or %s", format, protocol.ArchiveFormatTar, protocol.ArchiveFormatTarGz, protocol.ArchiveFormatZip)
+	}
+
+	maxSize := args.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultArchiveMaxSize
+	}
+
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(dest); err == nil {
+		dest = resolved
+	}
+
+	x := &extractor{
+		dest:      dest,
+		remaining: maxSize,
+		maxSize:   maxSize,
+		overwrite: args.Overwrite,
+		result:    &protocol.ExtractResult{},
+		reserve: func(name string, n int64) error {
+			return w.disk.reserve("extract", filepath.Join(args.Dest, name), n)
+		},
+	}
+	if format == protocol.ArchiveFormatZip {
+		err = x.extractZip(ctx, loc.path)
+	} else {
+		err = x.extractTar(ctx, loc.path, format == protocol.ArchiveFormatTarGz)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return x.result, nil
+}
+
+// detectArchiveFormat identifies an archive by its leading bytes.
+func detectArchiveFormat(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	magic := make([]byte, 4)
+	n, _ := io.ReadFull(file, magic)
+	switch {
+	case bytes.HasPrefix(magic[:n], []byte("PK\x03\x04")), bytes.HasPrefix(magic[:n], []byte("PK\x05\x06")):
+		return protocol.ArchiveFormatZip, nil
+	case bytes.HasPrefix(magic[:n], []byte{0x1f, 0x8b}):
+		return protocol.ArchiveFormatTarGz, nil
+	default:
+		return protocol.ArchiveFormatTar, nil
+	}
+}
+
+// archiveEntryTarget returns where an archive entry is extracted, rejecting
+// names that would escape dest directly or through a symlink already inside
+// it. dest must have symlinks resolved.
+func archiveEntryTarget(dest, name string) (string, error) {
+	cleanName := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(cleanName) || cleanName == ".." || strings.HasPrefix(cleanName, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid file path in archive: %s", name)
+	}
+
+	target := filepath.Join(dest, cleanName)
+	if !isWithin(dest, target) {
+		return "", fmt.Errorf("file path escapes destination: %s", name)
+	}
+
+	// The closest existing parent decides where new directories are created
+	for dir := filepath.Dir(target); isWithin(dest, dir) && dir != dest; dir = filepath.Dir(dir) {
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		if !isWithin(dest, real) {
+			return "", fmt.Errorf("file path escapes destination via symlink: %s", name)
+		}
+		break
+	}
+	return target, nil
+}
+
+// extractor writes archive entries below dest.
+type extractor struct {
+	dest      string
+	remaining int64 // Bytes left before maxSize is reached
+	maxSize   int64
+	overwrite bool
+	result    *protocol.ExtractResult
+	reserve   func(name string, n int64) error // Accounts for extracted bytes against the quota
+}
+
+func (x *extractor) extractTar(ctx context.Context, path string, compressed bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var r io.Reader = file
+	if compressed {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to read gzip archive: %w", err)
+		}
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar archive: %w", err)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = x.mkdir(hdr.Name)
+		case tar.TypeReg:
+			err = x.writeFile(hdr.Name, tr, hdr.FileInfo().Mode())
+		case tar.TypeXGlobalHeader:
+		default:
+			x.result.Skipped = append(x.result.Skipped, hdr.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (x *extractor) extractZip(ctx context.Context, path string) error {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("failed to read zip archive: %w", err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	for _, f := range reader.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = x.mkdir(f.Name)
+		case mode.IsRegular():
+			err = x.extractZipEntry(f)
+		default:
+			x.result.Skipped = append(x.result.Skipped, f.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *extractor) extractZipEntry(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	return x.writeFile(f.Name, rc, f.Mode())
+}
+
+func (x *extractor) mkdir(name string) error {
+	target, err := archiveEntryTarget(x.dest, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(target, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", name, err)
+	}
+	return nil
+}
+
+// writeFile extracts one regular file, counting its size against the limit.
+func (x *extractor) writeFile(name string, r io.Reader, mode fs.FileMode) error {
+	target, err := archiveEntryTarget(x.dest, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("failed to create parent directory: %w", err)
+	}
+
+	if x.overwrite {
+		// Remove rather than truncate so an existing symlink is never followed
+		if info, err := os.Lstat(target); err == nil {
+			if info.IsDir() {
+				return fmt.Errorf("cannot overwrite directory %s", name)
+			}
+			if err := os.Remove(target); err != nil {
+				return fmt.Errorf("failed to replace %s: %w", name, err)
+			}
+		}
+	}
+
+	perm := mode.Perm()
+	if perm == 0 {
+		perm = 0o644
+	}
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists: set overwrite to replace it", name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+
+	n, err := io.Copy(dst, io.LimitReader(r, x.remaining+1))
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	x.remaining -= n
+	if err == nil && x.remaining < 0 {
+		err = fmt.Errorf("archive exceeds the maximum extracted size of %d bytes", x.maxSize)
+	}
+	if err == nil && x.reserve != nil {
+		err = x.reserve(name, n)
+	}
+	if err != nil {
+		_ = os.Remove(target)
+		return fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+
+	x.result.Files++
+	x.result.TotalSize += n
+	return nil
+}
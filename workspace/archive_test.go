@@ -0,0 +1,214 @@
+package workspace
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// newArchiveWorkspace creates a diagnostics tree and a mount with a log file.
+func newArchiveWorkspace(t *testing.T) *Workspace {
+	ws := newTestWorkspace(t)
+	files := map[string]string{
+		"diag/ps.txt":        "ps output",
+		"diag/net/ss.txt":    "ss output",
+		"diag/net/cache.tmp": "temporary",
+		"other.txt":          "not included",
+	}
+	for name, content := range files {
+		path := filepath.Join(ws.Root(), name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	// Symlinks are never followed out of the workspace
+	outside := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(outside, []byte("secret"), 0o644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(ws.Root(), "diag", "link")))
+
+	logDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(logDir, "syslog"), []byte("log line"), 0o644))
+	require.NoError(t, ws.SetMounts(map[string]string{"logs": logDir}))
+	return ws
+}
+
+// readTree returns the files under dir relative to it.
+func readTree(t *testing.T, dir string) map[string]string {
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	require.NoError(t, err)
+	return files
+}
+
+func TestWorkspace_ArchiveExtract(t *testing.T) {
+	for _, output := range []string{"bundle.tar.gz", "bundle.zip"} {
+		t.Run(output, func(t *testing.T) {
+			ws := newArchiveWorkspace(t)
+			ctx := context.Background()
+
+			res, err := ws.Archive(ctx, &protocol.ArchiveArgs{
+				Output:  "out/" + output,
+				Paths:   []string{"diag", "logs:syslog", "diag/*.txt"},
+				Exclude: []string{"*.tmp"},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, 3, res.Files)
+			assert.Equal(t, int64(len("ps output")+len("ss output")+len("log line")), res.TotalSize)
+
+			data, err := os.ReadFile(filepath.Join(ws.Root(), "out", output))
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(data)), res.Size)
+			assert.Equal(t, hashContent(data), res.SHA256)
+
+			extracted, err := ws.Extract(ctx, &protocol.ExtractArgs{Path: "out/" + output, Dest: "unpacked"})
+			require.NoError(t, err)
+			assert.Equal(t, 3, extracted.Files)
+			assert.Equal(t, map[string]string{
+				"diag/ps.txt":     "ps output",
+				"diag/net/ss.txt": "ss output",
+				"logs/syslog":     "log line",
+			}, readTree(t, filepath.Join(ws.Root(), "unpacked")))
+
+			// Existing files are kept unless overwrite is set
+			_, err = ws.Extract(ctx, &protocol.ExtractArgs{Path: "out/" + output, Dest: "unpacked"})
+			assert.ErrorContains(t, err, "already exists")
+			_, err = ws.Extract(ctx, &protocol.ExtractArgs{Path: "out/" + output, Dest: "unpacked", Overwrite: true})
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestWorkspace_Archive_Errors(t *testing.T) {
+	ws := newArchiveWorkspace(t)
+	ctx := context.Background()
+
+	_, err := ws.Archive(ctx, &protocol.ArchiveArgs{Output: "a.tar.gz"})
+	assert.Error(t, err)
+
+	_, err = ws.Archive(ctx, &protocol.ArchiveArgs{Output: "a.rar", Paths: []string{"diag"}, Format: "rar"})
+	assert.Error(t, err)
+
+	_, err = ws.Archive(ctx, &protocol.ArchiveArgs{Output: "a.tar.gz", Paths: []string{"missing/*"}})
+	assert.ErrorContains(t, err, "no files match")
+
+	_, err = ws.Archive(ctx, &protocol.ArchiveArgs{Output: "a.tar.gz", Paths: []string{"diag"}, MaxSize: 10})
+	assert.ErrorContains(t, err, "maximum archive size")
+	_, err = os.Stat(filepath.Join(ws.Root(), "a.tar.gz"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = ws.Archive(ctx, &protocol.ArchiveArgs{Output: "logs:a.tar.gz", Paths: []string{"diag"}})
+	assert.ErrorContains(t, err, "read-only")
+}
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	body     string
+	linkname string
+}
+
+// writeTestTar writes a tar.gz archive with the given entries.
+func writeTestTar(t *testing.T, path string, entries []tarEntry) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Mode: 0o644, Size: int64(len(e.body)), Linkname: e.linkname}
+		if e.typeflag != tar.TypeReg {
+			hdr.Size = 0
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		if e.typeflag == tar.TypeReg {
+			_, err := tw.Write([]byte(e.body))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+}
+
+func TestWorkspace_Extract_Unsafe(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+	archive := filepath.Join(ws.Root(), "a.tgz")
+
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		wantErr string
+	}{
+		{"parent traversal", []tarEntry{{name: "../evil", typeflag: tar.TypeReg, body: "x"}}, "invalid file path"},
+		{"nested traversal", []tarEntry{{name: "a/../../evil", typeflag: tar.TypeReg, body: "x"}}, "invalid file path"},
+		{"absolute path", []tarEntry{{name: "/etc/evil", typeflag: tar.TypeReg, body: "x"}}, "invalid file path"},
+		{"size limit", []tarEntry{{name: "big", typeflag: tar.TypeReg, body: "0123456789abcdef"}}, "maximum extracted size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeTestTar(t, archive, tt.entries)
+			_, err := ws.Extract(ctx, &protocol.ExtractArgs{Path: "a.tgz", Dest: "out", MaxSize: 10})
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+	_, err := os.Stat(filepath.Join(ws.Root(), "out", "big"))
+	assert.True(t, os.IsNotExist(err))
+
+	t.Run("links are skipped", func(t *testing.T) {
+		writeTestTar(t, archive, []tarEntry{
+			{name: "dir/", typeflag: tar.TypeDir},
+			{name: "dir/passwd", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"},
+			{name: "dir/ok", typeflag: tar.TypeReg, body: "ok"},
+		})
+		res, err := ws.Extract(ctx, &protocol.ExtractArgs{Path: "a.tgz", Dest: "links"})
+		require.NoError(t, err)
+		assert.Equal(t, 1, res.Files)
+		assert.Equal(t, []string{"dir/passwd"}, res.Skipped)
+	})
+
+	t.Run("symlink in destination", func(t *testing.T) {
+		outside := t.TempDir()
+		dest := filepath.Join(ws.Root(), "dest")
+		require.NoError(t, os.MkdirAll(dest, 0o755))
+		require.NoError(t, os.Symlink(outside, filepath.Join(dest, "escape")))
+
+		writeTestTar(t, archive, []tarEntry{{name: "escape/sub/evil", typeflag: tar.TypeReg, body: "x"}})
+		_, err := ws.Extract(ctx, &protocol.ExtractArgs{Path: "a.tgz", Dest: "dest"})
+		assert.ErrorContains(t, err, "escapes destination")
+		assert.Empty(t, readTree(t, outside))
+	})
+
+	t.Run("zip traversal", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		fw, err := zw.Create("../evil")
+		require.NoError(t, err)
+		_, err = fw.Write([]byte("x"))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		require.NoError(t, os.WriteFile(filepath.Join(ws.Root(), "a.zip"), buf.Bytes(), 0o644))
+
+		_, err = ws.Extract(ctx, &protocol.ExtractArgs{Path: "a.zip", Dest: "zip"})
+		assert.ErrorContains(t, err, "invalid file path")
+	})
+}
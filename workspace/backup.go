@@ -0,0 +1,243 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lithammer/shortuuid/v4"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const (
+	// BackupsDir is the directory for copies of files taken before they are modified
+	BackupsDir = ".work/backups"
+	// DefaultBackupLimit is the number of modifications kept in the backup ring
+	DefaultBackupLimit = 50
+
+	backupIndexFile = "index.json"
+)
+
+// backupEntry records the state of a file before one modification.
+type backupEntry struct {
+	ID   string      `json:"id"`
+	Path string      `json:"path"`           // Workspace-relative path of the modified file
+	Op   string      `json:"op"`             // Operation that modified the file
+	File string      `json:"file,omitempty"` // Backup file name, empty if the file did not exist
+	Mode os.FileMode `json:"mode,omitempty"`
+	Time time.Time   `json:"time"`
+}
+
+// backup saves the current state of realPath before it is modified by op.
+// Failures are logged and returned as a message for the result, and do not
+// block the modification. Callers must hold writeMu.
+func (w *Workspace) backup(realPath, op string) string {
+	if err := w.saveBackup(realPath, op); err != nil {
+		slog.Warn("failed to back up file", "path", realPath, "error", err)
+		return err.Error()
+	}
+	return ""
+}
+
+// joinBackupErrors combines the backup failures of an operation that modifies
+// several files.
+func joinBackupErrors(msgs ...string) string {
+	return strings.Join(slices.DeleteFunc(msgs, func(msg string) bool { return msg == "" }), "; ")
+}
+
+func (w *Workspace) saveBackup(realPath, op string) error {
+	rel, err := w.relPath(realPath)
+	if err != nil {
+		return err
+	}
+	// Never back up the runner's own working files
+	if isWorkPath(rel) {
+		return nil
+	}
+
+	entry := backupEntry{
+		ID:   time.Now().UTC().Format("20060102T150405.000000") + "_" + shortuuid.New()[:8],
+		Path: rel,
+		Op:   op,
+		Time: time.Now(),
+	}
+
+	info, err := os.Stat(realPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// Restoring a new file deletes it
+	case err != nil:
+		return err
+	case !info.Mode().IsRegular():
+		return nil
+	case info.Size() > DefaultMaxReadSize:
+		return fmt.Errorf("file too large to back up: %d bytes", info.Size())
+	default:
+		// Backups count against the quota like the files they copy
+		if err := w.disk.reserve("backup", rel, info.Size()); err != nil {
+			return err
+		}
+		data, err := os.ReadFile(realPath)
+		if err == nil {
+			entry.File = entry.ID + ".bak"
+			entry.Mode = info.Mode().Perm()
+			err = writeFileAtomic(filepath.Join(w.root, BackupsDir, entry.File), data, 0o600)
+		}
+		if err != nil {
+			w.disk.release(info.Size())
+			return err
+		}
+	}
+
+	entries, err := w.loadBackupIndex()
+	if err != nil {
+		return err
+	}
+	entries = append(entries, entry)
+
+	// Drop the oldest entries beyond the ring size
+	if excess := len(entries) - DefaultBackupLimit; excess > 0 {
+		for _, old := range entries[:excess] {
+			w.removeBackupFile(old)
+		}
+		entries = entries[excess:]
+	}
+	return w.saveBackupIndex(entries)
+}
+
+// Restore undoes the most recent backed-up modifications, newest first.
+func (w *Workspace) Restore(ctx context.Context, args *protocol.RestoreArgs) (*protocol.RestoreResult, error) {
+	count := args.Count
+	if count <= 0 {
+		count = 1
+	}
+
+	filter := ""
+	if args.Path != "" {
+		realPath, err := w.safePath(args.Path)
+		if err != nil {
+			return nil, err
+		}
+		if filter, err = w.relPath(realPath); err != nil {
+			return nil, err
+		}
+	}
+
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	entries, err := w.loadBackupIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &protocol.RestoreResult{Restored: []protocol.RestoredFile{}}
+	for i := len(entries) - 1; i >= 0 && len(result.Restored) < count; i-- {
+		entry := entries[i]
+		if filter != "" && entry.Path != filter {
+			continue
+		}
+
+		restored, err := w.restoreEntry(entry)
+		if err != nil {
+			return result, fmt.Errorf("failed to restore %s: %w", entry.Path, err)
+		}
+		result.Restored = append(result.Restored, *restored)
+
+		w.removeBackupFile(entry)
+		entries = append(entries[:i], entries[i+1:]...)
+		if err := w.saveBackupIndex(entries); err != nil {
+			return result, err
+		}
+	}
+
+	if len(result.Restored) == 0 {
+		return nil, fmt.Errorf("no backups to restore")
+	}
+	return result, nil
+}
+
+// restoreEntry puts a file back into the state recorded by entry.
+func (w *Workspace) restoreEntry(entry backupEntry) (*protocol.RestoredFile, error) {
+	realPath, err := w.safePath(entry.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	restored := &protocol.RestoredFile{Path: entry.Path, Op: entry.Op, Time: entry.Time}
+	if entry.File == "" {
+		if err := os.Remove(realPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		restored.Action = "deleted"
+		return restored, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(w.root, BackupsDir, entry.File))
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(realPath, data, entry.Mode); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(realPath, entry.Mode); err != nil {
+		return nil, err
+	}
+	restored.Action = "restored"
+	return restored, nil
+}
+
+func (w *Workspace) loadBackupIndex() ([]backupEntry, error) {
+	data, err := os.ReadFile(filepath.Join(w.root, BackupsDir, backupIndexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup index: %w", err)
+	}
+
+	var entries []backupEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse backup index: %w", err)
+	}
+	return entries, nil
+}
+
+func (w *Workspace) saveBackupIndex(entries []backupEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode backup index: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(w.root, BackupsDir, backupIndexFile), data, 0o600)
+}
+
+func (w *Workspace) removeBackupFile(entry backupEntry) {
+	if entry.File == "" {
+		return
+	}
+	path := filepath.Join(w.root, BackupsDir, entry.File)
+	if info, err := os.Stat(path); err == nil && os.Remove(path) == nil {
+		w.disk.release(info.Size())
+	}
+}
+
+// relPath returns the slash-separated path of realPath relative to the workspace root.
+func (w *Workspace) relPath(realPath string) (string, error) {
+	root := w.root
+	if resolved, err := filepath.EvalSymlinks(w.root); err == nil && strings.HasPrefix(realPath, resolved) {
+		root = resolved
+	}
+	rel, err := filepath.Rel(root, realPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get relative path: %w", err)
+	}
+	return filepath.ToSlash(rel), nil
+}
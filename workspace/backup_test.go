@@ -0,0 +1,129 @@
+package workspace
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+func writeString(t *testing.T, ws *Workspace, path, content string) {
+	t.Helper()
+	_, err := ws.Write(context.Background(), &protocol.WriteArgs{
+		Path:    path,
+		Content: base64.StdEncoding.EncodeToString([]byte(content)),
+	})
+	require.NoError(t, err)
+}
+
+func TestWorkspace_Restore(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+	path := filepath.Join(ws.Root(), "app.conf")
+
+	writeString(t, ws, "app.conf", "v1")
+	writeString(t, ws, "app.conf", "v2")
+	writeString(t, ws, "other.conf", "x")
+	_, err := ws.Edit(ctx, &protocol.EditArgs{Path: "app.conf", OldString: "v2", NewString: "v3"})
+	require.NoError(t, err)
+
+	// Undo the last modification of app.conf only
+	result, err := ws.Restore(ctx, &protocol.RestoreArgs{Path: "app.conf"})
+	require.NoError(t, err)
+	require.Len(t, result.Restored, 1)
+	assert.Equal(t, "edit", result.Restored[0].Op)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(data))
+
+	// Undo the next two: other.conf creation, then app.conf v1 -> v2
+	result, err = ws.Restore(ctx, &protocol.RestoreArgs{Count: 2})
+	require.NoError(t, err)
+	require.Len(t, result.Restored, 2)
+	assert.Equal(t, "deleted", result.Restored[0].Action)
+	assert.NoFileExists(t, filepath.Join(ws.Root(), "other.conf"))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(data))
+
+	// Undo the creation of app.conf
+	_, err = ws.Restore(ctx, &protocol.RestoreArgs{})
+	require.NoError(t, err)
+	assert.NoFileExists(t, path)
+
+	_, err = ws.Restore(ctx, &protocol.RestoreArgs{})
+	assert.Error(t, err)
+}
+
+func TestWorkspace_BackupRing(t *testing.T) {
+	ws := newTestWorkspace(t)
+
+	for i := 0; i < DefaultBackupLimit+5; i++ {
+		writeString(t, ws, "f.txt", string(rune('a'+i%26)))
+	}
+
+	entries, err := ws.loadBackupIndex()
+	require.NoError(t, err)
+	assert.Len(t, entries, DefaultBackupLimit)
+
+	files, err := filepath.Glob(filepath.Join(ws.Root(), BackupsDir, "*.bak"))
+	require.NoError(t, err)
+	assert.Len(t, files, DefaultBackupLimit)
+}
+
+func TestWorkspace_BackupError(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+	content := base64.StdEncoding.EncodeToString([]byte("x"))
+
+	// Files over the read limit are modified without a backup
+	large := filepath.Join(ws.Root(), "large.bin")
+	require.NoError(t, os.WriteFile(large, nil, 0o644))
+	require.NoError(t, os.Truncate(large, DefaultMaxReadSize+1))
+	written, err := ws.Write(ctx, &protocol.WriteArgs{Path: "large.bin", Content: content, Append: true})
+	require.NoError(t, err)
+	assert.True(t, written.Success)
+	assert.Contains(t, written.BackupError, "too large to back up")
+
+	// A backup directory that cannot be written fails every backup
+	writeString(t, ws, "app.conf", "v1")
+	require.NoError(t, os.RemoveAll(filepath.Join(ws.Root(), BackupsDir)))
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root(), BackupsDir), nil, 0o600))
+
+	written, err = ws.Write(ctx, &protocol.WriteArgs{Path: "app.conf", Content: content})
+	require.NoError(t, err)
+	assert.NotEmpty(t, written.BackupError)
+
+	edited, err := ws.Edit(ctx, &protocol.EditArgs{Path: "app.conf", OldString: "x", NewString: "y"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, edited.BackupError)
+
+	copied, err := ws.Copy(ctx, &protocol.CopyArgs{Source: "app.conf", Dest: "copy.conf"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, copied.BackupError)
+
+	moved, err := ws.Move(ctx, &protocol.MoveArgs{Source: "copy.conf", Dest: "moved.conf"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, moved.BackupError)
+
+	archived, err := ws.Archive(ctx, &protocol.ArchiveArgs{Output: "moved.conf", Paths: []string{"app.conf"}, Format: protocol.ArchiveFormatZip})
+	require.NoError(t, err)
+	assert.NotEmpty(t, archived.BackupError)
+
+	deleted, err := ws.Delete(ctx, &protocol.DeleteArgs{Path: "app.conf"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, deleted.BackupError)
+	assert.NoFileExists(t, filepath.Join(ws.Root(), "app.conf"))
+
+	// Backed-up modifications report no error
+	require.NoError(t, os.Remove(filepath.Join(ws.Root(), BackupsDir)))
+	written, err = ws.Write(ctx, &protocol.WriteArgs{Path: "app.conf", Content: content})
+	require.NoError(t, err)
+	assert.Empty(t, written.BackupError)
+}
@@ -0,0 +1,131 @@
+package workspace
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// Edit modifies a file by exact string replacement or by applying a unified diff.
+// If ExpectedHash is set, the edit fails when the file no longer has that hash.
+func (w *Workspace) Edit(ctx context.Context, args *protocol.EditArgs) (*protocol.EditResult, error) {
+	hasPatch := args.Patch != ""
+	if hasPatch && (args.OldString != "" || args.NewString != "") {
+		return nil, fmt.Errorf("set either old_string/new_string or patch, not both")
+	}
+	if !hasPatch && args.OldString == args.NewString {
+		return nil, fmt.Errorf("old_string and new_string are identical")
+	}
+
+	realPath, err := w.safePath(args.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Serialize modifications so the hash check and write are atomic
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	info, err := os.Stat(realPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if hasPatch || args.OldString != "" || args.ExpectedHash != "" {
+			return nil, fmt.Errorf("file not found: %s", args.Path)
+		}
+		return w.createFile(args.Path, realPath, args.NewString)
+	case err != nil:
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	case info.IsDir():
+		return nil, fmt.Errorf("cannot edit a directory: %s", args.Path)
+	case info.Size() > DefaultMaxReadSize:
+		return nil, fmt.Errorf("file too large to edit: %d bytes (max %d)", info.Size(), DefaultMaxReadSize)
+	}
+
+	data, err := os.ReadFile(realPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	if args.ExpectedHash != "" {
+		if current := hashContent(data); !strings.EqualFold(current, args.ExpectedHash) {
+			return nil, fmt.Errorf("file has changed since it was read: expected sha256 %s, got %s", args.ExpectedHash, current)
+		}
+	}
+
+	result := &protocol.EditResult{}
+	var updated string
+	if hasPatch {
+		hunks, err := parsePatch(args.Patch)
+		if err != nil {
+			return nil, fmt.Errorf("invalid patch: %w", err)
+		}
+		if updated, result.Hunks, err = applyPatch(string(data), hunks); err != nil {
+			return nil, err
+		}
+	} else {
+		if args.OldString == "" {
+			return nil, fmt.Errorf("old_string is required to edit an existing file")
+		}
+		count := strings.Count(string(data), args.OldString)
+		switch {
+		case count == 0:
+			return nil, fmt.Errorf("old_string not found in %s", args.Path)
+		case count > 1 && !args.ReplaceAll:
+			return nil, fmt.Errorf("old_string found %d times in %s: add surrounding context to make it unique or set replace_all", count, args.Path)
+		}
+		updated = strings.ReplaceAll(string(data), args.OldString, args.NewString)
+		result.Replacements = count
+	}
+
+	if err := w.disk.reserveReplace("edit", args.Path, realPath, int64(len(updated))); err != nil {
+		return nil, err
+	}
+	result.BackupError = w.backup(realPath, "edit")
+	if err := writeFileAtomic(realPath, []byte(updated), 0o644); err != nil {
+		return nil, err
+	}
+	result.SHA256 = hashContent([]byte(updated))
+	return result, nil
+}
+
+// createFile creates a new file for an edit with an empty old_string.
+func (w *Workspace) createFile(path, realPath, content string) (*protocol.EditResult, error) {
+	if err := w.disk.reserve("edit", path, int64(len(content))); err != nil {
+		return nil, err
+	}
+	backupErr := w.backup(realPath, "edit")
+	if err := writeFileAtomic(realPath, []byte(content), 0o644); err != nil {
+		return nil, err
+	}
+	return &protocol.EditResult{SHA256: hashContent([]byte(content)), BackupError: backupErr}, nil
+}
+
+// hashContent returns the hex SHA-256 of data.
+func hashContent(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashFile returns the hex SHA-256 of a file, streaming its content.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
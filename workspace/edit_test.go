@@ -0,0 +1,227 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+func TestWorkspace_Edit_Replace(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+	path := filepath.Join(ws.Root(), "a.txt")
+	require.NoError(t, os.WriteFile(path, []byte("foo bar foo\n"), 0o600))
+
+	// Ambiguous match is rejected
+	_, err := ws.Edit(ctx, &protocol.EditArgs{Path: "a.txt", OldString: "foo", NewString: "baz"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "found 2 times")
+
+	// Missing match is rejected
+	_, err = ws.Edit(ctx, &protocol.EditArgs{Path: "a.txt", OldString: "qux", NewString: "baz"})
+	require.Error(t, err)
+
+	result, err := ws.Edit(ctx, &protocol.EditArgs{Path: "a.txt", OldString: "foo", NewString: "baz", ReplaceAll: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Replacements)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "baz bar baz\n", string(data))
+	assert.Equal(t, hashContent(data), result.SHA256)
+
+	// File mode is preserved
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestWorkspace_Edit_ExpectedHash(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root(), "a.txt"), []byte("one\n"), 0o644))
+
+	read, err := ws.Read(ctx, &protocol.ReadArgs{Path: "a.txt"})
+	require.NoError(t, err)
+	require.NotEmpty(t, read.SHA256)
+
+	// File changes after it was read
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root(), "a.txt"), []byte("two\n"), 0o644))
+
+	_, err = ws.Edit(ctx, &protocol.EditArgs{Path: "a.txt", OldString: "two", NewString: "three", ExpectedHash: read.SHA256})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "changed since it was read")
+
+	read, err = ws.Read(ctx, &protocol.ReadArgs{Path: "a.txt"})
+	require.NoError(t, err)
+	_, err = ws.Edit(ctx, &protocol.EditArgs{Path: "a.txt", OldString: "two", NewString: "three", ExpectedHash: read.SHA256})
+	require.NoError(t, err)
+}
+
+func TestWorkspace_Read_SHA256(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+	data := []byte("one\ntwo\nthree\n")
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root(), "a.txt"), data, 0o644))
+
+	tests := []struct {
+		name string
+		args protocol.ReadArgs
+		want string // Empty for partial reads
+	}{
+		{"bytes", protocol.ReadArgs{Path: "a.txt"}, hashContent(data)},
+		{"bytes with offset", protocol.ReadArgs{Path: "a.txt", Offset: 4}, ""},
+		{"bytes with limit", protocol.ReadArgs{Path: "a.txt", Limit: 4}, ""},
+		{"lines", protocol.ReadArgs{Path: "a.txt", Mode: protocol.ReadModeLines}, hashContent(data)},
+		{"lines from the second", protocol.ReadArgs{Path: "a.txt", Mode: protocol.ReadModeLines, StartLine: 2}, ""},
+		{"first lines", protocol.ReadArgs{Path: "a.txt", Mode: protocol.ReadModeLines, LineCount: 2}, ""},
+		{"first lines counted", protocol.ReadArgs{Path: "a.txt", Mode: protocol.ReadModeLines, LineCount: 2, CountLines: true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ws.Read(ctx, &tt.args)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, result.SHA256)
+		})
+	}
+}
+
+func TestWorkspace_Edit_Create(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+
+	_, err := ws.Edit(ctx, &protocol.EditArgs{Path: "new/file.txt", NewString: "hello\n"})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(ws.Root(), "new/file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", string(data))
+
+	// Empty old_string does not overwrite an existing file
+	_, err = ws.Edit(ctx, &protocol.EditArgs{Path: "new/file.txt", NewString: "bye\n"})
+	assert.Error(t, err)
+}
+
+func TestWorkspace_Edit_Patch(t *testing.T) {
+	original := "line1\nline2\nline3\nline4\nline5\nline6\nline7\nline8\nline9\nline10\n"
+
+	tests := []struct {
+		name       string
+		content    string
+		patch      string
+		want       string
+		wantOffset int
+		wantFuzz   int
+		wantErr    bool
+	}{
+		{
+			name:    "exact",
+			content: original,
+			patch: `--- a/f.txt
++++ b/f.txt
+@@ -2,3 +2,3 @@
+ line2
+-line3
++LINE3
+ line4
+`,
+			want: "line1\nline2\nLINE3\nline4\nline5\nline6\nline7\nline8\nline9\nline10\n",
+		},
+		{
+			name:    "offset",
+			content: "extra\nextra\n" + original,
+			patch: `@@ -2,3 +2,3 @@
+ line2
+-line3
++LINE3
+ line4
+`,
+			want:       "extra\nextra\nline1\nline2\nLINE3\nline4\nline5\nline6\nline7\nline8\nline9\nline10\n",
+			wantOffset: 2,
+		},
+		{
+			name:    "fuzz",
+			content: original,
+			patch: `@@ -2,3 +2,3 @@
+ changed
+-line3
++LINE3
+ line4
+`,
+			want:     "line1\nline2\nLINE3\nline4\nline5\nline6\nline7\nline8\nline9\nline10\n",
+			wantFuzz: 1,
+		},
+		{
+			name:    "multiple hunks",
+			content: original,
+			patch: `@@ -1,2 +1,3 @@
+ line1
++inserted
+ line2
+@@ -9,2 +10,1 @@
+ line9
+-line10
+`,
+			want: "line1\ninserted\nline2\nline3\nline4\nline5\nline6\nline7\nline8\nline9\n",
+		},
+		{
+			name:    "no newline at end",
+			content: "a\nb\n",
+			patch: `@@ -1,2 +1,2 @@
+ a
+-b
++c
+\ No newline at end of file
+`,
+			want: "a\nc",
+		},
+		{
+			name:    "crlf",
+			content: "a\r\nb\r\n",
+			patch: `@@ -1,2 +1,2 @@
+ a
+-b
++c
+`,
+			want: "a\r\nc\r\n",
+		},
+		{
+			name:    "does not apply",
+			content: original,
+			patch: `@@ -2,1 +2,1 @@
+-missing
++LINE
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newTestWorkspace(t)
+			path := filepath.Join(ws.Root(), "f.txt")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o644))
+
+			result, err := ws.Edit(context.Background(), &protocol.EditArgs{Path: "f.txt", Patch: tt.patch})
+			if tt.wantErr {
+				require.Error(t, err)
+				data, _ := os.ReadFile(path)
+				assert.Equal(t, tt.content, string(data), "file must be unchanged")
+				return
+			}
+			require.NoError(t, err)
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(data))
+			assert.Equal(t, tt.wantOffset, result.Hunks[0].Offset)
+			assert.Equal(t, tt.wantFuzz, result.Hunks[0].Fuzz)
+		})
+	}
+}
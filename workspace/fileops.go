@@ -0,0 +1,477 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// FileError is a failed file operation with a machine-readable code, so the
+// cloud can tell a missing file from a refused one without parsing messages.
+type FileError struct {
+	Op   string
+	Path string
+	Code string // One of the protocol.ErrorCode* constants, empty if unknown
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return e.Op + " " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// fileError wraps err in a FileError, deriving the code from OS errors.
+// FileErrors are returned unchanged.
+func fileError(op, path string, err error) error {
+	var fe *FileError
+	if errors.As(err, &fe) {
+		return err
+	}
+
+	code := ""
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		code = protocol.ErrorCodeNotFound
+	case errors.Is(err, fs.ErrExist):
+		code = protocol.ErrorCodeExists
+	case errors.Is(err, fs.ErrPermission):
+		code = protocol.ErrorCodePermission
+	case errors.Is(err, syscall.ENOTDIR):
+		code = protocol.ErrorCodeNotDir
+	case errors.Is(err, syscall.ENOTEMPTY):
+		code = protocol.ErrorCodeNotEmpty
+	}
+
+	// The path is already part of the message
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		err = linkErr.Err
+	}
+	return &FileError{Op: op, Path: path, Code: code, Err: err}
+}
+
+// entryPath resolves path for an operation on the entry itself: its parent is
+// resolved like resolvePath, but a final symlink is not followed, so deleting or
+// moving a link affects the link and not its target.
+func (w *Workspace) entryPath(path string) (string, error) {
+	if name, _, ok := w.splitMount(path); ok {
+		return "", fmt.Errorf("mount %s is read-only: %s", name, path)
+	}
+
+	absPath := filepath.Join(w.root, path)
+	if !isWithin(w.root, absPath) {
+		return "", fmt.Errorf("path is outside workspace root: %s", path)
+	}
+	rel, err := filepath.Rel(w.root, absPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get relative path: %w", err)
+	}
+	if rel == "." {
+		return w.realRoot(), nil
+	}
+
+	parent, err := w.resolvePath(filepath.Dir(rel))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(parent, filepath.Base(rel)), nil
+}
+
+// resolveEntry resolves path with entryPath. Paths that are modified must not
+// be the workspace root or the runner's working files.
+func (w *Workspace) resolveEntry(op, path string, modify bool) (string, error) {
+	realPath, err := w.entryPath(path)
+	if err != nil {
+		return "", &FileError{Op: op, Path: path, Code: protocol.ErrorCodeInvalidPath, Err: err}
+	}
+	if !modify {
+		return realPath, nil
+	}
+
+	rel, err := w.relPath(realPath)
+	if err != nil {
+		return "", &FileError{Op: op, Path: path, Code: protocol.ErrorCodeInvalidPath, Err: err}
+	}
+	if rel == "." {
+		return "", &FileError{Op: op, Path: path, Code: protocol.ErrorCodeProtected, Err: errors.New("the workspace root cannot be modified")}
+	}
+	if isWorkPath(rel) {
+		return "", &FileError{Op: op, Path: path, Code: protocol.ErrorCodeProtected, Err: fmt.Errorf("%s is reserved for runner working files", WorkDir)}
+	}
+	if name, _, ok := w.splitShared(rel); ok {
+		return "", &FileError{Op: op, Path: path, Code: protocol.ErrorCodeProtected, Err: fmt.Errorf("%s is shared by all sessions and read-only", name)}
+	}
+	return realPath, nil
+}
+
+// Stat reports whether a path exists and its type, size and mode.
+// A final symlink is reported as a link rather than followed.
+func (w *Workspace) Stat(ctx context.Context, args *protocol.StatArgs) (*protocol.StatResult, error) {
+	const op = "stat"
+
+	var realPath string
+	_, _, mounted := w.splitMount(args.Path)
+	if _, _, shared := w.splitShared(args.Path); mounted || shared {
+		loc, err := w.resolveRead(args.Path)
+		if err != nil {
+			return nil, &FileError{Op: op, Path: args.Path, Code: protocol.ErrorCodeInvalidPath, Err: err}
+		}
+		realPath = loc.path
+	} else {
+		var err error
+		if realPath, err = w.resolveEntry(op, args.Path, false); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &protocol.StatResult{Path: args.Path}
+	info, err := os.Lstat(realPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, fileError(op, args.Path, err)
+	}
+
+	modTime := info.ModTime()
+	result.Exists = true
+	result.Mode = info.Mode().String()
+	result.ModTime = &modTime
+
+	switch mode := info.Mode(); {
+	case mode.IsRegular():
+		result.Type = protocol.FileTypeFile
+		result.Size = info.Size()
+	case mode.IsDir():
+		result.Type = protocol.FileTypeDir
+	case mode&fs.ModeSymlink != 0:
+		result.Type = protocol.FileTypeSymlink
+		result.Size = info.Size()
+		result.LinkTarget, _ = os.Readlink(realPath)
+	default:
+		result.Type = protocol.FileTypeOther
+	}
+	return result, nil
+}
+
+// Mkdir creates a directory and any missing parents.
+func (w *Workspace) Mkdir(ctx context.Context, args *protocol.MkdirArgs) (*protocol.MkdirResult, error) {
+	const op = "mkdir"
+
+	realPath, err := w.resolveEntry(op, args.Path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	result := &protocol.MkdirResult{Path: args.Path}
+	info, err := os.Lstat(realPath)
+	switch {
+	case err == nil && info.IsDir():
+		return result, nil
+	case err == nil:
+		return nil, &FileError{Op: op, Path: args.Path, Code: protocol.ErrorCodeNotDir, Err: errors.New("path exists and is not a directory")}
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, fileError(op, args.Path, err)
+	}
+
+	if err := os.MkdirAll(realPath, 0o755); err != nil {
+		return nil, fileError(op, args.Path, err)
+	}
+	result.Created = true
+	return result, nil
+}
+
+// Move renames a file or directory within the workspace. Moved files are
+// backed up so the move can be undone with restore.
+func (w *Workspace) Move(ctx context.Context, args *protocol.MoveArgs) (*protocol.MoveResult, error) {
+	const op = "move"
+
+	src, err := w.resolveEntry(op, args.Source, true)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := w.resolveEntry(op, args.Dest, true)
+	if err != nil {
+		return nil, err
+	}
+
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	srcInfo, err := os.Lstat(src)
+	if err != nil {
+		return nil, fileError(op, args.Source, err)
+	}
+	if src == dst {
+		return nil, &FileError{Op: op, Path: args.Dest, Code: protocol.ErrorCodeInvalidPath, Err: errors.New("source and destination are the same")}
+	}
+	if srcInfo.IsDir() && isWithin(src, dst) {
+		return nil, &FileError{Op: op, Path: args.Dest, Code: protocol.ErrorCodeInvalidPath, Err: errors.New("cannot move a directory into itself")}
+	}
+
+	result := &protocol.MoveResult{Source: args.Source, Dest: args.Dest}
+	dstInfo, err := os.Lstat(dst)
+	switch {
+	case err == nil && dstInfo.IsDir():
+		return nil, &FileError{Op: op, Path: args.Dest, Code: protocol.ErrorCodeIsDir, Err: errors.New("destination is a directory")}
+	case err == nil && !args.Overwrite:
+		return nil, &FileError{Op: op, Path: args.Dest, Code: protocol.ErrorCodeExists, Err: errors.New("destination already exists; set overwrite to replace it")}
+	case err == nil:
+		result.Overwritten = true
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, fileError(op, args.Dest, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return nil, fileError(op, args.Dest, err)
+	}
+	if srcInfo.Mode().IsRegular() {
+		result.BackupError = joinBackupErrors(w.backup(src, op), w.backup(dst, op))
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return nil, fileError(op, args.Source, err)
+	}
+	return result, nil
+}
+
+// Copy copies a file, or a directory with Recursive, to a new path in the
+// workspace. The source may be in a mount. Symlinks inside a copied directory
+// are skipped. Copying a single file backs up the destination.
+func (w *Workspace) Copy(ctx context.Context, args *protocol.CopyArgs) (*protocol.CopyResult, error) {
+	const op = "copy"
+
+	loc, err := w.resolveRead(args.Source)
+	if err != nil {
+		return nil, &FileError{Op: op, Path: args.Source, Code: protocol.ErrorCodeInvalidPath, Err: err}
+	}
+	dst, err := w.resolveEntry(op, args.Dest, true)
+	if err != nil {
+		return nil, err
+	}
+
+	srcInfo, err := os.Stat(loc.path)
+	if err != nil {
+		return nil, fileError(op, args.Source, err)
+	}
+
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	result := &protocol.CopyResult{}
+	if !srcInfo.IsDir() {
+		if !srcInfo.Mode().IsRegular() {
+			return nil, &FileError{Op: op, Path: args.Source, Err: errors.New("not a regular file")}
+		}
+		if err := checkCopyTarget(dst, args.Dest, args.Overwrite); err != nil {
+			return nil, err
+		}
+		if err := w.disk.reserveReplace(op, args.Dest, dst, srcInfo.Size()); err != nil {
+			return nil, err
+		}
+		result.BackupError = w.backup(dst, op)
+		if err := copyFile(loc.path, dst, srcInfo.Mode().Perm()); err != nil {
+			return nil, fileError(op, args.Dest, err)
+		}
+		result.Files = 1
+		result.TotalSize = srcInfo.Size()
+		return result, nil
+	}
+
+	if !args.Recursive {
+		return nil, &FileError{Op: op, Path: args.Source, Code: protocol.ErrorCodeIsDir, Err: errors.New("source is a directory; set recursive to copy it")}
+	}
+	if isWithin(loc.path, dst) {
+		return nil, &FileError{Op: op, Path: args.Dest, Code: protocol.ErrorCodeInvalidPath, Err: errors.New("cannot copy a directory into itself")}
+	}
+	if _, err := os.Lstat(dst); err == nil && !args.Overwrite {
+		return nil, &FileError{Op: op, Path: args.Dest, Code: protocol.ErrorCodeExists, Err: errors.New("destination already exists; set overwrite to merge into it")}
+	}
+
+	err = filepath.WalkDir(loc.path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fileError(op, loc.display(p), err)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(loc.path, p)
+		if err != nil {
+			return err
+		}
+		// Existing directories of a merge must not lead out of the destination
+		target, err := archiveEntryTarget(dst, rel)
+		if err != nil {
+			return &FileError{Op: op, Path: loc.display(p), Code: protocol.ErrorCodeInvalidPath, Err: err}
+		}
+
+		switch {
+		case d.IsDir():
+			if info, err := os.Lstat(target); err == nil && !info.IsDir() {
+				return &FileError{Op: op, Path: loc.display(p), Code: protocol.ErrorCodeNotDir, Err: errors.New("destination exists and is not a directory")}
+			}
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return fileError(op, loc.display(p), err)
+			}
+		case d.Type().IsRegular():
+			info, err := d.Info()
+			if err != nil {
+				return fileError(op, loc.display(p), err)
+			}
+			if err := checkCopyTarget(target, loc.display(p), args.Overwrite); err != nil {
+				return err
+			}
+			if err := w.disk.reserveReplace(op, loc.display(p), target, info.Size()); err != nil {
+				return err
+			}
+			if err := copyFile(p, target, info.Mode().Perm()); err != nil {
+				return fileError(op, loc.display(p), err)
+			}
+			result.Files++
+			result.TotalSize += info.Size()
+		default:
+			result.Skipped = append(result.Skipped, loc.display(p))
+		}
+		return nil
+	})
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkCopyTarget checks that the file at path can be copied to target.
+func checkCopyTarget(target, path string, overwrite bool) error {
+	info, err := os.Lstat(target)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return fileError("copy", path, err)
+	case info.IsDir():
+		return &FileError{Op: "copy", Path: path, Code: protocol.ErrorCodeIsDir, Err: errors.New("destination is a directory")}
+	case !overwrite:
+		return &FileError{Op: "copy", Path: path, Code: protocol.ErrorCodeExists, Err: errors.New("destination already exists; set overwrite to replace it")}
+	}
+	return nil
+}
+
+// copyFile copies src to a temporary file next to dst and installs it, so an
+// interrupted copy never leaves a partial destination.
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	dir := filepath.Dir(dst)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	_, err = io.Copy(tmp, in)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = installFile(tmpPath, dst, perm)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// Delete removes a file, symlink or directory. Non-empty directories are only
+// removed with both Recursive and Confirm. Deleted files are backed up so the
+// deletion can be undone with restore; directory contents are not.
+func (w *Workspace) Delete(ctx context.Context, args *protocol.DeleteArgs) (*protocol.DeleteResult, error) {
+	const op = "delete"
+
+	realPath, err := w.resolveEntry(op, args.Path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	info, err := os.Lstat(realPath)
+	if err != nil {
+		return nil, fileError(op, args.Path, err)
+	}
+
+	result := &protocol.DeleteResult{Path: args.Path}
+	if !info.IsDir() {
+		if info.Mode().IsRegular() {
+			result.BackupError = w.backup(realPath, op)
+		}
+		if err := os.Remove(realPath); err != nil {
+			return nil, fileError(op, args.Path, err)
+		}
+		result.Files = 1
+		return result, nil
+	}
+
+	err = filepath.WalkDir(realPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			result.Dirs++
+		} else {
+			result.Files++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fileError(op, args.Path, err)
+	}
+
+	if result.Files+result.Dirs > 1 {
+		if !args.Recursive {
+			return nil, &FileError{Op: op, Path: args.Path, Code: protocol.ErrorCodeNotEmpty, Err: errors.New("directory is not empty; set recursive and confirm to delete it")}
+		}
+		if !args.Confirm {
+			return nil, &FileError{Op: op, Path: args.Path, Code: protocol.ErrorCodeConfirmRequired,
+				Err: fmt.Errorf("would delete %d files and %d directories; set confirm to proceed", result.Files, result.Dirs)}
+		}
+	}
+
+	if err := os.RemoveAll(realPath); err != nil {
+		return nil, fileError(op, args.Path, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,231 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// assertErrorCode checks that err is a FileError with the given code.
+func assertErrorCode(t *testing.T, err error, code string) {
+	t.Helper()
+	var fileErr *FileError
+	require.True(t, errors.As(err, &fileErr), "expected FileError, got %v", err)
+	assert.Equal(t, code, fileErr.Code, fileErr.Error())
+}
+
+func readString(t *testing.T, ws *Workspace, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(ws.Root(), path))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestWorkspace_Stat(t *testing.T) {
+	ws, logDir := newMountedWorkspace(t)
+	ctx := context.Background()
+	writeString(t, ws, "a.txt", "hello")
+	require.NoError(t, os.Mkdir(filepath.Join(ws.Root(), "dir"), 0o755))
+	require.NoError(t, os.Symlink("a.txt", filepath.Join(ws.Root(), "link")))
+	require.NoError(t, os.WriteFile(filepath.Join(logDir, "syslog"), []byte("log"), 0o644))
+
+	res, err := ws.Stat(ctx, &protocol.StatArgs{Path: "a.txt"})
+	require.NoError(t, err)
+	assert.True(t, res.Exists)
+	assert.Equal(t, protocol.FileTypeFile, res.Type)
+	assert.Equal(t, int64(5), res.Size)
+	assert.NotNil(t, res.ModTime)
+
+	res, err = ws.Stat(ctx, &protocol.StatArgs{Path: "dir"})
+	require.NoError(t, err)
+	assert.Equal(t, protocol.FileTypeDir, res.Type)
+
+	res, err = ws.Stat(ctx, &protocol.StatArgs{Path: "link"})
+	require.NoError(t, err)
+	assert.Equal(t, protocol.FileTypeSymlink, res.Type)
+	assert.Equal(t, "a.txt", res.LinkTarget)
+
+	res, err = ws.Stat(ctx, &protocol.StatArgs{Path: "missing"})
+	require.NoError(t, err)
+	assert.False(t, res.Exists)
+
+	res, err = ws.Stat(ctx, &protocol.StatArgs{Path: "logs:syslog"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), res.Size)
+
+	_, err = ws.Stat(ctx, &protocol.StatArgs{Path: "../outside"})
+	assertErrorCode(t, err, protocol.ErrorCodeInvalidPath)
+}
+
+func TestWorkspace_Mkdir(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+
+	res, err := ws.Mkdir(ctx, &protocol.MkdirArgs{Path: "a/b/c"})
+	require.NoError(t, err)
+	assert.True(t, res.Created)
+	assert.DirExists(t, filepath.Join(ws.Root(), "a", "b", "c"))
+
+	res, err = ws.Mkdir(ctx, &protocol.MkdirArgs{Path: "a/b"})
+	require.NoError(t, err)
+	assert.False(t, res.Created)
+
+	writeString(t, ws, "file", "x")
+	_, err = ws.Mkdir(ctx, &protocol.MkdirArgs{Path: "file"})
+	assertErrorCode(t, err, protocol.ErrorCodeNotDir)
+
+	_, err = ws.Mkdir(ctx, &protocol.MkdirArgs{Path: ".work/x"})
+	assertErrorCode(t, err, protocol.ErrorCodeProtected)
+
+	// A symlinked parent must not lead out of the workspace
+	outside := t.TempDir()
+	require.NoError(t, os.Symlink(outside, filepath.Join(ws.Root(), "escape")))
+	_, err = ws.Mkdir(ctx, &protocol.MkdirArgs{Path: "escape/new/dir"})
+	assertErrorCode(t, err, protocol.ErrorCodeInvalidPath)
+	assert.NoDirExists(t, filepath.Join(outside, "new"))
+}
+
+func TestWorkspace_Move(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+	writeString(t, ws, "a.txt", "a")
+	writeString(t, ws, "b.txt", "b")
+
+	_, err := ws.Move(ctx, &protocol.MoveArgs{Source: "a.txt", Dest: "b.txt"})
+	assertErrorCode(t, err, protocol.ErrorCodeExists)
+
+	res, err := ws.Move(ctx, &protocol.MoveArgs{Source: "a.txt", Dest: "b.txt", Overwrite: true})
+	require.NoError(t, err)
+	assert.True(t, res.Overwritten)
+	assert.Equal(t, "a", readString(t, ws, "b.txt"))
+	assert.NoFileExists(t, filepath.Join(ws.Root(), "a.txt"))
+
+	// Restore undoes both sides of the move
+	_, err = ws.Restore(ctx, &protocol.RestoreArgs{Count: 2})
+	require.NoError(t, err)
+	assert.Equal(t, "a", readString(t, ws, "a.txt"))
+	assert.Equal(t, "b", readString(t, ws, "b.txt"))
+
+	_, err = ws.Move(ctx, &protocol.MoveArgs{Source: "a.txt", Dest: "new/dir/a.txt"})
+	require.NoError(t, err)
+	assert.Equal(t, "a", readString(t, ws, "new/dir/a.txt"))
+
+	_, err = ws.Move(ctx, &protocol.MoveArgs{Source: "new", Dest: "new/dir/sub"})
+	assertErrorCode(t, err, protocol.ErrorCodeInvalidPath)
+
+	_, err = ws.Move(ctx, &protocol.MoveArgs{Source: "b.txt", Dest: "new"})
+	assertErrorCode(t, err, protocol.ErrorCodeIsDir)
+
+	_, err = ws.Move(ctx, &protocol.MoveArgs{Source: "missing", Dest: "x"})
+	assertErrorCode(t, err, protocol.ErrorCodeNotFound)
+
+	_, err = ws.Move(ctx, &protocol.MoveArgs{Source: "b.txt", Dest: ".work/b.txt"})
+	assertErrorCode(t, err, protocol.ErrorCodeProtected)
+}
+
+func TestWorkspace_Copy(t *testing.T) {
+	ws, logDir := newMountedWorkspace(t)
+	ctx := context.Background()
+	writeString(t, ws, "src/a.txt", "a")
+	writeString(t, ws, "src/sub/b.txt", "bb")
+	require.NoError(t, os.Symlink("/etc/passwd", filepath.Join(ws.Root(), "src", "link")))
+	require.NoError(t, os.WriteFile(filepath.Join(logDir, "syslog"), []byte("log"), 0o644))
+
+	_, err := ws.Copy(ctx, &protocol.CopyArgs{Source: "src", Dest: "dst"})
+	assertErrorCode(t, err, protocol.ErrorCodeIsDir)
+
+	res, err := ws.Copy(ctx, &protocol.CopyArgs{Source: "src", Dest: "dst", Recursive: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Files)
+	assert.Equal(t, int64(3), res.TotalSize)
+	assert.Equal(t, []string{"src/link"}, res.Skipped)
+	assert.Equal(t, "bb", readString(t, ws, "dst/sub/b.txt"))
+
+	_, err = ws.Copy(ctx, &protocol.CopyArgs{Source: "src", Dest: "dst", Recursive: true})
+	assertErrorCode(t, err, protocol.ErrorCodeExists)
+	_, err = ws.Copy(ctx, &protocol.CopyArgs{Source: "src", Dest: "dst", Recursive: true, Overwrite: true})
+	require.NoError(t, err)
+
+	_, err = ws.Copy(ctx, &protocol.CopyArgs{Source: "src", Dest: "src/sub/copy", Recursive: true})
+	assertErrorCode(t, err, protocol.ErrorCodeInvalidPath)
+
+	// Files can be copied out of a mount but not into it
+	res, err = ws.Copy(ctx, &protocol.CopyArgs{Source: "logs:syslog", Dest: "syslog.copy"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Files)
+	assert.Equal(t, "log", readString(t, ws, "syslog.copy"))
+
+	_, err = ws.Copy(ctx, &protocol.CopyArgs{Source: "src/a.txt", Dest: "logs:a.txt"})
+	assertErrorCode(t, err, protocol.ErrorCodeInvalidPath)
+
+	_, err = ws.Copy(ctx, &protocol.CopyArgs{Source: "src/a.txt", Dest: "syslog.copy"})
+	assertErrorCode(t, err, protocol.ErrorCodeExists)
+}
+
+func TestWorkspace_Delete(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+	writeString(t, ws, "tmp.txt", "tmp")
+	writeString(t, ws, "dir/a.txt", "a")
+	writeString(t, ws, "dir/sub/b.txt", "b")
+	require.NoError(t, os.Mkdir(filepath.Join(ws.Root(), "empty"), 0o755))
+
+	res, err := ws.Delete(ctx, &protocol.DeleteArgs{Path: "tmp.txt"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Files)
+	assert.NoFileExists(t, filepath.Join(ws.Root(), "tmp.txt"))
+
+	// A deleted file can be restored
+	_, err = ws.Restore(ctx, &protocol.RestoreArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, "tmp", readString(t, ws, "tmp.txt"))
+
+	res, err = ws.Delete(ctx, &protocol.DeleteArgs{Path: "empty"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Dirs)
+
+	_, err = ws.Delete(ctx, &protocol.DeleteArgs{Path: "dir"})
+	assertErrorCode(t, err, protocol.ErrorCodeNotEmpty)
+	_, err = ws.Delete(ctx, &protocol.DeleteArgs{Path: "dir", Recursive: true})
+	assertErrorCode(t, err, protocol.ErrorCodeConfirmRequired)
+	assert.ErrorContains(t, err, "2 files and 2 directories")
+	assert.DirExists(t, filepath.Join(ws.Root(), "dir"))
+
+	res, err = ws.Delete(ctx, &protocol.DeleteArgs{Path: "dir", Recursive: true, Confirm: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Files)
+	assert.Equal(t, 2, res.Dirs)
+	assert.NoDirExists(t, filepath.Join(ws.Root(), "dir"))
+
+	_, err = ws.Delete(ctx, &protocol.DeleteArgs{Path: "missing"})
+	assertErrorCode(t, err, protocol.ErrorCodeNotFound)
+}
+
+func TestWorkspace_Delete_Protected(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+	writeString(t, ws, "target/keep.txt", "keep")
+	writeString(t, ws, "a.txt", "a") // Creates .work/backups
+
+	for _, path := range []string{"", ".", "/", "sub/..", ".work", ".work/backups", "./.work/backups/index.json"} {
+		_, err := ws.Delete(ctx, &protocol.DeleteArgs{Path: path, Recursive: true, Confirm: true})
+		assertErrorCode(t, err, protocol.ErrorCodeProtected)
+	}
+	_, err := ws.Delete(ctx, &protocol.DeleteArgs{Path: "../x"})
+	assertErrorCode(t, err, protocol.ErrorCodeInvalidPath)
+	assert.FileExists(t, filepath.Join(ws.Root(), BackupsDir, backupIndexFile))
+
+	// Deleting a symlink removes the link, not its target
+	require.NoError(t, os.Symlink("target", filepath.Join(ws.Root(), "link")))
+	res, err := ws.Delete(ctx, &protocol.DeleteArgs{Path: "link"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Files)
+	assert.FileExists(t, filepath.Join(ws.Root(), "target", "keep.txt"))
+}
@@ -0,0 +1,144 @@
+package workspace
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// ignoreRule is a single pattern from a .gitignore file.
+type ignoreRule struct {
+	pattern  string
+	negate   bool // "!pattern" re-includes a path
+	dirOnly  bool // "pattern/" only matches directories
+	anchored bool // Pattern contains "/" and matches relative to the .gitignore directory
+}
+
+// match reports whether the rule matches rel, a slash path relative to the
+// directory of the .gitignore file.
+func (r *ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	target := rel
+	if !r.anchored {
+		target = path.Base(rel)
+	}
+	ok, _ := doublestar.Match(r.pattern, target)
+	return ok
+}
+
+// parseIgnoreRule parses a .gitignore line. It returns false for blank lines and comments.
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	var rule ignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	// A backslash escapes a leading "#" or "!"
+	line = strings.TrimPrefix(line, `\`)
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	rule.pattern = line
+	return rule, true
+}
+
+// gitignore decides which paths under a root are ignored by the .gitignore
+// files in the root and its subdirectories. Files are read on first use.
+type gitignore struct {
+	root       string
+	rules      map[string][]ignoreRule // Directory (slash path, "" for root) to its rules
+	dirIgnored map[string]bool
+}
+
+func newGitignore(root string) *gitignore {
+	return &gitignore{
+		root:       root,
+		rules:      make(map[string][]ignoreRule),
+		dirIgnored: make(map[string]bool),
+	}
+}
+
+// ignored reports whether rel, a slash path relative to the root, is ignored
+// by its own name or because a parent directory is ignored.
+func (g *gitignore) ignored(rel string, isDir bool) bool {
+	if rel == "" || rel == "." {
+		return false
+	}
+	if path.Base(rel) == ".git" {
+		return true
+	}
+
+	if parent := path.Dir(rel); parent != "." {
+		ignored, ok := g.dirIgnored[parent]
+		if !ok {
+			ignored = g.ignored(parent, true)
+			g.dirIgnored[parent] = ignored
+		}
+		if ignored {
+			return true
+		}
+	}
+	return g.match(rel, isDir)
+}
+
+// match applies the rules of every directory above rel, outermost first.
+// As in git, the last matching rule wins.
+func (g *gitignore) match(rel string, isDir bool) bool {
+	ignored := false
+	dir := ""
+	for {
+		sub := strings.TrimPrefix(rel, dir)
+		sub = strings.TrimPrefix(sub, "/")
+		for _, rule := range g.load(dir) {
+			if rule.match(sub, isDir) {
+				ignored = !rule.negate
+			}
+		}
+
+		next, _, found := strings.Cut(sub, "/")
+		if !found {
+			return ignored
+		}
+		dir = path.Join(dir, next)
+	}
+}
+
+// load returns the rules of the .gitignore file in dir.
+func (g *gitignore) load(dir string) []ignoreRule {
+	if rules, ok := g.rules[dir]; ok {
+		return rules
+	}
+
+	var rules []ignoreRule
+	if file, err := os.Open(filepath.Join(g.root, filepath.FromSlash(dir), ".gitignore")); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+				rules = append(rules, rule)
+			}
+		}
+		_ = file.Close()
+	}
+	g.rules[dir] = rules
+	return rules
+}
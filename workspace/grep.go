@@ -0,0 +1,690 @@
+package workspace
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// grepBinarySniffSize matches ripgrep's initial buffer used for binary detection
+const grepBinarySniffSize = 64 * 1024
+
+// maxGrepFileSize is the largest file searched by either backend; larger
+// files are reported as skipped. A variable so tests can lower it.
+var maxGrepFileSize int64 = 64 * 1024 * 1024
+
+// grepSkipDirs are never searched, wherever they appear below the search path.
+// The runner's own working directory holds saved outputs that would echo old results.
+var grepSkipDirs = []string{".git", WorkDir}
+
+// grepOptions are normalized grep arguments shared by the ripgrep and Go backends.
+type grepOptions struct {
+	args       *protocol.GrepArgs
+	loc        *location // Resolved search path and its workspace or mount root
+	searchPath string    // Real path of the file or directory to search
+	relPath    string    // searchPath relative to its root, "." for the root
+	before     int
+	after      int
+	mode       string
+}
+
+// Grep searches for a pattern in files. ripgrep is used when installed, with a
+// pure-Go fallback that follows the same semantics.
+func (w *Workspace) Grep(ctx context.Context, args *protocol.GrepArgs) (*protocol.GrepResult, error) {
+	opts, err := w.grepOptions(args)
+	if err != nil {
+		return nil, err
+	}
+	outputConfig, err := OutputConfig(args.Truncate, args.MaxTokens, protocol.TruncateHead)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newGrepCollector(opts)
+	if _, lookErr := exec.LookPath("rg"); lookErr == nil {
+		err = w.grepWithRipgrep(ctx, opts, c)
+	} else {
+		err = w.grepWithGo(ctx, opts, c)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := c.result()
+	content := formatGrepContent(res, opts.mode)
+
+	// Process large output
+	processor := NewLargeOutputProcessor(w, outputConfig)
+	processed, err := processor.Process(ctx, content, "grep")
+	if err != nil {
+		res.Content = content
+		res.TotalSize = int64(len(content))
+		return res, nil
+	}
+
+	res.Content = processed.Content
+	res.Truncated = processed.Truncated
+	res.FilePath = processed.FilePath
+	res.TotalSize = processed.TotalSize
+	res.TotalLines = processed.TotalLines
+	res.PreviewLines = processed.PreviewLines
+	res.TotalTokens = processed.TotalTokens
+	res.EstimatedTokens = processed.EstimatedTokens
+
+	return res, nil
+}
+
+// grepOptions validates arguments and resolves the search path.
+func (w *Workspace) grepOptions(args *protocol.GrepArgs) (*grepOptions, error) {
+	if args.Pattern == "" {
+		return nil, fmt.Errorf("pattern is required")
+	}
+	if !args.Multiline && strings.Contains(args.Pattern, "\n") {
+		return nil, fmt.Errorf("pattern contains a newline: set multiline to match across lines")
+	}
+
+	switch args.Case {
+	case "", protocol.GrepCaseSmart, protocol.GrepCaseSensitive, protocol.GrepCaseInsensitive:
+	default:
+		return nil, fmt.Errorf("unsupported case mode: %s", args.Case)
+	}
+
+	opts := &grepOptions{args: args, mode: args.OutputMode}
+	switch opts.mode {
+	case "":
+		opts.mode = protocol.GrepOutputContent
+	case protocol.GrepOutputContent, protocol.GrepOutputFiles, protocol.GrepOutputCount:
+	default:
+		return nil, fmt.Errorf("unsupported output mode: %s", args.OutputMode)
+	}
+
+	opts.before, opts.after = max(args.Context, 0), max(args.Context, 0)
+	if args.Before > 0 {
+		opts.before = args.Before
+	}
+	if args.After > 0 {
+		opts.after = args.After
+	}
+
+	path := args.Path
+	if path == "" {
+		path = "."
+	}
+	loc, err := w.resolveRead(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(loc.path); err != nil {
+		return nil, fmt.Errorf("failed to stat search path: %w", err)
+	}
+	opts.loc = loc
+	opts.searchPath = loc.path
+	opts.relPath = strings.TrimPrefix(loc.display(loc.path), loc.prefix)
+	return opts, nil
+}
+
+// grepCollector gathers matches from either backend and applies the overall
+// result limit, so both backends produce identical results.
+type grepCollector struct {
+	opts    *grepOptions
+	matches []protocol.GrepMatch
+	files   []string
+	counts  []protocol.GrepFileCount
+	skipped []string // Files too large to search
+	found   int
+	limited bool
+
+	// Once full, only the trailing context of the last match is accepted
+	full        bool
+	lastPath    string
+	trailingEnd int
+}
+
+func newGrepCollector(opts *grepOptions) *grepCollector {
+	return &grepCollector{opts: opts}
+}
+
+// add records a match or context line. It returns false once no further
+// results can be accepted, telling the backend to stop.
+func (c *grepCollector) add(m protocol.GrepMatch) bool {
+	content := c.opts.mode == protocol.GrepOutputContent
+	limit := c.opts.args.MaxResults
+
+	if c.full {
+		if m.IsContext && m.Path == c.lastPath && m.LineNumber <= c.trailingEnd {
+			c.matches = append(c.matches, m)
+			return true
+		}
+		// Context is only produced around matches, so more results exist
+		c.limited = true
+		return false
+	}
+
+	if m.IsContext {
+		if content {
+			c.matches = append(c.matches, m)
+		}
+		return true
+	}
+
+	newFile := len(c.files) == 0 || c.files[len(c.files)-1] != m.Path
+	if !content && newFile && limit > 0 && len(c.files) >= limit {
+		c.limited = true
+		return false
+	}
+
+	if content {
+		c.matches = append(c.matches, m)
+	}
+	c.found++
+	if newFile {
+		c.files = append(c.files, m.Path)
+		c.counts = append(c.counts, protocol.GrepFileCount{Path: m.Path})
+	}
+	c.counts[len(c.counts)-1].Count++
+
+	c.lastPath = m.Path
+	c.trailingEnd = m.LineNumber + strings.Count(m.Content, "\n") + c.opts.after
+	if content && limit > 0 && c.found >= limit {
+		c.full = true
+	}
+	return true
+}
+
+func (c *grepCollector) result() *protocol.GrepResult {
+	res := &protocol.GrepResult{Matches: c.matches, Limited: c.limited, Skipped: c.skipped}
+	if res.Matches == nil {
+		res.Matches = []protocol.GrepMatch{}
+	}
+	switch c.opts.mode {
+	case protocol.GrepOutputFiles:
+		res.Files = c.files
+	case protocol.GrepOutputCount:
+		res.Counts = c.counts
+	}
+	return res
+}
+
+// formatGrepContent renders results ripgrep-style: "path:line:text" for
+// matches and "path-line-text" for context.
+func formatGrepContent(res *protocol.GrepResult, mode string) string {
+	var sb strings.Builder
+	switch mode {
+	case protocol.GrepOutputFiles:
+		for _, f := range res.Files {
+			sb.WriteString(f + "\n")
+		}
+	case protocol.GrepOutputCount:
+		for _, fc := range res.Counts {
+			sb.WriteString(fmt.Sprintf("%s:%d\n", fc.Path, fc.Count))
+		}
+	default:
+		for _, m := range res.Matches {
+			sep := ":"
+			if m.IsContext {
+				sep = "-"
+			}
+			for i, line := range strings.Split(m.Content, "\n") {
+				sb.WriteString(fmt.Sprintf("%s%s%d%s%s\n", m.Path, sep, m.LineNumber+i, sep, line))
+			}
+		}
+	}
+	if len(res.Skipped) > 0 {
+		sb.WriteString(fmt.Sprintf("[%d files over %d MiB not searched: %s]\n",
+			len(res.Skipped), maxGrepFileSize/(1024*1024), strings.Join(res.Skipped, ", ")))
+	}
+	return sb.String()
+}
+
+// rgMessage is a line of ripgrep's --json output.
+type rgMessage struct {
+	Type string `json:"type"`
+	Data struct {
+		Path       rgText `json:"path"`
+		Lines      rgText `json:"lines"`
+		LineNumber int    `json:"line_number"`
+	} `json:"data"`
+}
+
+// rgText is ripgrep's encoding of possibly non-UTF-8 text.
+type rgText struct {
+	Text  string `json:"text"`
+	Bytes string `json:"bytes"`
+}
+
+func (t rgText) String() string {
+	if t.Bytes != "" {
+		if b, err := base64.StdEncoding.DecodeString(t.Bytes); err == nil {
+			return string(b)
+		}
+	}
+	return t.Text
+}
+
+// ripgrepArgs builds the ripgrep command line for opts.
+func ripgrepArgs(opts *grepOptions) []string {
+	args := opts.args
+	cmdArgs := []string{"--json", "--sort", "path", "--hidden", "--no-ignore", "--no-config",
+		"--max-filesize", strconv.FormatInt(maxGrepFileSize, 10)}
+	for _, dir := range grepSkipDirs {
+		cmdArgs = append(cmdArgs, "--glob", "!"+dir)
+	}
+
+	switch args.Case {
+	case protocol.GrepCaseSensitive:
+		cmdArgs = append(cmdArgs, "--case-sensitive")
+	case protocol.GrepCaseInsensitive:
+		cmdArgs = append(cmdArgs, "--ignore-case")
+	default:
+		cmdArgs = append(cmdArgs, "--smart-case")
+	}
+	if args.FixedStrings {
+		cmdArgs = append(cmdArgs, "--fixed-strings")
+	}
+	if args.Multiline {
+		cmdArgs = append(cmdArgs, "--multiline")
+	}
+	if opts.before > 0 {
+		cmdArgs = append(cmdArgs, "--before-context", strconv.Itoa(opts.before))
+	}
+	if opts.after > 0 {
+		cmdArgs = append(cmdArgs, "--after-context", strconv.Itoa(opts.after))
+	}
+	if args.MaxCount > 0 {
+		cmdArgs = append(cmdArgs, "--max-count", strconv.Itoa(args.MaxCount))
+	}
+	for _, inc := range args.Include {
+		cmdArgs = append(cmdArgs, "--glob", inc)
+	}
+	for _, exc := range args.Exclude {
+		cmdArgs = append(cmdArgs, "--glob", "!"+exc)
+	}
+	return append(cmdArgs, "--regexp", args.Pattern, "--", opts.relPath)
+}
+
+func (w *Workspace) grepWithRipgrep(ctx context.Context, opts *grepOptions, c *grepCollector) error {
+	// ripgrep searches a file it is given whatever its size or content, so
+	// a single file gets the size and binary checks of the Go backend
+	if info, err := os.Stat(opts.searchPath); err == nil && !info.IsDir() {
+		return w.grepWithGo(ctx, opts, c)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "rg", ripgrepArgs(opts)...)
+	cmd.Dir = opts.loc.root
+
+	var stderr strings.Builder
+	cmd.Stderr = &LimitedWriter{W: &stderr, Limit: 64 * 1024}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to start ripgrep: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ripgrep: %w", err)
+	}
+
+	stopped := false
+	reader := bufio.NewReader(stdout)
+	for !stopped {
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var msg rgMessage
+			if err := json.Unmarshal(line, &msg); err == nil && (msg.Type == "match" || msg.Type == "context") {
+				stopped = !c.add(protocol.GrepMatch{
+					Path:       opts.loc.prefix + strings.TrimPrefix(filepath.ToSlash(msg.Data.Path.String()), "./"),
+					LineNumber: msg.Data.LineNumber,
+					Content:    trimLineEnding(msg.Data.Lines.String()),
+					IsContext:  msg.Type == "context",
+				})
+			}
+		}
+		if readErr != nil {
+			break
+		}
+	}
+
+	if stopped {
+		cancel()
+		_, _ = io.Copy(io.Discard, stdout)
+		_ = cmd.Wait()
+		return recordOversized(context.WithoutCancel(ctx), opts, c, c.lastPath)
+	}
+
+	// Exit code 1 means no matches; 2 means an error, which may be partial (e.g., unreadable files)
+	err = cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 2 && c.found == 0 {
+		return fmt.Errorf("grep failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return recordOversized(ctx, opts, c, "")
+}
+
+// recordOversized adds the files ripgrep left out for exceeding
+// maxGrepFileSize to c.skipped, as the Go backend reports them. With stopAt
+// set, only files before the one the search stopped in are considered.
+func recordOversized(ctx context.Context, opts *grepOptions, c *grepCollector, stopAt string) error {
+	return walkGrepFiles(ctx, opts, func(p, path string, d fs.DirEntry) bool {
+		if path == stopAt {
+			return false
+		}
+		if info, err := d.Info(); err == nil && info.Size() > maxGrepFileSize {
+			c.skipped = append(c.skipped, path)
+		}
+		return true
+	})
+}
+
+// compileGrepPattern builds a Go regexp following ripgrep's case and line semantics.
+func compileGrepPattern(args *protocol.GrepArgs) (*regexp.Regexp, error) {
+	pattern := args.Pattern
+	if args.FixedStrings {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+
+	insensitive := false
+	switch args.Case {
+	case protocol.GrepCaseInsensitive:
+		insensitive = true
+	case protocol.GrepCaseSensitive:
+	default:
+		insensitive = !hasUppercaseLiteral(args.Pattern, args.FixedStrings)
+	}
+
+	// ripgrep always treats ^ and $ as line anchors
+	flags := "m"
+	if insensitive {
+		flags += "i"
+	}
+	re, err := regexp.Compile("(?" + flags + ")" + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	return re, nil
+}
+
+// hasUppercaseLiteral reports whether a pattern contains an uppercase literal
+// character, ignoring escape sequences such as \S or \p{Lu}, as ripgrep's
+// smart case does.
+func hasUppercaseLiteral(pattern string, fixed bool) bool {
+	for i := 0; i < len(pattern); {
+		r, n := utf8.DecodeRuneInString(pattern[i:])
+		i += n
+		if r == '\\' && !fixed && i < len(pattern) {
+			next := pattern[i]
+			i++
+			// \p{...}, \P{...} and \x{...} carry names or hex digits, not literals
+			if (next == 'p' || next == 'P' || next == 'x') && i < len(pattern) && pattern[i] == '{' {
+				if end := strings.IndexByte(pattern[i:], '}'); end >= 0 {
+					i += end + 1
+				}
+			} else if next == 'x' {
+				i = min(i+2, len(pattern))
+			}
+			continue
+		}
+		if unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Workspace) grepWithGo(ctx context.Context, opts *grepOptions, c *grepCollector) error {
+	re, err := compileGrepPattern(opts.args)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(opts.searchPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat search path: %w", err)
+	}
+	// An explicit file is searched regardless of globs, as with ripgrep
+	if !info.IsDir() {
+		_, err := grepFile(opts, re, opts.searchPath, opts.loc.display(opts.searchPath), c)
+		return err
+	}
+
+	return walkGrepFiles(ctx, opts, func(p, path string, _ fs.DirEntry) bool {
+		more, err := grepFile(opts, re, p, path, c)
+		return err != nil || more
+	})
+}
+
+// walkGrepFiles calls visit with the real and displayed path of each file a
+// search of the directory opts.searchPath covers, until visit returns false.
+func walkGrepFiles(ctx context.Context, opts *grepOptions, visit func(p, path string, d fs.DirEntry) bool) error {
+	errStop := errors.New("stop")
+	err := filepath.WalkDir(opts.searchPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip unreadable entries like ripgrep does
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if p == opts.searchPath {
+			return nil
+		}
+
+		rel := strings.TrimPrefix(opts.loc.display(p), opts.loc.prefix)
+
+		if d.IsDir() {
+			for _, skip := range grepSkipDirs {
+				if d.Name() == skip {
+					return filepath.SkipDir
+				}
+			}
+			if matchesAnyGlob(opts.args.Exclude, rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// ripgrep does not follow symlinks by default
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if len(opts.args.Include) > 0 && !matchesAnyGlob(opts.args.Include, rel) {
+			return nil
+		}
+		if matchesAnyGlob(opts.args.Exclude, rel) {
+			return nil
+		}
+
+		if !visit(p, opts.loc.prefix+rel, d) {
+			return errStop
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStop) {
+		return err
+	}
+	return nil
+}
+
+// matchesAnyGlob matches a workspace-relative path against gitignore-style
+// globs: a glob without "/" matches the file name at any depth, otherwise it
+// matches the whole path.
+func matchesAnyGlob(globs []string, rel string) bool {
+	for _, g := range globs {
+		g = strings.TrimPrefix(g, "/")
+		target := rel
+		if !strings.Contains(strings.TrimSuffix(g, "/"), "/") {
+			target = filepath.Base(rel)
+		}
+		if ok, _ := doublestar.Match(strings.TrimSuffix(g, "/"), target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// lineRange is an inclusive range of 0-based line indexes.
+type lineRange struct {
+	start, end int
+}
+
+// grepFile searches one file and sends its matches and context to c.
+// It returns false when c accepts no more results.
+func grepFile(opts *grepOptions, re *regexp.Regexp, path, rel string, c *grepCollector) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return true, err
+	}
+	if info.Size() > maxGrepFileSize {
+		c.skipped = append(c.skipped, rel)
+		return true, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return true, err
+	}
+
+	// Binary files: skip when a NUL byte appears early, otherwise stop at the line containing it
+	if nul := bytes.IndexByte(data, 0); nul >= 0 {
+		if nul < grepBinarySniffSize {
+			return true, nil
+		}
+		data = data[:bytes.LastIndexByte(data[:nul], '\n')+1]
+	}
+
+	content := string(data)
+	lines, offsets := splitLinesWithOffsets(content)
+
+	var ranges []lineRange
+	if opts.args.Multiline {
+		ranges = multilineMatches(re, content, offsets)
+	} else {
+		for i, line := range lines {
+			if re.MatchString(line) {
+				ranges = append(ranges, lineRange{i, i})
+			}
+		}
+	}
+	if maxCount := opts.args.MaxCount; maxCount > 0 && len(ranges) > maxCount {
+		ranges = ranges[:maxCount]
+	}
+
+	emit := func(start, end int, isContext bool) bool {
+		return c.add(protocol.GrepMatch{
+			Path:       rel,
+			LineNumber: start + 1,
+			Content:    trimLineEnding(strings.Join(lines[start:end+1], "\n")),
+			IsContext:  isContext,
+		})
+	}
+
+	printed := -1
+	for k, r := range ranges {
+		for j := max(r.start-opts.before, printed+1); j < r.start; j++ {
+			if !emit(j, j, true) {
+				return false, nil
+			}
+		}
+		if !emit(r.start, r.end, false) {
+			return false, nil
+		}
+		printed = r.end
+
+		// After context stops at the next match; after the last one it runs to the end
+		limit := len(lines) - 1
+		if k+1 < len(ranges) {
+			limit = ranges[k+1].start - 1
+		}
+		for j := printed + 1; j <= min(r.end+opts.after, limit); j++ {
+			if !emit(j, j, true) {
+				return false, nil
+			}
+			printed = j
+		}
+	}
+	return true, nil
+}
+
+// multilineMatches returns the line ranges of all matches in content,
+// merging matches that share a line as ripgrep does.
+func multilineMatches(re *regexp.Regexp, content string, offsets []int) []lineRange {
+	lineOf := func(off int) int {
+		// Index of the last line starting at or before off
+		lo, hi := 0, len(offsets)-1
+		for lo < hi {
+			mid := (lo + hi + 1) / 2
+			if offsets[mid] <= off {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+		return lo
+	}
+
+	var ranges []lineRange
+	for _, loc := range re.FindAllStringIndex(content, -1) {
+		if loc[0] >= len(content) {
+			break
+		}
+		last := loc[1] - 1
+		if last < loc[0] {
+			last = loc[0]
+		}
+		r := lineRange{lineOf(loc[0]), lineOf(last)}
+		if n := len(ranges); n > 0 && r.start <= ranges[n-1].end {
+			ranges[n-1].end = max(ranges[n-1].end, r.end)
+			continue
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// splitLinesWithOffsets splits content into lines without the trailing "\n"
+// and returns the byte offset of each line.
+func splitLinesWithOffsets(content string) ([]string, []int) {
+	var lines []string
+	var offsets []int
+	for start := 0; start < len(content); {
+		end := strings.IndexByte(content[start:], '\n')
+		if end < 0 {
+			lines = append(lines, content[start:])
+			offsets = append(offsets, start)
+			break
+		}
+		lines = append(lines, content[start:start+end])
+		offsets = append(offsets, start)
+		start += end + 1
+	}
+	return lines, offsets
+}
+
+// trimLineEnding removes one trailing "\n" or "\r\n".
+func trimLineEnding(s string) string {
+	s = strings.TrimSuffix(s, "\n")
+	return strings.TrimSuffix(s, "\r")
+}
@@ -0,0 +1,279 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// newGrepWorkspace creates a workspace with a fixed tree for grep tests.
+func newGrepWorkspace(t *testing.T) *Workspace {
+	ws := newTestWorkspace(t)
+	files := map[string]string{
+		"a.txt":               "alpha\nBeta\ngamma\ndelta\nepsilon\nzeta\neta\n",
+		"crlf.txt":            "alpha\r\nbeta\r\n",
+		"bin.dat":             "alpha\x00\x01\x02",
+		"sub/b.go":            "package sub\n\nfunc Alpha() {}\n// alpha beta\n",
+		"sub/deep/c.go":       "alpha\n",
+		".hidden/h.txt":       "alpha hidden\n",
+		".git/config":         "alpha git\n",
+		".work/outputs/o.txt": "alpha output\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(ws.Root(), name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	return ws
+}
+
+// grepWith runs a single grep backend and formats its result.
+func grepWith(t *testing.T, ws *Workspace, args *protocol.GrepArgs, ripgrep bool) *protocol.GrepResult {
+	t.Helper()
+	opts, err := ws.grepOptions(args)
+	require.NoError(t, err)
+
+	c := newGrepCollector(opts)
+	if ripgrep {
+		err = ws.grepWithRipgrep(context.Background(), opts, c)
+	} else {
+		err = ws.grepWithGo(context.Background(), opts, c)
+	}
+	require.NoError(t, err)
+
+	res := c.result()
+	res.Content = formatGrepContent(res, opts.mode)
+	return res
+}
+
+var grepCases = []struct {
+	name        string
+	args        protocol.GrepArgs
+	wantContent string
+	wantLimited bool
+}{
+	{
+		name: "smart case lowercase is insensitive",
+		args: protocol.GrepArgs{Pattern: "alpha"},
+		wantContent: ".hidden/h.txt:1:alpha hidden\n" +
+			"a.txt:1:alpha\n" +
+			"crlf.txt:1:alpha\n" +
+			"sub/b.go:3:func Alpha() {}\n" +
+			"sub/b.go:4:// alpha beta\n" +
+			"sub/deep/c.go:1:alpha\n",
+	},
+	{
+		name:        "smart case uppercase is sensitive",
+		args:        protocol.GrepArgs{Pattern: "Alpha"},
+		wantContent: "sub/b.go:3:func Alpha() {}\n",
+	},
+	{
+		name:        "smart case ignores escapes",
+		args:        protocol.GrepArgs{Pattern: `\Walpha`, Path: "sub"},
+		wantContent: "sub/b.go:3:func Alpha() {}\nsub/b.go:4:// alpha beta\n",
+	},
+	{
+		name:        "case sensitive",
+		args:        protocol.GrepArgs{Pattern: "beta", Case: protocol.GrepCaseSensitive, Path: "a.txt"},
+		wantContent: "",
+	},
+	{
+		name:        "case insensitive",
+		args:        protocol.GrepArgs{Pattern: "BETA", Case: protocol.GrepCaseInsensitive, Path: "a.txt"},
+		wantContent: "a.txt:2:Beta\n",
+	},
+	{
+		name:        "fixed strings",
+		args:        protocol.GrepArgs{Pattern: "() {}", FixedStrings: true},
+		wantContent: "sub/b.go:3:func Alpha() {}\n",
+	},
+	{
+		name:        "include globs match file names at any depth",
+		args:        protocol.GrepArgs{Pattern: "alpha", Include: []string{"*.go"}},
+		wantContent: "sub/b.go:3:func Alpha() {}\nsub/b.go:4:// alpha beta\nsub/deep/c.go:1:alpha\n",
+	},
+	{
+		name:        "exclude directory",
+		args:        protocol.GrepArgs{Pattern: "alpha", Include: []string{"*.go"}, Exclude: []string{"deep"}},
+		wantContent: "sub/b.go:3:func Alpha() {}\nsub/b.go:4:// alpha beta\n",
+	},
+	{
+		name:        "include path glob",
+		args:        protocol.GrepArgs{Pattern: "alpha", Include: []string{"sub/deep/*.go"}},
+		wantContent: "sub/deep/c.go:1:alpha\n",
+	},
+	{
+		name:        "sub path",
+		args:        protocol.GrepArgs{Pattern: "alpha", Path: "sub/deep"},
+		wantContent: "sub/deep/c.go:1:alpha\n",
+	},
+	{
+		name:        "context",
+		args:        protocol.GrepArgs{Pattern: "delta", Path: "a.txt", Context: 1},
+		wantContent: "a.txt-3-gamma\na.txt:4:delta\na.txt-5-epsilon\n",
+	},
+	{
+		name: "before context merges with previous match",
+		args: protocol.GrepArgs{Pattern: "^e", Path: "a.txt", Before: 2},
+		wantContent: "a.txt-3-gamma\na.txt-4-delta\na.txt:5:epsilon\n" +
+			"a.txt-6-zeta\na.txt:7:eta\n",
+	},
+	{
+		name:        "multiline",
+		args:        protocol.GrepArgs{Pattern: `gamma\ndelta`, Path: "a.txt", Multiline: true},
+		wantContent: "a.txt:3:gamma\na.txt:4:delta\n",
+	},
+	{
+		name:        "max count per file",
+		args:        protocol.GrepArgs{Pattern: "alpha", Path: "sub", MaxCount: 1},
+		wantContent: "sub/b.go:3:func Alpha() {}\nsub/deep/c.go:1:alpha\n",
+	},
+	{
+		name:        "max results overall",
+		args:        protocol.GrepArgs{Pattern: "alpha", MaxResults: 2},
+		wantContent: ".hidden/h.txt:1:alpha hidden\na.txt:1:alpha\n",
+		wantLimited: true,
+	},
+	{
+		name:        "max results keeps trailing context",
+		args:        protocol.GrepArgs{Pattern: "^e", Path: "a.txt", MaxResults: 1, After: 1},
+		wantContent: "a.txt:5:epsilon\na.txt-6-zeta\n",
+		wantLimited: true,
+	},
+	{
+		name:        "max results not reached",
+		args:        protocol.GrepArgs{Pattern: "alpha", Path: "sub", MaxResults: 3},
+		wantContent: "sub/b.go:3:func Alpha() {}\nsub/b.go:4:// alpha beta\nsub/deep/c.go:1:alpha\n",
+	},
+	{
+		name:        "files with matches",
+		args:        protocol.GrepArgs{Pattern: "alpha", OutputMode: protocol.GrepOutputFiles},
+		wantContent: ".hidden/h.txt\na.txt\ncrlf.txt\nsub/b.go\nsub/deep/c.go\n",
+	},
+	{
+		name:        "files with matches limited",
+		args:        protocol.GrepArgs{Pattern: "alpha", OutputMode: protocol.GrepOutputFiles, MaxResults: 1},
+		wantContent: ".hidden/h.txt\n",
+		wantLimited: true,
+	},
+	{
+		name:        "count",
+		args:        protocol.GrepArgs{Pattern: "a", Path: "sub", OutputMode: protocol.GrepOutputCount},
+		wantContent: "sub/b.go:3\nsub/deep/c.go:1\n",
+	},
+}
+
+func TestWorkspace_Grep_Go(t *testing.T) {
+	ws := newGrepWorkspace(t)
+
+	for _, tt := range grepCases {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			res := grepWith(t, ws, &args, false)
+			assert.Equal(t, tt.wantContent, res.Content)
+			assert.Equal(t, tt.wantLimited, res.Limited)
+		})
+	}
+}
+
+// requireRipgrep skips a test comparing the backends when ripgrep is missing.
+func requireRipgrep(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("rg"); err != nil {
+		// CI installs ripgrep so the backends are always compared there
+		if os.Getenv("CI") != "" {
+			t.Fatal("ripgrep not installed")
+		}
+		t.Skip("ripgrep not installed")
+	}
+}
+
+func TestWorkspace_Grep_Parity(t *testing.T) {
+	requireRipgrep(t)
+	ws := newGrepWorkspace(t)
+
+	for _, tt := range grepCases {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			goRes := grepWith(t, ws, &args, false)
+			rgRes := grepWith(t, ws, &args, true)
+			assert.Equal(t, goRes.Matches, rgRes.Matches)
+			assert.Equal(t, goRes.Files, rgRes.Files)
+			assert.Equal(t, goRes.Counts, rgRes.Counts)
+			assert.Equal(t, goRes.Limited, rgRes.Limited)
+			assert.Equal(t, tt.wantContent, rgRes.Content)
+		})
+	}
+}
+
+func TestWorkspace_Grep_SkipsLargeFiles(t *testing.T) {
+	ws := newGrepWorkspace(t)
+	saved := maxGrepFileSize
+	maxGrepFileSize = 1024 * 1024
+	t.Cleanup(func() { maxGrepFileSize = saved })
+	big := "alpha\n" + strings.Repeat("x", int(maxGrepFileSize))
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root(), "sub", "big.log"), []byte(big), 0o644))
+
+	res := grepWith(t, ws, &protocol.GrepArgs{Pattern: "alpha", Path: "sub", OutputMode: protocol.GrepOutputFiles}, false)
+	assert.Equal(t, []string{"sub/big.log"}, res.Skipped)
+	assert.Equal(t, "sub/b.go\nsub/deep/c.go\n[1 files over 1 MiB not searched: sub/big.log]\n", res.Content)
+}
+
+func TestWorkspace_Grep_ParitySkipped(t *testing.T) {
+	requireRipgrep(t)
+	ws := newGrepWorkspace(t)
+	saved := maxGrepFileSize
+	maxGrepFileSize = 1024 * 1024
+	t.Cleanup(func() { maxGrepFileSize = saved })
+	big := "alpha\n" + strings.Repeat("x", int(maxGrepFileSize))
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root(), "sub", "big.log"), []byte(big), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root(), "sub", "late.bin"), []byte("alpha 1\nalpha 2\x00\nalpha 3\n"), 0o644))
+
+	tests := []struct {
+		name        string
+		args        protocol.GrepArgs
+		wantSkipped []string
+	}{
+		{"oversized in directory", protocol.GrepArgs{Pattern: "alpha", Path: "sub"}, []string{"sub/big.log"}},
+		{"oversized file", protocol.GrepArgs{Pattern: "alpha", Path: "sub/big.log"}, []string{"sub/big.log"}},
+		{"binary file", protocol.GrepArgs{Pattern: "alpha", Path: "bin.dat"}, nil},
+		{"binary after matches", protocol.GrepArgs{Pattern: "alpha", Path: "sub/late.bin"}, nil},
+		{"stopped before oversized", protocol.GrepArgs{Pattern: "alpha", Path: "sub", MaxResults: 1}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			goRes := grepWith(t, ws, &args, false)
+			rgRes := grepWith(t, ws, &args, true)
+			assert.Equal(t, tt.wantSkipped, goRes.Skipped)
+			assert.Equal(t, goRes.Skipped, rgRes.Skipped)
+			assert.Equal(t, goRes.Matches, rgRes.Matches)
+			assert.Equal(t, goRes.Content, rgRes.Content)
+		})
+	}
+}
+
+func TestWorkspace_Grep_InvalidArgs(t *testing.T) {
+	ws := newGrepWorkspace(t)
+	ctx := context.Background()
+
+	_, err := ws.Grep(ctx, &protocol.GrepArgs{Pattern: "a\nb"})
+	assert.Error(t, err)
+
+	_, err = ws.Grep(ctx, &protocol.GrepArgs{Pattern: "("})
+	assert.Error(t, err)
+
+	_, err = ws.Grep(ctx, &protocol.GrepArgs{Pattern: "a", OutputMode: "json"})
+	assert.Error(t, err)
+
+	_, err = ws.Grep(ctx, &protocol.GrepArgs{Pattern: "a", Path: "../"})
+	assert.Error(t, err)
+}
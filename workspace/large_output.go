@@ -4,19 +4,28 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/lithammer/shortuuid/v4"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
 )
 
 const (
-	// DefaultMaxOutputSize is the default character limit before truncation (~7.5k tokens)
-	DefaultMaxOutputSize = 30000 // ~7.5k tokens at 4 chars/token
+	// DefaultMaxOutputSize is the default byte limit before truncation
+	DefaultMaxOutputSize = 30000
+	// DefaultMaxOutputTokens is the default estimated token limit before truncation
+	DefaultMaxOutputTokens = 7500
+	// MaxOutputTokens is the largest token budget a task can request
+	MaxOutputTokens = 100000
 	// DefaultPreviewSize is the maximum characters for preview
 	DefaultPreviewSize = 8000 // ~2k tokens
 	// DefaultPreviewLines is the number of lines shown in the preview
 	DefaultPreviewLines = 20
+	// DefaultContextLines is the number of lines shown around each interesting line
+	DefaultContextLines = 2
 	// OutputsDir is the directory name for storing large outputs
 	OutputsDir = ".work/outputs"
 	// WorkDir is the base working directory
@@ -25,20 +34,52 @@ const (
 
 // LargeOutputConfig holds configuration for large output handling.
 type LargeOutputConfig struct {
-	MaxOutputSize int
+	MaxOutputSize int // Byte limit, 0 for none
+	MaxTokens     int // Estimated token limit, 0 for none; the truncated content also fits it
 	PreviewSize   int
-	PreviewLines  int
+	PreviewLines  int    // Lines shown, or interesting lines shown with the interesting strategy
+	ContextLines  int    // Lines shown around each interesting line
+	Strategy      string // One of the protocol.Truncate* strategies (default: head)
 }
 
 // DefaultLargeOutputConfig returns the default configuration.
 func DefaultLargeOutputConfig() LargeOutputConfig {
 	return LargeOutputConfig{
 		MaxOutputSize: DefaultMaxOutputSize,
+		MaxTokens:     DefaultMaxOutputTokens,
 		PreviewSize:   DefaultPreviewSize,
 		PreviewLines:  DefaultPreviewLines,
+		ContextLines:  DefaultContextLines,
+		Strategy:      protocol.TruncateHead,
 	}
 }
 
+// OutputConfig returns the default configuration with the truncation
+// strategy requested by a task, or fallback when none was requested, and the
+// token budget requested by the task. A requested budget replaces both
+// default limits, since the cloud knows how much context it can spare.
+func OutputConfig(strategy string, maxTokens int, fallback string) (LargeOutputConfig, error) {
+	if strategy == "" {
+		strategy = fallback
+	}
+	switch strategy {
+	case protocol.TruncateHead, protocol.TruncateTail, protocol.TruncateHeadTail, protocol.TruncateInteresting:
+	default:
+		return LargeOutputConfig{}, fmt.Errorf("invalid truncate %q: must be %s, %s, %s or %s", strategy,
+			protocol.TruncateHead, protocol.TruncateTail, protocol.TruncateHeadTail, protocol.TruncateInteresting)
+	}
+	if maxTokens < 0 || maxTokens > MaxOutputTokens {
+		return LargeOutputConfig{}, fmt.Errorf("invalid max_tokens %d: must be between 0 and %d", maxTokens, MaxOutputTokens)
+	}
+	config := DefaultLargeOutputConfig()
+	config.Strategy = strategy
+	if maxTokens > 0 {
+		config.MaxOutputSize = 0
+		config.MaxTokens = maxTokens
+	}
+	return config, nil
+}
+
 // LargeOutputProcessor handles large output truncation and file storage.
 type LargeOutputProcessor struct {
 	config LargeOutputConfig
@@ -47,7 +88,7 @@ type LargeOutputProcessor struct {
 
 // NewLargeOutputProcessor creates a new processor with the given workspace.
 func NewLargeOutputProcessor(ws *Workspace, config LargeOutputConfig) *LargeOutputProcessor {
-	if config.MaxOutputSize <= 0 {
+	if config.MaxOutputSize <= 0 && config.MaxTokens <= 0 {
 		config.MaxOutputSize = DefaultMaxOutputSize
 	}
 	if config.PreviewSize <= 0 {
@@ -56,6 +97,12 @@ func NewLargeOutputProcessor(ws *Workspace, config LargeOutputConfig) *LargeOutp
 	if config.PreviewLines <= 0 {
 		config.PreviewLines = DefaultPreviewLines
 	}
+	if config.ContextLines < 0 {
+		config.ContextLines = 0
+	}
+	if config.Strategy == "" {
+		config.Strategy = protocol.TruncateHead
+	}
 	return &LargeOutputProcessor{
 		config: config,
 		ws:     ws,
@@ -64,45 +111,68 @@ func NewLargeOutputProcessor(ws *Workspace, config LargeOutputConfig) *LargeOutp
 
 // ProcessResult holds the result of processing large output.
 type ProcessResult struct {
-	Content   string
-	Truncated bool
-	FilePath  string
-	TotalSize int64
+	Content      string
+	Truncated    bool
+	FilePath     string
+	TotalSize    int64
+	TotalLines   int // Lines in the original content
+	PreviewLines int // Lines shown in the preview when truncated
+
+	TotalTokens     int // Estimated tokens of the original content
+	EstimatedTokens int // Estimated tokens of Content
 }
 
 // Process checks if content exceeds the limit and handles accordingly.
 func (p *LargeOutputProcessor) Process(ctx context.Context, content string, prefix string) (*ProcessResult, error) {
 	totalSize := int64(len(content))
+	totalTokens := EstimateTokens(content)
 
-	// Content is within limit, return unchanged
-	if len(content) <= p.config.MaxOutputSize {
+	// Content is within limits, return unchanged
+	if !p.exceeds(len(content), totalTokens) {
 		return &ProcessResult{
-			Content:   content,
-			Truncated: false,
-			TotalSize: totalSize,
+			Content:         content,
+			Truncated:       false,
+			TotalSize:       totalSize,
+			TotalLines:      countLines(content),
+			TotalTokens:     totalTokens,
+			EstimatedTokens: totalTokens,
 		}, nil
 	}
 
-	// Generate unique filename
+	// Save full content to file; if that fails, return the preview without
+	// a file reference
+	filePath := p.save(ctx, content, prefix)
+
+	lines := outputLines(content)
+	preview, shown := p.truncateContent(content, lines, totalTokens, filePath)
+	return &ProcessResult{
+		Content:         preview,
+		Truncated:       true,
+		FilePath:        filePath,
+		TotalSize:       totalSize,
+		TotalLines:      len(lines),
+		PreviewLines:    shown,
+		TotalTokens:     totalTokens,
+		EstimatedTokens: EstimateTokens(preview),
+	}, nil
+}
+
+// save saves content to a new file in OutputsDir and returns its path, or ""
+// if it could not be saved.
+func (p *LargeOutputProcessor) save(ctx context.Context, content string, prefix string) string {
 	filename := fmt.Sprintf("%s_%s_%d.txt", prefix, shortuuid.New()[:8], time.Now().Unix())
 	filePath := filepath.Join(OutputsDir, filename)
-
-	// Save full content to file
 	if err := p.ws.WriteRaw(ctx, filePath, []byte(content)); err != nil {
-		// If save fails, just return truncated content without file reference
-		return &ProcessResult{
-			Content:   p.truncateContent(content, ""),
-			Truncated: true,
-			TotalSize: totalSize,
-		}, nil
+		return ""
 	}
+	return filePath
+}
 
-	return &ProcessResult{
-		Content:   p.truncateContent(content, filePath),
-		Truncated: true,
-		FilePath:  filePath,
-		TotalSize: totalSize,
-	}, nil
+// exceeds reports whether content of size bytes and tokens estimated tokens
+// exceeds the configured limits.
+func (p *LargeOutputProcessor) exceeds(size, tokens int) bool {
+	return (p.config.MaxOutputSize > 0 && size > p.config.MaxOutputSize) ||
+		(p.config.MaxTokens > 0 && tokens > p.config.MaxTokens)
 }
 
 // ShouldSkipForWorkDir checks if large output processing should be skipped
@@ -119,24 +189,100 @@ func ShouldSkipForWorkDir(command string) bool {
 	return false
 }
 
-// truncateContent creates a truncated preview with optional file reference.
-func (p *LargeOutputProcessor) truncateContent(content string, filePath string) string {
-	lines := strings.Split(content, "\n")
+// interestingPattern matches lines that usually explain why a command failed.
+var interestingPattern = regexp.MustCompile(`(?i)\b(error|errors|err|warn|warning|fatal|panic|exception|traceback|fail|failed|failure|critical|denied|refused|timeout|timed out|killed|oom)\b|^\s+at \S+\(`)
+
+// previewRange is a half-open range of line indexes shown in a preview.
+type previewRange struct {
+	start, end int
+}
+
+// truncateContent creates a preview of lines chosen by the configured
+// strategy, with an optional file reference, and returns it with the number
+// of lines shown. The preview is shortened further to fit the token limit.
+func (p *LargeOutputProcessor) truncateContent(content string, lines []string, totalTokens int, filePath string) (string, int) {
 	totalLines := len(lines)
+	ranges, desc := p.selectLines(lines)
+
+	var preview strings.Builder
+	shown, next := 0, 0
+	for _, r := range ranges {
+		if r.start > next {
+			fmt.Fprintf(&preview, "... [%d lines omitted]\n", r.start-next)
+		}
+		for i := r.start; i < r.end; i++ {
+			fmt.Fprintf(&preview, "%6d\t%s\n", i+1, lines[i])
+		}
+		shown += r.end - r.start
+		next = r.end
+	}
+	if next < totalLines {
+		fmt.Fprintf(&preview, "... [%d lines omitted]\n", totalLines-next)
+	}
+
+	// Truncate preview if too long, keeping the end for the tail strategy
+	text := preview.String()
+	if len(text) > p.config.PreviewSize {
+		text = p.shortenPreview(text, p.config.PreviewSize)
+	}
+
+	message := p.truncationMessage(content, totalLines, totalTokens, filePath, desc, shown, text, ranges)
+	if p.config.MaxTokens <= 0 {
+		return message, shown
+	}
+	// Shorten the preview by the tokens the message is over budget until it
+	// fits; the truncation marker and message take a few tokens themselves
+	full := preview.String()
+	budget := EstimateTokens(text)
+	for excess := EstimateTokens(message) - p.config.MaxTokens; excess > 0 && budget > 0; excess = EstimateTokens(message) - p.config.MaxTokens {
+		budget = max(budget-excess, 0)
+		size := min(bytesWithinTokens(full, budget, p.config.Strategy == protocol.TruncateTail), p.config.PreviewSize)
+		text = p.shortenPreview(full, size)
+		message = p.truncationMessage(content, totalLines, totalTokens, filePath, desc, shown, text, ranges)
+	}
+	return message, shown
+}
 
-	// Calculate preview
-	previewLines := min(p.config.PreviewLines, totalLines)
-	preview := strings.Join(lines[:previewLines], "\n")
+// shortenPreview cuts text to size bytes, keeping the end for the tail
+// strategy and the start otherwise.
+func (p *LargeOutputProcessor) shortenPreview(text string, size int) string {
+	if p.config.Strategy == protocol.TruncateTail {
+		return "... [preview truncated]\n" + strings.ToValidUTF8(text[len(text)-size:], "")
+	}
+	return strings.ToValidUTF8(text[:size], "") + "\n... [preview truncated]\n"
+}
 
-	// Truncate preview if too long
-	if len(preview) > p.config.PreviewSize {
-		preview = preview[:p.config.PreviewSize] + "\n... [preview truncated]"
+// bytesWithinTokens returns the largest number of bytes from the start of
+// text, or from its end if fromEnd, that are estimated to take at most budget
+// tokens.
+func bytesWithinTokens(text string, budget int, fromEnd bool) int {
+	if budget <= 0 {
+		return 0
+	}
+	// Token estimates grow with the length of the text, so the length can be
+	// found by binary search
+	lo, hi := 0, len(text)
+	for lo < hi {
+		n := (lo + hi + 1) / 2
+		part := text[:n]
+		if fromEnd {
+			part = text[len(text)-n:]
+		}
+		if EstimateTokens(part) <= budget {
+			lo = n
+		} else {
+			hi = n - 1
+		}
 	}
+	return lo
+}
 
-	// Build truncation message
+// truncationMessage builds the message returned in place of oversized
+// content around the preview text.
+func (p *LargeOutputProcessor) truncationMessage(content string, totalLines, totalTokens int, filePath, desc string, shown int, text string, ranges []previewRange) string {
 	var sb strings.Builder
 	sb.WriteString("<output_truncated>\n")
-	sb.WriteString(fmt.Sprintf("Output too large (%d chars, %d lines).", len(content), totalLines))
+	sb.WriteString(fmt.Sprintf("Output too large (%d chars, %d lines, about %d tokens).", len(content), totalLines, totalTokens))
 
 	if filePath != "" {
 		sb.WriteString(fmt.Sprintf(" Full content saved to: %s\n\n", filePath))
@@ -144,12 +290,101 @@ func (p *LargeOutputProcessor) truncateContent(content string, filePath string)
 		sb.WriteString(" Could not save full content.\n\n")
 	}
 
-	sb.WriteString(fmt.Sprintf("Preview (first %d lines):\n```\n%s\n```\n\n", previewLines, preview))
+	sb.WriteString(fmt.Sprintf("Preview (%s, %d of %d lines, line numbers on the left):\n```\n%s```\n\n", desc, shown, totalLines, text))
 
-	if filePath != "" {
-		sb.WriteString(fmt.Sprintf("To read more: read(\"%s\", offset=%d, limit=100)\n", filePath, previewLines))
+	if start := firstOmitted(ranges, totalLines); filePath != "" && start > 0 {
+		sb.WriteString(fmt.Sprintf("To read more: read(\"%s\", mode=\"lines\", start_line=%d, line_count=100)\n", filePath, start))
 	}
 
 	sb.WriteString("</output_truncated>")
 	return sb.String()
 }
+
+// selectLines returns the ranges of lines shown by the configured strategy
+// and a description of them.
+func (p *LargeOutputProcessor) selectLines(lines []string) ([]previewRange, string) {
+	total := len(lines)
+	n := min(p.config.PreviewLines, total)
+
+	switch p.config.Strategy {
+	case protocol.TruncateTail:
+		return []previewRange{{total - n, total}}, fmt.Sprintf("last %d lines", n)
+
+	case protocol.TruncateHeadTail:
+		return headTail(total, n), fmt.Sprintf("first %d and last %d lines", (n+1)/2, n/2)
+
+	case protocol.TruncateInteresting:
+		var matches []int
+		for i, line := range lines {
+			if interestingPattern.MatchString(line) {
+				matches = append(matches, i)
+			}
+		}
+		if len(matches) == 0 {
+			return headTail(total, n), fmt.Sprintf("no error or warning lines; first %d and last %d lines", (n+1)/2, n/2)
+		}
+
+		// The last matches are kept, since the cause of a failure is usually
+		// reported at the end
+		kept := matches[max(len(matches)-p.config.PreviewLines, 0):]
+		var ranges []previewRange
+		for _, i := range kept {
+			r := previewRange{max(i-p.config.ContextLines, 0), min(i+p.config.ContextLines+1, total)}
+			if last := len(ranges) - 1; last >= 0 && r.start <= ranges[last].end {
+				ranges[last].end = r.end
+				continue
+			}
+			ranges = append(ranges, r)
+		}
+		return ranges, fmt.Sprintf("%d of %d error or warning lines with %d lines of context", len(kept), len(matches), p.config.ContextLines)
+
+	default:
+		return []previewRange{{0, n}}, fmt.Sprintf("first %d lines", n)
+	}
+}
+
+// headTail returns the first and last lines of total, n lines in all.
+func headTail(total, n int) []previewRange {
+	head := (n + 1) / 2
+	if tail := n / 2; total-tail > head {
+		return []previewRange{{0, head}, {total - tail, total}}
+	}
+	return []previewRange{{0, total}}
+}
+
+// firstOmitted returns the 1-based number of the first line not shown, or 0
+// when all lines are shown.
+func firstOmitted(ranges []previewRange, total int) int {
+	next := 0
+	for _, r := range ranges {
+		if r.start > next {
+			break
+		}
+		next = r.end
+	}
+	if next >= total {
+		return 0
+	}
+	return next + 1
+}
+
+// outputLines splits content into lines. A final newline does not start
+// another line.
+func outputLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// countLines returns the number of lines in content, as outputLines counts them.
+func countLines(content string) int {
+	if content == "" {
+		return 0
+	}
+	n := strings.Count(content, "\n")
+	if !strings.HasSuffix(content, "\n") {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,206 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// numberedOutput returns n lines "line 1" to "line n", with extra lines
+// replacing some of them.
+func numberedOutput(n int, extra map[int]string) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		if line, ok := extra[i]; ok {
+			sb.WriteString(line + "\n")
+			continue
+		}
+		fmt.Fprintf(&sb, "line %d\n", i)
+	}
+	return sb.String()
+}
+
+func processWith(t *testing.T, strategy, content string) *ProcessResult {
+	t.Helper()
+	ws := newTestWorkspace(t)
+	config, err := OutputConfig(strategy, 0, protocol.TruncateHead)
+	require.NoError(t, err)
+	config.MaxOutputSize = 100
+	config.PreviewLines = 4
+	config.ContextLines = 1
+
+	res, err := NewLargeOutputProcessor(ws, config).Process(context.Background(), content, "bash")
+	require.NoError(t, err)
+	require.True(t, res.Truncated)
+	require.NotEmpty(t, res.FilePath)
+
+	// The full content is saved either way
+	saved, err := os.ReadFile(filepath.Join(ws.Root(), res.FilePath))
+	require.NoError(t, err)
+	assert.Equal(t, content, string(saved))
+	return res
+}
+
+func TestLargeOutputProcessor_Strategies(t *testing.T) {
+	content := numberedOutput(100, map[int]string{
+		30: "WARN disk almost full",
+		31: "ERROR: write failed",
+		70: "panic: runtime error",
+	})
+
+	t.Run("head", func(t *testing.T) {
+		res := processWith(t, protocol.TruncateHead, content)
+		assert.Equal(t, 100, res.TotalLines)
+		assert.Equal(t, 4, res.PreviewLines)
+		assert.Contains(t, res.Content, "first 4 lines, 4 of 100 lines")
+		assert.Contains(t, res.Content, "     4\tline 4\n... [96 lines omitted]")
+		assert.Contains(t, res.Content, "start_line=5,")
+	})
+
+	t.Run("tail", func(t *testing.T) {
+		res := processWith(t, protocol.TruncateTail, content)
+		assert.Equal(t, 4, res.PreviewLines)
+		assert.Contains(t, res.Content, "... [96 lines omitted]\n    97\tline 97\n")
+		assert.Contains(t, res.Content, "   100\tline 100\n```")
+		assert.Contains(t, res.Content, "start_line=1,")
+	})
+
+	t.Run("head_tail", func(t *testing.T) {
+		res := processWith(t, protocol.TruncateHeadTail, content)
+		assert.Equal(t, 4, res.PreviewLines)
+		assert.Contains(t, res.Content, "first 2 and last 2 lines")
+		assert.Contains(t, res.Content, "     2\tline 2\n... [96 lines omitted]\n    99\tline 99\n")
+		assert.Contains(t, res.Content, "start_line=3,")
+	})
+
+	t.Run("interesting", func(t *testing.T) {
+		res := processWith(t, protocol.TruncateInteresting, content)
+		assert.Contains(t, res.Content, "3 of 3 error or warning lines with 1 lines of context")
+		assert.Contains(t, res.Content, "... [28 lines omitted]\n    29\tline 29\n    30\tWARN disk almost full\n    31\tERROR: write failed\n    32\tline 32\n... [36 lines omitted]\n")
+		assert.Contains(t, res.Content, "    69\tline 69\n    70\tpanic: runtime error\n    71\tline 71\n... [29 lines omitted]\n")
+		assert.Equal(t, 7, res.PreviewLines)
+	})
+
+	t.Run("interesting without matches", func(t *testing.T) {
+		res := processWith(t, protocol.TruncateInteresting, numberedOutput(50, nil))
+		assert.Contains(t, res.Content, "no error or warning lines; first 2 and last 2 lines")
+		assert.Equal(t, 4, res.PreviewLines)
+	})
+}
+
+func TestLargeOutputProcessor_KeepsLastInterestingLines(t *testing.T) {
+	extra := map[int]string{}
+	for i := 10; i <= 90; i += 10 {
+		extra[i] = fmt.Sprintf("error %d", i)
+	}
+	res := processWith(t, protocol.TruncateInteresting, numberedOutput(100, extra))
+	assert.Contains(t, res.Content, "4 of 9 error or warning lines")
+	assert.NotContains(t, res.Content, "error 50")
+	assert.Contains(t, res.Content, "error 60")
+	assert.Contains(t, res.Content, "error 90")
+}
+
+func TestLargeOutputProcessor_LineCounts(t *testing.T) {
+	ws := newTestWorkspace(t)
+	p := NewLargeOutputProcessor(ws, DefaultLargeOutputConfig())
+
+	for content, lines := range map[string]int{"": 0, "a": 1, "a\n": 1, "a\nb": 2, "a\n\nb\n": 3} {
+		res, err := p.Process(context.Background(), content, "bash")
+		require.NoError(t, err)
+		assert.False(t, res.Truncated)
+		assert.Equal(t, lines, res.TotalLines, "%q", content)
+	}
+}
+
+func TestOutputConfig(t *testing.T) {
+	config, err := OutputConfig("", 0, protocol.TruncateTail)
+	require.NoError(t, err)
+	assert.Equal(t, protocol.TruncateTail, config.Strategy)
+
+	config, err = OutputConfig(protocol.TruncateInteresting, 0, protocol.TruncateTail)
+	require.NoError(t, err)
+	assert.Equal(t, protocol.TruncateInteresting, config.Strategy)
+
+	_, err = OutputConfig("middle", 0, protocol.TruncateHead)
+	assert.Error(t, err)
+
+	config, err = OutputConfig("", 20000, protocol.TruncateHead)
+	require.NoError(t, err)
+	assert.Equal(t, 20000, config.MaxTokens)
+	assert.Zero(t, config.MaxOutputSize)
+
+	_, err = OutputConfig("", MaxOutputTokens+1, protocol.TruncateHead)
+	assert.Error(t, err)
+
+	ws := newTestWorkspace(t)
+	_, err = ws.Bash(context.Background(), &protocol.BashArgs{Command: "echo hi", Truncate: "middle"})
+	assert.Error(t, err)
+}
+
+func TestWorkspace_Bash_TruncatesHeadAndTail(t *testing.T) {
+	ws := newTestWorkspace(t)
+	res, err := ws.Bash(context.Background(), &protocol.BashArgs{Command: "seq 1 20000; echo 'build failed'"})
+	require.NoError(t, err)
+	assert.True(t, res.Truncated)
+	assert.Equal(t, 20001, res.TotalLines)
+	assert.Equal(t, DefaultPreviewLines, res.PreviewLines)
+	assert.Contains(t, res.Stdout, "     1\t1\n")
+	assert.Contains(t, res.Stdout, " 20001\tbuild failed\n")
+}
+
+func TestLargeOutputProcessor_TokenBudget(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+
+	// About 10000 CJK characters are under the byte limit but over the
+	// default token limit
+	cjk := strings.Repeat("磁盘空间不足请清理日志文件\n", 250)
+	large := strings.Repeat(cjk, 3)
+	require.LessOrEqual(t, len(large), DefaultMaxOutputSize)
+	res, err := NewLargeOutputProcessor(ws, DefaultLargeOutputConfig()).Process(ctx, large, "bash")
+	require.NoError(t, err)
+	assert.True(t, res.Truncated)
+	assert.Equal(t, 10500, res.TotalTokens)
+	assert.Equal(t, EstimateTokens(res.Content), res.EstimatedTokens)
+
+	// A larger budget keeps the output, and the result reports its tokens
+	config, err := OutputConfig("", 20000, protocol.TruncateHead)
+	require.NoError(t, err)
+	res, err = NewLargeOutputProcessor(ws, config).Process(ctx, large, "bash")
+	require.NoError(t, err)
+	assert.False(t, res.Truncated)
+	assert.Equal(t, 10500, res.EstimatedTokens)
+
+	// A small budget also shortens the preview to fit
+	for _, strategy := range []string{protocol.TruncateHead, protocol.TruncateTail} {
+		config, err = OutputConfig(strategy, 300, protocol.TruncateHead)
+		require.NoError(t, err)
+		res, err = NewLargeOutputProcessor(ws, config).Process(ctx, cjk, "bash")
+		require.NoError(t, err)
+		assert.True(t, res.Truncated)
+		assert.LessOrEqual(t, res.EstimatedTokens, 300, strategy)
+		assert.Greater(t, res.EstimatedTokens, 200, strategy)
+		assert.Contains(t, res.Content, "[preview truncated]")
+		assert.Contains(t, res.Content, "about 3500 tokens")
+	}
+}
+
+func TestWorkspace_Bash_ReportsTokens(t *testing.T) {
+	ws := newTestWorkspace(t)
+	res, err := ws.Bash(context.Background(), &protocol.BashArgs{Command: "echo hello world; echo oops >&2"})
+	require.NoError(t, err)
+	assert.False(t, res.Truncated)
+	assert.Equal(t, 5, res.EstimatedTokens)
+	assert.Equal(t, res.EstimatedTokens, res.TotalTokens)
+
+	_, err = ws.Bash(context.Background(), &protocol.BashArgs{Command: "true", MaxTokens: -1})
+	assert.Error(t, err)
+}
@@ -0,0 +1,294 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const (
+	// DefaultListResults is the number of list entries or glob matches returned when not specified
+	DefaultListResults = 1000
+	// MaxListResults caps the entries returned by a single list or glob
+	MaxListResults = 10000
+)
+
+// listItem is a list entry with the metadata used for sorting.
+type listItem struct {
+	entry   protocol.ListEntry
+	modTime time.Time
+	mode    fs.FileMode
+}
+
+// listCollector keeps the first entries in sort order, up to a limit, without
+// holding every entry of a large tree in memory.
+type listCollector struct {
+	limit     int
+	cmp       func(a, b *listItem) int // nil keeps walk order
+	items     []*listItem
+	truncated bool
+}
+
+// newListCollector validates the sort order and result limit.
+func newListCollector(sortBy string, maxResults int) (*listCollector, error) {
+	c := &listCollector{limit: maxResults}
+	if c.limit <= 0 {
+		c.limit = DefaultListResults
+	}
+	c.limit = min(c.limit, MaxListResults)
+
+	switch sortBy {
+	case "", protocol.ListSortName:
+	case protocol.ListSortMtime:
+		c.cmp = func(a, b *listItem) int {
+			if n := b.modTime.Compare(a.modTime); n != 0 {
+				return n
+			}
+			return strings.Compare(a.entry.Path, b.entry.Path)
+		}
+	case protocol.ListSortSize:
+		c.cmp = func(a, b *listItem) int {
+			if a.entry.Size != b.entry.Size {
+				if a.entry.Size > b.entry.Size {
+					return -1
+				}
+				return 1
+			}
+			return strings.Compare(a.entry.Path, b.entry.Path)
+		}
+	default:
+		return nil, fmt.Errorf("invalid sort %q: must be %s, %s or %s", sortBy, protocol.ListSortName, protocol.ListSortMtime, protocol.ListSortSize)
+	}
+	return c, nil
+}
+
+// add adds an item. It returns false when no later item can be part of the result.
+func (c *listCollector) add(item *listItem) bool {
+	if c.cmp == nil {
+		if len(c.items) >= c.limit {
+			c.truncated = true
+			return false
+		}
+		c.items = append(c.items, item)
+		return true
+	}
+
+	c.items = append(c.items, item)
+	if len(c.items) >= 2*c.limit {
+		c.trim()
+	}
+	return true
+}
+
+// trim sorts the items and drops those past the limit.
+func (c *listCollector) trim() {
+	slices.SortFunc(c.items, c.cmp)
+	if len(c.items) > c.limit {
+		clear(c.items[c.limit:])
+		c.items = c.items[:c.limit]
+		c.truncated = true
+	}
+}
+
+// result returns the kept items in order.
+func (c *listCollector) result() []*listItem {
+	if c.cmp != nil {
+		c.trim()
+	}
+	return c.items
+}
+
+// newListItem builds the item for a walked entry.
+func newListItem(displayPath string, d fs.DirEntry) (*listItem, error) {
+	info, err := d.Info()
+	if err != nil {
+		return nil, err
+	}
+	return &listItem{
+		entry: protocol.ListEntry{
+			Path:  displayPath,
+			IsDir: d.IsDir(),
+			Size:  info.Size(),
+		},
+		modTime: info.ModTime(),
+		mode:    info.Mode(),
+	}, nil
+}
+
+// List lists entries in a directory. Entries are returned in directory order
+// unless a sort is requested, and stop at MaxResults.
+func (w *Workspace) List(ctx context.Context, args *protocol.ListArgs) (*protocol.ListResult, error) {
+	loc, err := w.resolveRead(args.Path)
+	if err != nil {
+		return nil, err
+	}
+	realPath := loc.path
+
+	c, err := newListCollector(args.Sort, args.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+
+	maxDepth := 1
+	if args.Recursive {
+		maxDepth = args.MaxDepth
+	}
+
+	var ignore *gitignore
+	if args.Gitignore {
+		ignore = newGitignore(loc.root)
+	}
+
+	errStop := errors.New("stop")
+	err = filepath.WalkDir(realPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// The listed directory itself is not an entry, a listed file is
+		if p == realPath && d.IsDir() {
+			return nil
+		}
+
+		// Check ignore patterns
+		for _, pattern := range args.Ignore {
+			if matched, _ := filepath.Match(pattern, d.Name()); matched {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		if ignore != nil {
+			rel, err := filepath.Rel(loc.root, p)
+			if err == nil && ignore.ignored(filepath.ToSlash(rel), d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		item, err := newListItem(loc.display(p), d)
+		if err != nil {
+			// Removed while walking
+			return nil
+		}
+		if !c.add(item) {
+			return errStop
+		}
+
+		if d.IsDir() && maxDepth > 0 {
+			rel, err := filepath.Rel(realPath, p)
+			if err == nil && strings.Count(rel, string(filepath.Separator))+1 >= maxDepth {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStop) {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("failed to list directory: %w", err)
+	}
+
+	items := c.result()
+	entries := make([]protocol.ListEntry, 0, len(items))
+	for _, item := range items {
+		entry := item.entry
+		if args.Details {
+			modTime := item.modTime
+			entry.ModTime = &modTime
+			entry.Mode = item.mode.String()
+		}
+		entries = append(entries, entry)
+	}
+
+	return &protocol.ListResult{Entries: entries, Truncated: c.truncated}, nil
+}
+
+// Glob searches for files matching a pattern.
+// A pattern starting with a mount prefix (e.g. "logs:**/*.log") searches that mount.
+func (w *Workspace) Glob(ctx context.Context, args *protocol.GlobArgs) (*protocol.GlobResult, error) {
+	root, pattern, prefix, err := w.globRoot(args.Pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	sortBy := args.Sort
+	if sortBy == "" {
+		sortBy = protocol.ListSortName
+	}
+	c, err := newListCollector(sortBy, args.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	// Glob walk order is not sorted, so names are sorted by the collector too
+	if c.cmp == nil {
+		c.cmp = func(a, b *listItem) int {
+			return strings.Compare(a.entry.Path, b.entry.Path)
+		}
+	}
+
+	var ignore *gitignore
+	if args.Gitignore {
+		ignore = newGitignore(root)
+	}
+
+	err = doublestar.GlobWalk(os.DirFS(root), pattern, func(match string, d fs.DirEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if ignore != nil && ignore.ignored(match, d.IsDir()) {
+			return nil
+		}
+		item, err := newListItem(prefix+match, d)
+		if err != nil {
+			return nil
+		}
+		c.add(item)
+		return nil
+	})
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("failed to glob: %w", err)
+	}
+
+	items := c.result()
+	matches := make([]string, 0, len(items))
+	for _, item := range items {
+		matches = append(matches, item.entry.Path)
+	}
+	return &protocol.GlobResult{Matches: matches, Truncated: c.truncated}, nil
+}
+
+// globRoot splits a glob pattern into the directory it is matched in, the
+// pattern relative to that directory and the display prefix of matches.
+func (w *Workspace) globRoot(pattern string) (root, rest, prefix string, err error) {
+	name, rest, ok := w.splitMount(pattern)
+	if !ok {
+		return w.root, pattern, "", nil
+	}
+	loc, err := w.resolveRead(name + MountSeparator)
+	if err != nil {
+		return "", "", "", err
+	}
+	return loc.root, rest, loc.prefix, nil
+}
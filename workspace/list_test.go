@@ -0,0 +1,178 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// newListWorkspace creates a tree with distinct sizes and modification times.
+func newListWorkspace(t *testing.T) *Workspace {
+	ws := newTestWorkspace(t)
+	files := []struct {
+		name    string
+		content string
+	}{
+		{".gitignore", "*.log\nbuild/\n!keep.log\n"},
+		{"a.txt", "aaaa"},
+		{"b.txt", "b"},
+		{"app.log", "log"},
+		{"keep.log", "keep"},
+		{"build/out.bin", "binary"},
+		{"src/main.go", "package main\n"},
+		{"src/.gitignore", "gen/\n/local.go\n"},
+		{"src/local.go", "package main"},
+		{"src/gen/api.go", "package gen"},
+		{"src/pkg/util/util.go", "package util"},
+	}
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, f := range files {
+		path := filepath.Join(ws.Root(), f.name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(f.content), 0o644))
+		modTime := base.Add(time.Duration(i) * time.Hour)
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	return ws
+}
+
+func listPaths(entries []protocol.ListEntry) []string {
+	paths := make([]string, 0, len(entries))
+	for _, e := range entries {
+		paths = append(paths, e.Path)
+	}
+	return paths
+}
+
+func TestWorkspace_List_Options(t *testing.T) {
+	ws := newListWorkspace(t)
+	ctx := context.Background()
+
+	t.Run("max results", func(t *testing.T) {
+		res, err := ws.List(ctx, &protocol.ListArgs{Path: ".", Recursive: true, MaxResults: 3})
+		require.NoError(t, err)
+		assert.Equal(t, []string{".gitignore", "a.txt", "app.log"}, listPaths(res.Entries))
+		assert.True(t, res.Truncated)
+
+		res, err = ws.List(ctx, &protocol.ListArgs{Path: "src/pkg", Recursive: true, MaxResults: 2})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"src/pkg/util", "src/pkg/util/util.go"}, listPaths(res.Entries))
+		assert.False(t, res.Truncated)
+	})
+
+	t.Run("sort by size", func(t *testing.T) {
+		res, err := ws.List(ctx, &protocol.ListArgs{Path: ".", Sort: protocol.ListSortSize, MaxResults: 2, Ignore: []string{"build", "src"}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{".gitignore", "a.txt"}, listPaths(res.Entries))
+		assert.True(t, res.Truncated)
+	})
+
+	t.Run("sort by mtime", func(t *testing.T) {
+		res, err := ws.List(ctx, &protocol.ListArgs{Path: ".", Sort: protocol.ListSortMtime, Ignore: []string{"build", "src"}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"keep.log", "app.log", "b.txt", "a.txt", ".gitignore"}, listPaths(res.Entries))
+		assert.False(t, res.Truncated)
+	})
+
+	t.Run("depth", func(t *testing.T) {
+		res, err := ws.List(ctx, &protocol.ListArgs{Path: "src", Recursive: true, MaxDepth: 2})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"src/.gitignore", "src/gen", "src/gen/api.go", "src/local.go", "src/main.go", "src/pkg", "src/pkg/util"}, listPaths(res.Entries))
+	})
+
+	t.Run("gitignore", func(t *testing.T) {
+		res, err := ws.List(ctx, &protocol.ListArgs{Path: ".", Recursive: true, Gitignore: true})
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			".gitignore", "a.txt", "b.txt", "keep.log",
+			"src", "src/.gitignore", "src/main.go", "src/pkg", "src/pkg/util", "src/pkg/util/util.go",
+		}, listPaths(res.Entries))
+	})
+
+	t.Run("details", func(t *testing.T) {
+		res, err := ws.List(ctx, &protocol.ListArgs{Path: "a.txt", Details: true})
+		require.NoError(t, err)
+		require.Len(t, res.Entries, 1)
+		entry := res.Entries[0]
+		assert.Equal(t, "a.txt", entry.Path)
+		assert.Equal(t, int64(4), entry.Size)
+		assert.Equal(t, "-rw-r--r--", entry.Mode)
+		require.NotNil(t, entry.ModTime)
+		assert.True(t, entry.ModTime.Equal(time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)))
+	})
+
+	t.Run("invalid sort", func(t *testing.T) {
+		_, err := ws.List(ctx, &protocol.ListArgs{Path: ".", Sort: "random"})
+		assert.Error(t, err)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := ws.List(canceled, &protocol.ListArgs{Path: ".", Recursive: true})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestWorkspace_Glob_Options(t *testing.T) {
+	ws := newListWorkspace(t)
+	ctx := context.Background()
+
+	res, err := ws.Glob(ctx, &protocol.GlobArgs{Pattern: "**/*.go"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"src/gen/api.go", "src/local.go", "src/main.go", "src/pkg/util/util.go"}, res.Matches)
+	assert.False(t, res.Truncated)
+
+	res, err = ws.Glob(ctx, &protocol.GlobArgs{Pattern: "**/*.go", MaxResults: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"src/gen/api.go", "src/local.go"}, res.Matches)
+	assert.True(t, res.Truncated)
+
+	res, err = ws.Glob(ctx, &protocol.GlobArgs{Pattern: "**/*.go", Sort: protocol.ListSortMtime, MaxResults: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"src/pkg/util/util.go"}, res.Matches)
+
+	res, err = ws.Glob(ctx, &protocol.GlobArgs{Pattern: "**/*.go", Gitignore: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"src/main.go", "src/pkg/util/util.go"}, res.Matches)
+
+	_, err = ws.Glob(ctx, &protocol.GlobArgs{Pattern: "[", MaxResults: 1})
+	assert.Error(t, err)
+}
+
+func TestGitignore(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".gitignore"), []byte("# comment\n\n*.tmp\n/out\ndocs/**/*.pdf\n\\#hash\nnode_modules/\n"), 0o644))
+
+	g := newGitignore(root)
+	tests := []struct {
+		rel     string
+		isDir   bool
+		ignored bool
+	}{
+		{"a.tmp", false, true},
+		{"deep/dir/a.tmp", false, true},
+		{"out", true, true},
+		{"sub/out", true, false},
+		{"docs/a/b/c.pdf", false, true},
+		{"docs/c.pdf", false, true},
+		{"c.pdf", false, false},
+		{"#hash", false, true},
+		{"node_modules", true, true},
+		{"node_modules", false, false},
+		{"web/node_modules/x/index.js", false, true},
+		{".git", true, true},
+		{"main.go", false, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.ignored, g.ignored(tt.rel, tt.isDir), tt.rel)
+	}
+}
@@ -0,0 +1,139 @@
+package workspace
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// 2006-01-02T15:04:05.000Z07:00 and the common "2006-01-02 15:04:05,000" variant
+	isoTimePattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`)
+	// nginx and Apache access logs: [02/Jan/2006:15:04:05 -0700]
+	clfTimePattern = regexp.MustCompile(`\[(\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4})\]`)
+	// BSD syslog: "Jan  2 15:04:05" at the start of the line
+	syslogTimePattern = regexp.MustCompile(`^[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}`)
+)
+
+// jsonTimePatterns match the JSON fields checked for a timestamp, in order.
+var jsonTimePatterns = func() []*regexp.Regexp {
+	var patterns []*regexp.Regexp
+	for _, key := range []string{"ts", "time", "timestamp", "@timestamp"} {
+		patterns = append(patterns, regexp.MustCompile(`"`+key+`"\s*:\s*("[^"]*"|[0-9][0-9.eE+]*)`))
+	}
+	return patterns
+}()
+
+// timestampSearchLimit is how far into a line timestamps are looked for.
+const timestampSearchLimit = 128
+
+// parseLogTime extracts the timestamp of a log line. Supported formats are
+// RFC3339/ISO 8601, syslog, nginx/Apache access logs and JSON lines with a
+// ts, time, timestamp or @timestamp field. Timestamps without a zone are in
+// local time; syslog timestamps without a year are placed in the year that
+// puts them closest before now.
+func parseLogTime(line string, now time.Time) (time.Time, bool) {
+	if strings.HasPrefix(strings.TrimSpace(line), "{") {
+		if t, ok := parseJSONLogTime(line); ok {
+			return t, true
+		}
+	}
+
+	head := line
+	if len(head) > timestampSearchLimit {
+		head = head[:timestampSearchLimit]
+	}
+
+	if m := isoTimePattern.FindString(head); m != "" {
+		if t, ok := parseISOTime(m); ok {
+			return t, true
+		}
+	}
+
+	if m := clfTimePattern.FindStringSubmatch(head); m != nil {
+		if t, err := time.Parse("02/Jan/2006:15:04:05 -0700", m[1]); err == nil {
+			return t, true
+		}
+	}
+
+	if m := syslogTimePattern.FindString(head); m != "" {
+		if t, err := time.ParseInLocation("Jan _2 15:04:05", m, time.Local); err == nil {
+			t = t.AddDate(now.Year(), 0, 0)
+			// Allow a little clock skew before assuming the line is from last year
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// parseISOTime parses an ISO 8601 timestamp matched by isoTimePattern.
+func parseISOTime(s string) (time.Time, bool) {
+	s = strings.Replace(s, " ", "T", 1)
+	s = strings.Replace(s, ",", ".", 1)
+
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999Z0700"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05.999999999", s, time.Local); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// parseJSONLogTime reads the timestamp field of a JSON log line. Numeric
+// values are Unix timestamps in seconds, milliseconds, microseconds or
+// nanoseconds. The field is found without decoding the whole line, so lines
+// cut at MaxLineLength still parse.
+func parseJSONLogTime(line string) (time.Time, bool) {
+	for _, pattern := range jsonTimePatterns {
+		m := pattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if value, err := strconv.Unquote(m[1]); err == nil {
+			if t, ok := parseISOTime(value); ok {
+				return t, true
+			}
+			m[1] = value
+		}
+		if f, err := strconv.ParseFloat(m[1], 64); err == nil {
+			return unixTime(f), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// unixTime converts a Unix timestamp, guessing its unit from its magnitude.
+func unixTime(v float64) time.Time {
+	switch {
+	case v > 1e17:
+		return time.Unix(0, int64(v))
+	case v > 1e14:
+		return time.UnixMicro(int64(v))
+	case v > 1e11:
+		return time.UnixMilli(int64(v))
+	default:
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9))
+	}
+}
+
+// parseTimeArg parses a time-range bound: an RFC3339 timestamp, or a duration
+// such as "15m" meaning that long before now.
+func parseTimeArg(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, ok := parseISOTime(s); ok {
+		return t, nil
+	}
+	return time.Time{}, &time.ParseError{Layout: time.RFC3339, Value: s, Message: ": expected RFC3339 time or duration like 15m"}
+}
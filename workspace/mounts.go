@@ -0,0 +1,151 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// MountSeparator separates a mount name from the path inside it, e.g. "logs:nginx/error.log".
+const MountSeparator = ":"
+
+// mountNamePattern restricts mount names. Two characters minimum so a name can
+// never be mistaken for a Windows drive letter.
+var mountNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]+$`)
+
+// ValidMountName reports whether name can be used as a mount name.
+func ValidMountName(name string) bool {
+	return mountNamePattern.MatchString(name)
+}
+
+// location is a path resolved against the workspace root or a mount.
+type location struct {
+	path   string // Real path
+	root   string // Real root directory the path was resolved against
+	prefix string // Display prefix: "" for the workspace, "name:" for a mount, "name/" for a shared directory
+}
+
+// display returns how p, a real path under l.root, is shown to the caller.
+func (l *location) display(p string) string {
+	rel, err := filepath.Rel(l.root, p)
+	if err != nil {
+		return p
+	}
+	if strings.HasSuffix(l.prefix, "/") {
+		return path.Join(l.prefix, filepath.ToSlash(rel))
+	}
+	return l.prefix + filepath.ToSlash(rel)
+}
+
+// SetMounts sets additional read-only directories, addressed as "name:path".
+// Paths are resolved when accessed, so a mount may appear after startup.
+func (w *Workspace) SetMounts(mounts map[string]string) error {
+	resolved := make(map[string]string, len(mounts))
+	for name, dir := range mounts {
+		if !ValidMountName(name) {
+			return fmt.Errorf("invalid mount name %q", name)
+		}
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("mount %s: path must be absolute: %s", name, dir)
+		}
+		resolved[name] = filepath.Clean(dir)
+	}
+	w.mounts = resolved
+	return nil
+}
+
+// splitMount returns the mount name and the path inside it if path starts
+// with a configured mount prefix.
+func (w *Workspace) splitMount(path string) (name, rest string, ok bool) {
+	name, rest, found := strings.Cut(path, MountSeparator)
+	if !found {
+		return "", "", false
+	}
+	if _, ok := w.mounts[name]; !ok {
+		return "", "", false
+	}
+	return name, rest, true
+}
+
+// resolveRead resolves a path for a read-only operation. Paths with a mount
+// prefix resolve inside that mount, all others inside the workspace.
+func (w *Workspace) resolveRead(path string) (*location, error) {
+	if name, rest, ok := w.splitShared(path); ok {
+		return w.resolveShared(name, rest)
+	}
+
+	name, rest, ok := w.splitMount(path)
+	if !ok {
+		realPath, err := w.resolvePath(path)
+		if err != nil {
+			return nil, err
+		}
+		return &location{path: realPath, root: w.realRoot()}, nil
+	}
+
+	root, err := filepath.EvalSymlinks(w.mounts[name])
+	if err != nil {
+		return nil, fmt.Errorf("mount %s is not available: %w", name, err)
+	}
+
+	realPath, err := resolveWithin(root, rest)
+	if err != nil {
+		return nil, fmt.Errorf("%s%s%s: %w", name, MountSeparator, rest, err)
+	}
+	return &location{path: realPath, root: root, prefix: name + MountSeparator}, nil
+}
+
+// resolveShared resolves a path inside a directory a session shares with its
+// workspace. It is shown as a workspace path, "name/rest".
+func (w *Workspace) resolveShared(name, rest string) (*location, error) {
+	root, err := filepath.EvalSymlinks(filepath.Join(w.base.root, name))
+	if err != nil {
+		return nil, fmt.Errorf("shared directory %s is not available: %w", name, err)
+	}
+	realPath, err := resolveWithin(root, rest)
+	if err != nil {
+		return nil, fmt.Errorf("%s/%s: %w", name, rest, err)
+	}
+	return &location{path: realPath, root: root, prefix: name + "/"}, nil
+}
+
+// realRoot returns the workspace root with symlinks resolved.
+func (w *Workspace) realRoot() string {
+	if resolved, err := filepath.EvalSymlinks(w.root); err == nil {
+		return resolved
+	}
+	return w.root
+}
+
+// resolveWithin joins path to root and ensures the result, with symlinks
+// resolved, stays inside root. root must already be resolved.
+func resolveWithin(root, path string) (string, error) {
+	absPath := filepath.Join(root, path)
+	if !isWithin(root, absPath) {
+		return "", fmt.Errorf("path is outside mount root")
+	}
+
+	realPath, err := filepath.EvalSymlinks(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return absPath, nil
+		}
+		return "", fmt.Errorf("failed to resolve symlinks: %w", err)
+	}
+	if !isWithin(root, realPath) {
+		return "", fmt.Errorf("path escapes mount root via symlink")
+	}
+	return realPath, nil
+}
+
+// isWithin reports whether path is root or below it.
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,93 @@
+package workspace
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+func newMountedWorkspace(t *testing.T) (*Workspace, string) {
+	ws := newTestWorkspace(t)
+	logDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(logDir, "nginx"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(logDir, "nginx", "error.log"), []byte("ok\nupstream timed out\n"), 0o644))
+	require.NoError(t, ws.SetMounts(map[string]string{"logs": logDir}))
+	return ws, logDir
+}
+
+func TestWorkspace_Mounts_Read(t *testing.T) {
+	ws, _ := newMountedWorkspace(t)
+	ctx := context.Background()
+
+	result, err := ws.Read(ctx, &protocol.ReadArgs{Path: "logs:nginx/error.log", Mode: protocol.ReadModeLines})
+	require.NoError(t, err)
+	assert.Equal(t, "     1\tok\n     2\tupstream timed out\n", result.Content)
+
+	list, err := ws.List(ctx, &protocol.ListArgs{Path: "logs:", Recursive: true})
+	require.NoError(t, err)
+	var paths []string
+	for _, e := range list.Entries {
+		paths = append(paths, e.Path)
+	}
+	assert.Equal(t, []string{"logs:nginx", "logs:nginx/error.log"}, paths)
+
+	glob, err := ws.Glob(ctx, &protocol.GlobArgs{Pattern: "logs:**/*.log"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"logs:nginx/error.log"}, glob.Matches)
+
+	grep, err := ws.Grep(ctx, &protocol.GrepArgs{Pattern: "timed out", Path: "logs:nginx"})
+	require.NoError(t, err)
+	require.Len(t, grep.Matches, 1)
+	assert.Equal(t, "logs:nginx/error.log", grep.Matches[0].Path)
+	assert.Equal(t, 2, grep.Matches[0].LineNumber)
+}
+
+func TestWorkspace_Mounts_ReadOnly(t *testing.T) {
+	ws, logDir := newMountedWorkspace(t)
+	ctx := context.Background()
+
+	_, err := ws.Write(ctx, &protocol.WriteArgs{
+		Path:    "logs:nginx/error.log",
+		Content: base64.StdEncoding.EncodeToString([]byte("x")),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "read-only")
+
+	_, err = ws.Edit(ctx, &protocol.EditArgs{Path: "logs:nginx/error.log", OldString: "ok", NewString: "x"})
+	require.Error(t, err)
+
+	data, err := os.ReadFile(filepath.Join(logDir, "nginx", "error.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "ok\nupstream timed out\n", string(data))
+}
+
+func TestWorkspace_Mounts_Confinement(t *testing.T) {
+	ws, logDir := newMountedWorkspace(t)
+	ctx := context.Background()
+
+	_, err := ws.Read(ctx, &protocol.ReadArgs{Path: "logs:../../etc/passwd"})
+	assert.Error(t, err)
+
+	// Symlinks inside a mount may not point outside it
+	outside := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(outside, []byte("secret"), 0o644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(logDir, "link")))
+	_, err = ws.Read(ctx, &protocol.ReadArgs{Path: "logs:link"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "escapes mount root")
+
+	// Unknown prefixes are ordinary workspace paths
+	_, err = ws.Read(ctx, &protocol.ReadArgs{Path: "other:file"})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "mount")
+
+	assert.Error(t, ws.SetMounts(map[string]string{"c": "/var/log"}))
+	assert.Error(t, ws.SetMounts(map[string]string{"logs": "relative/dir"}))
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package workspace
+
+import (
+	"os"
+	"syscall"
+)
+
+// preserveOwner gives path the owner and group of info. Failures are ignored:
+// an unprivileged runner can only keep ownership it already has.
+func preserveOwner(path string, info os.FileInfo) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		_ = os.Lchown(path, int(st.Uid), int(st.Gid))
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package workspace
+
+import "os"
+
+// preserveOwner is a no-op on Windows, where new files inherit the directory ACL.
+func preserveOwner(path string, info os.FileInfo) {}
@@ -0,0 +1,487 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const (
+	// maxSampleItems is the most items sampled into a parsed output summary
+	maxSampleItems = 10
+	// maxSchemaItems is the number of array items merged into its schema
+	maxSchemaItems = 100
+	// maxSchemaKeys is the most keys of an object described in a schema
+	maxSchemaKeys = 100
+	// maxSchemaDepth is how deep objects are described in a schema
+	maxSchemaDepth = 8
+)
+
+var (
+	// kvAssignPattern matches key=value lines, as printed by env or found in
+	// /etc/os-release
+	kvAssignPattern = regexp.MustCompile(`^(?:export\s+)?([A-Za-z_][A-Za-z0-9_.\-]*)=(.*)$`)
+	// kvColonPattern matches key: value lines, as in /proc/meminfo or lscpu
+	kvColonPattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_.\-()/ ]*?)\s*:\s*(.*)$`)
+	// tableCellSeparator separates cells of tables aligned with two or more
+	// spaces or tabs, as printed by kubectl and docker
+	tableCellSeparator = regexp.MustCompile(`\s{2,}|\t`)
+	// tableColumnPattern matches column names of table headers
+	tableColumnPattern = regexp.MustCompile(`^[A-Za-z%#][^=]*$`)
+)
+
+// tableHeaderPhrases are column names of common commands that contain spaces.
+var tableHeaderPhrases = []string{
+	"Mounted on",         // df
+	"Local Address:Port", // ss
+	"Peer Address:Port",  // ss
+	"Local Address",      // netstat
+	"Foreign Address",    // netstat
+	"PID/Program name",   // netstat
+	"NOMINATED NODE",     // kubectl get -o wide
+	"READINESS GATES",    // kubectl get -o wide
+	"CONTAINER ID",       // docker ps
+}
+
+// checkParseFormat validates the parse hint of a task.
+func checkParseFormat(format string) error {
+	switch format {
+	case "", protocol.ParseAuto, protocol.ParseJSON, protocol.ParseJSONL, protocol.ParseTable, protocol.ParseKV:
+		return nil
+	}
+	return fmt.Errorf("invalid parse %q: must be %s, %s, %s, %s or %s", format,
+		protocol.ParseAuto, protocol.ParseJSON, protocol.ParseJSONL, protocol.ParseTable, protocol.ParseKV)
+}
+
+// ParseOutput converts command output in format to a value that encodes as
+// JSON, and returns the format it was parsed from, which ParseAuto detects.
+// Tables become arrays of objects keyed by column name, and key-value pairs
+// an object; their values are kept as strings.
+func ParseOutput(format, output string) (string, any, error) {
+	if err := checkParseFormat(format); err != nil {
+		return "", nil, err
+	}
+
+	switch format {
+	case protocol.ParseJSON:
+		values, err := decodeJSONValues(output)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(values) != 1 {
+			return "", nil, fmt.Errorf("expected a single JSON value, found %d", len(values))
+		}
+		return format, values[0], nil
+
+	case protocol.ParseJSONL:
+		values, err := decodeJSONValues(output)
+		if err != nil {
+			return "", nil, err
+		}
+		return format, values, nil
+
+	case protocol.ParseTable:
+		rows, err := parseTable(output)
+		if err != nil {
+			return "", nil, err
+		}
+		return format, rows, nil
+
+	case protocol.ParseKV:
+		pairs, err := parseKV(output)
+		if err != nil {
+			return "", nil, err
+		}
+		return format, pairs, nil
+	}
+
+	// Detect the format, trying the strictest first
+	if trimmed := strings.TrimSpace(output); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		if values, err := decodeJSONValues(output); err == nil {
+			if len(values) == 1 {
+				return protocol.ParseJSON, values[0], nil
+			}
+			return protocol.ParseJSONL, values, nil
+		}
+	}
+	if pairs, err := parseKV(output); err == nil {
+		return protocol.ParseKV, pairs, nil
+	}
+	if rows, err := parseTable(output); err == nil {
+		return protocol.ParseTable, rows, nil
+	}
+	return "", nil, fmt.Errorf("output is not JSON, JSON lines, a table or key-value pairs")
+}
+
+// decodeJSONValues decodes the JSON values in output, keeping numbers as
+// written.
+func decodeJSONValues(output string) ([]any, error) {
+	dec := json.NewDecoder(strings.NewReader(output))
+	dec.UseNumber()
+	var values []any
+	for {
+		var v any
+		err := dec.Decode(&v)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		values = append(values, v)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no JSON value")
+	}
+	return values, nil
+}
+
+// parseKV parses a key=value or key: value pair per line. Blank lines and
+// comments are skipped; later pairs replace earlier ones with the same key.
+func parseKV(output string) (map[string]any, error) {
+	pairs := make(map[string]any)
+	for i, line := range outputLines(output) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if m := kvAssignPattern.FindStringSubmatch(line); m != nil {
+			pairs[m[1]] = unquoteValue(m[2])
+			continue
+		}
+		// Keys may contain single spaces, as in "Model name", but a wider
+		// gap means the line is a table row
+		if m := kvColonPattern.FindStringSubmatch(line); m != nil && !strings.Contains(m[1], "  ") {
+			pairs[m[1]] = m[2]
+			continue
+		}
+		return nil, fmt.Errorf("line %d is not a key=value or key: value pair", i+1)
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("no key-value pairs")
+	}
+	return pairs, nil
+}
+
+// unquoteValue removes shell-style quotes around a value.
+func unquoteValue(value string) string {
+	if len(value) < 2 {
+		return value
+	}
+	switch {
+	case value[0] == '"' && value[len(value)-1] == '"':
+		if s, err := strconv.Unquote(value); err == nil {
+			return s
+		}
+		return value[1 : len(value)-1]
+	case value[0] == '\'' && value[len(value)-1] == '\'':
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// parseTable parses a header line and rows of columns. Cells separated by
+// two or more spaces are used when every row has a cell per column, so cells
+// may contain single spaces; otherwise cells are separated by whitespace and
+// the last column holds the rest of the row, as COMMAND does in ps.
+func parseTable(output string) ([]any, error) {
+	var lines []string
+	for _, line := range outputLines(output) {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("a table needs a header line and at least one row")
+	}
+	header, rows := lines[0], lines[1:]
+
+	columns := splitCells(header)
+	split := func(row string, _ int) []string { return splitCells(row) }
+	if len(columns) < 2 || !allHaveCells(rows, len(columns)) {
+		columns = headerColumns(header)
+		split = splitFields
+	}
+	if len(columns) < 2 {
+		return nil, fmt.Errorf("table header has fewer than two columns")
+	}
+	for _, column := range columns {
+		if !tableColumnPattern.MatchString(column) {
+			return nil, fmt.Errorf("%q is not a column name", column)
+		}
+	}
+
+	result := make([]any, 0, len(rows))
+	for i, row := range rows {
+		cells := split(row, len(columns))
+		// A missing last cell is empty, as the Process column of ss often is
+		if len(cells) < len(columns)-1 {
+			return nil, fmt.Errorf("row %d has %d cells, expected %d", i+1, len(cells), len(columns))
+		}
+		obj := make(map[string]any, len(columns))
+		for j, column := range columns {
+			if j < len(cells) {
+				obj[column] = cells[j]
+			} else {
+				obj[column] = ""
+			}
+		}
+		result = append(result, obj)
+	}
+	return result, nil
+}
+
+// splitCells splits a line at runs of two or more spaces or tabs.
+func splitCells(line string) []string {
+	return tableCellSeparator.Split(strings.TrimSpace(line), -1)
+}
+
+// allHaveCells reports whether every row splits into n cells.
+func allHaveCells(rows []string, n int) bool {
+	for _, row := range rows {
+		if len(splitCells(row)) != n {
+			return false
+		}
+	}
+	return true
+}
+
+// headerColumns splits a header line at whitespace, keeping known column
+// names with spaces together.
+func headerColumns(header string) []string {
+	words := strings.Fields(header)
+	var columns []string
+	for i := 0; i < len(words); i++ {
+		column := words[i]
+		for _, phrase := range tableHeaderPhrases {
+			parts := strings.Fields(phrase)
+			if i+len(parts) <= len(words) && strings.Join(words[i:i+len(parts)], " ") == phrase {
+				column = phrase
+				i += len(parts) - 1
+				break
+			}
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+// splitFields splits a line at whitespace into at most n fields, the last
+// holding the rest of the line.
+func splitFields(line string, n int) []string {
+	var fields []string
+	rest := strings.TrimSpace(line)
+	for rest != "" && len(fields) < n-1 {
+		i := strings.IndexFunc(rest, unicode.IsSpace)
+		if i < 0 {
+			break
+		}
+		fields = append(fields, rest[:i])
+		rest = strings.TrimLeftFunc(rest[i:], unicode.IsSpace)
+	}
+	if rest != "" {
+		fields = append(fields, rest)
+	}
+	return fields
+}
+
+// parseBashOutput replaces the stdout of result with its parsed value, or a
+// summary of it if the value exceeds the output limits. It records why and
+// returns false if stdout cannot be parsed.
+func (w *Workspace) parseBashOutput(ctx context.Context, result *protocol.BashResult, format string, config LargeOutputConfig) bool {
+	parsedFormat, value, err := ParseOutput(format, result.Stdout)
+	if err != nil {
+		result.ParseError = err.Error()
+		return false
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		result.ParseError = fmt.Sprintf("failed to encode parsed output: %v", err)
+		return false
+	}
+
+	stdout := result.Stdout
+	stderrTokens := EstimateTokens(result.Stderr)
+	result.Stdout = ""
+	result.ParsedFormat = parsedFormat
+	result.TotalSize = int64(len(stdout))
+	result.TotalLines = countLines(stdout)
+	result.TotalTokens = EstimateTokens(stdout) + stderrTokens
+
+	processor := NewLargeOutputProcessor(w, config)
+	if tokens := EstimateTokens(string(data)); !processor.exceeds(len(data), tokens) {
+		result.Parsed = data
+		result.EstimatedTokens = tokens + stderrTokens
+		return true
+	}
+
+	// Too large: describe the value and sample its items instead, and save
+	// the full output
+	summary := processor.summarize(value)
+	result.ParsedSummary = summary
+	result.Truncated = true
+	result.FilePath = processor.save(ctx, stdout, "bash")
+	if data, err := json.Marshal(summary); err == nil {
+		result.EstimatedTokens = EstimateTokens(string(data)) + stderrTokens
+	}
+	return true
+}
+
+// summarize returns the schema of v with as many items of its largest array,
+// spread evenly over it, as fit the output limits.
+func (p *LargeOutputProcessor) summarize(v any) *protocol.ParsedSummary {
+	path, items := largestArray(v, "")
+	summary := &protocol.ParsedSummary{
+		Schema:    schemaOf(v, 0),
+		ItemsPath: path,
+		Items:     len(items),
+	}
+	for n := min(len(items), maxSampleItems); n > 0; n-- {
+		summary.SampleIndexes = spreadIndexes(len(items), n)
+		summary.Sample = make([]any, n)
+		for i, index := range summary.SampleIndexes {
+			summary.Sample[i] = items[index]
+		}
+		data, err := json.Marshal(summary)
+		if err == nil && !p.exceeds(len(data), EstimateTokens(string(data))) {
+			return summary
+		}
+	}
+	summary.Sample, summary.SampleIndexes = nil, nil
+	return summary
+}
+
+// largestArray returns the dot-separated path and items of the largest array
+// in v, looking through objects but not into arrays.
+func largestArray(v any, path string) (string, []any) {
+	switch v := v.(type) {
+	case []any:
+		return path, v
+	case map[string]any:
+		bestPath, best := "", []any(nil)
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			if p, items := largestArray(v[key], childPath); len(items) > len(best) {
+				bestPath, best = p, items
+			}
+		}
+		return bestPath, best
+	}
+	return "", nil
+}
+
+// spreadIndexes returns n indexes spread evenly over 0 to total-1, including
+// the first and last.
+func spreadIndexes(total, n int) []int {
+	if n == 1 {
+		return []int{0}
+	}
+	indexes := make([]int, n)
+	for i := range indexes {
+		indexes[i] = i * (total - 1) / (n - 1)
+	}
+	return indexes
+}
+
+// schemaOf describes v: objects by the schema of their values, arrays by the
+// merged schema of their items, and other values by their type name.
+func schemaOf(v any, depth int) any {
+	switch v := v.(type) {
+	case map[string]any:
+		if depth >= maxSchemaDepth {
+			return "object"
+		}
+		keys := slices.Sorted(maps.Keys(v))
+		schema := make(map[string]any, min(len(keys), maxSchemaKeys+1))
+		for _, key := range keys[:min(len(keys), maxSchemaKeys)] {
+			schema[key] = schemaOf(v[key], depth+1)
+		}
+		if len(keys) > maxSchemaKeys {
+			schema["..."] = fmt.Sprintf("%d more keys", len(keys)-maxSchemaKeys)
+		}
+		return schema
+	case []any:
+		if depth >= maxSchemaDepth {
+			return "array"
+		}
+		var merged any
+		for _, item := range v[:min(len(v), maxSchemaItems)] {
+			merged = mergeSchema(merged, schemaOf(item, depth+1))
+		}
+		if merged == nil {
+			return []any{}
+		}
+		return []any{merged}
+	case string:
+		return "string"
+	case json.Number, float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// mergeSchema merges two schemas: objects by the union of their keys, arrays
+// by their items, and different types into a list such as "null|string".
+func mergeSchema(a, b any) any {
+	if a == nil {
+		return b
+	}
+	switch a := a.(type) {
+	case map[string]any:
+		if b, ok := b.(map[string]any); ok {
+			for key, schema := range b {
+				if len(a) >= maxSchemaKeys+1 {
+					break
+				}
+				if existing, ok := a[key]; ok {
+					a[key] = mergeSchema(existing, schema)
+				} else {
+					a[key] = schema
+				}
+			}
+			return a
+		}
+	case []any:
+		if b, ok := b.([]any); ok {
+			if len(a) == 0 {
+				return b
+			}
+			if len(b) == 0 {
+				return a
+			}
+			return []any{mergeSchema(a[0], b[0])}
+		}
+	}
+
+	names := map[string]bool{}
+	for _, schema := range []any{a, b} {
+		switch schema := schema.(type) {
+		case map[string]any:
+			names["object"] = true
+		case []any:
+			names["array"] = true
+		case string:
+			for _, name := range strings.Split(schema, "|") {
+				names[name] = true
+			}
+		}
+	}
+	return strings.Join(slices.Sorted(maps.Keys(names)), "|")
+}
@@ -0,0 +1,169 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const (
+	psOutput = `USER         PID %CPU %MEM    VSZ   RSS TTY      STAT START   TIME COMMAND
+root           1  0.0  0.1 169836 13056 ?        Ss   Oct17   0:04 /sbin/init splash
+mysql        812  2.5 12.0 2483648 980120 ?     Ssl  Oct17  41:10 /usr/sbin/mysqld --daemonize
+`
+	dfOutput = `Filesystem      Size  Used Avail Use% Mounted on
+/dev/sda1        20G  5.0G   15G  26% /
+tmpfs           3.9G     0  3.9G   0% /dev/shm
+`
+	kubectlOutput = `NAME                     READY   STATUS             RESTARTS       AGE
+api-7d9f8b6c5d-x2x9k     1/1     Running            0              5d
+worker-5c6d7e8f9-abcde   0/1     CrashLoopBackOff   12 (3m ago)    1h
+`
+	ssOutput = `State  Recv-Q Send-Q Local Address:Port Peer Address:Port Process
+LISTEN 0      4096  127.0.0.53%lo:53      0.0.0.0:*
+LISTEN 0      128         0.0.0.0:22      0.0.0.0:*     users:(("sshd",pid=901,fd=3))
+`
+	meminfoOutput = `MemTotal:       16318248 kB
+MemFree:         1218844 kB
+Model name:      Intel(R) Xeon(R)
+`
+	envOutput = `# exported
+HOME=/root
+export NAME="web server"
+EMPTY=
+`
+)
+
+func TestParseOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		output string
+		want   string // Detected format
+		check  func(t *testing.T, v any)
+	}{
+		{"ps", protocol.ParseTable, psOutput, protocol.ParseTable, func(t *testing.T, v any) {
+			rows := v.([]any)
+			require.Len(t, rows, 2)
+			assert.Equal(t, "812", rows[1].(map[string]any)["PID"])
+			assert.Equal(t, "/usr/sbin/mysqld --daemonize", rows[1].(map[string]any)["COMMAND"])
+		}},
+		{"df", protocol.ParseAuto, dfOutput, protocol.ParseTable, func(t *testing.T, v any) {
+			rows := v.([]any)
+			require.Len(t, rows, 2)
+			assert.Equal(t, "/dev/shm", rows[1].(map[string]any)["Mounted on"])
+			assert.Equal(t, "0", rows[1].(map[string]any)["Used"])
+		}},
+		{"kubectl", protocol.ParseAuto, kubectlOutput, protocol.ParseTable, func(t *testing.T, v any) {
+			rows := v.([]any)
+			require.Len(t, rows, 2)
+			assert.Equal(t, "12 (3m ago)", rows[1].(map[string]any)["RESTARTS"])
+			assert.Equal(t, "1h", rows[1].(map[string]any)["AGE"])
+		}},
+		{"ss", protocol.ParseTable, ssOutput, protocol.ParseTable, func(t *testing.T, v any) {
+			rows := v.([]any)
+			require.Len(t, rows, 2)
+			assert.Equal(t, "127.0.0.53%lo:53", rows[0].(map[string]any)["Local Address:Port"])
+			assert.Equal(t, "", rows[0].(map[string]any)["Process"])
+			assert.Equal(t, `users:(("sshd",pid=901,fd=3))`, rows[1].(map[string]any)["Process"])
+		}},
+		{"meminfo", protocol.ParseAuto, meminfoOutput, protocol.ParseKV, func(t *testing.T, v any) {
+			assert.Equal(t, map[string]any{"MemTotal": "16318248 kB", "MemFree": "1218844 kB", "Model name": "Intel(R) Xeon(R)"}, v)
+		}},
+		{"env", protocol.ParseKV, envOutput, protocol.ParseKV, func(t *testing.T, v any) {
+			assert.Equal(t, map[string]any{"HOME": "/root", "NAME": "web server", "EMPTY": ""}, v)
+		}},
+		{"json", protocol.ParseAuto, `{"items": [{"id": 12345678901234567890}]}`, protocol.ParseJSON, func(t *testing.T, v any) {
+			data, err := json.Marshal(v)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"items": [{"id": 12345678901234567890}]}`, string(data))
+			assert.Contains(t, string(data), "12345678901234567890")
+		}},
+		{"jsonl", protocol.ParseAuto, "{\"level\":\"error\"}\n{\"level\":\"info\"}\n", protocol.ParseJSONL, func(t *testing.T, v any) {
+			assert.Len(t, v, 2)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, v, err := ParseOutput(tt.format, tt.output)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, format)
+			tt.check(t, v)
+		})
+	}
+}
+
+func TestParseOutput_Errors(t *testing.T) {
+	for _, tt := range []struct{ format, output string }{
+		{protocol.ParseJSON, "{\"a\": 1}\n{\"a\": 2}\n"},
+		{protocol.ParseJSON, "not json"},
+		{protocol.ParseKV, psOutput},
+		{protocol.ParseTable, "only a header\n"},
+		{protocol.ParseAuto, "Starting server on port 8080\nListening\n"},
+		{"xml", "<a/>"},
+	} {
+		_, _, err := ParseOutput(tt.format, tt.output)
+		assert.Error(t, err, "%s: %q", tt.format, tt.output)
+	}
+}
+
+func TestWorkspace_Bash_Parse(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+
+	res, err := ws.Bash(ctx, &protocol.BashArgs{Command: "printf 'A=1\\nB=two\\n'", Parse: protocol.ParseAuto})
+	require.NoError(t, err)
+	assert.Empty(t, res.Stdout)
+	assert.Equal(t, protocol.ParseKV, res.ParsedFormat)
+	assert.JSONEq(t, `{"A": "1", "B": "two"}`, string(res.Parsed))
+	assert.Equal(t, EstimateTokens(string(res.Parsed)), res.EstimatedTokens)
+
+	// Output that cannot be parsed is returned as is
+	res, err = ws.Bash(ctx, &protocol.BashArgs{Command: "echo plain text", Parse: protocol.ParseJSON})
+	require.NoError(t, err)
+	assert.Equal(t, "plain text\n", res.Stdout)
+	assert.Nil(t, res.Parsed)
+	assert.Contains(t, res.ParseError, "invalid JSON")
+
+	_, err = ws.Bash(ctx, &protocol.BashArgs{Command: "true", Parse: "xml"})
+	assert.Error(t, err)
+}
+
+func TestWorkspace_Bash_ParseSummary(t *testing.T) {
+	ws := newTestWorkspace(t)
+
+	var items []string
+	for i := range 500 {
+		items = append(items, fmt.Sprintf(`{"metadata":{"name":"pod-%d","labels":{"app":"api"}},"status":{"phase":"Running","restarts":%d}}`, i, i%3))
+	}
+	items[7] = `{"metadata":{"name":"pod-7"},"status":{"phase":null}}`
+	list := `{"kind":"List","items":[` + strings.Join(items, ",") + `]}`
+	writeString(t, ws, "pods.json", list)
+
+	res, err := ws.Bash(context.Background(), &protocol.BashArgs{Command: "cat pods.json", Parse: protocol.ParseAuto, MaxTokens: 1000})
+	require.NoError(t, err)
+	assert.True(t, res.Truncated)
+	assert.Nil(t, res.Parsed)
+	require.NotNil(t, res.ParsedSummary)
+	assert.Equal(t, protocol.ParseJSON, res.ParsedFormat)
+	assert.Equal(t, list, readString(t, ws, res.FilePath))
+	assert.LessOrEqual(t, res.EstimatedTokens, 1000)
+
+	summary := res.ParsedSummary
+	assert.Equal(t, "items", summary.ItemsPath)
+	assert.Equal(t, 500, summary.Items)
+	require.NotEmpty(t, summary.Sample)
+	assert.Equal(t, 0, summary.SampleIndexes[0])
+	assert.Equal(t, 499, summary.SampleIndexes[len(summary.SampleIndexes)-1])
+
+	schema, err := json.Marshal(summary.Schema)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"kind": "string", "items": [{"metadata": {"name": "string", "labels": {"app": "string"}}, "status": {"phase": "null|string", "restarts": "number"}}]}`, string(schema))
+}
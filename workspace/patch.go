@@ -0,0 +1,248 @@
+package workspace
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// maxPatchFuzz is the maximum number of context lines ignored at each end of a hunk,
+// matching the default of GNU patch
+const maxPatchFuzz = 2
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// patchLine is a single line of a hunk body.
+type patchLine struct {
+	op   byte // ' ', '-' or '+'
+	text string
+}
+
+// patchHunk is a parsed unified diff hunk.
+type patchHunk struct {
+	oldStart int
+	oldLines int
+	lines    []patchLine
+	oldNoEOL bool // Old side ends without a trailing newline
+	newNoEOL bool // New side ends without a trailing newline
+}
+
+// parsePatch parses a single-file unified diff into hunks.
+func parsePatch(patch string) ([]patchHunk, error) {
+	lines := strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n")
+
+	var hunks []patchHunk
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if strings.HasPrefix(line, "--- ") && len(hunks) > 0 {
+			return nil, fmt.Errorf("patch must modify a single file")
+		}
+		m := hunkHeaderPattern.FindStringSubmatch(line)
+		if m == nil {
+			i++
+			continue
+		}
+
+		hunk := patchHunk{oldStart: atoiDefault(m[1], 0), oldLines: atoiDefault(m[2], 1)}
+		newLines := atoiDefault(m[4], 1)
+		i++
+
+		oldSeen, newSeen := 0, 0
+		for i < len(lines) && (oldSeen < hunk.oldLines || newSeen < newLines) {
+			body := lines[i]
+			if strings.HasPrefix(body, "@@") {
+				break
+			}
+			op, text := byte(' '), ""
+			if body != "" {
+				// Editors often strip the space from empty context lines
+				op, text = body[0], body[1:]
+			}
+			switch op {
+			case ' ':
+				oldSeen++
+				newSeen++
+			case '-':
+				oldSeen++
+			case '+':
+				newSeen++
+			default:
+				return nil, fmt.Errorf("hunk %d: invalid line %q", len(hunks)+1, body)
+			}
+			hunk.lines = append(hunk.lines, patchLine{op: op, text: text})
+			i++
+		}
+		if oldSeen != hunk.oldLines || newSeen != newLines {
+			return nil, fmt.Errorf("hunk %d: expected %d old and %d new lines, got %d and %d",
+				len(hunks)+1, hunk.oldLines, newLines, oldSeen, newSeen)
+		}
+
+		// "\ No newline at end of file" applies to the line before it
+		for i < len(lines) && strings.HasPrefix(lines[i], `\`) {
+			switch hunk.lines[len(hunk.lines)-1].op {
+			case '-':
+				hunk.oldNoEOL = true
+			case '+':
+				hunk.newNoEOL = true
+			default:
+				hunk.oldNoEOL, hunk.newNoEOL = true, true
+			}
+			i++
+		}
+
+		hunks = append(hunks, hunk)
+	}
+
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("patch contains no hunks")
+	}
+	return hunks, nil
+}
+
+// applyPatch applies hunks to content. Hunks that do not match at their header
+// position are searched for nearby (offset) and, failing that, retried while
+// ignoring up to maxPatchFuzz outer context lines (fuzz).
+func applyPatch(content string, hunks []patchHunk) (string, []protocol.EditHunkResult, error) {
+	lines, eol := splitLines(content)
+	crlf := len(lines) > 0 && strings.HasSuffix(lines[0], "\r")
+
+	out := make([]string, 0, len(lines))
+	results := make([]protocol.EditHunkResult, 0, len(hunks))
+	pos := 0
+
+	for idx, hunk := range hunks {
+		applied := false
+		for fuzz := 0; fuzz <= maxPatchFuzz && !applied; fuzz++ {
+			body, lead := trimContext(hunk.lines, fuzz)
+			if fuzz > 0 && len(body) == len(hunk.lines) {
+				break // Nothing left to ignore
+			}
+
+			var old []string
+			for _, l := range body {
+				if l.op != '+' {
+					old = append(old, l.text)
+				}
+			}
+
+			expected := hunk.oldStart - 1 + lead
+			if hunk.oldLines == 0 {
+				// For pure insertions the header names the line after which to insert
+				expected = hunk.oldStart
+			}
+
+			at := findLines(lines, old, expected, pos)
+			if at < 0 {
+				continue
+			}
+
+			out = append(out, lines[pos:at]...)
+			orig := at
+			for _, l := range body {
+				switch l.op {
+				case ' ':
+					out = append(out, lines[orig])
+					orig++
+				case '-':
+					orig++
+				case '+':
+					text := l.text
+					if crlf && !strings.HasSuffix(text, "\r") {
+						text += "\r"
+					}
+					out = append(out, text)
+				}
+			}
+			pos = orig
+
+			if pos == len(lines) {
+				if hunk.newNoEOL {
+					eol = false
+				} else if hunk.oldNoEOL {
+					eol = true
+				}
+			}
+
+			results = append(results, protocol.EditHunkResult{
+				Hunk:   idx + 1,
+				Line:   at + 1,
+				Offset: at - expected,
+				Fuzz:   fuzz,
+			})
+			applied = true
+		}
+		if !applied {
+			return "", nil, fmt.Errorf("hunk %d (at line %d) does not apply", idx+1, hunk.oldStart)
+		}
+	}
+	out = append(out, lines[pos:]...)
+
+	result := strings.Join(out, "\n")
+	if eol && len(out) > 0 {
+		result += "\n"
+	}
+	return result, results, nil
+}
+
+// trimContext drops up to fuzz context lines from each end of a hunk and
+// returns the remaining lines and the number dropped from the start.
+func trimContext(lines []patchLine, fuzz int) ([]patchLine, int) {
+	lead := 0
+	for lead < fuzz && lead < len(lines) && lines[lead].op == ' ' {
+		lead++
+	}
+	end := len(lines)
+	for trail := 0; trail < fuzz && end > lead && lines[end-1].op == ' '; trail++ {
+		end--
+	}
+	return lines[lead:end], lead
+}
+
+// findLines returns the index of want in lines closest to expected and not
+// before minPos, or -1. Trailing carriage returns are ignored.
+func findLines(lines, want []string, expected, minPos int) int {
+	matchAt := func(i int) bool {
+		if i < minPos || i+len(want) > len(lines) {
+			return false
+		}
+		for j, w := range want {
+			if strings.TrimSuffix(lines[i+j], "\r") != strings.TrimSuffix(w, "\r") {
+				return false
+			}
+		}
+		return true
+	}
+
+	expected = max(minPos, min(expected, len(lines)))
+	for delta := 0; expected-delta >= minPos || expected+delta <= len(lines); delta++ {
+		if matchAt(expected - delta) {
+			return expected - delta
+		}
+		if delta > 0 && matchAt(expected+delta) {
+			return expected + delta
+		}
+	}
+	return -1
+}
+
+// splitLines splits content into lines without terminators and reports
+// whether it ends with a newline.
+func splitLines(content string) ([]string, bool) {
+	if content == "" {
+		return nil, true
+	}
+	eol := strings.HasSuffix(content, "\n")
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n"), eol
+}
+
+// atoiDefault parses s as an int, returning def if s is empty or invalid.
+func atoiDefault(s string, def int) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return def
+	}
+	return n
+}
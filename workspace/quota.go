@@ -0,0 +1,308 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const (
+	// DefaultOutputsTTL is how long saved large outputs are kept
+	DefaultOutputsTTL = 24 * time.Hour
+	// DefaultOutputsMaxSize is the total size of saved large outputs kept
+	DefaultOutputsMaxSize = 1 << 30
+	// DefaultCleanupInterval is how often outputs are cleaned up and disk usage is rescanned
+	DefaultCleanupInterval = 10 * time.Minute
+)
+
+// QuotaConfig limits the disk space used by the workspace.
+type QuotaConfig struct {
+	MaxSize        int64         // Bytes the workspace may use, 0 for no limit
+	OutputsTTL     time.Duration // Saved outputs older than this are deleted, 0 keeps them
+	OutputsMaxSize int64         // Oldest saved outputs are deleted beyond this total, 0 for no limit
+}
+
+// DefaultQuotaConfig returns the default configuration: no quota, and saved
+// outputs kept for a day up to 1 GiB.
+func DefaultQuotaConfig() QuotaConfig {
+	return QuotaConfig{
+		OutputsTTL:     DefaultOutputsTTL,
+		OutputsMaxSize: DefaultOutputsMaxSize,
+	}
+}
+
+// Usage is the disk usage of the workspace as of the last scan, plus the
+// writes made through the workspace since.
+type Usage struct {
+	Used    int64 // Bytes of all files in the workspace
+	Outputs int64 // Bytes of saved large outputs
+	Quota   int64 // Configured quota, 0 if unlimited
+}
+
+// diskQuota tracks the disk usage of a workspace and its sessions, which share
+// one quota.
+type diskQuota struct {
+	root string // Root of the top-level workspace
+
+	mu      sync.Mutex
+	cfg     QuotaConfig
+	usage   Usage
+	scanned bool
+}
+
+// SetQuota configures the disk quota and the cleanup of saved outputs.
+func (w *Workspace) SetQuota(cfg QuotaConfig) error {
+	if cfg.MaxSize < 0 || cfg.OutputsMaxSize < 0 || cfg.OutputsTTL < 0 {
+		return fmt.Errorf("quota settings must not be negative")
+	}
+	w.disk.mu.Lock()
+	defer w.disk.mu.Unlock()
+	w.disk.cfg = cfg
+	return nil
+}
+
+// Usage returns the current disk usage of the workspace.
+func (w *Workspace) Usage() Usage {
+	d := w.disk
+	d.ensureScanned()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	usage := d.usage
+	usage.Quota = d.cfg.MaxSize
+	return usage
+}
+
+// RunCleanup deletes expired saved outputs and idle sessions, and rescans
+// disk usage, every interval until ctx is done.
+func (w *Workspace) RunCleanup(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultCleanupInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		w.cleanup(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleanup deletes idle sessions and expired and excess saved outputs, then
+// rescans disk usage.
+func (w *Workspace) cleanup(now time.Time) {
+	w.expireSessions(now)
+
+	d := w.disk
+	d.mu.Lock()
+	cfg := d.cfg
+	d.mu.Unlock()
+
+	files, err := d.outputFiles()
+	if err != nil {
+		slog.Warn("failed to list saved outputs", "error", err)
+	}
+
+	var remove []outputFile
+	var total int64
+	// Newest first, so the oldest are dropped when the total is too large
+	for i := len(files) - 1; i >= 0; i-- {
+		f := files[i]
+		expired := cfg.OutputsTTL > 0 && now.Sub(f.modTime) > cfg.OutputsTTL
+		if expired || (cfg.OutputsMaxSize > 0 && total+f.size > cfg.OutputsMaxSize) {
+			remove = append(remove, f)
+			continue
+		}
+		total += f.size
+	}
+	if count, freed := removeOutputs(remove); count > 0 {
+		slog.Info("removed expired saved outputs", "count", count, "bytes", freed)
+	}
+
+	d.scan()
+}
+
+// reserve accounts for n more bytes written to path by op, refusing the write
+// when it would exceed the quota. Saved outputs are deleted, oldest first, to
+// make room before a write is refused.
+func (d *diskQuota) reserve(op, path string, n int64) error {
+	if n <= 0 {
+		return nil
+	}
+	d.ensureScanned()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	limit := d.cfg.MaxSize
+	if limit > 0 && d.usage.Used+n > limit {
+		d.evictOutputsLocked(d.usage.Used + n - limit)
+		if d.usage.Used+n > limit {
+			return &FileError{Op: op, Path: path, Code: protocol.ErrorCodeQuotaExceeded,
+				Err: fmt.Errorf("workspace quota exceeded: %d of %d bytes used, %d more needed", d.usage.Used, limit, n)}
+		}
+	}
+	d.usage.Used += n
+	return nil
+}
+
+// release returns n bytes of removed runner files to the free space.
+func (d *diskQuota) release(n int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.usage.Used = max(d.usage.Used-n, 0)
+}
+
+// reserveReplace reserves the growth of realPath when it is replaced by
+// content of size bytes.
+func (d *diskQuota) reserveReplace(op, path, realPath string, size int64) error {
+	if info, err := os.Lstat(realPath); err == nil && info.Mode().IsRegular() {
+		size -= info.Size()
+	}
+	return d.reserve(op, path, size)
+}
+
+// ensureScanned takes the first usage scan if none was taken yet.
+func (d *diskQuota) ensureScanned() {
+	d.mu.Lock()
+	scanned := d.scanned
+	d.mu.Unlock()
+	if !scanned {
+		d.scan()
+	}
+}
+
+// scan measures the disk usage of the workspace.
+func (d *diskQuota) scan() {
+	var used, outputs int64
+	err := filepath.WalkDir(d.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Removed while scanning or unreadable
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		used += info.Size()
+		if d.isOutput(path) {
+			outputs += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Warn("failed to scan workspace usage", "error", err)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.usage = Usage{Used: used, Outputs: outputs}
+	d.scanned = true
+}
+
+// isOutput reports whether path is a saved output of the workspace or of a
+// session.
+func (d *diskQuota) isOutput(path string) bool {
+	rel, err := filepath.Rel(d.root, filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	if rel == OutputsDir {
+		return true
+	}
+	ok, _ := filepath.Match(filepath.Join(SessionsDir, "*", OutputsDir), rel)
+	return ok
+}
+
+// evictOutputsLocked deletes saved outputs, oldest first, until need bytes
+// are freed or none are left. Callers must hold mu.
+func (d *diskQuota) evictOutputsLocked(need int64) {
+	files, err := d.outputFiles()
+	if err != nil {
+		return
+	}
+	n := 0
+	for size := int64(0); n < len(files) && size < need; n++ {
+		size += files[n].size
+	}
+
+	count, freed := removeOutputs(files[:n])
+	d.usage.Used = max(d.usage.Used-freed, 0)
+	d.usage.Outputs = max(d.usage.Outputs-freed, 0)
+	if count > 0 {
+		slog.Info("removed saved outputs to stay within the workspace quota", "count", count, "bytes", freed)
+	}
+}
+
+// outputFile is a saved large output.
+type outputFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// outputFiles lists saved outputs of the workspace and its sessions, oldest
+// first.
+func (d *diskQuota) outputFiles() ([]outputFile, error) {
+	dirs := []string{filepath.Join(d.root, OutputsDir)}
+	sessions, _ := filepath.Glob(filepath.Join(d.root, SessionsDir, "*", OutputsDir))
+	dirs = append(dirs, sessions...)
+
+	var files []outputFile
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			files = append(files, outputFile{path: filepath.Join(dir, entry.Name()), size: info.Size(), modTime: info.ModTime()})
+		}
+	}
+	slices.SortFunc(files, func(a, b outputFile) int {
+		return a.modTime.Compare(b.modTime)
+	})
+	return files, nil
+}
+
+// removeOutputs deletes saved outputs and returns how many and how many bytes
+// were deleted.
+func removeOutputs(files []outputFile) (int, int64) {
+	count := 0
+	var freed int64
+	for _, f := range files {
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("failed to remove saved output", "path", f.path, "error", err)
+			continue
+		}
+		count++
+		freed += f.size
+	}
+	return count, freed
+}
@@ -0,0 +1,145 @@
+package workspace
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// writeOutput saves a large output file with the given modification time.
+func writeOutput(t *testing.T, ws *Workspace, name string, size int, modTime time.Time) string {
+	t.Helper()
+	path := filepath.Join(ws.Root(), OutputsDir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(strings.Repeat("x", size)), 0o644))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+	return path
+}
+
+func TestWorkspace_Quota(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+	require.NoError(t, ws.SetQuota(QuotaConfig{MaxSize: 100}))
+
+	writeString(t, ws, "a.txt", strings.Repeat("a", 60))
+
+	_, err := ws.Write(ctx, &protocol.WriteArgs{
+		Path:    "b.txt",
+		Content: base64.StdEncoding.EncodeToString([]byte(strings.Repeat("b", 60))),
+	})
+	var fileErr *FileError
+	require.ErrorAs(t, err, &fileErr)
+	assert.Equal(t, protocol.ErrorCodeQuotaExceeded, fileErr.Code)
+	assert.NoFileExists(t, filepath.Join(ws.Root(), "b.txt"))
+
+	// Replacing a file only counts its growth
+	writeString(t, ws, "a.txt", strings.Repeat("c", 90))
+
+	_, err = ws.Edit(ctx, &protocol.EditArgs{Path: "new.txt", NewString: strings.Repeat("d", 20)})
+	require.ErrorAs(t, err, &fileErr)
+	assert.Equal(t, "edit", fileErr.Op)
+
+	usage := ws.Usage()
+	assert.Equal(t, int64(100), usage.Quota)
+	assert.Equal(t, int64(90), usage.Used)
+
+	assert.Error(t, ws.SetQuota(QuotaConfig{MaxSize: -1}))
+}
+
+func TestWorkspace_Quota_EvictsOutputs(t *testing.T) {
+	ws := newTestWorkspace(t)
+	now := time.Now()
+	oldest := writeOutput(t, ws, "bash_1.txt", 40, now.Add(-2*time.Minute))
+	newest := writeOutput(t, ws, "bash_2.txt", 40, now.Add(-time.Minute))
+	require.NoError(t, ws.SetQuota(QuotaConfig{MaxSize: 100}))
+
+	// Saved outputs are deleted oldest first to make room
+	writeString(t, ws, "a.txt", strings.Repeat("a", 50))
+	assert.NoFileExists(t, oldest)
+	assert.FileExists(t, newest)
+
+	usage := ws.Usage()
+	assert.Equal(t, int64(90), usage.Used)
+	assert.Equal(t, int64(40), usage.Outputs)
+
+	// A large output that does not fit is returned without being saved
+	p := NewLargeOutputProcessor(ws, LargeOutputConfig{MaxOutputSize: 10, PreviewLines: 1})
+	res, err := p.Process(context.Background(), strings.Repeat("line\n", 50), "bash")
+	require.NoError(t, err)
+	assert.True(t, res.Truncated)
+	assert.Empty(t, res.FilePath)
+	assert.NoFileExists(t, newest)
+}
+
+func TestWorkspace_Cleanup(t *testing.T) {
+	ws := newTestWorkspace(t)
+	now := time.Now()
+	expired := writeOutput(t, ws, "bash_1.txt", 10, now.Add(-2*time.Hour))
+	old := writeOutput(t, ws, "bash_2.txt", 30, now.Add(-30*time.Minute))
+	recent := writeOutput(t, ws, "bash_3.txt", 30, now.Add(-time.Minute))
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root(), "notes.txt"), []byte("keep"), 0o644))
+	require.NoError(t, ws.SetQuota(QuotaConfig{OutputsTTL: time.Hour, OutputsMaxSize: 50}))
+
+	ws.cleanup(now)
+	assert.NoFileExists(t, expired)
+	assert.NoFileExists(t, old)
+	assert.FileExists(t, recent)
+	assert.FileExists(t, filepath.Join(ws.Root(), "notes.txt"))
+
+	usage := ws.Usage()
+	assert.Equal(t, int64(34), usage.Used)
+	assert.Equal(t, int64(30), usage.Outputs)
+	assert.Zero(t, usage.Quota)
+
+	// Cleanup stops with the context
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ws.RunCleanup(ctx, time.Hour)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cleanup did not stop")
+	}
+}
+
+func TestWorkspace_Quota_Backups(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+	require.NoError(t, ws.SetQuota(QuotaConfig{MaxSize: 100}))
+	write := func(content string) *protocol.WriteResult {
+		t.Helper()
+		res, err := ws.Write(ctx, &protocol.WriteArgs{Path: "a.txt", Content: base64.StdEncoding.EncodeToString([]byte(content))})
+		require.NoError(t, err)
+		return res
+	}
+
+	write(strings.Repeat("a", 40))
+	assert.Empty(t, write(strings.Repeat("b", 40)).BackupError)
+	assert.Equal(t, int64(80), ws.Usage().Used)
+
+	// The next backup does not fit, so the write goes ahead without it
+	res := write(strings.Repeat("c", 40))
+	assert.Contains(t, res.BackupError, "workspace quota exceeded")
+	assert.Equal(t, int64(80), ws.Usage().Used)
+	data, err := os.ReadFile(filepath.Join(ws.Root(), "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("c", 40), string(data))
+
+	// Restoring frees the backup it used
+	_, err = ws.Restore(ctx, &protocol.RestoreArgs{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(40), ws.Usage().Used)
+}
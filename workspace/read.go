@@ -0,0 +1,151 @@
+package workspace
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const (
+	// DefaultMaxReadSize caps the bytes returned by a single read so a limit of 0
+	// cannot load a multi-GB file into memory
+	DefaultMaxReadSize = 10 * 1024 * 1024
+	// DefaultReadLines is the number of lines returned in lines mode when not specified
+	DefaultReadLines = 2000
+	// MaxLineLength is the maximum bytes kept per line in lines mode
+	MaxLineLength = 2000
+	// binarySniffSize is the number of leading bytes inspected for binary detection
+	binarySniffSize = 8000
+)
+
+// readLines reads a line range as UTF-8 text prefixed with line numbers.
+// Reading stops after the range, so TotalLines is only known when the range
+// reaches the end of the file, unless countLines reads on to count them.
+func (w *Workspace) readLines(path string, size int64, startLine, lineCount int, countLines bool) (*protocol.ReadResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	if startLine <= 0 {
+		startLine = 1
+	}
+	if lineCount <= 0 {
+		lineCount = DefaultReadLines
+	}
+	endLine := startLine + lineCount - 1
+
+	// The hash covers the bytes read, so it matches the content returned
+	hash := sha256.New()
+	reader := bufio.NewReaderSize(io.TeeReader(file, hash), 64*1024)
+
+	sample, err := reader.Peek(binarySniffSize)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if IsBinary(sample) {
+		return &protocol.ReadResult{TotalSize: size, IsBinary: true}, nil
+	}
+
+	result := &protocol.ReadResult{TotalSize: size}
+	var sb strings.Builder
+	var line []byte
+	lineNum := 0
+
+	// Only the requested range is kept in memory
+	for {
+		if (lineNum >= endLine || result.Truncated) && !countLines {
+			_, err := reader.Peek(1)
+			result.More = err == nil
+			break
+		}
+
+		chunk, readErr := reader.ReadSlice('\n')
+		if len(chunk) > 0 {
+			inRange := lineNum+1 >= startLine && lineNum+1 <= endLine && !result.Truncated
+			if inRange && len(line) <= MaxLineLength {
+				line = append(line, chunk...)
+			}
+			if chunk[len(chunk)-1] == '\n' || (readErr != nil && !errors.Is(readErr, bufio.ErrBufferFull)) {
+				lineNum++
+				if inRange {
+					if sb.Len()+len(line) > DefaultMaxReadSize {
+						result.Truncated = true
+					} else {
+						fmt.Fprintf(&sb, "%6d\t%s\n", lineNum, formatLine(line))
+						if result.StartLine == 0 {
+							result.StartLine = lineNum
+						}
+						result.EndLine = lineNum
+					}
+				}
+				line = line[:0]
+			}
+		}
+		if readErr != nil {
+			if errors.Is(readErr, bufio.ErrBufferFull) {
+				continue
+			}
+			if errors.Is(readErr, io.EOF) {
+				result.TotalLines = lineNum
+				// A later edit can detect concurrent changes when the whole file was returned
+				if startLine == 1 && result.EndLine == lineNum && !result.Truncated {
+					result.SHA256 = hex.EncodeToString(hash.Sum(nil))
+				}
+				break
+			}
+			return nil, fmt.Errorf("failed to read file: %w", readErr)
+		}
+	}
+
+	result.Content = sb.String()
+	return result, nil
+}
+
+// formatLine strips the line ending, caps the length and replaces invalid UTF-8.
+func formatLine(line []byte) string {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+
+	suffix := ""
+	if len(line) > MaxLineLength {
+		cut := MaxLineLength
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		line = line[:cut]
+		suffix = "... [line truncated]"
+	}
+	return strings.ToValidUTF8(string(line), "�") + suffix
+}
+
+// IsBinary reports whether data looks like binary content: it contains a NUL
+// byte or more than 10% of it is not valid UTF-8.
+func IsBinary(data []byte) bool {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return true
+	}
+
+	invalid := 0
+	for i := 0; i < len(data); {
+		r, n := utf8.DecodeRune(data[i:])
+		// A rune cut off at the end of the sample is not an error
+		if r == utf8.RuneError && n == 1 && len(data)-i >= utf8.UTFMax {
+			invalid++
+		}
+		i += n
+	}
+	return invalid*10 > len(data)
+}
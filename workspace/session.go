@@ -0,0 +1,286 @@
+package workspace
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const (
+	// SessionsDir holds the directories of session workspaces
+	SessionsDir = ".work/sessions"
+	// DefaultSessionIdleTTL is how long an unused session is kept
+	DefaultSessionIdleTTL = 24 * time.Hour
+)
+
+// What sessions are keyed by
+const (
+	SessionKeySourceInstance = "source_instance" // The Safari instance that sent the task
+	SessionKeyTrace          = "trace"           // The trace ID of the task
+)
+
+// SessionConfig configures per-session workspaces. Each session works in its
+// own directory below SessionsDir, so concurrent investigations cannot
+// overwrite each other's files.
+type SessionConfig struct {
+	Key     string        // SessionKeySourceInstance or SessionKeyTrace, empty disables sessions
+	Shared  []string      // Top-level workspace directories sessions can read but not modify
+	IdleTTL time.Duration // Sessions unused for this long are deleted, 0 keeps them
+}
+
+// DefaultSessionConfig returns the default configuration: sessions disabled,
+// and skills shared when they are enabled.
+func DefaultSessionConfig() SessionConfig {
+	return SessionConfig{
+		Shared:  []string{"skills"},
+		IdleTTL: DefaultSessionIdleTTL,
+	}
+}
+
+// session is a session workspace and when it was last used.
+type session struct {
+	ws       *Workspace
+	lastUsed time.Time
+}
+
+// sessionNamePattern matches session IDs used as directory names as is;
+// other IDs are hashed.
+var sessionNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// SetSessions configures per-session workspaces.
+func (w *Workspace) SetSessions(cfg SessionConfig) error {
+	switch cfg.Key {
+	case "", SessionKeySourceInstance, SessionKeyTrace:
+	default:
+		return fmt.Errorf("invalid session key %q: must be %s or %s", cfg.Key, SessionKeySourceInstance, SessionKeyTrace)
+	}
+	for _, name := range cfg.Shared {
+		if name == "" || name == "." || name == ".." || name == WorkDir || strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("invalid shared directory %q: must be a top-level directory name", name)
+		}
+	}
+	if cfg.IdleTTL < 0 {
+		return fmt.Errorf("session idle TTL must not be negative")
+	}
+
+	w.sessionsMu.Lock()
+	defer w.sessionsMu.Unlock()
+	w.sessionCfg = cfg
+	return nil
+}
+
+// ForTask returns the workspace a task works in: its session workspace when
+// sessions are enabled, w otherwise. With sessions enabled, a task without
+// the session key is refused rather than given the workspace holding every
+// session.
+func (w *Workspace) ForTask(sourceInstanceID, traceID string) (*Workspace, error) {
+	w.sessionsMu.Lock()
+	key := w.sessionCfg.Key
+	w.sessionsMu.Unlock()
+	if key == "" {
+		return w, nil
+	}
+
+	id := w.sessionID(sourceInstanceID, traceID)
+	if id == "" {
+		return nil, fmt.Errorf("task has no %s: it is required to pick a session workspace", key)
+	}
+	return w.Session(id)
+}
+
+// sessionID returns the ID of the session a task belongs to, or "" when
+// sessions are disabled or the task has no session key.
+func (w *Workspace) sessionID(sourceInstanceID, traceID string) string {
+	w.sessionsMu.Lock()
+	key := w.sessionCfg.Key
+	w.sessionsMu.Unlock()
+
+	switch key {
+	case SessionKeySourceInstance:
+		return sourceInstanceID
+	case SessionKeyTrace:
+		return traceID
+	}
+	return ""
+}
+
+// symlink creates the links to shared directories, replaced in tests.
+var symlink = os.Symlink
+
+// Session returns the workspace of session id, creating its directory on
+// demand. Relative paths resolve inside the session directory, and shared
+// directories are linked into it for reading.
+func (w *Workspace) Session(id string) (*Workspace, error) {
+	if w.base != nil {
+		return nil, fmt.Errorf("sessions cannot be nested")
+	}
+	if id == "" {
+		return nil, fmt.Errorf("session id is required")
+	}
+	name := sessionName(id)
+
+	w.sessionsMu.Lock()
+	defer w.sessionsMu.Unlock()
+
+	now := time.Now()
+	if s, ok := w.sessions[name]; ok {
+		s.lastUsed = now
+		return s.ws, nil
+	}
+
+	dir := filepath.Join(w.root, SessionsDir, name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	}
+	// The modification time marks when a session was last used across restarts
+	_ = os.Chtimes(dir, now, now)
+
+	for _, shared := range w.sessionCfg.Shared {
+		target := filepath.Join(w.root, shared)
+		if err := os.MkdirAll(target, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create shared directory %s: %w", shared, err)
+		}
+		// The link lets commands see the directory; file operations resolve
+		// shared paths without it, so they keep working where links cannot be
+		// created, e.g. on Windows without the privilege
+		link := filepath.Join(dir, shared)
+		if _, err := os.Lstat(link); errors.Is(err, fs.ErrNotExist) {
+			if err := symlink(target, link); err != nil {
+				slog.Warn("failed to link shared directory into session, commands will not see it",
+					"session", id, "dir", shared, "error", err)
+			}
+		}
+	}
+
+	s := &Workspace{
+		root:    dir,
+		checker: w.checker,
+		mcpMgr:  w.mcpMgr,
+		mounts:  w.mounts,
+		disk:    w.disk,
+		base:    w,
+		shared:  slices.Clone(w.sessionCfg.Shared),
+	}
+	if w.sessions == nil {
+		w.sessions = make(map[string]*session)
+	}
+	w.sessions[name] = &session{ws: s, lastUsed: now}
+	slog.Info("session workspace created", "session", id, "root", dir)
+	return s, nil
+}
+
+// EndSession deletes the session a task belongs to and all its files.
+func (w *Workspace) EndSession(sourceInstanceID, traceID string) (*protocol.EndSessionResult, error) {
+	id := w.sessionID(sourceInstanceID, traceID)
+	if id == "" {
+		return nil, fmt.Errorf("task has no session: sessions are disabled or the session key is missing")
+	}
+
+	removed, err := w.removeSession(sessionName(id))
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.EndSessionResult{Session: id, Removed: removed}, nil
+}
+
+// removeSession deletes the session directory name and reports whether it
+// existed.
+func (w *Workspace) removeSession(name string) (bool, error) {
+	w.sessionsMu.Lock()
+	delete(w.sessions, name)
+	w.sessionsMu.Unlock()
+
+	dir := filepath.Join(w.root, SessionsDir, name)
+	if _, err := os.Lstat(dir); errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	// Links to shared directories are removed, never followed
+	if err := os.RemoveAll(dir); err != nil {
+		return false, fmt.Errorf("failed to remove session directory: %w", err)
+	}
+	w.disk.scan()
+	return true, nil
+}
+
+// expireSessions deletes sessions unused for longer than the idle TTL.
+// Sessions from before a restart are judged by their directory's
+// modification time.
+func (w *Workspace) expireSessions(now time.Time) {
+	w.sessionsMu.Lock()
+	ttl := w.sessionCfg.IdleTTL
+	w.sessionsMu.Unlock()
+	if ttl <= 0 {
+		return
+	}
+
+	entries, err := os.ReadDir(filepath.Join(w.root, SessionsDir))
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		w.sessionsMu.Lock()
+		s, ok := w.sessions[name]
+		var lastUsed time.Time
+		if ok {
+			lastUsed = s.lastUsed
+		}
+		w.sessionsMu.Unlock()
+		if !ok {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			lastUsed = info.ModTime()
+		}
+
+		if now.Sub(lastUsed) <= ttl {
+			continue
+		}
+		if _, err := w.removeSession(name); err != nil {
+			slog.Warn("failed to remove idle session", "session", name, "error", err)
+			continue
+		}
+		slog.Info("removed idle session", "session", name, "idle", now.Sub(lastUsed).Round(time.Second))
+	}
+}
+
+// sessionName returns the directory name of session id.
+func sessionName(id string) string {
+	if sessionNamePattern.MatchString(id) {
+		return id
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:16])
+}
+
+// splitShared returns the shared directory and the path inside it if path
+// addresses a directory a session shares with its workspace.
+func (w *Workspace) splitShared(path string) (name, rest string, ok bool) {
+	if w.base == nil {
+		return "", "", false
+	}
+	rel, err := filepath.Rel(w.root, filepath.Join(w.root, path))
+	if err != nil {
+		return "", "", false
+	}
+	name, rest, _ = strings.Cut(filepath.ToSlash(rel), "/")
+	if !slices.Contains(w.shared, name) {
+		return "", "", false
+	}
+	return name, rest, true
+}
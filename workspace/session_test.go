@@ -0,0 +1,207 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// newSessionWorkspace returns a workspace with sessions keyed by trace ID and
+// a skill in the shared skills directory.
+func newSessionWorkspace(t *testing.T) *Workspace {
+	t.Helper()
+	ws := newTestWorkspace(t)
+	cfg := DefaultSessionConfig()
+	cfg.Key = SessionKeyTrace
+	require.NoError(t, ws.SetSessions(cfg))
+
+	skill := filepath.Join(ws.Root(), "skills", "triage", "SKILL.md")
+	require.NoError(t, os.MkdirAll(filepath.Dir(skill), 0o755))
+	require.NoError(t, os.WriteFile(skill, []byte("# Triage\n"), 0o644))
+	return ws
+}
+
+func TestWorkspace_Session(t *testing.T) {
+	ws := newSessionWorkspace(t)
+	ctx := context.Background()
+
+	// Tasks without the session key do not get the workspace of all sessions
+	_, err := ws.ForTask("instance-1", "")
+	assert.ErrorContains(t, err, "task has no trace")
+
+	s1, err := ws.ForTask("instance-1", "trace-1")
+	require.NoError(t, err)
+	s2, err := ws.ForTask("instance-1", "trace-2")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(ws.Root(), SessionsDir, "trace-1"), s1.Root())
+	again, err := ws.ForTask("instance-2", "trace-1")
+	require.NoError(t, err)
+	assert.Same(t, s1, again)
+
+	// Relative paths resolve inside each session
+	writeString(t, s1, "notes.txt", "first")
+	writeString(t, s2, "notes.txt", "second")
+	assert.Equal(t, "first", readString(t, s1, "notes.txt"))
+	assert.Equal(t, "second", readString(t, s2, "notes.txt"))
+	assert.NoFileExists(t, filepath.Join(ws.Root(), "notes.txt"))
+
+	// Git Bash on Windows prints D:\a\x as /d/a/x, so only the end is compared
+	res, err := s1.Bash(ctx, &protocol.BashArgs{Command: "pwd"})
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(res.Stdout), filepath.ToSlash(filepath.Join(SessionsDir, "trace-1"))), res.Stdout)
+
+	if _, err := os.Lstat(filepath.Join(s1.Root(), "skills")); err == nil {
+		res, err = s1.Bash(ctx, &protocol.BashArgs{Command: "cat skills/triage/SKILL.md"})
+		require.NoError(t, err)
+		assert.Equal(t, "# Triage\n", res.Stdout)
+	}
+}
+
+func TestWorkspace_Session_WithoutSymlinks(t *testing.T) {
+	saved := symlink
+	symlink = func(string, string) error { return &os.LinkError{Op: "symlink", Err: os.ErrPermission} }
+	t.Cleanup(func() { symlink = saved })
+
+	ws := newSessionWorkspace(t)
+	ctx := context.Background()
+	s, err := ws.Session("trace-1")
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(s.Root(), "skills"))
+
+	// Shared paths resolve without the link
+	read, err := s.Read(ctx, &protocol.ReadArgs{Path: "skills/triage/SKILL.md", Mode: protocol.ReadModeLines})
+	require.NoError(t, err)
+	assert.Contains(t, read.Content, "# Triage")
+
+	_, err = s.Write(ctx, &protocol.WriteArgs{Path: "skills/triage/SKILL.md", Content: "eA=="})
+	assert.ErrorContains(t, err, "read-only")
+}
+
+func TestWorkspace_Session_SharedReadOnly(t *testing.T) {
+	ws := newSessionWorkspace(t)
+	ctx := context.Background()
+	s, err := ws.Session("trace-1")
+	require.NoError(t, err)
+
+	read, err := s.Read(ctx, &protocol.ReadArgs{Path: "skills/triage/SKILL.md", Mode: protocol.ReadModeLines})
+	require.NoError(t, err)
+	assert.Contains(t, read.Content, "# Triage")
+
+	list, err := s.List(ctx, &protocol.ListArgs{Path: "skills", Recursive: true})
+	require.NoError(t, err)
+	var paths []string
+	for _, e := range list.Entries {
+		paths = append(paths, e.Path)
+	}
+	assert.ElementsMatch(t, []string{"skills/triage", "skills/triage/SKILL.md"}, paths)
+
+	stat, err := s.Stat(ctx, &protocol.StatArgs{Path: "skills/triage"})
+	require.NoError(t, err)
+	assert.Equal(t, protocol.FileTypeDir, stat.Type)
+
+	_, err = s.Write(ctx, &protocol.WriteArgs{Path: "skills/triage/SKILL.md", Content: "eA=="})
+	assert.ErrorContains(t, err, "read-only")
+
+	var fileErr *FileError
+	_, err = s.Delete(ctx, &protocol.DeleteArgs{Path: "skills", Recursive: true, Confirm: true})
+	require.ErrorAs(t, err, &fileErr)
+	assert.Equal(t, protocol.ErrorCodeProtected, fileErr.Code)
+	_, err = s.Move(ctx, &protocol.MoveArgs{Source: "skills/triage", Dest: "mine"})
+	assert.Error(t, err)
+	assert.FileExists(t, filepath.Join(ws.Root(), "skills", "triage", "SKILL.md"))
+}
+
+func TestWorkspace_EndSession(t *testing.T) {
+	ws := newSessionWorkspace(t)
+	s, err := ws.ForTask("", "trace-1")
+	require.NoError(t, err)
+	writeString(t, s, "notes.txt", "data")
+
+	res, err := ws.EndSession("", "trace-1")
+	require.NoError(t, err)
+	assert.Equal(t, &protocol.EndSessionResult{Session: "trace-1", Removed: true}, res)
+	assert.NoDirExists(t, s.Root())
+	assert.FileExists(t, filepath.Join(ws.Root(), "skills", "triage", "SKILL.md"))
+
+	res, err = ws.EndSession("", "trace-1")
+	require.NoError(t, err)
+	assert.False(t, res.Removed)
+
+	_, err = ws.EndSession("instance-1", "")
+	assert.Error(t, err)
+
+	// A new session starts empty
+	s, err = ws.ForTask("", "trace-1")
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(s.Root(), "notes.txt"))
+}
+
+func TestWorkspace_Session_Names(t *testing.T) {
+	ws := newSessionWorkspace(t)
+
+	s, err := ws.Session("../../etc")
+	require.NoError(t, err)
+	name := filepath.Base(s.Root())
+	assert.Len(t, name, 32)
+	assert.Equal(t, filepath.Join(ws.Root(), SessionsDir, name), s.Root())
+
+	_, err = ws.Session("")
+	assert.Error(t, err)
+	_, err = s.Session("nested")
+	assert.Error(t, err)
+
+	assert.Error(t, ws.SetSessions(SessionConfig{Key: "user"}))
+	assert.Error(t, ws.SetSessions(SessionConfig{Shared: []string{"a/b"}}))
+	assert.Error(t, ws.SetSessions(SessionConfig{Shared: []string{WorkDir}}))
+}
+
+func TestWorkspace_Session_IdleCleanup(t *testing.T) {
+	ws := newSessionWorkspace(t)
+	now := time.Now()
+
+	active, err := ws.Session("active")
+	require.NoError(t, err)
+	idle, err := ws.Session("idle")
+	require.NoError(t, err)
+	ws.sessions["idle"].lastUsed = now.Add(-2 * DefaultSessionIdleTTL)
+
+	// A session left over from before a restart
+	stale := filepath.Join(ws.Root(), SessionsDir, "stale")
+	require.NoError(t, os.MkdirAll(stale, 0o755))
+	old := now.Add(-2 * DefaultSessionIdleTTL)
+	require.NoError(t, os.Chtimes(stale, old, old))
+
+	ws.cleanup(now)
+	assert.DirExists(t, active.Root())
+	assert.NoDirExists(t, idle.Root())
+	assert.NoDirExists(t, stale)
+	assert.DirExists(t, filepath.Join(ws.Root(), "skills", "triage"))
+}
+
+func TestWorkspace_Session_SharesQuota(t *testing.T) {
+	ws := newSessionWorkspace(t)
+	s, err := ws.Session("trace-1")
+	require.NoError(t, err)
+	require.NoError(t, ws.SetQuota(QuotaConfig{MaxSize: 100}))
+
+	// Saved outputs of a session count as outputs and are cleaned up
+	output := filepath.Join(s.Root(), OutputsDir, "bash_1.txt")
+	require.NoError(t, os.MkdirAll(filepath.Dir(output), 0o755))
+	require.NoError(t, os.WriteFile(output, []byte(strings.Repeat("x", 30)), 0o644))
+	assert.Equal(t, int64(30), ws.Usage().Outputs)
+
+	writeString(t, s, "a.txt", strings.Repeat("a", 60))
+	_, err = ws.Write(context.Background(), &protocol.WriteArgs{Path: "b.txt", Content: strings.Repeat("YWFh", 20)})
+	var fileErr *FileError
+	require.ErrorAs(t, err, &fileErr)
+	assert.Equal(t, protocol.ErrorCodeQuotaExceeded, fileErr.Code)
+	assert.NoFileExists(t, output)
+}
@@ -0,0 +1,670 @@
+package workspace
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const (
+	// DefaultTailLines is the number of lines returned when not specified
+	DefaultTailLines = 100
+	// MaxTailLines caps the lines returned by a single tail
+	MaxTailLines = 10000
+	// DefaultFollowSeconds is how long follow mode runs when not specified
+	DefaultFollowSeconds = 30
+	// MaxFollowSeconds caps how long follow mode runs
+	MaxFollowSeconds = 300
+	// tailBlockSize is the read size for reverse reading and following
+	tailBlockSize = 64 * 1024
+	// followPollInterval is how often a followed file is checked for new data
+	followPollInterval = 250 * time.Millisecond
+	// maxFollowChunk caps the data a follower reads and emits at once; a longer
+	// line is emitted in pieces
+	maxFollowChunk = 1024 * 1024
+)
+
+// rotatedSuffixPattern matches what log rotation appends to a file name:
+// app.log.1, app.log.2.gz, app.log-20240101, app.log-2024-01-01.gz.
+var rotatedSuffixPattern = regexp.MustCompile(`^[.-][0-9][0-9T_:-]*(\.gz)?$`)
+
+// timeWindow bounds the timestamps of lines returned by a tail. Zero bounds are open.
+type timeWindow struct {
+	since time.Time
+	until time.Time
+}
+
+// Tail returns the last lines of a log file, optionally limited to a time
+// window and including rotated siblings. In follow mode it then streams lines
+// appended to the file through output until the follow duration elapses.
+func (w *Workspace) Tail(ctx context.Context, args *protocol.TailArgs, output OutputFunc) (*protocol.TailResult, error) {
+	outputConfig, err := OutputConfig(args.Truncate, args.MaxTokens, protocol.TruncateTail)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := w.resolveRead(args.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(loc.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("cannot tail a directory: %s", args.Path)
+	}
+
+	lines := args.Lines
+	if lines <= 0 {
+		lines = DefaultTailLines
+	}
+	lines = min(lines, MaxTailLines)
+
+	now := time.Now()
+	window, err := parseTimeWindow(args.Since, args.Until, now)
+	if err != nil {
+		return nil, err
+	}
+
+	compressed, err := checkLogFile(loc.path)
+	if err != nil {
+		return nil, err
+	}
+	if args.Follow && compressed {
+		return nil, fmt.Errorf("cannot follow a compressed file: %s", args.Path)
+	}
+	if args.Follow && output == nil {
+		return nil, fmt.Errorf("follow is not supported without an output stream")
+	}
+
+	files := []string{loc.path}
+	if args.IncludeRotated {
+		files = append(rotatedSiblings(loc.path), loc.path)
+	}
+
+	// Only the current file's content up to this size is tailed, so following
+	// continues exactly where the tail ended
+	size := info.Size()
+
+	ring := newLineRing(lines)
+	var read []string
+	if window != nil {
+		read, err = tailWindow(ctx, files, size, window, now, ring)
+	} else {
+		read, err = tailFiles(ctx, files, size, ring)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	selected := ring.lines()
+	result := &protocol.TailResult{
+		Lines:   len(selected),
+		Omitted: ring.dropped,
+		Files:   make([]string, 0, len(read)),
+	}
+	for _, p := range read {
+		result.Files = append(result.Files, loc.display(p))
+	}
+
+	if args.Follow {
+		seconds := args.FollowSeconds
+		if seconds <= 0 {
+			seconds = DefaultFollowSeconds
+		}
+		seconds = min(seconds, MaxFollowSeconds)
+
+		result.Followed, err = followFile(ctx, loc.path, size, time.Duration(seconds)*time.Second, output)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	content := ""
+	if len(selected) > 0 {
+		content = strings.Join(selected, "\n") + "\n"
+	}
+
+	// Process large output
+	processor := NewLargeOutputProcessor(w, outputConfig)
+	processed, err := processor.Process(ctx, content, "tail")
+	if err != nil {
+		result.Content = content
+		result.TotalSize = int64(len(content))
+		return result, nil
+	}
+
+	result.Content = processed.Content
+	result.Truncated = processed.Truncated
+	result.FilePath = processed.FilePath
+	result.TotalSize = processed.TotalSize
+	result.TotalLines = processed.TotalLines
+	result.PreviewLines = processed.PreviewLines
+	result.TotalTokens = processed.TotalTokens
+	result.EstimatedTokens = processed.EstimatedTokens
+
+	return result, nil
+}
+
+// parseTimeWindow parses the since and until arguments. It returns nil when
+// neither is set.
+func parseTimeWindow(since, until string, now time.Time) (*timeWindow, error) {
+	if since == "" && until == "" {
+		return nil, nil
+	}
+
+	window := &timeWindow{}
+	var err error
+	if since != "" {
+		if window.since, err = parseTimeArg(since, now); err != nil {
+			return nil, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	if until != "" {
+		if window.until, err = parseTimeArg(until, now); err != nil {
+			return nil, fmt.Errorf("invalid until: %w", err)
+		}
+	}
+	if !window.since.IsZero() && !window.until.IsZero() && window.since.After(window.until) {
+		return nil, fmt.Errorf("since is after until")
+	}
+	return window, nil
+}
+
+// tailFiles collects the last lines of files, newest file first, until the
+// ring is full. It returns the files read, oldest first.
+func tailFiles(ctx context.Context, files []string, size int64, ring *lineRing) ([]string, error) {
+	var read []string
+	var collected [][]string
+	remaining := ring.size
+
+	for i := len(files) - 1; i >= 0 && remaining > 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		limit := int64(-1)
+		if i == len(files)-1 {
+			limit = size
+		}
+		lines, err := lastLines(files[i], limit, remaining)
+		if err != nil {
+			return nil, err
+		}
+		read = append(read, files[i])
+		collected = append(collected, lines)
+		remaining -= len(lines)
+	}
+
+	for i := len(collected) - 1; i >= 0; i-- {
+		for _, line := range collected[i] {
+			ring.add(line)
+		}
+	}
+	slices.Reverse(read)
+	return read, nil
+}
+
+// tailWindow scans files, oldest first, adding lines whose timestamp falls in
+// the window to the ring. Lines without a timestamp take the timestamp of the
+// closest line above them, so stack traces stay with their log entry. It
+// returns the files read.
+func tailWindow(ctx context.Context, files []string, size int64, window *timeWindow, now time.Time, ring *lineRing) ([]string, error) {
+	var read []string
+
+	for i, path := range files {
+		current := i == len(files)-1
+		limit := int64(-1)
+		if current {
+			limit = size
+		} else if !window.since.IsZero() {
+			// Rotated files are no longer written, so one last modified before
+			// the window starts has no lines in it
+			if info, err := os.Stat(path); err == nil && info.ModTime().Before(window.since) {
+				continue
+			}
+		}
+
+		reader, err := openLog(path, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		var ts time.Time
+		past := false
+		err = scanLines(reader, func(line []byte) bool {
+			if ctx.Err() != nil {
+				return false
+			}
+			if t, ok := parseLogTime(string(line), now); ok {
+				ts = t
+			}
+			switch {
+			case ts.IsZero(), ts.Before(window.since):
+				return true
+			case !window.until.IsZero() && ts.After(window.until):
+				past = true
+				return false
+			}
+			ring.add(formatLine(line))
+			return true
+		})
+		_ = reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		read = append(read, path)
+		// Files are in order, so later ones are past the window too
+		if past {
+			break
+		}
+	}
+	return read, nil
+}
+
+// rotatedSiblings returns the rotated versions of a log file, oldest first.
+func rotatedSiblings(path string) []string {
+	dir, base := filepath.Split(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	type sibling struct {
+		path    string
+		modTime time.Time
+	}
+	var siblings []sibling
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasPrefix(name, base) || !rotatedSuffixPattern.MatchString(name[len(base):]) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		siblings = append(siblings, sibling{path: filepath.Join(dir, name), modTime: info.ModTime()})
+	}
+
+	slices.SortFunc(siblings, func(a, b sibling) int {
+		if c := a.modTime.Compare(b.modTime); c != 0 {
+			return c
+		}
+		// Numbered rotation: app.log.2 is older than app.log.1
+		return strings.Compare(b.path, a.path)
+	})
+
+	paths := make([]string, len(siblings))
+	for i, s := range siblings {
+		paths[i] = s.path
+	}
+	return paths
+}
+
+// checkLogFile reports whether a file is gzip compressed and rejects binary content.
+func checkLogFile(path string) (bool, error) {
+	reader, err := openLog(path, -1)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	sample := make([]byte, binarySniffSize)
+	n, err := io.ReadFull(reader, sample)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, fmt.Errorf("failed to read file: %w", err)
+	}
+	if IsBinary(sample[:n]) {
+		return false, fmt.Errorf("file looks binary: %s", filepath.Base(path))
+	}
+	return reader.compressed, nil
+}
+
+// logReader reads a log file, decompressing it if it is gzip compressed.
+type logReader struct {
+	io.Reader
+	file       *os.File
+	compressed bool
+}
+
+// Close closes the underlying file.
+func (r *logReader) Close() error {
+	return r.file.Close()
+}
+
+// openLog opens a log file for streaming. Gzip content is detected by its
+// magic bytes. If limit is not negative, only that many bytes of an
+// uncompressed file are read.
+func openLog(path string, limit int64) (*logReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	buffered := bufio.NewReaderSize(file, tailBlockSize)
+	magic, _ := buffered.Peek(2)
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("failed to decompress %s: %w", filepath.Base(path), err)
+		}
+		return &logReader{Reader: gz, file: file, compressed: true}, nil
+	}
+
+	var r io.Reader = buffered
+	if limit >= 0 {
+		r = io.LimitReader(buffered, limit)
+	}
+	return &logReader{Reader: r, file: file}, nil
+}
+
+// lastLines returns up to n last lines of a file, formatted for output.
+// Uncompressed files are read backwards from limit (or the end when limit is
+// negative); compressed files have to be streamed.
+func lastLines(path string, limit int64, n int) ([]string, error) {
+	reader, err := openLog(path, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	if reader.compressed {
+		ring := newLineRing(n)
+		err := scanLines(reader, func(line []byte) bool {
+			ring.add(formatLine(line))
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+		}
+		return ring.lines(), nil
+	}
+
+	if limit < 0 {
+		info, err := reader.file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat file: %w", err)
+		}
+		limit = info.Size()
+	}
+	return reverseLines(reader.file, limit, n, tailBlockSize)
+}
+
+// reverseLines reads up to n lines ending at offset size, reading blocks from
+// the end of the file so only the returned lines are loaded.
+func reverseLines(file io.ReaderAt, size int64, n, blockSize int) ([]string, error) {
+	var lines []string
+	var partial []byte
+	pos := size
+	first := true
+
+	for pos > 0 && len(lines) < n {
+		readSize := int64(blockSize)
+		if readSize > pos {
+			readSize = pos
+		}
+		pos -= readSize
+
+		data := make([]byte, int(readSize)+len(partial))
+		if _, err := file.ReadAt(data[:readSize], pos); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		copy(data[readSize:], partial)
+
+		// The final newline terminates the last line rather than starting a new one
+		if first {
+			data = bytes.TrimSuffix(data, []byte("\n"))
+			first = false
+		}
+
+		for len(lines) < n {
+			i := bytes.LastIndexByte(data, '\n')
+			if i < 0 {
+				break
+			}
+			lines = append(lines, formatLine(data[i+1:]))
+			data = data[:i]
+		}
+		partial = data
+	}
+
+	// Whatever is left at the start of a non-empty file is its first line
+	if pos == 0 && size > 0 && len(lines) < n {
+		lines = append(lines, formatLine(partial))
+	}
+
+	slices.Reverse(lines)
+	return lines, nil
+}
+
+// scanLines calls fn for each line of r, including its line ending, until fn
+// returns false. Lines longer than MaxLineLength are cut short.
+func scanLines(r io.Reader, fn func(line []byte) bool) error {
+	reader := bufio.NewReaderSize(r, tailBlockSize)
+	var line []byte
+
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(line) <= MaxLineLength {
+			line = append(line, chunk...)
+		}
+		complete := len(chunk) > 0 && chunk[len(chunk)-1] == '\n'
+		if complete || (errors.Is(err, io.EOF) && len(line) > 0) {
+			if !fn(line) {
+				return nil
+			}
+			line = line[:0]
+		}
+		if err != nil {
+			if errors.Is(err, bufio.ErrBufferFull) {
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// lineRing keeps the last lines added to it.
+type lineRing struct {
+	buf     []string
+	size    int
+	start   int
+	dropped int // Lines pushed out by newer ones
+}
+
+func newLineRing(size int) *lineRing {
+	return &lineRing{size: size}
+}
+
+func (r *lineRing) add(line string) {
+	if len(r.buf) < r.size {
+		r.buf = append(r.buf, line)
+		return
+	}
+	r.buf[r.start] = line
+	r.start = (r.start + 1) % r.size
+	r.dropped++
+}
+
+// lines returns the kept lines, oldest first.
+func (r *lineRing) lines() []string {
+	return append(slices.Clone(r.buf[r.start:]), r.buf[:r.start]...)
+}
+
+// follower streams lines appended to a file.
+type follower struct {
+	file    *os.File
+	offset  int64
+	pending []byte // Incomplete last line
+	buf     []byte
+	output  OutputFunc
+	count   int
+}
+
+// followFile streams complete lines written to path after offset through
+// output until d elapses or ctx is done. It keeps following when the file is
+// truncated or replaced by rotation. It returns the number of lines streamed.
+func followFile(ctx context.Context, path string, offset int64, d time.Duration, output OutputFunc) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	f := &follower{file: file, offset: offset, buf: make([]byte, tailBlockSize), output: output}
+	defer func() {
+		_ = f.file.Close()
+	}()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	ticker := time.NewTicker(followPollInterval)
+	defer ticker.Stop()
+
+	for {
+		caughtUp, err := f.poll(path)
+		if err != nil {
+			return f.count, err
+		}
+		if !caughtUp {
+			// More data is waiting, read on unless stopped
+			select {
+			case <-ctx.Done():
+				return f.count, ctx.Err()
+			case <-timer.C:
+				return f.count, f.flushPartial()
+			default:
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return f.count, ctx.Err()
+		case <-timer.C:
+			return f.count, f.flushPartial()
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll streams new data and switches files after truncation or rotation.
+// It reports whether the end of the file was reached; the file is only
+// switched once the old one has been read to its end.
+func (f *follower) poll(path string) (bool, error) {
+	caughtUp, err := f.readNew()
+	if err != nil || !caughtUp {
+		return caughtUp, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		// Rotated away and not recreated yet
+		return true, nil
+	}
+	current, err := f.file.Stat()
+	if err != nil {
+		return true, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	switch {
+	case !os.SameFile(info, current):
+		file, err := os.Open(path)
+		if err != nil {
+			return true, nil
+		}
+		if err := f.flushPartial(); err != nil {
+			_ = file.Close()
+			return true, err
+		}
+		_ = f.file.Close()
+		f.file = file
+		f.offset = 0
+		return f.readNew()
+	case info.Size() < f.offset:
+		f.pending = f.pending[:0]
+		f.offset = 0
+		return f.readNew()
+	}
+	return true, nil
+}
+
+// readNew reads up to maxFollowChunk bytes of new data and emits the
+// complete lines. It reports whether the end of the file was reached.
+func (f *follower) readNew() (bool, error) {
+	eof := false
+	for len(f.pending) < maxFollowChunk {
+		n, err := f.file.ReadAt(f.buf[:min(len(f.buf), maxFollowChunk-len(f.pending))], f.offset)
+		f.offset += int64(n)
+		f.pending = append(f.pending, f.buf[:n]...)
+		if errors.Is(err, io.EOF) {
+			eof = true
+			break
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to read file: %w", err)
+		}
+	}
+
+	i := bytes.LastIndexByte(f.pending, '\n')
+	if i < 0 {
+		// A line filling the whole chunk is emitted as it is
+		if len(f.pending) >= maxFollowChunk {
+			return eof, f.flushPartial()
+		}
+		return eof, nil
+	}
+	if err := f.send(f.pending[:i]); err != nil {
+		return false, err
+	}
+	f.pending = append(f.pending[:0], f.pending[i+1:]...)
+	return eof, nil
+}
+
+// flushPartial emits an incomplete last line.
+func (f *follower) flushPartial() error {
+	if len(f.pending) == 0 {
+		return nil
+	}
+	data := f.pending
+	f.pending = f.pending[:0]
+	return f.send(data)
+}
+
+// send emits newline-separated data as one chunk of formatted lines.
+func (f *follower) send(data []byte) error {
+	var sb strings.Builder
+	for line := range bytes.SplitSeq(data, []byte("\n")) {
+		sb.WriteString(formatLine(line))
+		sb.WriteByte('\n')
+		f.count++
+	}
+	if err := f.output(protocol.TaskStreamStdout, sb.String()); err != nil {
+		return fmt.Errorf("failed to stream output: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package workspace
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+func TestParseLogTime(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	want := time.Date(2024, 3, 10, 8, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		line string
+		want time.Time
+	}{
+		{"rfc3339", "2024-03-10T08:30:15Z INFO started", want},
+		{"rfc3339 offset", "level=info ts=2024-03-10T16:30:15+08:00 msg=ok", want},
+		{"rfc3339 fraction", "2024-03-10T08:30:15.250Z x", want.Add(250 * time.Millisecond)},
+		{"space and comma", "2024-03-10 08:30:15,500+0000 ERROR x", want.Add(500 * time.Millisecond)},
+		{"nginx", `10.0.0.1 - - [10/Mar/2024:09:30:15 +0100] "GET / HTTP/1.1" 200 612`, want},
+		{"json string", `{"level":"info","ts":"2024-03-10T08:30:15Z","msg":"ok"}`, want},
+		{"json seconds", fmt.Sprintf(`{"ts":%d.5,"msg":"ok"}`, want.Unix()), want.Add(500 * time.Millisecond)},
+		{"json millis", fmt.Sprintf(`{"msg":"ok","timestamp":%d}`, want.UnixMilli()), want},
+		{"json at timestamp", `{"@timestamp":"2024-03-10T08:30:15Z"}`, want},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseLogTime(tt.line, now)
+			require.True(t, ok)
+			assert.True(t, tt.want.Equal(got), "got %s", got)
+		})
+	}
+
+	t.Run("syslog", func(t *testing.T) {
+		got, ok := parseLogTime("Mar 10 08:30:15 host sshd[1]: accepted", now)
+		require.True(t, ok)
+		assert.Equal(t, time.Date(2024, 3, 10, 8, 30, 15, 0, time.Local), got)
+
+		// A date after now belongs to the previous year
+		got, ok = parseLogTime("Dec 31 23:59:59 host cron[1]: run", now)
+		require.True(t, ok)
+		assert.Equal(t, 2023, got.Year())
+	})
+
+	t.Run("no timestamp", func(t *testing.T) {
+		_, ok := parseLogTime("\tat main.go:12", now)
+		assert.False(t, ok)
+	})
+}
+
+func TestReverseLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		n       int
+		want    []string
+	}{
+		{"empty", "", 3, nil},
+		{"fewer lines than requested", "a\nb\n", 5, []string{"a", "b"}},
+		{"last lines", "a\nb\nc\nd\n", 2, []string{"c", "d"}},
+		{"no final newline", "a\nb\nc", 2, []string{"b", "c"}},
+		{"empty lines", "a\n\nb\n\n", 3, []string{"", "b", ""}},
+		{"crlf", "a\r\nb\r\n", 5, []string{"a", "b"}},
+		{"lines span blocks", "alpha\nbravo\ncharlie\n", 3, []string{"alpha", "bravo", "charlie"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A tiny block size exercises lines crossing block boundaries
+			for _, blockSize := range []int{1, 3, 4096} {
+				r := strings.NewReader(tt.content)
+				got, err := reverseLines(r, int64(len(tt.content)), tt.n, blockSize)
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, got, "block size %d", blockSize)
+			}
+		})
+	}
+}
+
+// writeGzip writes content to a gzip compressed file.
+func writeGzip(t *testing.T, path, content string) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+}
+
+// newRotatedLogs writes app.log with two rotated siblings, one per hour from 08:00 UTC.
+func newRotatedLogs(t *testing.T) *Workspace {
+	ws := newTestWorkspace(t)
+	dir := filepath.Join(ws.Root(), "logs")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+
+	base := time.Date(2024, 3, 10, 8, 0, 0, 0, time.UTC)
+	files := []string{"app.log.2.gz", "app.log.1", "app.log"}
+	for i, name := range files {
+		hour := base.Add(time.Duration(i) * time.Hour)
+		var sb strings.Builder
+		for m := 0; m < 60; m += 20 {
+			fmt.Fprintf(&sb, "%s line %d:%02d\n", hour.Add(time.Duration(m)*time.Minute).Format(time.RFC3339), 8+i, m)
+		}
+		if i == 1 {
+			sb.WriteString("\tat stack trace\n")
+		}
+
+		path := filepath.Join(dir, name)
+		if strings.HasSuffix(name, ".gz") {
+			writeGzip(t, path, sb.String())
+		} else {
+			require.NoError(t, os.WriteFile(path, []byte(sb.String()), 0o644))
+		}
+		modTime := hour.Add(time.Hour)
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.log.lock"), []byte("not a log\n"), 0o644))
+	return ws
+}
+
+func TestWorkspace_Tail(t *testing.T) {
+	ws := newRotatedLogs(t)
+	ctx := context.Background()
+
+	t.Run("last lines", func(t *testing.T) {
+		res, err := ws.Tail(ctx, &protocol.TailArgs{Path: "logs/app.log", Lines: 2}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "2024-03-10T10:20:00Z line 10:20\n2024-03-10T10:40:00Z line 10:40\n", res.Content)
+		assert.Equal(t, 2, res.Lines)
+		assert.Equal(t, []string{"logs/app.log"}, res.Files)
+	})
+
+	t.Run("rotated siblings fill up the lines", func(t *testing.T) {
+		res, err := ws.Tail(ctx, &protocol.TailArgs{Path: "logs/app.log", Lines: 8, IncludeRotated: true}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"logs/app.log.2.gz", "logs/app.log.1", "logs/app.log"}, res.Files)
+		lines := strings.Split(strings.TrimSuffix(res.Content, "\n"), "\n")
+		require.Len(t, lines, 8)
+		assert.Equal(t, "2024-03-10T08:40:00Z line 8:40", lines[0])
+		assert.Equal(t, "\tat stack trace", lines[4])
+	})
+
+	t.Run("time window", func(t *testing.T) {
+		res, err := ws.Tail(ctx, &protocol.TailArgs{
+			Path:           "logs/app.log",
+			Since:          "2024-03-10T09:20:00Z",
+			Until:          "2024-03-10T10:00:00Z",
+			IncludeRotated: true,
+		}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "2024-03-10T09:20:00Z line 9:20\n"+
+			"2024-03-10T09:40:00Z line 9:40\n"+
+			"\tat stack trace\n"+
+			"2024-03-10T10:00:00Z line 10:00\n", res.Content)
+		// The gzip sibling ends before the window and is skipped
+		assert.Equal(t, []string{"logs/app.log.1", "logs/app.log"}, res.Files)
+	})
+
+	t.Run("time window keeps the latest lines", func(t *testing.T) {
+		res, err := ws.Tail(ctx, &protocol.TailArgs{
+			Path:           "logs/app.log",
+			Lines:          2,
+			Since:          "2024-03-10T08:00:00Z",
+			IncludeRotated: true,
+		}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "2024-03-10T10:20:00Z line 10:20\n2024-03-10T10:40:00Z line 10:40\n", res.Content)
+		assert.Equal(t, 8, res.Omitted)
+		assert.Len(t, res.Files, 3)
+	})
+
+	t.Run("compressed file", func(t *testing.T) {
+		res, err := ws.Tail(ctx, &protocol.TailArgs{Path: "logs/app.log.2.gz", Lines: 1}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "2024-03-10T08:40:00Z line 8:40\n", res.Content)
+
+		_, err = ws.Tail(ctx, &protocol.TailArgs{Path: "logs/app.log.2.gz", Follow: true}, func(string, string) error { return nil })
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid args", func(t *testing.T) {
+		_, err := ws.Tail(ctx, &protocol.TailArgs{Path: "logs"}, nil)
+		assert.Error(t, err)
+
+		_, err = ws.Tail(ctx, &protocol.TailArgs{Path: "logs/app.log", Since: "yesterday"}, nil)
+		assert.Error(t, err)
+
+		_, err = ws.Tail(ctx, &protocol.TailArgs{Path: "logs/app.log", Since: "1h", Until: "2h"}, nil)
+		assert.Error(t, err)
+
+		_, err = ws.Tail(ctx, &protocol.TailArgs{Path: "../app.log"}, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestWorkspace_Tail_Mount(t *testing.T) {
+	ws := newTestWorkspace(t)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "syslog"), []byte("one\ntwo\n"), 0o644))
+	require.NoError(t, ws.SetMounts(map[string]string{"logs": dir}))
+
+	res, err := ws.Tail(context.Background(), &protocol.TailArgs{Path: "logs:syslog", Lines: 1}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "two\n", res.Content)
+	assert.Equal(t, []string{"logs:syslog"}, res.Files)
+}
+
+func TestWorkspace_Tail_Follow(t *testing.T) {
+	ws := newTestWorkspace(t)
+	path := filepath.Join(ws.Root(), "app.log")
+	require.NoError(t, os.WriteFile(path, []byte("old\n"), 0o644))
+
+	var mu sync.Mutex
+	var streamed strings.Builder
+	output := func(stream, data string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, protocol.TaskStreamStdout, stream)
+		streamed.WriteString(data)
+		return nil
+	}
+
+	go func() {
+		time.Sleep(2 * followPollInterval)
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		_, _ = f.WriteString("new 1\nnew 2\npart")
+		_ = f.Close()
+	}()
+
+	res, err := ws.Tail(context.Background(), &protocol.TailArgs{Path: "app.log", Follow: true, FollowSeconds: 1}, output)
+	require.NoError(t, err)
+	assert.Equal(t, "old\n", res.Content)
+	assert.Equal(t, 3, res.Followed)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "new 1\nnew 2\npart\n", streamed.String())
+}
+
+func TestFollowFile_BoundedChunks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	line := strings.Repeat("x", 99) + "\n"
+	lines := 3 * maxFollowChunk / len(line)
+	long := strings.Repeat("y", 2*maxFollowChunk+10)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Repeat(line, lines)+long+"\n"), 0o644))
+
+	var chunks []string
+	output := func(_, data string) error {
+		chunks = append(chunks, data)
+		return nil
+	}
+	count, err := followFile(context.Background(), path, 0, followPollInterval, output)
+	require.NoError(t, err)
+
+	// A line longer than a chunk is emitted in pieces
+	assert.Equal(t, lines+3, count)
+	assert.Greater(t, len(chunks), 3)
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, strings.Count(chunk, "\n"), maxFollowChunk/len(line)+1)
+	}
+	assert.Equal(t, "y", chunks[len(chunks)-1][:1])
+}
+
+func TestWorkspace_Tail_FollowCanceled(t *testing.T) {
+	ws := newTestWorkspace(t)
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root(), "app.log"), []byte("old\n"), 0o644))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*followPollInterval)
+	defer cancel()
+
+	_, err := ws.Tail(ctx, &protocol.TailArgs{Path: "app.log", Follow: true, FollowSeconds: 60}, func(string, string) error { return nil })
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
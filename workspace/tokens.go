@@ -0,0 +1,144 @@
+package workspace
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// runeClass groups runes that a BPE tokenizer tends to merge into tokens at
+// a similar rate.
+type runeClass int
+
+const (
+	classNone        runeClass = iota
+	classSpace                 // Whitespace other than line breaks
+	classNewline               // Line breaks
+	classLetter                // ASCII letters
+	classDigit                 // ASCII digits
+	classPunct                 // ASCII punctuation and symbols
+	classLatin                 // Non-ASCII letters of alphabetic scripts: accented Latin, Cyrillic, Greek, Arabic...
+	classIdeographic           // Han, kana, Hangul and non-ASCII punctuation: about one token per character
+	classOther                 // Emoji, other symbols and control characters
+)
+
+func classify(r rune) runeClass {
+	switch {
+	case r < utf8.RuneSelf:
+		switch {
+		case r == '\n' || r == '\r':
+			return classNewline
+		case r == ' ' || r == '\t' || r == '\v' || r == '\f':
+			return classSpace
+		case 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z':
+			return classLetter
+		case '0' <= r && r <= '9':
+			return classDigit
+		case r < 0x20 || r == 0x7f:
+			return classOther
+		default:
+			return classPunct
+		}
+	case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) || unicode.IsPunct(r):
+		return classIdeographic
+	case unicode.IsSpace(r):
+		return classSpace
+	case unicode.IsLetter(r) || unicode.IsMark(r):
+		return classLatin
+	case unicode.IsDigit(r):
+		return classDigit
+	default:
+		return classOther
+	}
+}
+
+// EstimateTokens approximates the number of tokens an LLM tokenizer produces
+// for s. Rather than assuming a fixed number of characters per token, it
+// splits s into runs of the same kind of character: English words are
+// usually one token, digits are grouped in threes, mixed identifiers such as
+// hashes split often, punctuation in JSON merges in pairs, a single space
+// joins the following word, line breaks cost a token, and CJK text costs about one token per character.
+func EstimateTokens(s string) int {
+	tokens := 0
+	class, runLen := classNone, 0
+	alnum, mixed := 0, false // Length of the current word and whether it mixes letters and digits
+
+	flush := func() {
+		tokens += runTokens(class, runLen)
+		class, runLen = classNone, 0
+	}
+	endWord := func() {
+		if alnum == 0 {
+			return
+		}
+		if mixed {
+			// Hashes, IDs and versions split into short pieces
+			tokens += (alnum + 1) / 2
+		} else {
+			tokens += runTokens(class, runLen)
+		}
+		class, runLen, alnum, mixed = classNone, 0, 0, false
+	}
+
+	for _, r := range s {
+		c := classify(r)
+		if (c == classLetter || c == classDigit) && (class == classLetter || class == classDigit) {
+			if c != class {
+				mixed = true
+			}
+			alnum++
+			runLen++
+			class = c
+			continue
+		}
+		if class == classLetter || class == classDigit {
+			endWord()
+		}
+		if c == class && c != classIdeographic && c != classOther {
+			runLen++
+			continue
+		}
+		flush()
+		class, runLen = c, 1
+		if c == classLetter || c == classDigit {
+			alnum = 1
+		}
+	}
+	if class == classLetter || class == classDigit {
+		endWord()
+	} else {
+		flush()
+	}
+	return tokens
+}
+
+// runTokens estimates the tokens of n runes of one class.
+func runTokens(class runeClass, n int) int {
+	if n == 0 {
+		return 0
+	}
+	switch class {
+	case classSpace:
+		// A single space is part of the next token; longer runs such as
+		// indentation merge into few tokens
+		if n == 1 {
+			return 0
+		}
+		return 1 + (n-1)/8
+	case classNewline:
+		// Blank lines merge with the line break before them
+		return 1 + (n-1)/4
+	case classLetter:
+		return (n + 5) / 6
+	case classDigit:
+		return (n + 2) / 3
+	case classPunct:
+		return (n + 1) / 2
+	case classLatin:
+		return (n + 2) / 3
+	case classOther:
+		return 2 * n
+	default:
+		return n
+	}
+}
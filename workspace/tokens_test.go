@@ -0,0 +1,42 @@
+package workspace
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	for text, tokens := range map[string]int{
+		"":                     0,
+		"hello world":          2,
+		"internationalization": 4,
+		"12345678":             3,
+		"a1b2c3d4":             4,
+		`{"a": 1}`:             5,
+		"   ":                  1,
+		"数据库连接失败":              7,
+		"🔥":                    2,
+	} {
+		assert.Equal(t, tokens, EstimateTokens(text), "%q", text)
+	}
+}
+
+func TestEstimateTokens_Scripts(t *testing.T) {
+	english := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 100)
+	chinese := strings.Repeat("服务器磁盘空间不足，请清理日志文件。", 100)
+	json := strings.Repeat(`{"id":"9f8e7d6c","status":"ok","latency_ms":12},`, 100)
+
+	// English prose is about four characters per token
+	ratio := float64(len(english)) / float64(EstimateTokens(english))
+	assert.InDelta(t, 4.5, ratio, 1)
+
+	// CJK text is about one token per character, far more than bytes/4
+	runes := len([]rune(chinese))
+	assert.InDelta(t, runes, EstimateTokens(chinese), float64(runes)/5)
+	assert.Greater(t, EstimateTokens(chinese), len(chinese)/4)
+
+	// JSON takes more tokens per character than prose
+	assert.Greater(t, EstimateTokens(json)*len(english), EstimateTokens(english)*len(json))
+}
@@ -0,0 +1,375 @@
+package workspace
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const (
+	// UploadsDir is the directory where uploads are staged until committed
+	UploadsDir = ".work/uploads"
+	// DefaultChunkSize is the transfer chunk size when not specified
+	DefaultChunkSize = 1024 * 1024
+	// MaxChunkSize caps the transfer chunk size so a chunk fits in one message
+	MaxChunkSize = 8 * 1024 * 1024
+
+	uploadStateFile = "upload.json"
+	uploadDataFile  = "data"
+)
+
+var (
+	uploadIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+	sha256Pattern   = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+)
+
+// uploadState is the persisted state of an upload, so it survives reconnects and restarts.
+type uploadState struct {
+	Path      string    `json:"path"` // Workspace-relative target path
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	ChunkSize int       `json:"chunk_size"`
+	Received  []int     `json:"received"` // Sorted indexes of received chunks
+	Created   time.Time `json:"created"`
+}
+
+func (s *uploadState) chunks() int {
+	return chunkCount(s.Size, s.ChunkSize)
+}
+
+// chunkCount returns the number of chunks of chunkSize needed for size bytes.
+func chunkCount(size int64, chunkSize int) int {
+	return int((size + int64(chunkSize) - 1) / int64(chunkSize))
+}
+
+// chunkLen returns the length of chunk index; only the last chunk is shorter.
+func chunkLen(size int64, chunkSize, index int) int {
+	return int(min(int64(chunkSize), size-int64(index)*int64(chunkSize)))
+}
+
+// resolveChunkSize applies the default and maximum chunk size.
+func resolveChunkSize(n int) int {
+	if n <= 0 {
+		return DefaultChunkSize
+	}
+	return min(n, MaxChunkSize)
+}
+
+// UploadBegin starts an upload or, when the same file is already being
+// uploaded to the same path, returns the chunks received so far.
+func (w *Workspace) UploadBegin(ctx context.Context, args *protocol.UploadBeginArgs) (*protocol.UploadBeginResult, error) {
+	if args.Size < 0 {
+		return nil, fmt.Errorf("invalid size: %d", args.Size)
+	}
+	if !sha256Pattern.MatchString(args.SHA256) {
+		return nil, fmt.Errorf("sha256 must be 64 hex characters")
+	}
+
+	realPath, err := w.safePath(args.Path)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := w.relPath(realPath)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkSize := resolveChunkSize(args.ChunkSize)
+	hash := strings.ToLower(args.SHA256)
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s\x00%d\x00%s\x00%d", rel, args.Size, hash, chunkSize))
+	id := hex.EncodeToString(sum[:16])
+
+	w.uploadMu.Lock()
+	defer w.uploadMu.Unlock()
+
+	dir := w.uploadDir(id)
+	state, err := loadUploadState(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := w.disk.reserve("upload", args.Path, args.Size); err != nil {
+			return nil, err
+		}
+		state = &uploadState{
+			Path:      rel,
+			Size:      args.Size,
+			SHA256:    hash,
+			ChunkSize: chunkSize,
+			Received:  []int{},
+			Created:   time.Now(),
+		}
+		err = createUpload(dir, state)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &protocol.UploadBeginResult{
+		UploadID:  id,
+		ChunkSize: state.ChunkSize,
+		Chunks:    state.chunks(),
+		Received:  slices.Clone(state.Received),
+	}, nil
+}
+
+// UploadChunk verifies a chunk against its hash and stores it. Chunks may
+// arrive in any order and may be sent again.
+func (w *Workspace) UploadChunk(ctx context.Context, args *protocol.UploadChunkArgs, output OutputFunc) (*protocol.UploadChunkResult, error) {
+	data, err := base64.StdEncoding.DecodeString(args.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode chunk: %w", err)
+	}
+	if got := hashContent(data); !strings.EqualFold(got, args.SHA256) {
+		return nil, fmt.Errorf("chunk %d checksum mismatch: expected sha256 %s, got %s", args.Index, args.SHA256, got)
+	}
+
+	dir, err := w.existingUploadDir(args.UploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	w.uploadMu.Lock()
+	defer w.uploadMu.Unlock()
+
+	state, err := loadUploadState(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unknown upload %s: %w", args.UploadID, err)
+	}
+
+	chunks := state.chunks()
+	if args.Index < 0 || args.Index >= chunks {
+		return nil, fmt.Errorf("chunk index %d out of range: upload has %d chunks", args.Index, chunks)
+	}
+	if want := chunkLen(state.Size, state.ChunkSize, args.Index); len(data) != want {
+		return nil, fmt.Errorf("chunk %d has %d bytes, expected %d", args.Index, len(data), want)
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, uploadDataFile), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload data: %w", err)
+	}
+	_, err = file.WriteAt(data, int64(args.Index)*int64(state.ChunkSize))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write chunk: %w", err)
+	}
+
+	if i, found := slices.BinarySearch(state.Received, args.Index); !found {
+		state.Received = slices.Insert(state.Received, i, args.Index)
+		if err := saveUploadState(dir, state); err != nil {
+			return nil, err
+		}
+	}
+
+	received := len(state.Received)
+	reportProgress(output, "received %d/%d chunks (%d%%)", received, chunks, received*100/chunks)
+	return &protocol.UploadChunkResult{Received: received, Chunks: chunks}, nil
+}
+
+// UploadCommit verifies the whole-file hash of a complete upload and moves
+// the file into place, replacing any existing file.
+func (w *Workspace) UploadCommit(ctx context.Context, args *protocol.UploadCommitArgs, output OutputFunc) (*protocol.UploadCommitResult, error) {
+	dir, err := w.existingUploadDir(args.UploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	w.uploadMu.Lock()
+	defer w.uploadMu.Unlock()
+
+	state, err := loadUploadState(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unknown upload %s: %w", args.UploadID, err)
+	}
+	if chunks := state.chunks(); len(state.Received) < chunks {
+		return nil, fmt.Errorf("upload incomplete: %d of %d chunks received", len(state.Received), chunks)
+	}
+
+	reportProgress(output, "verifying %d bytes", state.Size)
+	dataPath := filepath.Join(dir, uploadDataFile)
+	hash, err := hashFile(dataPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash upload: %w", err)
+	}
+	if hash != state.SHA256 {
+		// Some chunk was written wrongly; start over rather than keep bad data
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("file checksum mismatch: expected sha256 %s, got %s; upload discarded", state.SHA256, hash)
+	}
+
+	realPath, err := w.safePath(state.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(realPath), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	w.writeMu.Lock()
+	backupErr := w.backup(realPath, "upload")
+	err = installFile(dataPath, realPath, 0o644)
+	w.writeMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	_ = os.RemoveAll(dir)
+	return &protocol.UploadCommitResult{Path: state.Path, Size: state.Size, SHA256: hash, BackupError: backupErr}, nil
+}
+
+// Download streams a file as chunks on the chunk stream of output, starting
+// at StartChunk, and returns the hash of the whole file.
+func (w *Workspace) Download(ctx context.Context, args *protocol.DownloadArgs, output OutputFunc) (*protocol.DownloadResult, error) {
+	if output == nil {
+		return nil, fmt.Errorf("download is not supported without an output stream")
+	}
+
+	loc, err := w.resolveRead(args.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(loc.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("cannot download a directory: %s", args.Path)
+	}
+
+	size := info.Size()
+	chunkSize := resolveChunkSize(args.ChunkSize)
+	chunks := chunkCount(size, chunkSize)
+	if args.StartChunk < 0 || args.StartChunk > chunks {
+		return nil, fmt.Errorf("start chunk %d out of range: file has %d chunks", args.StartChunk, chunks)
+	}
+
+	// Hash the part sent by an earlier attempt so the file is read only once
+	h := sha256.New()
+	if _, err := io.CopyN(h, file, int64(args.StartChunk)*int64(chunkSize)); err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	result := &protocol.DownloadResult{Size: size, ChunkSize: chunkSize, Chunks: chunks}
+	buf := make([]byte, chunkSize)
+	nextReport := 10
+	for i := args.StartChunk; i < chunks; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		data := buf[:chunkLen(size, chunkSize, i)]
+		if _, err := io.ReadFull(file, data); err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		h.Write(data)
+
+		chunk, err := json.Marshal(protocol.DownloadChunk{
+			Index:  i,
+			Offset: int64(i) * int64(chunkSize),
+			Data:   base64.StdEncoding.EncodeToString(data),
+			SHA256: hashContent(data),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode chunk: %w", err)
+		}
+		if err := output(protocol.TaskStreamChunk, string(chunk)); err != nil {
+			return nil, fmt.Errorf("failed to send chunk %d: %w", i, err)
+		}
+		result.Sent++
+
+		if percent := (i + 1) * 100 / chunks; percent >= nextReport {
+			reportProgress(output, "sent %d/%d chunks (%d%%)", i+1, chunks, percent)
+			nextReport = percent/10*10 + 10
+		}
+	}
+
+	// A file written to during the download has no consistent hash
+	if after, err := os.Stat(loc.path); err != nil || after.Size() != size || !after.ModTime().Equal(info.ModTime()) {
+		return nil, fmt.Errorf("file changed during download: %s", args.Path)
+	}
+
+	result.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return result, nil
+}
+
+// reportProgress sends a progress message. Progress is informational, so
+// delivery failures are ignored.
+func reportProgress(output OutputFunc, format string, args ...any) {
+	if output != nil {
+		_ = output(protocol.TaskStreamProgress, fmt.Sprintf(format, args...))
+	}
+}
+
+func (w *Workspace) uploadDir(id string) string {
+	return filepath.Join(w.root, UploadsDir, id)
+}
+
+// existingUploadDir validates an upload ID and returns its staging directory.
+func (w *Workspace) existingUploadDir(id string) (string, error) {
+	if !uploadIDPattern.MatchString(id) {
+		return "", fmt.Errorf("invalid upload id: %q", id)
+	}
+	return w.uploadDir(id), nil
+}
+
+// createUpload creates the staging directory and a data file of the final size.
+func createUpload(dir string, state *uploadState) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, uploadDataFile), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create upload data: %w", err)
+	}
+	err = file.Truncate(state.Size)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create upload data: %w", err)
+	}
+	return saveUploadState(dir, state)
+}
+
+func loadUploadState(dir string) (*uploadState, error) {
+	data, err := os.ReadFile(filepath.Join(dir, uploadStateFile))
+	if err != nil {
+		return nil, err
+	}
+	var state uploadState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse upload state: %w", err)
+	}
+	return &state, nil
+}
+
+func saveUploadState(dir string, state *uploadState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload state: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(dir, uploadStateFile), data, 0o600)
+}
@@ -0,0 +1,233 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// transferData returns deterministic test content of n bytes.
+func transferData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func uploadChunkArgs(id string, data []byte, index, chunkSize int) *protocol.UploadChunkArgs {
+	chunk := data[index*chunkSize : min((index+1)*chunkSize, len(data))]
+	return &protocol.UploadChunkArgs{
+		UploadID: id,
+		Index:    index,
+		Data:     base64.StdEncoding.EncodeToString(chunk),
+		SHA256:   hashContent(chunk),
+	}
+}
+
+func TestWorkspace_Upload(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+	data := transferData(10000)
+	begin := &protocol.UploadBeginArgs{Path: "dumps/core.bin", Size: int64(len(data)), SHA256: hashContent(data), ChunkSize: 4096}
+
+	res, err := ws.UploadBegin(ctx, begin)
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.Chunks)
+	assert.Equal(t, 4096, res.ChunkSize)
+	assert.Empty(t, res.Received)
+
+	var progress []string
+	output := func(stream, data string) error {
+		assert.Equal(t, protocol.TaskStreamProgress, stream)
+		progress = append(progress, data)
+		return nil
+	}
+
+	// Chunks in any order
+	chunk, err := ws.UploadChunk(ctx, uploadChunkArgs(res.UploadID, data, 2, 4096), output)
+	require.NoError(t, err)
+	assert.Equal(t, 1, chunk.Received)
+	_, err = ws.UploadChunk(ctx, uploadChunkArgs(res.UploadID, data, 0, 4096), output)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"received 1/3 chunks (33%)", "received 2/3 chunks (66%)"}, progress)
+
+	_, err = ws.UploadCommit(ctx, &protocol.UploadCommitArgs{UploadID: res.UploadID}, nil)
+	assert.ErrorContains(t, err, "2 of 3 chunks")
+
+	// Beginning again after a reconnect resumes the upload
+	resumed, err := ws.UploadBegin(ctx, begin)
+	require.NoError(t, err)
+	assert.Equal(t, res.UploadID, resumed.UploadID)
+	assert.Equal(t, []int{0, 2}, resumed.Received)
+
+	_, err = ws.UploadChunk(ctx, uploadChunkArgs(res.UploadID, data, 1, 4096), nil)
+	require.NoError(t, err)
+
+	commit, err := ws.UploadCommit(ctx, &protocol.UploadCommitArgs{UploadID: res.UploadID}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "dumps/core.bin", commit.Path)
+	assert.Equal(t, hashContent(data), commit.SHA256)
+
+	got, err := os.ReadFile(filepath.Join(ws.Root(), "dumps", "core.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	// The staging directory is gone
+	_, err = os.Stat(ws.uploadDir(res.UploadID))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWorkspace_Upload_Errors(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+	data := transferData(100)
+
+	_, err := ws.UploadBegin(ctx, &protocol.UploadBeginArgs{Path: "a.bin", Size: 100, SHA256: "abc"})
+	assert.Error(t, err)
+	_, err = ws.UploadBegin(ctx, &protocol.UploadBeginArgs{Path: "../a.bin", Size: 100, SHA256: hashContent(data)})
+	assert.Error(t, err)
+	_, err = ws.UploadBegin(ctx, &protocol.UploadBeginArgs{Path: ".work/a.bin", Size: 100, SHA256: hashContent(data)})
+	assert.Error(t, err)
+
+	_, err = ws.UploadChunk(ctx, &protocol.UploadChunkArgs{UploadID: "../../etc", Data: "", SHA256: hashContent(nil)}, nil)
+	assert.ErrorContains(t, err, "invalid upload id")
+
+	// The whole-file hash does not match the chunks
+	res, err := ws.UploadBegin(ctx, &protocol.UploadBeginArgs{Path: "a.bin", Size: 100, SHA256: hashContent([]byte("other")), ChunkSize: 60})
+	require.NoError(t, err)
+
+	bad := uploadChunkArgs(res.UploadID, data, 0, 60)
+	bad.SHA256 = hashContent([]byte("wrong"))
+	_, err = ws.UploadChunk(ctx, bad, nil)
+	assert.ErrorContains(t, err, "checksum mismatch")
+
+	short := uploadChunkArgs(res.UploadID, data, 0, 50)
+	_, err = ws.UploadChunk(ctx, short, nil)
+	assert.ErrorContains(t, err, "expected 60")
+
+	outOfRange := uploadChunkArgs(res.UploadID, data, 1, 60)
+	outOfRange.Index = 2
+	_, err = ws.UploadChunk(ctx, outOfRange, nil)
+	assert.ErrorContains(t, err, "out of range")
+
+	for i := range 2 {
+		_, err = ws.UploadChunk(ctx, uploadChunkArgs(res.UploadID, data, i, 60), nil)
+		require.NoError(t, err)
+	}
+	_, err = ws.UploadCommit(ctx, &protocol.UploadCommitArgs{UploadID: res.UploadID}, nil)
+	assert.ErrorContains(t, err, "upload discarded")
+	_, err = os.Stat(filepath.Join(ws.Root(), "a.bin"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWorkspace_Upload_Empty(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+
+	res, err := ws.UploadBegin(ctx, &protocol.UploadBeginArgs{Path: "empty", SHA256: hashContent(nil)})
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Chunks)
+
+	_, err = ws.UploadCommit(ctx, &protocol.UploadCommitArgs{UploadID: res.UploadID}, nil)
+	require.NoError(t, err)
+	info, err := os.Stat(filepath.Join(ws.Root(), "empty"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size())
+}
+
+func TestWorkspace_Upload_BackupError(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+	// A file over the read limit is replaced without a backup
+	path := filepath.Join(ws.Root(), "core.bin")
+	require.NoError(t, os.WriteFile(path, nil, 0o644))
+	require.NoError(t, os.Truncate(path, DefaultMaxReadSize+1))
+
+	res, err := ws.UploadBegin(ctx, &protocol.UploadBeginArgs{Path: "core.bin", SHA256: hashContent(nil)})
+	require.NoError(t, err)
+	commit, err := ws.UploadCommit(ctx, &protocol.UploadCommitArgs{UploadID: res.UploadID}, nil)
+	require.NoError(t, err)
+	assert.Contains(t, commit.BackupError, "too large to back up")
+}
+
+// downloadAll runs a download and reassembles the streamed chunks.
+func downloadAll(t *testing.T, ws *Workspace, args *protocol.DownloadArgs) (*protocol.DownloadResult, []protocol.DownloadChunk, []string) {
+	t.Helper()
+	var chunks []protocol.DownloadChunk
+	var progress []string
+	res, err := ws.Download(context.Background(), args, func(stream, data string) error {
+		switch stream {
+		case protocol.TaskStreamChunk:
+			var chunk protocol.DownloadChunk
+			require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+			chunks = append(chunks, chunk)
+		case protocol.TaskStreamProgress:
+			progress = append(progress, data)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	return res, chunks, progress
+}
+
+func TestWorkspace_Download(t *testing.T) {
+	ws := newTestWorkspace(t)
+	data := transferData(10000)
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root(), "heap.pprof"), data, 0o644))
+
+	res, chunks, progress := downloadAll(t, ws, &protocol.DownloadArgs{Path: "heap.pprof", ChunkSize: 4096})
+	assert.Equal(t, int64(10000), res.Size)
+	assert.Equal(t, 3, res.Chunks)
+	assert.Equal(t, 3, res.Sent)
+	assert.Equal(t, hashContent(data), res.SHA256)
+	assert.Equal(t, []string{"sent 1/3 chunks (33%)", "sent 2/3 chunks (66%)", "sent 3/3 chunks (100%)"}, progress)
+
+	var buf bytes.Buffer
+	for i, chunk := range chunks {
+		assert.Equal(t, i, chunk.Index)
+		assert.Equal(t, int64(i*4096), chunk.Offset)
+		decoded, err := base64.StdEncoding.DecodeString(chunk.Data)
+		require.NoError(t, err)
+		assert.Equal(t, chunk.SHA256, hashContent(decoded))
+		buf.Write(decoded)
+	}
+	assert.Equal(t, data, buf.Bytes())
+
+	// Resuming sends only the remaining chunks but still hashes the whole file
+	res, chunks, _ = downloadAll(t, ws, &protocol.DownloadArgs{Path: "heap.pprof", ChunkSize: 4096, StartChunk: 2})
+	assert.Equal(t, 1, res.Sent)
+	require.Len(t, chunks, 1)
+	assert.Equal(t, 2, chunks[0].Index)
+	assert.Equal(t, hashContent(data), res.SHA256)
+}
+
+func TestWorkspace_Download_Errors(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root(), "a.bin"), transferData(10), 0o644))
+	discard := func(string, string) error { return nil }
+
+	_, err := ws.Download(ctx, &protocol.DownloadArgs{Path: "."}, discard)
+	assert.Error(t, err)
+
+	_, err = ws.Download(ctx, &protocol.DownloadArgs{Path: "a.bin", StartChunk: 2}, discard)
+	assert.Error(t, err)
+
+	_, err = ws.Download(ctx, &protocol.DownloadArgs{Path: "a.bin"}, nil)
+	assert.Error(t, err)
+
+	sendErr := errors.New("connection lost")
+	_, err = ws.Download(ctx, &protocol.DownloadArgs{Path: "a.bin"}, func(string, string) error { return sendErr })
+	assert.ErrorIs(t, err, sendErr)
+}
@@ -0,0 +1,450 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const (
+	// DefaultWatchSeconds is how long a watch runs when not specified
+	DefaultWatchSeconds = 60
+	// MaxWatchSeconds caps how long a watch runs
+	MaxWatchSeconds = 600
+	// DefaultWatchDebounce is how long a path must be quiet before its event is sent
+	DefaultWatchDebounce = 500 * time.Millisecond
+	// MaxWatchDebounce caps the debounce delay
+	MaxWatchDebounce = 10 * time.Second
+	// DefaultWatchEvents is the number of events after which a watch stops when not specified
+	DefaultWatchEvents = 1000
+	// MaxWatchEvents caps the events streamed by a single watch
+	MaxWatchEvents = 10000
+
+	// watchPollInterval is how often the polling backend rescans
+	watchPollInterval = time.Second
+	// maxPollEntries bounds the entries the polling backend tracks
+	maxPollEntries = 50000
+)
+
+// Watch backends
+const (
+	watchBackendInotify = "inotify"
+	watchBackendPoll    = "poll"
+)
+
+// watchTarget is a watched directory, or a single entry of it when a file is watched.
+type watchTarget struct {
+	loc  *location
+	dir  string
+	name string // Only this entry of dir is reported; empty for a directory
+}
+
+// watchSpec describes what a watcher backend monitors.
+type watchSpec struct {
+	targets   []*watchTarget
+	recursive bool
+	skip      string // Runner working directory, never reported
+}
+
+// skipped reports whether changes of path are not reported.
+func (s *watchSpec) skipped(path string) bool {
+	return isWithin(s.skip, path)
+}
+
+// rawEvent is a change reported by a watcher backend, before debouncing.
+// An event without target reports that the backend lost events.
+type rawEvent struct {
+	target *watchTarget
+	path   string
+	op     string
+	isDir  bool
+}
+
+// watcher is a backend that reports changes of a watchSpec.
+type watcher interface {
+	// run sends events until ctx is done or the backend fails.
+	run(ctx context.Context, events chan<- rawEvent) error
+}
+
+// Watch streams create, modify and delete events of the watched paths through
+// output until the watch duration elapses or MaxEvents is reached. Bursts of
+// changes to one path are debounced into a single event. On Linux inotify is
+// used, falling back to polling when it is unavailable.
+func (w *Workspace) Watch(ctx context.Context, args *protocol.WatchArgs, output OutputFunc) (*protocol.WatchResult, error) {
+	if output == nil {
+		return nil, fmt.Errorf("watch is not supported without an output stream")
+	}
+	if len(args.Paths) == 0 {
+		return nil, fmt.Errorf("no paths to watch")
+	}
+
+	seconds := args.Duration
+	if seconds <= 0 {
+		seconds = DefaultWatchSeconds
+	}
+	seconds = min(seconds, MaxWatchSeconds)
+
+	debounce := time.Duration(args.Debounce) * time.Millisecond
+	if debounce <= 0 {
+		debounce = DefaultWatchDebounce
+	}
+	debounce = min(debounce, MaxWatchDebounce)
+
+	maxEvents := args.MaxEvents
+	if maxEvents <= 0 {
+		maxEvents = DefaultWatchEvents
+	}
+	maxEvents = min(maxEvents, MaxWatchEvents)
+
+	spec := &watchSpec{recursive: args.Recursive, skip: filepath.Join(w.realRoot(), WorkDir)}
+	for _, path := range args.Paths {
+		target, err := w.watchTarget(path)
+		if err != nil {
+			return nil, err
+		}
+		spec.targets = append(spec.targets, target)
+	}
+
+	result := &protocol.WatchResult{}
+	var backend watcher
+	if !args.Poll {
+		var err error
+		if backend, err = newNotifyWatcher(spec); err != nil {
+			slog.Debug("inotify unavailable, polling for changes", "error", err)
+			backend = nil
+		} else {
+			result.Backend = watchBackendInotify
+		}
+	}
+	if backend == nil {
+		var err error
+		if backend, err = newPollWatcher(spec); err != nil {
+			return nil, err
+		}
+		result.Backend = watchBackendPoll
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	events := make(chan rawEvent, 256)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- backend.run(watchCtx, events)
+	}()
+	// The backend must be stopped before returning so no event is sent later
+	stop := func() error {
+		cancel()
+		return <-errc
+	}
+
+	timer := time.NewTimer(time.Duration(seconds) * time.Second)
+	defer timer.Stop()
+	ticker := time.NewTicker(max(debounce/4, 10*time.Millisecond))
+	defer ticker.Stop()
+
+	d := newDebouncer(debounce)
+	send := func(events []rawEvent) error {
+		for _, ev := range events {
+			if err := sendWatchEvent(ev, d.times[ev.path], output); err != nil {
+				return err
+			}
+			delete(d.times, ev.path)
+			result.Events++
+			if result.Events >= maxEvents {
+				result.Truncated = true
+				return nil
+			}
+		}
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			_ = stop()
+			return nil, ctx.Err()
+
+		case err := <-errc:
+			cancel()
+			if err != nil {
+				return nil, fmt.Errorf("watch failed: %w", err)
+			}
+			return result, nil
+
+		case ev := <-events:
+			if ev.target == nil {
+				result.Overflow = true
+				continue
+			}
+			if !spec.skipped(ev.path) {
+				d.add(ev, time.Now())
+			}
+
+		case <-ticker.C:
+			if err := send(d.ready(time.Now())); err != nil {
+				_ = stop()
+				return nil, err
+			}
+			if result.Truncated {
+				return result, stop()
+			}
+
+		case <-timer.C:
+			if err := stop(); err != nil {
+				return nil, fmt.Errorf("watch failed: %w", err)
+			}
+			// Bursts still settling when the watch ends are sent as they are
+			if err := send(d.flush()); err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+	}
+}
+
+// watchTarget resolves a watched path, which must exist.
+func (w *Workspace) watchTarget(path string) (*watchTarget, error) {
+	loc, err := w.resolveRead(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(loc.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat path: %w", err)
+	}
+	if info.IsDir() {
+		return &watchTarget{loc: loc, dir: loc.path}, nil
+	}
+	// Watching the directory sees a file replaced by rename as well
+	return &watchTarget{loc: loc, dir: filepath.Dir(loc.path), name: filepath.Base(loc.path)}, nil
+}
+
+// sendWatchEvent streams one event with the current size of the path.
+func sendWatchEvent(ev rawEvent, at time.Time, output OutputFunc) error {
+	event := protocol.WatchEvent{
+		Path:  ev.target.loc.display(ev.path),
+		Op:    ev.op,
+		IsDir: ev.isDir,
+		Time:  at,
+	}
+	if ev.op != protocol.WatchOpDelete {
+		if info, err := os.Lstat(ev.path); err == nil {
+			event.IsDir = info.IsDir()
+			if info.Mode().IsRegular() {
+				event.Size = info.Size()
+			}
+		}
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	return output(protocol.TaskStreamEvent, string(data))
+}
+
+// debouncer coalesces the events of each path until it has been quiet for delay.
+type debouncer struct {
+	delay   time.Duration
+	pending map[string]*rawEvent
+	times   map[string]time.Time // Time of the last change of each pending path
+}
+
+func newDebouncer(delay time.Duration) *debouncer {
+	return &debouncer{
+		delay:   delay,
+		pending: make(map[string]*rawEvent),
+		times:   make(map[string]time.Time),
+	}
+}
+
+// add records an event, merging it with a pending event of the same path.
+func (d *debouncer) add(ev rawEvent, now time.Time) {
+	d.times[ev.path] = now
+	p, ok := d.pending[ev.path]
+	if !ok {
+		d.pending[ev.path] = &ev
+		return
+	}
+
+	switch {
+	case p.op == protocol.WatchOpCreate && ev.op == protocol.WatchOpDelete:
+		// A temporary file that came and went
+		delete(d.pending, ev.path)
+		delete(d.times, ev.path)
+	case p.op == protocol.WatchOpCreate:
+		// Still a new file, however often it was written
+	case p.op == protocol.WatchOpDelete && ev.op == protocol.WatchOpCreate:
+		// Replaced, e.g. by an atomic rename
+		p.op = protocol.WatchOpModify
+		p.isDir = ev.isDir
+	default:
+		p.op = ev.op
+	}
+}
+
+// ready removes and returns the events of paths quiet for the debounce delay,
+// oldest first.
+func (d *debouncer) ready(now time.Time) []rawEvent {
+	var events []rawEvent
+	for path, ev := range d.pending {
+		if now.Sub(d.times[path]) >= d.delay {
+			events = append(events, *ev)
+			delete(d.pending, path)
+		}
+	}
+	d.sort(events)
+	return events
+}
+
+// flush removes and returns all pending events, oldest first.
+func (d *debouncer) flush() []rawEvent {
+	events := make([]rawEvent, 0, len(d.pending))
+	for path, ev := range d.pending {
+		events = append(events, *ev)
+		delete(d.pending, path)
+	}
+	d.sort(events)
+	return events
+}
+
+func (d *debouncer) sort(events []rawEvent) {
+	slices.SortFunc(events, func(a, b rawEvent) int {
+		if n := d.times[a.path].Compare(d.times[b.path]); n != 0 {
+			return n
+		}
+		return strings.Compare(a.path, b.path)
+	})
+}
+
+// fileState is what the polling backend compares between scans.
+type fileState struct {
+	target  *watchTarget
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+// pollWatcher detects changes by rescanning the watched paths.
+type pollWatcher struct {
+	spec     *watchSpec
+	interval time.Duration
+	state    map[string]fileState
+}
+
+// newPollWatcher takes the initial scan that later scans are compared with.
+func newPollWatcher(spec *watchSpec) (*pollWatcher, error) {
+	p := &pollWatcher{spec: spec, interval: watchPollInterval}
+	state, err := p.scan()
+	if err != nil {
+		return nil, err
+	}
+	p.state = state
+	return p, nil
+}
+
+func (p *pollWatcher) run(ctx context.Context, events chan<- rawEvent) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		state, err := p.scan()
+		if err != nil {
+			return err
+		}
+		for _, ev := range p.diff(state) {
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		p.state = state
+	}
+}
+
+// diff returns the changes from the previous scan to state, sorted by path.
+func (p *pollWatcher) diff(state map[string]fileState) []rawEvent {
+	var events []rawEvent
+	for path, cur := range state {
+		prev, ok := p.state[path]
+		switch {
+		case !ok:
+			events = append(events, rawEvent{target: cur.target, path: path, op: protocol.WatchOpCreate, isDir: cur.isDir})
+		case cur.isDir != prev.isDir || (!cur.isDir && (cur.size != prev.size || !cur.modTime.Equal(prev.modTime))):
+			events = append(events, rawEvent{target: cur.target, path: path, op: protocol.WatchOpModify, isDir: cur.isDir})
+		}
+	}
+	for path, prev := range p.state {
+		if _, ok := state[path]; !ok {
+			events = append(events, rawEvent{target: prev.target, path: path, op: protocol.WatchOpDelete, isDir: prev.isDir})
+		}
+	}
+	slices.SortFunc(events, func(a, b rawEvent) int {
+		return strings.Compare(a.path, b.path)
+	})
+	return events
+}
+
+// scan records the state of every watched entry.
+func (p *pollWatcher) scan() (map[string]fileState, error) {
+	state := make(map[string]fileState)
+	errFull := errors.New("too many entries")
+
+	for _, t := range p.spec.targets {
+		if t.name != "" {
+			path := filepath.Join(t.dir, t.name)
+			if info, err := os.Lstat(path); err == nil {
+				state[path] = fileState{target: t, size: info.Size(), modTime: info.ModTime(), isDir: info.IsDir()}
+			}
+			continue
+		}
+
+		err := filepath.WalkDir(t.dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// Removed while scanning, or the watched directory itself is gone
+				return nil
+			}
+			if path == t.dir {
+				return nil
+			}
+			if p.spec.skipped(path) {
+				return filepath.SkipDir
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			if len(state) >= maxPollEntries {
+				return errFull
+			}
+			state[path] = fileState{target: t, size: info.Size(), modTime: info.ModTime(), isDir: d.IsDir()}
+			if d.IsDir() && !p.spec.recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if errors.Is(err, errFull) {
+			return nil, fmt.Errorf("too many entries to poll, more than %d", maxPollEntries)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
@@ -0,0 +1,192 @@
+//go:build linux
+
+package workspace
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_ONLYDIR
+
+// inotifyWatch is a directory watched for a target.
+type inotifyWatch struct {
+	target *watchTarget
+	dir    string
+}
+
+// inotifyWatcher reports changes with inotify. Directories created below a
+// recursively watched directory are added as they appear.
+type inotifyWatcher struct {
+	spec    *watchSpec
+	fd      int
+	file    *os.File
+	watches map[int32][]inotifyWatch
+}
+
+func newNotifyWatcher(spec *watchSpec) (watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inotify: %w", err)
+	}
+	n := &inotifyWatcher{
+		spec:    spec,
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		watches: make(map[int32][]inotifyWatch),
+	}
+
+	for _, t := range spec.targets {
+		if err := n.addTree(t, t.dir, nil); err != nil {
+			// Usually the watch limit of the user is reached
+			_ = n.file.Close()
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// addTree watches dir and, for recursive watches, its subdirectories. When
+// found is set, it is called for every entry below dir, which may have been
+// created before the watch was in place.
+func (n *inotifyWatcher) addTree(t *watchTarget, dir string, found func(path string, isDir bool)) error {
+	if t.name != "" || !n.spec.recursive {
+		return n.add(t, dir)
+	}
+
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Removed while walking
+			return nil
+		}
+		if n.spec.skipped(path) {
+			return filepath.SkipDir
+		}
+		if path != dir && found != nil {
+			found(path, d.IsDir())
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if err := n.add(t, path); err != nil && !errors.Is(err, syscall.ENOENT) {
+			return err
+		}
+		return nil
+	})
+}
+
+func (n *inotifyWatcher) add(t *watchTarget, dir string) error {
+	wd, err := syscall.InotifyAddWatch(n.fd, dir, inotifyMask)
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+	n.watches[int32(wd)] = append(n.watches[int32(wd)], inotifyWatch{target: t, dir: dir})
+	return nil
+}
+
+func (n *inotifyWatcher) run(ctx context.Context, events chan<- rawEvent) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		// Unblocks the read below
+		_ = n.file.Close()
+	}()
+
+	send := func(ev rawEvent) bool {
+		select {
+		case events <- ev:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	buf := make([]byte, 64*1024)
+	for {
+		size, err := n.file.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to read inotify events: %w", err)
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= size; {
+			wd := int32(binary.NativeEndian.Uint32(buf[offset:]))
+			mask := binary.NativeEndian.Uint32(buf[offset+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+			start := offset + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[start:min(start+nameLen, size)]), "\x00")
+			offset = start + nameLen
+
+			for _, ev := range n.handle(wd, mask, name) {
+				if !send(ev) {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// handle converts one inotify event into raw events.
+func (n *inotifyWatcher) handle(wd int32, mask uint32, name string) []rawEvent {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		return []rawEvent{{}}
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(n.watches, wd)
+		return nil
+	}
+
+	isDir := mask&syscall.IN_ISDIR != 0
+	var events []rawEvent
+	for _, watch := range n.watches[wd] {
+		t := watch.target
+		if name == "" {
+			// Only the removal of a watched directory itself is reported
+			// here; subdirectories are reported by their parent
+			if mask&syscall.IN_DELETE_SELF != 0 && t.name == "" && watch.dir == t.dir {
+				events = append(events, rawEvent{target: t, path: t.dir, op: protocol.WatchOpDelete, isDir: true})
+			}
+			continue
+		}
+		if t.name != "" && name != t.name {
+			continue
+		}
+
+		path := filepath.Join(watch.dir, name)
+		switch {
+		case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+			events = append(events, rawEvent{target: t, path: path, op: protocol.WatchOpCreate, isDir: isDir})
+			if isDir && n.spec.recursive && t.name == "" {
+				// Entries created before the new directory was watched are
+				// reported as created too
+				err := n.addTree(t, path, func(p string, isDir bool) {
+					events = append(events, rawEvent{target: t, path: p, op: protocol.WatchOpCreate, isDir: isDir})
+				})
+				if err != nil {
+					events = append(events, rawEvent{})
+				}
+			}
+		case mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+			events = append(events, rawEvent{target: t, path: path, op: protocol.WatchOpDelete, isDir: isDir})
+		case mask&syscall.IN_MODIFY != 0:
+			events = append(events, rawEvent{target: t, path: path, op: protocol.WatchOpModify, isDir: isDir})
+		}
+	}
+	return events
+}
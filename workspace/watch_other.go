@@ -0,0 +1,10 @@
+//go:build !linux
+
+package workspace
+
+import "errors"
+
+// newNotifyWatcher is only implemented with inotify on Linux; elsewhere watch polls.
+func newNotifyWatcher(*watchSpec) (watcher, error) {
+	return nil, errors.New("file notifications not supported on this platform")
+}
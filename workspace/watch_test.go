@@ -0,0 +1,207 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// watchRecorder collects streamed watch events.
+type watchRecorder struct {
+	mu     sync.Mutex
+	events []protocol.WatchEvent
+}
+
+func (r *watchRecorder) output(stream, data string) error {
+	if stream != protocol.TaskStreamEvent {
+		return nil
+	}
+	var ev protocol.WatchEvent
+	if err := json.Unmarshal([]byte(data), &ev); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, ev)
+	return nil
+}
+
+// ops returns the events as "op path" strings.
+func (r *watchRecorder) ops() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ops := make([]string, 0, len(r.events))
+	for _, ev := range r.events {
+		ops = append(ops, ev.Op+" "+ev.Path)
+	}
+	return ops
+}
+
+// startWatch runs a watch in the background and waits until it is set up.
+func startWatch(t *testing.T, ws *Workspace, args *protocol.WatchArgs) (*watchRecorder, func() *protocol.WatchResult) {
+	t.Helper()
+	rec := &watchRecorder{}
+	type outcome struct {
+		res *protocol.WatchResult
+		err error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		res, err := ws.Watch(context.Background(), args, rec.output)
+		done <- outcome{res, err}
+	}()
+	// The watch has no readiness signal; give it time to take its initial state
+	time.Sleep(200 * time.Millisecond)
+
+	return rec, func() *protocol.WatchResult {
+		select {
+		case o := <-done:
+			require.NoError(t, o.err)
+			return o.res
+		case <-time.After(10 * time.Second):
+			t.Fatalf("watch did not finish, events: %v", rec.ops())
+			return nil
+		}
+	}
+}
+
+func TestWorkspace_Watch(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		name := "inotify"
+		if poll {
+			name = "poll"
+		}
+		t.Run(name, func(t *testing.T) {
+			ws := newTestWorkspace(t)
+			dir := filepath.Join(ws.Root(), "watched")
+			require.NoError(t, os.MkdirAll(dir, 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("a: 1"), 0o644))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "old.log"), []byte("old"), 0o644))
+
+			rec, wait := startWatch(t, ws, &protocol.WatchArgs{
+				Paths:     []string{"watched"},
+				Recursive: true,
+				Debounce:  100,
+				Duration:  8,
+				MaxEvents: 4,
+				Poll:      poll,
+			})
+
+			// A burst of writes is one event
+			for i := range 5 {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("a: "+string(rune('2'+i))), 0o644))
+			}
+			require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "dump.core"), []byte("core"), 0o644))
+			require.NoError(t, os.Remove(filepath.Join(dir, "old.log")))
+			// A file that comes and goes within the debounce delay is not reported
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "tmp"), nil, 0o644))
+			require.NoError(t, os.Remove(filepath.Join(dir, "tmp")))
+			// Outside the watched directory
+			require.NoError(t, os.WriteFile(filepath.Join(ws.Root(), "other.txt"), nil, 0o644))
+
+			res := wait()
+			assert.Equal(t, name, res.Backend)
+			assert.Equal(t, 4, res.Events)
+			assert.True(t, res.Truncated)
+			assert.ElementsMatch(t, []string{
+				"modify watched/config.yaml",
+				"create watched/sub",
+				"create watched/sub/dump.core",
+				"delete watched/old.log",
+			}, rec.ops())
+		})
+	}
+}
+
+func TestWorkspace_Watch_File(t *testing.T) {
+	ws, logDir := newMountedWorkspace(t)
+	logFile := filepath.Join(logDir, "app.log")
+	require.NoError(t, os.WriteFile(logFile, []byte("start\n"), 0o644))
+
+	rec, wait := startWatch(t, ws, &protocol.WatchArgs{
+		Paths:     []string{"logs:app.log", "."},
+		Debounce:  50,
+		Duration:  1,
+		MaxEvents: 10,
+	})
+
+	// Siblings of a watched file and runner working files are not reported
+	require.NoError(t, os.WriteFile(filepath.Join(logDir, "other.log"), []byte("x"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(ws.Root(), WorkDir, "outputs"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root(), WorkDir, "outputs", "out.txt"), []byte("x"), 0o644))
+
+	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString("error\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	res := wait()
+	assert.False(t, res.Truncated)
+	assert.Equal(t, []string{"modify logs:app.log"}, rec.ops())
+	require.Len(t, rec.events, 1)
+	assert.Equal(t, int64(len("start\nerror\n")), rec.events[0].Size)
+}
+
+func TestWorkspace_Watch_Errors(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+	discard := func(string, string) error { return nil }
+
+	_, err := ws.Watch(ctx, &protocol.WatchArgs{Paths: []string{"."}}, nil)
+	assert.Error(t, err)
+	_, err = ws.Watch(ctx, &protocol.WatchArgs{}, discard)
+	assert.Error(t, err)
+	_, err = ws.Watch(ctx, &protocol.WatchArgs{Paths: []string{"missing"}}, discard)
+	assert.Error(t, err)
+	_, err = ws.Watch(ctx, &protocol.WatchArgs{Paths: []string{"../"}}, discard)
+	assert.Error(t, err)
+
+	// Cancellation ends the watch
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = ws.Watch(cancelled, &protocol.WatchArgs{Paths: []string{"."}}, discard)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestDebouncer(t *testing.T) {
+	now := time.Now()
+	target := &watchTarget{}
+	d := newDebouncer(100 * time.Millisecond)
+
+	d.add(rawEvent{target: target, path: "tmp", op: protocol.WatchOpCreate}, now)
+	d.add(rawEvent{target: target, path: "tmp", op: protocol.WatchOpModify}, now)
+	d.add(rawEvent{target: target, path: "tmp", op: protocol.WatchOpDelete}, now)
+
+	d.add(rawEvent{target: target, path: "new", op: protocol.WatchOpCreate}, now)
+	d.add(rawEvent{target: target, path: "new", op: protocol.WatchOpModify}, now)
+
+	d.add(rawEvent{target: target, path: "replaced", op: protocol.WatchOpDelete}, now)
+	d.add(rawEvent{target: target, path: "replaced", op: protocol.WatchOpCreate}, now.Add(10*time.Millisecond))
+
+	d.add(rawEvent{target: target, path: "removed", op: protocol.WatchOpModify}, now)
+	d.add(rawEvent{target: target, path: "removed", op: protocol.WatchOpDelete}, now.Add(50*time.Millisecond))
+
+	assert.Empty(t, d.ready(now.Add(50*time.Millisecond)))
+
+	ready := d.ready(now.Add(100 * time.Millisecond))
+	require.Len(t, ready, 1)
+	assert.Equal(t, rawEvent{target: target, path: "new", op: protocol.WatchOpCreate}, ready[0])
+
+	rest := d.flush()
+	require.Len(t, rest, 2)
+	assert.Equal(t, "replaced", rest[0].path)
+	assert.Equal(t, protocol.WatchOpModify, rest[0].op)
+	assert.Equal(t, "removed", rest[1].path)
+	assert.Equal(t, protocol.WatchOpDelete, rest[1].op)
+}
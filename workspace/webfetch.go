@@ -26,6 +26,10 @@ func (w *Workspace) WebFetch(ctx context.Context, args *protocol.WebFetchArgs) (
 	if args.URL == "" || (!strings.HasPrefix(args.URL, "http://") && !strings.HasPrefix(args.URL, "https://")) {
 		return nil, fmt.Errorf("valid http/https url is required")
 	}
+	outputConfig, err := OutputConfig(args.Truncate, args.MaxTokens, protocol.TruncateHead)
+	if err != nil {
+		return nil, err
+	}
 
 	timeout := defaultFetchTimeout
 	if args.Timeout > 0 {
@@ -54,18 +58,22 @@ func (w *Workspace) WebFetch(ctx context.Context, args *protocol.WebFetchArgs) (
 	}
 
 	content := convertContent(string(body), format, resp.Header.Get("Content-Type"))
-	processor := NewLargeOutputProcessor(w, DefaultLargeOutputConfig())
+	processor := NewLargeOutputProcessor(w, outputConfig)
 	processed, err := processor.Process(ctx, content, "webfetch")
 	if err != nil {
 		return nil, err
 	}
 
 	return &protocol.WebFetchResult{
-		Content:   processed.Content,
-		URL:       resp.Request.URL.String(),
-		Truncated: processed.Truncated,
-		FilePath:  processed.FilePath,
-		TotalSize: processed.TotalSize,
+		Content:         processed.Content,
+		URL:             resp.Request.URL.String(),
+		Truncated:       processed.Truncated,
+		FilePath:        processed.FilePath,
+		TotalSize:       processed.TotalSize,
+		TotalLines:      processed.TotalLines,
+		PreviewLines:    processed.PreviewLines,
+		TotalTokens:     processed.TotalTokens,
+		EstimatedTokens: processed.EstimatedTokens,
 	}, nil
 }
 
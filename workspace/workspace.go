@@ -3,7 +3,6 @@ package workspace
 
 import (
 	"archive/zip"
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/base64"
@@ -14,13 +13,10 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"sort"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/bmatcuk/doublestar/v4"
-
 	"github.com/flashcatcloud/flashduty-runner/mcp"
 	"github.com/flashcatcloud/flashduty-runner/permission"
 	"github.com/flashcatcloud/flashduty-runner/protocol"
@@ -31,8 +27,31 @@ type Workspace struct {
 	root    string
 	checker *permission.Checker
 	mcpMgr  *mcp.ClientManager
+	mounts  map[string]string // Read-only mount name to directory
+
+	// Serializes file modifications so edit preconditions cannot race with writes
+	writeMu sync.Mutex
+	// Serializes updates of upload state
+	uploadMu sync.Mutex
+
+	// Disk usage, shared with sessions
+	disk *diskQuota
+
+	// Set for a session workspace: the workspace it belongs to and the
+	// directories shared read-only from it
+	base   *Workspace
+	shared []string
+
+	sessionsMu sync.Mutex
+	sessionCfg SessionConfig
+	sessions   map[string]*session
 }
 
+// OutputFunc streams task output such as followed log lines, progress and
+// download chunks. stream is one of the protocol.TaskStream* constants. An
+// error means the output can no longer be delivered.
+type OutputFunc func(stream, data string) error
+
 // New creates a new workspace with the given root directory and permission checker.
 func New(root string, checker *permission.Checker) (*Workspace, error) {
 	absRoot, err := filepath.Abs(root)
@@ -49,6 +68,7 @@ func New(root string, checker *permission.Checker) (*Workspace, error) {
 		root:    absRoot,
 		checker: checker,
 		mcpMgr:  mcp.NewClientManager(),
+		disk:    &diskQuota{root: absRoot, cfg: DefaultQuotaConfig()},
 	}, nil
 }
 
@@ -57,15 +77,47 @@ func (w *Workspace) Root() string {
 	return w.root
 }
 
-// safePath ensures the path is within the workspace root, resolving symlinks.
+// safePath resolves a path a task modifies. Besides the checks of
+// resolvePath, the runner's working files are refused, so a task cannot
+// change saved outputs, staged uploads or other sessions.
 func (w *Workspace) safePath(path string) (string, error) {
+	realPath, err := w.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := w.relPath(realPath)
+	if err != nil {
+		return "", err
+	}
+	if isWorkPath(rel) {
+		return "", fmt.Errorf("%s is reserved for runner working files: %s", WorkDir, path)
+	}
+	return realPath, nil
+}
+
+// isWorkPath reports whether the workspace-relative path rel is in WorkDir.
+func isWorkPath(rel string) bool {
+	return rel == WorkDir || strings.HasPrefix(rel, WorkDir+"/")
+}
+
+// resolvePath ensures the path is within the workspace root, resolving
+// symlinks. Mounts are read-only, so paths addressing a mount are rejected
+// here. It is used for reads and for the runner's own working files.
+func (w *Workspace) resolvePath(path string) (string, error) {
+	if name, _, ok := w.splitMount(path); ok {
+		return "", fmt.Errorf("mount %s is read-only: %s", name, path)
+	}
+	if name, _, ok := w.splitShared(path); ok {
+		return "", fmt.Errorf("%s is shared by all sessions and read-only: %s", name, path)
+	}
+
 	absPath, err := filepath.Abs(filepath.Join(w.root, path))
 	if err != nil {
 		return "", fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
 	// First check without resolving symlinks
-	if !strings.HasPrefix(absPath, w.root) {
+	if !isWithin(w.root, absPath) {
 		return "", fmt.Errorf("path is outside workspace root: %s", path)
 	}
 
@@ -87,21 +139,35 @@ func (w *Workspace) safePath(path string) (string, error) {
 			realRoot = w.root
 		}
 
-		if !strings.HasPrefix(realPath, realRoot) {
+		if !isWithin(realRoot, realPath) {
 			return "", fmt.Errorf("path escapes workspace root via symlink: %s", path)
 		}
 		return realPath, nil
 	}
 
+	// A new path is created below its closest existing parent, which must not
+	// lead out of the workspace either
+	for dir := filepath.Dir(absPath); dir != w.root && isWithin(w.root, dir); dir = filepath.Dir(dir) {
+		realDir, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		if !isWithin(w.realRoot(), realDir) {
+			return "", fmt.Errorf("path escapes workspace root via symlink: %s", path)
+		}
+		break
+	}
+
 	return absPath, nil
 }
 
 // Read reads a file from the workspace.
 func (w *Workspace) Read(ctx context.Context, args *protocol.ReadArgs) (*protocol.ReadResult, error) {
-	realPath, err := w.safePath(args.Path)
+	loc, err := w.resolveRead(args.Path)
 	if err != nil {
 		return nil, err
 	}
+	realPath := loc.path
 
 	info, err := os.Stat(realPath)
 	if err != nil {
@@ -111,7 +177,19 @@ func (w *Workspace) Read(ctx context.Context, args *protocol.ReadArgs) (*protoco
 		return nil, fmt.Errorf("cannot read a directory: %s", args.Path)
 	}
 
-	return w.readFileContent(realPath, info.Size(), args.Offset, args.Limit)
+	var result *protocol.ReadResult
+	switch args.Mode {
+	case "", protocol.ReadModeBytes:
+		result, err = w.readFileContent(realPath, info.Size(), args.Offset, args.Limit)
+	case protocol.ReadModeLines:
+		result, err = w.readLines(realPath, info.Size(), args.StartLine, args.LineCount, args.CountLines)
+	default:
+		return nil, fmt.Errorf("unsupported read mode: %s", args.Mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 // readFileContent reads file content with offset and limit support.
@@ -127,12 +205,19 @@ func (w *Workspace) readFileContent(path string, size, offset, limit int64) (*pr
 	if offset < 0 {
 		offset = 0
 	}
+	if offset >= size {
+		return &protocol.ReadResult{TotalSize: size}, nil
+	}
+
 	if limit <= 0 || offset+limit > size {
 		limit = size - offset
 	}
 
-	if offset >= size {
-		return &protocol.ReadResult{TotalSize: size}, nil
+	// Cap the read so a large file is never loaded into memory at once
+	truncated := false
+	if limit > DefaultMaxReadSize {
+		limit = DefaultMaxReadSize
+		truncated = true
 	}
 
 	buf := make([]byte, limit)
@@ -141,209 +226,55 @@ func (w *Workspace) readFileContent(path string, size, offset, limit int64) (*pr
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
-	return &protocol.ReadResult{
+	result := &protocol.ReadResult{
 		Content:   base64.StdEncoding.EncodeToString(buf[:n]),
 		TotalSize: size,
-	}, nil
+		Truncated: truncated,
+	}
+	// Hash the content read so a later edit can detect concurrent changes,
+	// only when it is the whole file
+	if offset == 0 && int64(n) == size && !truncated {
+		result.SHA256 = hashContent(buf[:n])
+	}
+	return result, nil
 }
 
 // Write writes content to a file in the workspace.
-func (w *Workspace) Write(ctx context.Context, args *protocol.WriteArgs) error {
+func (w *Workspace) Write(ctx context.Context, args *protocol.WriteArgs) (*protocol.WriteResult, error) {
 	realPath, err := w.safePath(args.Path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Decode base64 content
 	content, err := base64.StdEncoding.DecodeString(args.Content)
 	if err != nil {
-		return fmt.Errorf("failed to decode content: %w", err)
+		return nil, fmt.Errorf("failed to decode content: %w", err)
 	}
 
-	// Ensure parent directory exists
-	dir := filepath.Dir(realPath)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
-	}
-
-	return os.WriteFile(realPath, content, 0o644)
-}
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
 
-// List lists entries in a directory.
-func (w *Workspace) List(ctx context.Context, args *protocol.ListArgs) (*protocol.ListResult, error) {
-	realPath, err := w.safePath(args.Path)
-	if err != nil {
-		return nil, err
-	}
-
-	// Resolve root for consistent relative path calculation
-	resolvedRoot := w.root
-	if resolved, resolveErr := filepath.EvalSymlinks(w.root); resolveErr == nil {
-		resolvedRoot = resolved
-	}
-
-	var entries []protocol.ListEntry
-	err = filepath.Walk(realPath, func(p string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		relPath, _ := filepath.Rel(resolvedRoot, p)
-		if relPath == "." {
-			return nil
-		}
-
-		// Check ignore patterns
-		for _, pattern := range args.Ignore {
-			if matched, _ := filepath.Match(pattern, filepath.Base(p)); matched {
-				if info.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
-			}
+	result := &protocol.WriteResult{Success: true}
+	if args.Append {
+		if err := w.disk.reserve("write", args.Path, int64(len(content))); err != nil {
+			return nil, err
 		}
-
-		entries = append(entries, protocol.ListEntry{
-			Path:  relPath,
-			IsDir: info.IsDir(),
-			Size:  info.Size(),
-		})
-
-		if !args.Recursive && info.IsDir() && p != realPath {
-			return filepath.SkipDir
+		result.BackupError = w.backup(realPath, "append")
+		if err := appendFile(realPath, content, 0o644); err != nil {
+			return nil, err
 		}
-
-		return nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list directory: %w", err)
-	}
-
-	return &protocol.ListResult{Entries: entries}, nil
-}
-
-// Glob searches for files matching a pattern.
-func (w *Workspace) Glob(ctx context.Context, args *protocol.GlobArgs) (*protocol.GlobResult, error) {
-	fsys := os.DirFS(w.root)
-	matches, err := doublestar.Glob(fsys, args.Pattern)
-	if err != nil {
-		return nil, fmt.Errorf("failed to glob: %w", err)
-	}
-
-	sort.Strings(matches)
-	return &protocol.GlobResult{Matches: matches}, nil
-}
-
-// Grep searches for a pattern in files.
-func (w *Workspace) Grep(ctx context.Context, args *protocol.GrepArgs) (*protocol.GrepResult, error) {
-	var res *protocol.GrepResult
-	var err error
-	// Try ripgrep first
-	if _, lookErr := exec.LookPath("rg"); lookErr == nil {
-		res, err = w.grepWithRipgrep(ctx, args)
-	} else {
-		res, err = w.grepWithGo(ctx, args)
-	}
-
-	if err != nil || res == nil {
-		return res, err
-	}
-
-	// Build content string
-	var sb strings.Builder
-	for _, match := range res.Matches {
-		sb.WriteString(fmt.Sprintf("%s:%d:%s\n", match.Path, match.LineNumber, match.Content))
-	}
-	content := sb.String()
-
-	// Process large output
-	processor := NewLargeOutputProcessor(w, DefaultLargeOutputConfig())
-	processed, err := processor.Process(ctx, content, "grep")
-	if err != nil {
-		res.Content = content
-		res.TotalSize = int64(len(content))
-		return res, nil
-	}
-
-	res.Content = processed.Content
-	res.Truncated = processed.Truncated
-	res.FilePath = processed.FilePath
-	res.TotalSize = processed.TotalSize
-
-	return res, nil
-}
-
-func (w *Workspace) grepWithRipgrep(ctx context.Context, args *protocol.GrepArgs) (*protocol.GrepResult, error) {
-	cmdArgs := []string{"--column", "--line-number", "--no-heading", "--color", "never", "--smart-case"}
-	for _, inc := range args.Include {
-		cmdArgs = append(cmdArgs, "--glob", inc)
+		return result, nil
 	}
-	cmdArgs = append(cmdArgs, args.Pattern, ".")
-
-	cmd := exec.CommandContext(ctx, "rg", cmdArgs...)
-	cmd.Dir = w.root
-
-	var stdout strings.Builder
-	cmd.Stdout = &stdout
-	_ = cmd.Run() // rg returns exit code 1 if no matches found
-
-	lines := strings.Split(stdout.String(), "\n")
-	results := make([]protocol.GrepMatch, 0, len(lines))
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-		parts := strings.SplitN(line, ":", 4)
-		if len(parts) < 4 {
-			continue
-		}
-		lineNum, _ := strconv.Atoi(parts[1])
-		results = append(results, protocol.GrepMatch{
-			Path:       parts[0],
-			LineNumber: lineNum,
-			Content:    parts[3],
-		})
-	}
-	return &protocol.GrepResult{Matches: results}, nil
-}
 
-func (w *Workspace) grepWithGo(ctx context.Context, args *protocol.GrepArgs) (*protocol.GrepResult, error) {
-	var results []protocol.GrepMatch
-	include := args.Include
-	if len(include) == 0 {
-		include = []string{"**/*"}
+	if err := w.disk.reserveReplace("write", args.Path, realPath, int64(len(content))); err != nil {
+		return nil, err
 	}
-
-	for _, inc := range include {
-		matches, err := w.Glob(ctx, &protocol.GlobArgs{Pattern: inc})
-		if err != nil {
-			continue
-		}
-
-		for _, match := range matches.Matches {
-			realPath, _ := w.safePath(match)
-			file, err := os.Open(realPath)
-			if err != nil {
-				continue
-			}
-
-			scanner := bufio.NewScanner(file)
-			lineNum := 1
-			for scanner.Scan() {
-				line := scanner.Text()
-				if strings.Contains(line, args.Pattern) {
-					results = append(results, protocol.GrepMatch{
-						Path:       match,
-						LineNumber: lineNum,
-						Content:    line,
-					})
-				}
-				lineNum++
-			}
-			_ = file.Close()
-		}
+	result.BackupError = w.backup(realPath, "write")
+	if err := writeFileAtomic(realPath, content, 0o644); err != nil {
+		return nil, err
 	}
-	return &protocol.GrepResult{Matches: results}, nil
+	return result, nil
 }
 
 // Bash executes a bash command in the workspace.
@@ -351,6 +282,13 @@ func (w *Workspace) Bash(ctx context.Context, args *protocol.BashArgs) (*protoco
 	if err := w.checker.Check(args.Command); err != nil {
 		return nil, err
 	}
+	outputConfig, err := OutputConfig(args.Truncate, args.MaxTokens, protocol.TruncateHeadTail)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkParseFormat(args.Parse); err != nil {
+		return nil, err
+	}
 
 	workdir, err := w.resolveWorkdir(args.Workdir)
 	if err != nil {
@@ -363,13 +301,20 @@ func (w *Workspace) Bash(ctx context.Context, args *protocol.BashArgs) (*protoco
 		return result, err
 	}
 
+	if args.Parse != "" && result.Stdout != "" && w.parseBashOutput(ctx, result, args.Parse, outputConfig) {
+		return result, nil
+	}
+
 	// Skip large output processing for .work/ directory reads
 	if ShouldSkipForWorkDir(args.Command) {
 		result.TotalSize = int64(len(result.Stdout))
+		result.TotalLines = countLines(result.Stdout)
+		result.TotalTokens = EstimateTokens(result.Stdout) + EstimateTokens(result.Stderr)
+		result.EstimatedTokens = result.TotalTokens
 		return result, nil
 	}
 
-	return w.processLargeOutput(ctx, result, "bash")
+	return w.processLargeOutput(ctx, result, "bash", outputConfig)
 }
 
 // resolveWorkdir resolves the working directory for command execution.
@@ -377,7 +322,7 @@ func (w *Workspace) resolveWorkdir(workdir string) (string, error) {
 	if workdir == "" {
 		return w.root, nil
 	}
-	return w.safePath(workdir)
+	return w.resolvePath(workdir)
 }
 
 // resolveTimeout resolves the command timeout duration.
@@ -449,8 +394,8 @@ func (l *LimitedWriter) Write(p []byte) (n int, err error) {
 }
 
 // processLargeOutput processes command output for truncation if needed.
-func (w *Workspace) processLargeOutput(ctx context.Context, result *protocol.BashResult, prefix string) (*protocol.BashResult, error) {
-	processor := NewLargeOutputProcessor(w, DefaultLargeOutputConfig())
+func (w *Workspace) processLargeOutput(ctx context.Context, result *protocol.BashResult, prefix string, config LargeOutputConfig) (*protocol.BashResult, error) {
+	processor := NewLargeOutputProcessor(w, config)
 	processed, err := processor.Process(ctx, result.Stdout, prefix)
 	if err != nil {
 		result.TotalSize = int64(len(result.Stdout))
@@ -461,6 +406,12 @@ func (w *Workspace) processLargeOutput(ctx context.Context, result *protocol.Bas
 	result.Truncated = processed.Truncated
 	result.FilePath = processed.FilePath
 	result.TotalSize = processed.TotalSize
+	result.TotalLines = processed.TotalLines
+	result.PreviewLines = processed.PreviewLines
+	// Stderr is returned in full and counts towards the tokens of the result
+	stderrTokens := EstimateTokens(result.Stderr)
+	result.TotalTokens = processed.TotalTokens + stderrTokens
+	result.EstimatedTokens = processed.EstimatedTokens + stderrTokens
 
 	return result, nil
 }
@@ -468,10 +419,13 @@ func (w *Workspace) processLargeOutput(ctx context.Context, result *protocol.Bas
 // WriteRaw writes raw content (not base64 encoded) to a file.
 // Used internally for saving large output files.
 func (w *Workspace) WriteRaw(ctx context.Context, path string, content []byte) error {
-	realPath, err := w.safePath(path)
+	realPath, err := w.resolvePath(path)
 	if err != nil {
 		return err
 	}
+	if err := w.disk.reserveReplace("write", path, realPath, int64(len(content))); err != nil {
+		return err
+	}
 
 	// Ensure parent directory exists
 	dir := filepath.Dir(realPath)
@@ -484,6 +438,11 @@ func (w *Workspace) WriteRaw(ctx context.Context, path string, content []byte) e
 
 // MCPCall executes an MCP tool call.
 func (w *Workspace) MCPCall(ctx context.Context, args *protocol.MCPCallArgs, logger *slog.Logger) (*protocol.MCPCallResult, error) {
+	outputConfig, err := OutputConfig(args.Truncate, args.MaxTokens, protocol.TruncateHead)
+	if err != nil {
+		return nil, err
+	}
+
 	// Parse arguments
 	var toolArgs map[string]any
 	if len(args.Args) > 0 {
@@ -502,18 +461,22 @@ func (w *Workspace) MCPCall(ctx context.Context, args *protocol.MCPCallArgs, log
 	content := mcp.ExtractContent(result)
 
 	// Process large output
-	processor := NewLargeOutputProcessor(w, DefaultLargeOutputConfig())
+	processor := NewLargeOutputProcessor(w, outputConfig)
 	processed, err := processor.Process(ctx, content, "mcp")
 	if err != nil {
 		return nil, err
 	}
 
 	return &protocol.MCPCallResult{
-		Content:   processed.Content,
-		IsError:   result.IsError,
-		Truncated: processed.Truncated,
-		FilePath:  processed.FilePath,
-		TotalSize: processed.TotalSize,
+		Content:         processed.Content,
+		IsError:         result.IsError,
+		Truncated:       processed.Truncated,
+		FilePath:        processed.FilePath,
+		TotalSize:       processed.TotalSize,
+		TotalLines:      processed.TotalLines,
+		PreviewLines:    processed.PreviewLines,
+		TotalTokens:     processed.TotalTokens,
+		EstimatedTokens: processed.EstimatedTokens,
 	}, nil
 }
 
@@ -583,19 +546,17 @@ func (w *Workspace) unzipSkill(data []byte, dest string) error {
 	if err := os.MkdirAll(dest, 0o755); err != nil {
 		return fmt.Errorf("failed to create destination directory: %w", err)
 	}
+	if resolved, err := filepath.EvalSymlinks(dest); err == nil {
+		dest = resolved
+	}
 
 	for _, f := range reader.File {
 		// Security: validate zip entry path to prevent path traversal
-		cleanName := filepath.Clean(f.Name)
-		if strings.HasPrefix(cleanName, "..") || filepath.IsAbs(cleanName) {
-			return fmt.Errorf("invalid file path in zip: %s", f.Name)
-		}
-
-		targetPath := filepath.Join(dest, cleanName)
-		absTarget, err := filepath.Abs(targetPath)
-		if err != nil || !strings.HasPrefix(absTarget, dest) {
-			return fmt.Errorf("file path escapes destination: %s", f.Name)
+		absTarget, err := archiveEntryTarget(dest, f.Name)
+		if err != nil {
+			return err
 		}
+		cleanName := filepath.Clean(f.Name)
 
 		if f.FileInfo().IsDir() {
 			if err := os.MkdirAll(absTarget, f.Mode()); err != nil {
@@ -1,10 +1,12 @@
 package workspace
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -56,6 +58,92 @@ func TestWorkspace_Read(t *testing.T) {
 	assert.Equal(t, "World", string(decoded))
 }
 
+func TestWorkspace_Read_Lines(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+
+	content := "line1\nline2\r\nline3\nline4\n" + strings.Repeat("x", MaxLineLength+10)
+	err := os.WriteFile(filepath.Join(ws.Root(), "lines.txt"), []byte(content), 0o644)
+	require.NoError(t, err)
+
+	result, err := ws.Read(ctx, &protocol.ReadArgs{
+		Path:      "lines.txt",
+		Mode:      protocol.ReadModeLines,
+		StartLine: 2,
+		LineCount: 2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "     2\tline2\n     3\tline3\n", result.Content)
+	assert.Equal(t, 2, result.StartLine)
+	assert.Equal(t, 3, result.EndLine)
+	assert.True(t, result.More)
+	assert.Zero(t, result.TotalLines, "reading stops after the range")
+	assert.False(t, result.IsBinary)
+
+	result, err = ws.Read(ctx, &protocol.ReadArgs{
+		Path:       "lines.txt",
+		Mode:       protocol.ReadModeLines,
+		StartLine:  2,
+		LineCount:  2,
+		CountLines: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "     2\tline2\n     3\tline3\n", result.Content)
+	assert.Equal(t, 5, result.TotalLines)
+
+	// Last line has no trailing newline and is longer than the line cap
+	result, err = ws.Read(ctx, &protocol.ReadArgs{Path: "lines.txt", Mode: protocol.ReadModeLines, StartLine: 5})
+	require.NoError(t, err)
+	assert.Equal(t, 5, result.EndLine)
+	assert.Equal(t, 5, result.TotalLines)
+	assert.False(t, result.More)
+	assert.Contains(t, result.Content, "... [line truncated]")
+
+	// Past the end of the file
+	result, err = ws.Read(ctx, &protocol.ReadArgs{Path: "lines.txt", Mode: protocol.ReadModeLines, StartLine: 10})
+	require.NoError(t, err)
+	assert.Empty(t, result.Content)
+	assert.Equal(t, 5, result.TotalLines)
+}
+
+func TestWorkspace_Read_Truncated(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), DefaultMaxReadSize/16+1)
+	require.NoError(t, os.WriteFile(filepath.Join(ws.Root(), "big.txt"), data, 0o644))
+
+	result, err := ws.Read(ctx, &protocol.ReadArgs{Path: "big.txt"})
+	require.NoError(t, err)
+	assert.True(t, result.Truncated)
+	assert.Equal(t, int64(len(data)), result.TotalSize)
+	content, err := base64.StdEncoding.DecodeString(result.Content)
+	require.NoError(t, err)
+	assert.Equal(t, data[:DefaultMaxReadSize], content)
+
+	// A read within the cap is not truncated
+	result, err = ws.Read(ctx, &protocol.ReadArgs{Path: "big.txt", Offset: int64(len(data)) - 16})
+	require.NoError(t, err)
+	assert.False(t, result.Truncated)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("0123456789abcdef")), result.Content)
+}
+
+func TestWorkspace_Read_LinesBinary(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+
+	err := os.WriteFile(filepath.Join(ws.Root(), "bin.dat"), []byte{0x7f, 'E', 'L', 'F', 0, 1, 2}, 0o644)
+	require.NoError(t, err)
+
+	result, err := ws.Read(ctx, &protocol.ReadArgs{Path: "bin.dat", Mode: protocol.ReadModeLines})
+	require.NoError(t, err)
+	assert.True(t, result.IsBinary)
+	assert.Empty(t, result.Content)
+
+	_, err = ws.Read(ctx, &protocol.ReadArgs{Path: "bin.dat", Mode: "chars"})
+	assert.Error(t, err)
+}
+
 func TestWorkspace_Read_PathTraversal(t *testing.T) {
 	ws := newTestWorkspace(t)
 	ctx := context.Background()
@@ -73,7 +161,7 @@ func TestWorkspace_Write(t *testing.T) {
 	testContent := "Test content"
 	testPath := "subdir/test.txt"
 
-	err := ws.Write(ctx, &protocol.WriteArgs{
+	_, err := ws.Write(ctx, &protocol.WriteArgs{
 		Path:    testPath,
 		Content: base64.StdEncoding.EncodeToString([]byte(testContent)),
 	})
@@ -85,6 +173,40 @@ func TestWorkspace_Write(t *testing.T) {
 	assert.Equal(t, testContent, string(content))
 }
 
+func TestWorkspace_Write_PreservesModeAndAppends(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+
+	scriptPath := filepath.Join(ws.Root(), "run.sh")
+	require.NoError(t, os.WriteFile(scriptPath, []byte("#!/bin/sh\n"), 0o755))
+
+	_, err := ws.Write(ctx, &protocol.WriteArgs{
+		Path:    "run.sh",
+		Content: base64.StdEncoding.EncodeToString([]byte("#!/bin/sh\necho hi\n")),
+	})
+	require.NoError(t, err)
+
+	info, err := os.Stat(scriptPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+
+	_, err = ws.Write(ctx, &protocol.WriteArgs{
+		Path:    "run.sh",
+		Content: base64.StdEncoding.EncodeToString([]byte("echo bye\n")),
+		Append:  true,
+	})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(scriptPath)
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\necho hi\necho bye\n", string(content))
+
+	// No temp files are left behind
+	matches, err := filepath.Glob(filepath.Join(ws.Root(), ".run.sh.tmp-*"))
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
 func TestWorkspace_List(t *testing.T) {
 	ws := newTestWorkspace(t)
 	ctx := context.Background()
@@ -188,6 +310,10 @@ func TestWorkspace_SafePath(t *testing.T) {
 		{"relative path", "subdir/file.txt", false},
 		{"path traversal", "../etc/passwd", true},
 		{"path traversal deep", "../../../../../../etc/passwd", true},
+		{"work dir", ".work", true},
+		{"other session", ".work/sessions/trace-2/notes.txt", true},
+		{"work dir via dot", "subdir/../.work/uploads/x", true},
+		{"work dir prefix", ".workbench/file.txt", false},
 	}
 
 	for _, tt := range tests {
@@ -201,3 +327,21 @@ func TestWorkspace_SafePath(t *testing.T) {
 		})
 	}
 }
+
+func TestWorkspace_WorkDirProtected(t *testing.T) {
+	ws := newTestWorkspace(t)
+	ctx := context.Background()
+	content := base64.StdEncoding.EncodeToString([]byte("x"))
+
+	_, err := ws.Write(ctx, &protocol.WriteArgs{Path: ".work/sessions/trace-2/notes.txt", Content: content})
+	assert.ErrorContains(t, err, "reserved for runner working files")
+	_, err = ws.Write(ctx, &protocol.WriteArgs{Path: ".work/outputs/bash.txt", Content: content, Append: true})
+	assert.ErrorContains(t, err, "reserved for runner working files")
+	_, err = ws.Edit(ctx, &protocol.EditArgs{Path: ".work/notes.txt", NewString: "x"})
+	assert.ErrorContains(t, err, "reserved for runner working files")
+	assert.NoDirExists(t, filepath.Join(ws.Root(), ".work", "sessions"))
+
+	// The runner still saves its own files there, and tasks can read them
+	require.NoError(t, ws.WriteRaw(ctx, ".work/outputs/bash.txt", []byte("saved")))
+	assert.Equal(t, "saved", readString(t, ws, ".work/outputs/bash.txt"))
+}
@@ -0,0 +1,85 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic replaces path with data by writing a temporary file in the same
+// directory and renaming it over the target, so a crash never leaves a partially
+// written file. The mode and owner of an existing file are preserved; new files
+// get mode perm.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tmp.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := installFile(tmpPath, path, perm); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// installFile renames the complete file src over path. src must be on the same
+// filesystem. The mode and owner of an existing file are preserved; new files
+// get mode perm.
+func installFile(src, path string, perm os.FileMode) error {
+	existing, err := os.Stat(path)
+	if err == nil {
+		perm = existing.Mode().Perm()
+	}
+
+	if err := os.Chmod(src, perm); err != nil {
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+	if existing != nil {
+		preserveOwner(src, existing)
+	}
+
+	if err := os.Rename(src, path); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
+
+// appendFile appends data to path, creating it with mode perm if missing.
+func appendFile(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, perm)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to append to file: %w", err)
+	}
+	return f.Close()
+}
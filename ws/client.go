@@ -7,17 +7,13 @@ import (
 	"fmt"
 	"log/slog"
 	"net/url"
-	"os"
-	"os/exec"
-	"os/user"
-	"runtime"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 
 	"github.com/flashcatcloud/flashduty-runner/protocol"
+	"github.com/flashcatcloud/flashduty-runner/workspace"
 )
 
 const (
@@ -50,20 +46,28 @@ type Client struct {
 	workspaceRoot string
 	handler       MessageHandler
 	version       string
-	envInfo       *protocol.EnvironmentInfo
-
-	mu          sync.Mutex
-	conn        *websocket.Conn
-	closed      bool
-	envInfoSent bool // Track if environment info has been sent
-	stopCh      chan struct{}
-	doneCh      chan struct{}
-	sendCh      chan *protocol.Message
+	env           *envCollector
+	metrics       *metricsCollector
+
+	mu                 sync.Mutex
+	conn               *websocket.Conn
+	closed             bool
+	envInfoSent        bool          // Track if environment info has been sent on this connection
+	envSentAt          time.Time     // When environment info was last sent
+	envRefreshInterval time.Duration // How often to re-send environment info; 0 disables
+	stopCh             chan struct{}
+	doneCh             chan struct{}
+	sendCh             chan *protocol.Message
 
 	// Worknode info from welcome message
 	worknodeID string
 	name       string
 	labels     []string
+
+	// Labels and capabilities declared in local configuration
+	autoLabels   map[string]string
+	localLabels  map[string]string
+	capabilities []string
 }
 
 // NewClient creates a new WebSocket client.
@@ -74,13 +78,41 @@ func NewClient(token, apiURL, workspaceRoot string, handler MessageHandler, vers
 		workspaceRoot: workspaceRoot,
 		handler:       handler,
 		version:       version,
-		envInfo:       collectEnvironmentInfo(workspaceRoot),
+		env:           newEnvCollector(workspaceRoot),
+		metrics:       newMetricsCollector(workspaceRoot),
 		stopCh:        make(chan struct{}),
 		doneCh:        make(chan struct{}),
 		sendCh:        make(chan *protocol.Message, 100),
+
+		envRefreshInterval: defaultEnvRefreshInterval,
+		autoLabels:         AutoLabels(),
 	}
 }
 
+// SetLocalLabels sets labels and capability tags declared in local configuration.
+// They are merged with auto-detected and cloud-managed labels in every heartbeat.
+func (c *Client) SetLocalLabels(labels map[string]string, capabilities []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.localLabels = labels
+	c.capabilities = NormalizeCapabilities(capabilities)
+}
+
+// SetWorkspaceUsage sets the source of the workspace disk usage reported in
+// heartbeats.
+func (c *Client) SetWorkspaceUsage(usage func() workspace.Usage) {
+	c.metrics.setUsage(usage)
+}
+
+// SetEnvRefreshInterval sets how often environment info is re-collected and
+// sent on a live connection. Environment info is always re-sent after a
+// reconnect; an interval of 0 disables periodic refresh.
+func (c *Client) SetEnvRefreshInterval(interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.envRefreshInterval = interval
+}
+
 // Connect establishes a WebSocket connection to Flashduty.
 func (c *Client) Connect(ctx context.Context) error {
 	// Build URL with token as query parameter
@@ -122,7 +154,7 @@ func (c *Client) Connect(ctx context.Context) error {
 	slog.Info("connected to Flashduty",
 		"worknode_id", c.worknodeID,
 		"name", c.name,
-		"labels", c.labels,
+		"labels", c.EffectiveLabels(),
 	)
 
 	return nil
@@ -163,9 +195,11 @@ func (c *Client) readWelcomeMessage() error {
 		return fmt.Errorf("failed to parse welcome payload: %w", err)
 	}
 
+	c.mu.Lock()
 	c.worknodeID = welcome.WorknodeID
 	c.name = welcome.Name
 	c.labels = welcome.Labels
+	c.mu.Unlock()
 
 	return nil
 }
@@ -305,6 +339,13 @@ func (c *Client) Labels() []string {
 	return c.labels
 }
 
+// EffectiveLabels returns the merged auto, cloud and local labels reported in heartbeats.
+func (c *Client) EffectiveLabels() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return mergeLabels(c.autoLabels, c.labels, c.localLabels)
+}
+
 func (c *Client) readLoop(ctx context.Context) error {
 	c.mu.Lock()
 	conn := c.conn
@@ -404,7 +445,7 @@ func (c *Client) heartbeatLoop(ctx context.Context) {
 	defer ticker.Stop()
 
 	// Send initial heartbeat
-	c.sendHeartbeat()
+	c.sendHeartbeat(ctx)
 
 	for {
 		select {
@@ -415,29 +456,41 @@ func (c *Client) heartbeatLoop(ctx context.Context) {
 		case <-c.doneCh:
 			return
 		case <-ticker.C:
-			c.sendHeartbeat()
+			c.sendHeartbeat(ctx)
 		}
 	}
 }
 
-func (c *Client) sendHeartbeat() {
-	payload := protocol.HeartbeatPayload{
-		WorknodeID: c.worknodeID,
-		Name:       c.name,
-		Labels:     c.labels,
-		Version:    c.version,
-	}
-
-	// Only send environment info on first heartbeat after connection
-	// Environment info is static and doesn't need to be sent repeatedly
+func (c *Client) sendHeartbeat(ctx context.Context) {
 	c.mu.Lock()
-	if !c.envInfoSent {
-		payload.Environment = c.envInfo
-		c.envInfoSent = true
-		slog.Debug("sending environment info with first heartbeat")
-	}
+	capabilities := c.capabilities
 	c.mu.Unlock()
 
+	payload := protocol.HeartbeatPayload{
+		WorknodeID:   c.worknodeID,
+		Name:         c.name,
+		Labels:       c.EffectiveLabels(),
+		Capabilities: capabilities,
+		Version:      c.version,
+		Metrics:      c.metrics.Collect(),
+	}
+
+	// Environment info is sent with the first heartbeat after each connection
+	// and then re-collected periodically so time, hostname and tool changes are seen.
+	// Until tools and cloud metadata have been probed it is sent with every heartbeat.
+	if c.shouldSendEnvInfo() {
+		var ready bool
+		payload.Environment, ready = c.env.Collect(ctx)
+
+		if ready {
+			c.mu.Lock()
+			c.envInfoSent = true
+			c.envSentAt = time.Now()
+			c.mu.Unlock()
+		}
+		slog.Debug("sending environment info with heartbeat", "probed", ready)
+	}
+
 	if err := c.SendPayload(protocol.MessageTypeHeartbeat, payload); err != nil {
 		slog.Warn("failed to send heartbeat",
 			"error", err,
@@ -445,114 +498,13 @@ func (c *Client) sendHeartbeat() {
 	}
 }
 
-// collectEnvironmentInfo gathers system environment information.
-func collectEnvironmentInfo(workspaceRoot string) *protocol.EnvironmentInfo {
-	info := &protocol.EnvironmentInfo{
-		OS:            runtime.GOOS,
-		Arch:          runtime.GOARCH,
-		NumCPU:        runtime.NumCPU(),
-		WorkspaceRoot: workspaceRoot,
-		OSVersion:     getOSVersion(),
-		Shell:         getDefaultShell(),
-		TotalMemoryMB: getTotalMemoryMB(),
-	}
-
-	if hostname, err := os.Hostname(); err == nil {
-		info.Hostname = hostname
-	}
-
-	if u, err := user.Current(); err == nil {
-		info.Username = u.Username
-		info.HomeDir = u.HomeDir
-	}
-
-	now := time.Now()
-	info.CurrentTime = now.Format(time.RFC3339)
-	info.Timezone = now.Location().String()
-	info.UTCOffset = now.Format("-07:00")
-
-	return info
-}
-
-// getOSVersion returns the OS version string.
-func getOSVersion() string {
-	switch runtime.GOOS {
-	case "darwin":
-		return getCommandOutput("sw_vers", "-productVersion") // Try macOS version first
-	case "linux":
-		if version := getLinuxVersion(); version != "" {
-			return version
-		}
-	case "windows":
-		return getCommandOutput("cmd", "/c", "ver")
-	}
-	return getCommandOutput("uname", "-r") // Fallback
-}
-
-// getLinuxVersion tries to get Linux version from /etc/os-release.
-func getLinuxVersion() string {
-	data, err := os.ReadFile("/etc/os-release")
-	if err != nil {
-		return ""
-	}
-	for _, line := range strings.Split(string(data), "\n") {
-		if strings.HasPrefix(line, "VERSION_ID=") {
-			return strings.Trim(strings.TrimPrefix(line, "VERSION_ID="), "\"")
-		}
-	}
-	return ""
-}
-
-// getCommandOutput executes a command and returns its trimmed output.
-func getCommandOutput(name string, args ...string) string {
-	out, err := exec.Command(name, args...).Output()
-	if err == nil {
-		return strings.TrimSpace(string(out))
-	}
-	return ""
-}
-
-// getDefaultShell returns the default shell path.
-func getDefaultShell() string {
-	// Check SHELL environment variable first
-	if shell := os.Getenv("SHELL"); shell != "" {
-		return shell
-	}
-
-	// Platform-specific defaults
-	switch runtime.GOOS {
-	case "windows":
-		if comspec := os.Getenv("COMSPEC"); comspec != "" {
-			return comspec
-		}
-		return "cmd.exe"
-	default:
-		return "/bin/sh"
-	}
-}
+// shouldSendEnvInfo reports whether the next heartbeat should carry environment info.
+func (c *Client) shouldSendEnvInfo() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-// getTotalMemoryMB returns total system memory in MB.
-func getTotalMemoryMB() int64 {
-	switch runtime.GOOS {
-	case "darwin":
-		out, err := exec.Command("sysctl", "-n", "hw.memsize").Output()
-		if err == nil {
-			var bytes int64
-			if _, err := fmt.Sscanf(strings.TrimSpace(string(out)), "%d", &bytes); err == nil {
-				return bytes / (1024 * 1024)
-			}
-		}
-	case "linux":
-		if data, err := os.ReadFile("/proc/meminfo"); err == nil {
-			for _, line := range strings.Split(string(data), "\n") {
-				if strings.HasPrefix(line, "MemTotal:") {
-					var kb int64
-					if _, err := fmt.Sscanf(line, "MemTotal: %d kB", &kb); err == nil {
-						return kb / 1024
-					}
-				}
-			}
-		}
+	if !c.envInfoSent {
+		return true
 	}
-	return 0
+	return c.envRefreshInterval > 0 && time.Since(c.envSentAt) >= c.envRefreshInterval
 }
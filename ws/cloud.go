@@ -0,0 +1,221 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const (
+	// Overall timeout for cloud metadata detection
+	cloudProbeTimeout = 1500 * time.Millisecond
+
+	// Maximum metadata response size
+	maxMetadataSize = 64 * 1024
+)
+
+// Metadata service endpoints, variables so tests can serve them
+var (
+	awsMetadataURL     = "http://169.254.169.254"
+	gcpMetadataURL     = "http://metadata.google.internal"
+	azureMetadataURL   = "http://169.254.169.254/metadata/instance?api-version=2021-02-01"
+	alibabaMetadataURL = "http://100.100.100.200"
+)
+
+// metadataClient talks to link-local metadata services directly, never via a proxy.
+var metadataClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:       nil,
+		DialContext: (&net.Dialer{Timeout: cloudProbeTimeout}).DialContext,
+	},
+}
+
+// cloudProbe queries a single provider's metadata service.
+type cloudProbe func(ctx context.Context) *protocol.CloudInfo
+
+// detectCloud probes known cloud metadata services concurrently and returns
+// the first provider that responds, in priority order. Returns nil when the
+// runner is not on a recognized cloud instance.
+func detectCloud(ctx context.Context) *protocol.CloudInfo {
+	ctx, cancel := context.WithTimeout(ctx, cloudProbeTimeout)
+	var wg sync.WaitGroup
+	// Cancel the remaining probes and wait for them on return
+	defer wg.Wait()
+	defer cancel()
+
+	probes := []cloudProbe{probeAWS, probeGCP, probeAzure, probeAlibaba}
+	results := make([]chan *protocol.CloudInfo, len(probes))
+	for i, probe := range probes {
+		results[i] = make(chan *protocol.CloudInfo, 1)
+		wg.Add(1)
+		go func(probe cloudProbe, ch chan<- *protocol.CloudInfo) {
+			defer wg.Done()
+			ch <- probe(ctx)
+		}(probe, results[i])
+	}
+
+	for _, ch := range results {
+		if info := <-ch; info != nil {
+			return info
+		}
+	}
+	return nil
+}
+
+// probeAWS reads the EC2 instance identity document using IMDSv2.
+func probeAWS(ctx context.Context) *protocol.CloudInfo {
+	token, err := metadataRequest(ctx, http.MethodPut, awsMetadataURL+"/latest/api/token",
+		map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"})
+	if err != nil || token == "" {
+		return nil
+	}
+
+	body, err := metadataRequest(ctx, http.MethodGet, awsMetadataURL+"/latest/dynamic/instance-identity/document",
+		map[string]string{"X-aws-ec2-metadata-token": token})
+	if err != nil {
+		return nil
+	}
+
+	var doc struct {
+		InstanceID       string `json:"instanceId"`
+		InstanceType     string `json:"instanceType"`
+		Region           string `json:"region"`
+		AvailabilityZone string `json:"availabilityZone"`
+	}
+	if err := json.Unmarshal([]byte(body), &doc); err != nil || doc.InstanceID == "" {
+		return nil
+	}
+	return &protocol.CloudInfo{
+		Provider:     "aws",
+		InstanceID:   doc.InstanceID,
+		InstanceType: doc.InstanceType,
+		Region:       doc.Region,
+		Zone:         doc.AvailabilityZone,
+	}
+}
+
+// probeGCP reads instance attributes from the GCE metadata server.
+func probeGCP(ctx context.Context) *protocol.CloudInfo {
+	headers := map[string]string{"Metadata-Flavor": "Google"}
+	get := func(path string) string {
+		v, err := metadataRequest(ctx, http.MethodGet, gcpMetadataURL+"/computeMetadata/v1/instance/"+path, headers)
+		if err != nil {
+			return ""
+		}
+		return v
+	}
+
+	id := get("id")
+	if id == "" {
+		return nil
+	}
+
+	// Zone and machine type are returned as "projects/<num>/zones/<zone>" style paths
+	zone := lastPathSegment(get("zone"))
+	region := zone
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		region = zone[:i]
+	}
+	return &protocol.CloudInfo{
+		Provider:     "gcp",
+		InstanceID:   id,
+		InstanceType: lastPathSegment(get("machine-type")),
+		Region:       region,
+		Zone:         zone,
+	}
+}
+
+// probeAzure reads compute metadata from the Azure Instance Metadata Service.
+func probeAzure(ctx context.Context) *protocol.CloudInfo {
+	body, err := metadataRequest(ctx, http.MethodGet, azureMetadataURL, map[string]string{"Metadata": "true"})
+	if err != nil {
+		return nil
+	}
+
+	var doc struct {
+		Compute struct {
+			VMID     string `json:"vmId"`
+			VMSize   string `json:"vmSize"`
+			Location string `json:"location"`
+			Zone     string `json:"zone"`
+		} `json:"compute"`
+	}
+	if err := json.Unmarshal([]byte(body), &doc); err != nil || doc.Compute.VMID == "" {
+		return nil
+	}
+	return &protocol.CloudInfo{
+		Provider:     "azure",
+		InstanceID:   doc.Compute.VMID,
+		InstanceType: doc.Compute.VMSize,
+		Region:       doc.Compute.Location,
+		Zone:         doc.Compute.Zone,
+	}
+}
+
+// probeAlibaba reads instance attributes from the Alibaba Cloud metadata service.
+func probeAlibaba(ctx context.Context) *protocol.CloudInfo {
+	get := func(path string) string {
+		v, err := metadataRequest(ctx, http.MethodGet, alibabaMetadataURL+"/latest/meta-data/"+path, nil)
+		if err != nil {
+			return ""
+		}
+		return v
+	}
+
+	id := get("instance-id")
+	if id == "" {
+		return nil
+	}
+	return &protocol.CloudInfo{
+		Provider:     "alibaba",
+		InstanceID:   id,
+		InstanceType: get("instance/instance-type"),
+		Region:       get("region-id"),
+		Zone:         get("zone-id"),
+	}
+}
+
+// metadataRequest performs a metadata request and returns the trimmed body.
+func metadataRequest(ctx context.Context, method, url string, headers map[string]string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata service returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// lastPathSegment returns the part of s after the final "/".
+func lastPathSegment(s string) string {
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
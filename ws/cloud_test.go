@@ -0,0 +1,119 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+// metadataServer serves the metadata endpoints of every provider.
+type metadataServer struct {
+	unavailable atomic.Bool
+	requests    atomic.Int64
+}
+
+// newMetadataServer starts a metadata server and points the probes at it.
+func newMetadataServer(t *testing.T) *metadataServer {
+	t.Helper()
+	m := &metadataServer{}
+	server := httptest.NewServer(http.HandlerFunc(m.serve))
+	t.Cleanup(server.Close)
+
+	saved := []string{awsMetadataURL, gcpMetadataURL, azureMetadataURL, alibabaMetadataURL}
+	awsMetadataURL = server.URL
+	gcpMetadataURL = server.URL
+	azureMetadataURL = server.URL + "/metadata/instance?api-version=2021-02-01"
+	alibabaMetadataURL = server.URL + "/alibaba"
+	t.Cleanup(func() {
+		awsMetadataURL, gcpMetadataURL, azureMetadataURL, alibabaMetadataURL = saved[0], saved[1], saved[2], saved[3]
+	})
+	return m
+}
+
+func (m *metadataServer) setAvailable(available bool) { m.unavailable.Store(!available) }
+func (m *metadataServer) requestCount() int64         { return m.requests.Load() }
+
+func (m *metadataServer) serve(w http.ResponseWriter, r *http.Request) {
+	m.requests.Add(1)
+	if m.unavailable.Load() {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	gcp := map[string]string{
+		"id":           "4520031799277581759",
+		"zone":         "projects/123/zones/us-central1-a",
+		"machine-type": "projects/123/machineTypes/e2-medium",
+	}
+	alibaba := map[string]string{
+		"instance-id":            "i-bp1abc",
+		"instance/instance-type": "ecs.g7.large",
+		"region-id":              "cn-hangzhou",
+		"zone-id":                "cn-hangzhou-h",
+	}
+
+	switch path := r.URL.Path; {
+	case path == "/latest/api/token" && r.Method == http.MethodPut:
+		_, _ = w.Write([]byte("token-1"))
+	case path == "/latest/dynamic/instance-identity/document" && r.Header.Get("X-aws-ec2-metadata-token") == "token-1":
+		_, _ = w.Write([]byte(`{"instanceId":"i-0abc","instanceType":"t3.large","region":"us-east-1","availabilityZone":"us-east-1b"}`))
+	case strings.HasPrefix(path, "/computeMetadata/v1/instance/") && r.Header.Get("Metadata-Flavor") == "Google":
+		if v, ok := gcp[strings.TrimPrefix(path, "/computeMetadata/v1/instance/")]; ok {
+			_, _ = w.Write([]byte(v + "\n"))
+			return
+		}
+		http.NotFound(w, r)
+	case path == "/metadata/instance" && r.Header.Get("Metadata") == "true":
+		_, _ = w.Write([]byte(`{"compute":{"vmId":"02aab8a4","vmSize":"Standard_D2s_v3","location":"westeurope","zone":"1"}}`))
+	case strings.HasPrefix(path, "/alibaba/latest/meta-data/"):
+		if v, ok := alibaba[strings.TrimPrefix(path, "/alibaba/latest/meta-data/")]; ok {
+			_, _ = w.Write([]byte(v))
+			return
+		}
+		http.NotFound(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestCloudProbes(t *testing.T) {
+	newMetadataServer(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		probe cloudProbe
+		want  *protocol.CloudInfo
+	}{
+		{"aws", probeAWS, &protocol.CloudInfo{Provider: "aws", InstanceID: "i-0abc", InstanceType: "t3.large", Region: "us-east-1", Zone: "us-east-1b"}},
+		{"gcp", probeGCP, &protocol.CloudInfo{Provider: "gcp", InstanceID: "4520031799277581759", InstanceType: "e2-medium", Region: "us-central1", Zone: "us-central1-a"}},
+		{"azure", probeAzure, &protocol.CloudInfo{Provider: "azure", InstanceID: "02aab8a4", InstanceType: "Standard_D2s_v3", Region: "westeurope", Zone: "1"}},
+		{"alibaba", probeAlibaba, &protocol.CloudInfo{Provider: "alibaba", InstanceID: "i-bp1abc", InstanceType: "ecs.g7.large", Region: "cn-hangzhou", Zone: "cn-hangzhou-h"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.probe(ctx))
+		})
+	}
+}
+
+func TestDetectCloud(t *testing.T) {
+	server := newMetadataServer(t)
+	ctx := context.Background()
+
+	// Every provider answers; the first in priority order wins
+	info := detectCloud(ctx)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, "aws", info.Provider)
+	}
+
+	server.setAvailable(false)
+	assert.Nil(t, detectCloud(ctx))
+}
@@ -0,0 +1,372 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+const (
+	// Default interval for re-sending environment info on a live connection
+	defaultEnvRefreshInterval = 10 * time.Minute
+
+	// Timeout for a single tool version probe
+	toolVersionTimeout = 2 * time.Second
+
+	// Kubernetes service account namespace file
+	k8sNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// toolProbe describes how to detect a tool and query its version.
+type toolProbe struct {
+	name        string
+	versionArgs []string
+}
+
+// knownTools lists tools commonly needed for incident investigation.
+var knownTools = []toolProbe{
+	{"kubectl", []string{"version", "--client"}},
+	{"helm", []string{"version", "--short"}},
+	{"docker", []string{"--version"}},
+	{"podman", []string{"--version"}},
+	{"crictl", []string{"--version"}},
+	{"psql", []string{"--version"}},
+	{"mysql", []string{"--version"}},
+	{"redis-cli", []string{"--version"}},
+	{"mongosh", []string{"--version"}},
+	{"git", []string{"--version"}},
+	{"curl", []string{"--version"}},
+	{"jq", []string{"--version"}},
+	{"python3", []string{"--version"}},
+	{"java", []string{"-version"}},
+	{"go", []string{"version"}},
+	{"node", []string{"--version"}},
+	{"aws", []string{"--version"}},
+	{"gcloud", []string{"--version"}},
+	{"az", []string{"--version"}},
+	{"terraform", []string{"--version"}},
+	{"systemctl", []string{"--version"}},
+	{"journalctl", []string{"--version"}},
+	{"ss", []string{"--version"}},
+	{"tcpdump", []string{"--version"}},
+	{"rg", []string{"--version"}},
+}
+
+// envCollector gathers environment information for heartbeats.
+// Tool versions and cloud metadata take seconds to probe, so they are probed
+// in the background and heartbeats carry the last results. Cloud metadata
+// never changes for an instance, so it is no longer probed once found.
+type envCollector struct {
+	workspaceRoot string
+
+	mu      sync.Mutex
+	tools   []protocol.ToolInfo
+	cloud   *protocol.CloudInfo
+	probed  bool // Whether the probes completed at least once
+	probing bool
+}
+
+// newEnvCollector creates a new environment collector.
+func newEnvCollector(workspaceRoot string) *envCollector {
+	return &envCollector{workspaceRoot: workspaceRoot}
+}
+
+// Collect gathers a snapshot of the environment with the tools and cloud
+// metadata of the last probe, and starts a new probe unless one is running.
+// ready reports whether a probe had completed.
+func (e *envCollector) Collect(ctx context.Context) (info *protocol.EnvironmentInfo, ready bool) {
+	info = collectEnvironmentInfo(e.workspaceRoot)
+	info.IPAddresses = getIPAddresses()
+	info.Container = detectContainer()
+	info.Kubernetes = detectKubernetes()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	info.Tools, info.Cloud, ready = e.tools, e.cloud, e.probed
+	if !e.probing {
+		e.probing = true
+		// Probes have their own timeouts and should finish after a disconnect
+		go e.probe(context.WithoutCancel(ctx))
+	}
+	return info, ready
+}
+
+// probe detects tools and, until found, cloud metadata.
+func (e *envCollector) probe(ctx context.Context) {
+	tools := detectTools(ctx)
+
+	e.mu.Lock()
+	cloud := e.cloud
+	e.mu.Unlock()
+	if cloud == nil {
+		cloud = detectCloud(ctx)
+	}
+
+	e.mu.Lock()
+	e.tools, e.cloud, e.probed, e.probing = tools, cloud, true, false
+	e.mu.Unlock()
+}
+
+// collectEnvironmentInfo gathers system environment information.
+func collectEnvironmentInfo(workspaceRoot string) *protocol.EnvironmentInfo {
+	info := &protocol.EnvironmentInfo{
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		NumCPU:        runtime.NumCPU(),
+		WorkspaceRoot: workspaceRoot,
+		OSVersion:     getOSVersion(),
+		Shell:         getDefaultShell(),
+		TotalMemoryMB: getTotalMemoryMB(),
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		info.Hostname = hostname
+	}
+
+	if u, err := user.Current(); err == nil {
+		info.Username = u.Username
+		info.HomeDir = u.HomeDir
+	}
+
+	now := time.Now()
+	info.CurrentTime = now.Format(time.RFC3339)
+	info.Timezone = now.Location().String()
+	info.UTCOffset = now.Format("-07:00")
+
+	return info
+}
+
+// getOSVersion returns the OS version string.
+func getOSVersion() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return getCommandOutput("sw_vers", "-productVersion") // Try macOS version first
+	case "linux":
+		if version := getLinuxVersion(); version != "" {
+			return version
+		}
+	case "windows":
+		return getCommandOutput("cmd", "/c", "ver")
+	}
+	return getCommandOutput("uname", "-r") // Fallback
+}
+
+// getLinuxVersion tries to get Linux version from /etc/os-release.
+func getLinuxVersion() string {
+	data, err := os.ReadFile("/etc/os-release")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "VERSION_ID=") {
+			return strings.Trim(strings.TrimPrefix(line, "VERSION_ID="), "\"")
+		}
+	}
+	return ""
+}
+
+// getCommandOutput executes a command and returns its trimmed output.
+func getCommandOutput(name string, args ...string) string {
+	out, err := exec.Command(name, args...).Output()
+	if err == nil {
+		return strings.TrimSpace(string(out))
+	}
+	return ""
+}
+
+// getDefaultShell returns the default shell path.
+func getDefaultShell() string {
+	// Check SHELL environment variable first
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+
+	// Platform-specific defaults
+	switch runtime.GOOS {
+	case "windows":
+		if comspec := os.Getenv("COMSPEC"); comspec != "" {
+			return comspec
+		}
+		return "cmd.exe"
+	default:
+		return "/bin/sh"
+	}
+}
+
+// getTotalMemoryMB returns total system memory in MB.
+func getTotalMemoryMB() int64 {
+	switch runtime.GOOS {
+	case "darwin":
+		out, err := exec.Command("sysctl", "-n", "hw.memsize").Output()
+		if err == nil {
+			var bytes int64
+			if _, err := fmt.Sscanf(strings.TrimSpace(string(out)), "%d", &bytes); err == nil {
+				return bytes / (1024 * 1024)
+			}
+		}
+	case "linux":
+		if data, err := os.ReadFile("/proc/meminfo"); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if strings.HasPrefix(line, "MemTotal:") {
+					var kb int64
+					if _, err := fmt.Sscanf(line, "MemTotal: %d kB", &kb); err == nil {
+						return kb / 1024
+					}
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// getIPAddresses returns non-loopback, non-link-local interface addresses.
+func getIPAddresses() []string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+
+	var ips []string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipNet.IP
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+			continue
+		}
+		ips = append(ips, ip.String())
+	}
+	return ips
+}
+
+// detectTools looks up known tools on PATH and queries their versions concurrently.
+func detectTools(ctx context.Context) []protocol.ToolInfo {
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		tools []protocol.ToolInfo
+	)
+
+	for _, probe := range knownTools {
+		path, err := exec.LookPath(probe.name)
+		if err != nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(probe toolProbe, path string) {
+			defer wg.Done()
+			tool := protocol.ToolInfo{
+				Name:    probe.name,
+				Path:    path,
+				Version: getToolVersion(ctx, path, probe.versionArgs),
+			}
+			mu.Lock()
+			tools = append(tools, tool)
+			mu.Unlock()
+		}(probe, path)
+	}
+	wg.Wait()
+
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools
+}
+
+// getToolVersion runs a tool's version command and returns the first non-empty line.
+// Some tools (e.g., java) print their version to stderr, so combined output is used.
+func getToolVersion(ctx context.Context, path string, args []string) string {
+	ctx, cancel := context.WithTimeout(ctx, toolVersionTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, args...).CombinedOutput()
+	if err != nil && len(out) == 0 {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// detectContainer detects whether the runner is running inside a container.
+func detectContainer() *protocol.ContainerInfo {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+
+	if _, err := os.Stat("/.dockerenv"); err == nil {
+		return &protocol.ContainerInfo{Runtime: "docker"}
+	}
+	if _, err := os.Stat("/run/.containerenv"); err == nil {
+		return &protocol.ContainerInfo{Runtime: "podman"}
+	}
+
+	if data, err := os.ReadFile("/proc/1/cgroup"); err == nil {
+		if rt := containerRuntimeFromCgroup(string(data)); rt != "" {
+			return &protocol.ContainerInfo{Runtime: rt}
+		}
+	}
+
+	// systemd-nspawn, lxc and others set the "container" env var for PID 1
+	if rt := os.Getenv("container"); rt != "" {
+		return &protocol.ContainerInfo{Runtime: rt}
+	}
+	return nil
+}
+
+// containerRuntimeFromCgroup infers the container runtime from /proc/1/cgroup contents.
+func containerRuntimeFromCgroup(data string) string {
+	switch {
+	case strings.Contains(data, "kubepods"):
+		if strings.Contains(data, "docker") {
+			return "docker"
+		}
+		return "containerd"
+	case strings.Contains(data, "docker"):
+		return "docker"
+	case strings.Contains(data, "containerd"):
+		return "containerd"
+	case strings.Contains(data, "libpod"):
+		return "podman"
+	case strings.Contains(data, "lxc"):
+		return "lxc"
+	}
+	return ""
+}
+
+// detectKubernetes detects whether the runner is running inside a Kubernetes pod.
+func detectKubernetes() *protocol.KubernetesInfo {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return nil
+	}
+
+	info := &protocol.KubernetesInfo{
+		Namespace: os.Getenv("POD_NAMESPACE"),
+		PodName:   os.Getenv("POD_NAME"),
+		NodeName:  os.Getenv("NODE_NAME"),
+	}
+	if info.Namespace == "" {
+		if data, err := os.ReadFile(k8sNamespaceFile); err == nil {
+			info.Namespace = strings.TrimSpace(string(data))
+		}
+	}
+	if info.PodName == "" {
+		// Pod hostname defaults to the pod name
+		info.PodName, _ = os.Hostname()
+	}
+	return info
+}
@@ -0,0 +1,120 @@
+package ws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+func TestContainerRuntimeFromCgroup(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"docker", "12:memory:/docker/3f1e2a\n0::/docker/3f1e2a\n", "docker"},
+		{"kubernetes with containerd", "0::/kubepods/besteffort/pod1234/cri-containerd-abcd\n", "containerd"},
+		{"kubernetes with docker", "11:cpu:/kubepods/burstable/pod1234/docker-abcd.scope\n", "docker"},
+		{"containerd", "0::/system.slice/containerd.service/default/abcd\n", "containerd"},
+		{"podman", "0::/machine.slice/libpod-abcd.scope/container\n", "podman"},
+		{"lxc", "2:cpuset:/lxc/web01\n", "lxc"},
+		{"host", "0::/init.scope\n", ""},
+		{"cgroup v2 namespace", "0::/\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, containerRuntimeFromCgroup(tt.data))
+		})
+	}
+}
+
+func TestDetectKubernetes(t *testing.T) {
+	t.Run("outside a pod", func(t *testing.T) {
+		t.Setenv("KUBERNETES_SERVICE_HOST", "")
+		assert.Nil(t, detectKubernetes())
+	})
+
+	t.Run("downward API", func(t *testing.T) {
+		t.Setenv("KUBERNETES_SERVICE_HOST", "10.96.0.1")
+		t.Setenv("POD_NAMESPACE", "ops")
+		t.Setenv("POD_NAME", "runner-7d9f")
+		t.Setenv("NODE_NAME", "node-1")
+		assert.Equal(t, &protocol.KubernetesInfo{Namespace: "ops", PodName: "runner-7d9f", NodeName: "node-1"}, detectKubernetes())
+	})
+
+	t.Run("pod name from hostname", func(t *testing.T) {
+		t.Setenv("KUBERNETES_SERVICE_HOST", "10.96.0.1")
+		t.Setenv("POD_NAMESPACE", "ops")
+		t.Setenv("POD_NAME", "")
+		t.Setenv("NODE_NAME", "")
+		info := detectKubernetes()
+		require.NotNil(t, info)
+		assert.Equal(t, "ops", info.Namespace)
+		assert.NotEmpty(t, info.PodName)
+	})
+}
+
+func TestEnvCollector_ProbesInBackground(t *testing.T) {
+	newMetadataServer(t)
+	setKnownTools(t, nil)
+	e := newEnvCollector(t.TempDir())
+
+	// The first collection has nothing probed yet
+	info, ready := e.Collect(context.Background())
+	assert.False(t, ready)
+	assert.Nil(t, info.Cloud)
+	assert.NotEmpty(t, info.OS)
+
+	waitProbe(t, e)
+	info, ready = e.Collect(context.Background())
+	assert.True(t, ready)
+	require.NotNil(t, info.Cloud)
+	assert.Equal(t, "aws", info.Cloud.Provider)
+	waitProbe(t, e)
+}
+
+// waitProbe waits for the background probe of e to finish.
+func waitProbe(t *testing.T, e *envCollector) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		return !e.probing
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestEnvCollector_RetriesCloudUntilFound(t *testing.T) {
+	server := newMetadataServer(t)
+	setKnownTools(t, nil)
+	e := newEnvCollector(t.TempDir())
+	ctx := context.Background()
+
+	server.setAvailable(false)
+	e.probe(ctx)
+	assert.Nil(t, e.cloud, "a failed probe is not cached")
+
+	server.setAvailable(true)
+	e.probe(ctx)
+	require.NotNil(t, e.cloud)
+	assert.Equal(t, "i-0abc", e.cloud.InstanceID)
+
+	// Once found, the metadata service is not asked again
+	server.setAvailable(false)
+	requests := server.requestCount()
+	e.probe(ctx)
+	require.NotNil(t, e.cloud)
+	assert.Equal(t, requests, server.requestCount())
+}
+
+// setKnownTools replaces the tools probed for the duration of a test.
+func setKnownTools(t *testing.T, tools []toolProbe) {
+	t.Helper()
+	saved := knownTools
+	knownTools = tools
+	t.Cleanup(func() { knownTools = saved })
+}
@@ -2,32 +2,51 @@ package ws
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
 	"time"
 
+	"github.com/flashcatcloud/flashduty-runner/db"
+	"github.com/flashcatcloud/flashduty-runner/diag"
+	"github.com/flashcatcloud/flashduty-runner/k8s"
 	"github.com/flashcatcloud/flashduty-runner/protocol"
+	"github.com/flashcatcloud/flashduty-runner/redact"
 	"github.com/flashcatcloud/flashduty-runner/workspace"
 )
 
 // Handler handles incoming WebSocket messages.
 type Handler struct {
-	ws     *workspace.Workspace
-	client *Client
+	ws        *workspace.Workspace
+	client    *Client
+	redactor  *redact.Redactor  // Masks secrets in everything sent to the cloud, nil disables
+	diag      *diag.Diagnostics // Native host diagnostics, nil disables all
+	kube      *k8s.Client       // Kubernetes API client, nil disables the k8s_* operations
+	databases *db.Client        // Database connection profiles, nil disables db_query
 
 	// Track running tasks for cancellation and graceful shutdown
 	mu          sync.RWMutex
 	runningTask map[string]context.CancelFunc
 	taskWg      sync.WaitGroup // For graceful shutdown
+
+	// Secrets masked in streamed output, by task, reported with the result
+	outputRedactions map[string]int
+	// Downloads whose chunks had secrets masked, so the file hash no longer matches
+	maskedDownloads map[string]bool
 }
 
 // NewHandler creates a new message handler.
 func NewHandler(ws *workspace.Workspace) *Handler {
 	return &Handler{
-		ws:          ws,
-		runningTask: make(map[string]context.CancelFunc),
+		ws:               ws,
+		runningTask:      make(map[string]context.CancelFunc),
+		outputRedactions: make(map[string]int),
+		maskedDownloads:  make(map[string]bool),
 	}
 }
 
@@ -36,6 +55,27 @@ func (h *Handler) SetClient(client *Client) {
 	h.client = client
 }
 
+// SetRedactor sets the redactor applied to task results, errors and output
+// before they are sent.
+func (h *Handler) SetRedactor(redactor *redact.Redactor) {
+	h.redactor = redactor
+}
+
+// SetDiagnostics sets the host diagnostics tasks may run.
+func (h *Handler) SetDiagnostics(diagnostics *diag.Diagnostics) {
+	h.diag = diagnostics
+}
+
+// SetKubernetes sets the client the k8s_* operations read the cluster with.
+func (h *Handler) SetKubernetes(client *k8s.Client) {
+	h.kube = client
+}
+
+// SetDatabases sets the connection profiles db_query runs against.
+func (h *Handler) SetDatabases(databases *db.Client) {
+	h.databases = databases
+}
+
 // WaitForTasks waits for all running tasks to complete with a timeout.
 // Returns true if all tasks completed, false if timeout occurred.
 func (h *Handler) WaitForTasks(timeout time.Duration) bool {
@@ -130,12 +170,12 @@ func (h *Handler) executeAndSendResult(ctx context.Context, req *protocol.TaskRe
 	result, err := h.executeTask(ctx, req, logger)
 	if err != nil {
 		logger.Error("task execution failed", "error", err)
-		h.sendTaskResult(req.TaskID, req.SourceInstanceID, false, nil, err.Error(), 1)
+		h.sendTaskResult(req.TaskID, req.SourceInstanceID, false, nil, err, 1)
 		return
 	}
 
 	logger.Info("task completed successfully")
-	h.sendTaskResult(req.TaskID, req.SourceInstanceID, true, result, "", 0)
+	h.sendTaskResult(req.TaskID, req.SourceInstanceID, true, result, nil, 0)
 }
 
 func parseArgs[T any](data json.RawMessage) (*T, error) {
@@ -151,58 +191,193 @@ func (h *Handler) executeTask(ctx context.Context, req *protocol.TaskRequestPayl
 		logger = slog.Default()
 	}
 
+	switch req.Operation {
+	case protocol.TaskOpProcesses, protocol.TaskOpSockets, protocol.TaskOpDisks,
+		protocol.TaskOpMemory, protocol.TaskOpKernelLog, protocol.TaskOpSystemd:
+		// Diagnostics read the host rather than a workspace
+		return h.executeDiagnostic(ctx, req)
+	case protocol.TaskOpK8sGet, protocol.TaskOpK8sDescribe, protocol.TaskOpK8sLogs, protocol.TaskOpK8sEvents:
+		return h.executeKubernetes(ctx, req)
+	case protocol.TaskOpDBQuery:
+		return h.executeDBQuery(ctx, req)
+	}
+
+	// Skills are shared by all sessions, and a session is ended by the
+	// workspace it belongs to
+	ws := h.ws
+	if req.Operation != protocol.TaskOpSyncSkill && req.Operation != protocol.TaskOpEndSession {
+		var err error
+		if ws, err = h.ws.ForTask(req.SourceInstanceID, req.TraceID); err != nil {
+			return nil, err
+		}
+	}
+
 	switch req.Operation {
 	case protocol.TaskOpRead:
 		args, err := parseArgs[protocol.ReadArgs](req.Args)
 		if err != nil {
 			return nil, fmt.Errorf("invalid read args: %w", err)
 		}
-		return h.ws.Read(ctx, args)
+		result, err := ws.Read(ctx, args)
+		if err == nil && args.Mode != protocol.ReadModeLines {
+			result.Content, _ = h.redactBase64(req.TaskID, result.Content)
+		}
+		return result, err
 
 	case protocol.TaskOpWrite:
 		args, err := parseArgs[protocol.WriteArgs](req.Args)
 		if err != nil {
 			return nil, fmt.Errorf("invalid write args: %w", err)
 		}
-		if err := h.ws.Write(ctx, args); err != nil {
+		if data, err := base64.StdEncoding.DecodeString(args.Content); err == nil {
+			if err := h.checkUnmasked(string(data)); err != nil {
+				return nil, err
+			}
+		}
+		return ws.Write(ctx, args)
+
+	case protocol.TaskOpEdit:
+		args, err := parseArgs[protocol.EditArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid edit args: %w", err)
+		}
+		if err := h.checkUnmasked(args.NewString + args.Patch); err != nil {
 			return nil, err
 		}
-		return map[string]bool{"success": true}, nil
+		return ws.Edit(ctx, args)
+
+	case protocol.TaskOpRestore:
+		args, err := parseArgs[protocol.RestoreArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid restore args: %w", err)
+		}
+		return ws.Restore(ctx, args)
 
 	case protocol.TaskOpList:
 		args, err := parseArgs[protocol.ListArgs](req.Args)
 		if err != nil {
 			return nil, fmt.Errorf("invalid list args: %w", err)
 		}
-		return h.ws.List(ctx, args)
+		return ws.List(ctx, args)
 
 	case protocol.TaskOpGlob:
 		args, err := parseArgs[protocol.GlobArgs](req.Args)
 		if err != nil {
 			return nil, fmt.Errorf("invalid glob args: %w", err)
 		}
-		return h.ws.Glob(ctx, args)
+		return ws.Glob(ctx, args)
 
 	case protocol.TaskOpGrep:
 		args, err := parseArgs[protocol.GrepArgs](req.Args)
 		if err != nil {
 			return nil, fmt.Errorf("invalid grep args: %w", err)
 		}
-		return h.ws.Grep(ctx, args)
+		return ws.Grep(ctx, args)
+
+	case protocol.TaskOpTail:
+		args, err := parseArgs[protocol.TailArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tail args: %w", err)
+		}
+		return ws.Tail(ctx, args, h.taskOutput(req.TaskID))
+
+	case protocol.TaskOpWatch:
+		args, err := parseArgs[protocol.WatchArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid watch args: %w", err)
+		}
+		return ws.Watch(ctx, args, h.taskOutput(req.TaskID))
+
+	case protocol.TaskOpUploadBegin:
+		args, err := parseArgs[protocol.UploadBeginArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upload_begin args: %w", err)
+		}
+		return ws.UploadBegin(ctx, args)
+
+	case protocol.TaskOpUploadChunk:
+		args, err := parseArgs[protocol.UploadChunkArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upload_chunk args: %w", err)
+		}
+		return ws.UploadChunk(ctx, args, h.taskOutput(req.TaskID))
+
+	case protocol.TaskOpUploadCommit:
+		args, err := parseArgs[protocol.UploadCommitArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upload_commit args: %w", err)
+		}
+		return ws.UploadCommit(ctx, args, h.taskOutput(req.TaskID))
+
+	case protocol.TaskOpDownload:
+		args, err := parseArgs[protocol.DownloadArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid download args: %w", err)
+		}
+		return ws.Download(ctx, args, h.taskOutput(req.TaskID))
+
+	case protocol.TaskOpArchive:
+		args, err := parseArgs[protocol.ArchiveArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive args: %w", err)
+		}
+		return ws.Archive(ctx, args)
+
+	case protocol.TaskOpExtract:
+		args, err := parseArgs[protocol.ExtractArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extract args: %w", err)
+		}
+		return ws.Extract(ctx, args)
+
+	case protocol.TaskOpStat:
+		args, err := parseArgs[protocol.StatArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stat args: %w", err)
+		}
+		return ws.Stat(ctx, args)
+
+	case protocol.TaskOpMkdir:
+		args, err := parseArgs[protocol.MkdirArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mkdir args: %w", err)
+		}
+		return ws.Mkdir(ctx, args)
+
+	case protocol.TaskOpMove:
+		args, err := parseArgs[protocol.MoveArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid move args: %w", err)
+		}
+		return ws.Move(ctx, args)
+
+	case protocol.TaskOpCopy:
+		args, err := parseArgs[protocol.CopyArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid copy args: %w", err)
+		}
+		return ws.Copy(ctx, args)
+
+	case protocol.TaskOpDelete:
+		args, err := parseArgs[protocol.DeleteArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid delete args: %w", err)
+		}
+		return ws.Delete(ctx, args)
 
 	case protocol.TaskOpBash:
 		args, err := parseArgs[protocol.BashArgs](req.Args)
 		if err != nil {
 			return nil, fmt.Errorf("invalid bash args: %w", err)
 		}
-		return h.ws.Bash(ctx, args)
+		return ws.Bash(ctx, args)
 
 	case protocol.TaskOpWebFetch:
 		args, err := parseArgs[protocol.WebFetchArgs](req.Args)
 		if err != nil {
 			return nil, fmt.Errorf("invalid webfetch args: %w", err)
 		}
-		return h.ws.WebFetch(ctx, args)
+		return ws.WebFetch(ctx, args)
 
 	case protocol.TaskOpMCPCall:
 		args, err := parseArgs[protocol.MCPCallArgs](req.Args)
@@ -217,47 +392,296 @@ func (h *Handler) executeTask(ctx context.Context, req *protocol.TaskRequestPayl
 			"has_headers", len(args.Server.Headers) > 0,
 			"has_dynamic_headers", len(args.Server.DynamicHeaders) > 0,
 		)
-		return h.ws.MCPCall(ctx, args, logger)
+		return ws.MCPCall(ctx, args, logger)
 
 	case protocol.TaskOpMCPListTools:
 		args, err := parseArgs[protocol.MCPListToolsArgs](req.Args)
 		if err != nil {
 			return nil, fmt.Errorf("invalid mcp_list_tools args: %w", err)
 		}
-		return h.ws.MCPListTools(ctx, args)
+		return ws.MCPListTools(ctx, args)
 
 	case protocol.TaskOpSyncSkill:
 		args, err := parseArgs[protocol.SyncSkillArgs](req.Args)
 		if err != nil {
 			return nil, fmt.Errorf("invalid sync_skill args: %w", err)
 		}
-		return h.ws.SyncSkill(ctx, args)
+		return ws.SyncSkill(ctx, args)
+
+	case protocol.TaskOpEndSession:
+		return ws.EndSession(req.SourceInstanceID, req.TraceID)
+
+	default:
+		return nil, fmt.Errorf("unknown operation: %s", req.Operation)
+	}
+}
+
+func (h *Handler) executeDiagnostic(ctx context.Context, req *protocol.TaskRequestPayload) (any, error) {
+	switch req.Operation {
+	case protocol.TaskOpProcesses:
+		args, err := parseArgs[protocol.ProcessesArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid processes args: %w", err)
+		}
+		return h.diag.Processes(ctx, args)
+
+	case protocol.TaskOpSockets:
+		args, err := parseArgs[protocol.SocketsArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sockets args: %w", err)
+		}
+		return h.diag.Sockets(ctx, args)
+
+	case protocol.TaskOpDisks:
+		args, err := parseArgs[protocol.DisksArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid disks args: %w", err)
+		}
+		return h.diag.Disks(args)
+
+	case protocol.TaskOpMemory:
+		return h.diag.Memory()
+
+	case protocol.TaskOpKernelLog:
+		args, err := parseArgs[protocol.KernelLogArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kernel_log args: %w", err)
+		}
+		return h.diag.KernelLog(ctx, args)
+
+	case protocol.TaskOpSystemd:
+		args, err := parseArgs[protocol.SystemdArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid systemd args: %w", err)
+		}
+		return h.diag.Systemd(ctx, args)
 
 	default:
 		return nil, fmt.Errorf("unknown operation: %s", req.Operation)
 	}
 }
 
-func (h *Handler) sendTaskResult(taskID, sourceInstanceID string, success bool, result any, errMsg string, exitCode int) {
-	h.sendPayload(protocol.MessageTypeTaskResult, protocol.TaskResultPayload{
+func (h *Handler) executeKubernetes(ctx context.Context, req *protocol.TaskRequestPayload) (any, error) {
+	if h.kube == nil {
+		return nil, fmt.Errorf("kubernetes operations are not enabled: add resources to permission.kubernetes")
+	}
+
+	switch req.Operation {
+	case protocol.TaskOpK8sGet:
+		args, err := parseArgs[protocol.K8sGetArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid k8s_get args: %w", err)
+		}
+		return h.kube.Get(ctx, args)
+
+	case protocol.TaskOpK8sDescribe:
+		args, err := parseArgs[protocol.K8sDescribeArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid k8s_describe args: %w", err)
+		}
+		return h.kube.Describe(ctx, args)
+
+	case protocol.TaskOpK8sLogs:
+		args, err := parseArgs[protocol.K8sLogsArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid k8s_logs args: %w", err)
+		}
+		return h.kube.Logs(ctx, args)
+
+	case protocol.TaskOpK8sEvents:
+		args, err := parseArgs[protocol.K8sEventsArgs](req.Args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid k8s_events args: %w", err)
+		}
+		return h.kube.Events(ctx, args)
+
+	default:
+		return nil, fmt.Errorf("unknown operation: %s", req.Operation)
+	}
+}
+
+func (h *Handler) executeDBQuery(ctx context.Context, req *protocol.TaskRequestPayload) (any, error) {
+	if h.databases == nil {
+		return nil, fmt.Errorf("db_query is not enabled: add connection profiles to databases")
+	}
+	args, err := parseArgs[protocol.DBQueryArgs](req.Args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid db_query args: %w", err)
+	}
+	return h.databases.Query(ctx, args)
+}
+
+func (h *Handler) sendTaskResult(taskID, sourceInstanceID string, success bool, result any, taskErr error, exitCode int) {
+	h.mu.Lock()
+	outputRedactions, maskedDownload := h.outputRedactions[taskID], h.maskedDownloads[taskID]
+	delete(h.outputRedactions, taskID)
+	delete(h.maskedDownloads, taskID)
+	h.mu.Unlock()
+	if download, ok := result.(*protocol.DownloadResult); ok && maskedDownload {
+		download.SHA256 = ""
+		download.Redacted = true
+	}
+
+	data, redactions := h.redactJSON(marshalResult(result))
+	payload := protocol.TaskResultPayload{
 		TaskID:           taskID,
 		SourceInstanceID: sourceInstanceID,
 		Success:          success,
-		Result:           marshalResult(result),
-		Error:            errMsg,
+		Result:           data,
 		ExitCode:         exitCode,
-	})
+	}
+	if taskErr != nil {
+		var n int
+		payload.Error, n = h.redactString(taskErr.Error())
+		redactions += n
+		var fileErr *workspace.FileError
+		if errors.As(taskErr, &fileErr) {
+			payload.ErrorCode = fileErr.Code
+		}
+	}
+
+	redactions += outputRedactions
+	if redactions > 0 {
+		slog.Info("masked secrets in task result", "task_id", taskID, "redactions", redactions)
+	}
+	payload.Redactions = redactions
+	h.sendPayload(protocol.MessageTypeTaskResult, payload)
 }
 
 func (h *Handler) sendMCPResult(callID string, success bool, result any, errMsg string) {
+	data, redactions := h.redactJSON(marshalResult(result))
+	errMsg, n := h.redactString(errMsg)
 	h.sendPayload(protocol.MessageTypeMCPResult, protocol.MCPResultPayload{
-		CallID:  callID,
-		Success: success,
-		Result:  marshalResult(result),
-		Error:   errMsg,
+		CallID:     callID,
+		Success:    success,
+		Result:     data,
+		Error:      errMsg,
+		Redactions: redactions + n,
 	})
 }
 
+// redactJSON masks secrets in a marshaled result.
+func (h *Handler) redactJSON(data json.RawMessage) (json.RawMessage, int) {
+	if h.redactor == nil || data == nil {
+		return data, 0
+	}
+	return h.redactor.JSON(data)
+}
+
+// redactString masks secrets in an error message or streamed output.
+func (h *Handler) redactString(s string) (string, int) {
+	if h.redactor == nil || s == "" {
+		return s, 0
+	}
+	return h.redactor.String(s)
+}
+
+// checkUnmasked refuses content to be written that contains a masked secret.
+// Content read with secrets masked and written back whole would replace the
+// secrets in the file with the marker.
+func (h *Handler) checkUnmasked(content string) error {
+	if h.redactor == nil || !redact.HasMarker(content) {
+		return nil
+	}
+	return fmt.Errorf("content contains a masked secret such as [REDACTED:secret]: " +
+		"writing it would replace the secret in the file, change only the lines around it")
+}
+
+// redactBase64 masks secrets in base64 encoded text content, such as that of
+// a bytes mode read, which redacting the JSON of a result cannot see. It
+// reports whether anything was masked.
+func (h *Handler) redactBase64(taskID, encoded string) (string, bool) {
+	if h.redactor == nil || encoded == "" {
+		return encoded, false
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return encoded, false
+	}
+	masked, ok := h.redactBytes(taskID, data)
+	if !ok {
+		return encoded, false
+	}
+	return base64.StdEncoding.EncodeToString(masked), true
+}
+
+// redactChunk masks secrets in the decoded content of a download chunk and
+// rehashes it. Redacting the encoded chunk as text could corrupt its data.
+// A secret split across two chunks is not masked.
+func (h *Handler) redactChunk(taskID, data string) string {
+	if h.redactor == nil {
+		return data
+	}
+	var chunk protocol.DownloadChunk
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return data
+	}
+	decoded, err := base64.StdEncoding.DecodeString(chunk.Data)
+	if err != nil {
+		return data
+	}
+	masked, ok := h.redactBytes(taskID, decoded)
+	if !ok {
+		return data
+	}
+	sum := sha256.Sum256(masked)
+	chunk.Data = base64.StdEncoding.EncodeToString(masked)
+	chunk.SHA256 = hex.EncodeToString(sum[:])
+	encoded, err := json.Marshal(chunk)
+	if err != nil {
+		return data
+	}
+	h.mu.Lock()
+	h.maskedDownloads[taskID] = true
+	h.mu.Unlock()
+	return string(encoded)
+}
+
+// redactBytes masks secrets in file content unless it looks binary.
+func (h *Handler) redactBytes(taskID string, data []byte) ([]byte, bool) {
+	if workspace.IsBinary(data) {
+		return data, false
+	}
+	masked, n := h.redactor.String(string(data))
+	if n == 0 {
+		return data, false
+	}
+	h.countRedactions(taskID, n)
+	return []byte(masked), true
+}
+
+// countRedactions adds secrets masked outside the result to those reported
+// with it.
+func (h *Handler) countRedactions(taskID string, n int) {
+	if n == 0 {
+		return
+	}
+	h.mu.Lock()
+	h.outputRedactions[taskID] += n
+	h.mu.Unlock()
+}
+
+// taskOutput returns a function that streams output of a task as task.output messages.
+func (h *Handler) taskOutput(taskID string) workspace.OutputFunc {
+	return func(stream, data string) error {
+		if h.client == nil {
+			return fmt.Errorf("client not set")
+		}
+		if stream == protocol.TaskStreamChunk {
+			data = h.redactChunk(taskID, data)
+		} else {
+			var n int
+			data, n = h.redactString(data)
+			h.countRedactions(taskID, n)
+		}
+		return h.client.SendPayload(protocol.MessageTypeTaskOutput, protocol.TaskOutputPayload{
+			TaskID: taskID,
+			Stream: stream,
+			Data:   data,
+		})
+	}
+}
+
 func (h *Handler) sendPayload(msgType protocol.MessageType, payload any) {
 	if h.client == nil {
 		slog.Error("client not set, cannot send message", "type", msgType)
@@ -0,0 +1,78 @@
+package ws
+
+import (
+	"os"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// NormalizeCapabilities trims, de-duplicates and sorts capability tags.
+func NormalizeCapabilities(items []string) []string {
+	seen := make(map[string]bool, len(items))
+	var caps []string
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" || seen[item] {
+			continue
+		}
+		seen[item] = true
+		caps = append(caps, item)
+	}
+	sort.Strings(caps)
+	return caps
+}
+
+// AutoLabels returns labels detected from the host environment.
+func AutoLabels() map[string]string {
+	labels := map[string]string{
+		"os":   runtime.GOOS,
+		"arch": runtime.GOARCH,
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		labels["hostname"] = hostname
+	}
+	if detectKubernetes() != nil {
+		labels["k8s"] = "true"
+	}
+	if container := detectContainer(); container != nil {
+		labels["container"] = container.Runtime
+	}
+	return labels
+}
+
+// mergeLabels merges label sources into a sorted "key=value" list.
+// Precedence is auto < cloud < local: labels declared in local configuration
+// override cloud-managed labels with the same key, which override auto-labels.
+// Cloud labels without a "=" are kept verbatim.
+func mergeLabels(auto map[string]string, cloud []string, local map[string]string) []string {
+	merged := make(map[string]string, len(auto)+len(cloud)+len(local))
+	var plain []string
+
+	for k, v := range auto {
+		merged[k] = v
+	}
+	for _, label := range cloud {
+		if k, v, ok := strings.Cut(label, "="); ok {
+			merged[k] = v
+		} else {
+			plain = append(plain, label)
+		}
+	}
+	for k, v := range local {
+		merged[k] = v
+	}
+
+	result := make([]string, 0, len(merged)+len(plain))
+	for k, v := range merged {
+		result = append(result, k+"="+v)
+	}
+	for _, label := range plain {
+		if _, ok := merged[label]; !ok {
+			result = append(result, label)
+		}
+	}
+	sort.Strings(result)
+	return slices.Compact(result)
+}
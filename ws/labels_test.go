@@ -0,0 +1,28 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeLabels(t *testing.T) {
+	auto := map[string]string{"os": "linux", "arch": "amd64", "env": "auto"}
+	cloud := []string{"env=staging", "k8s", "region=cn-beijing"}
+	local := map[string]string{"env": "prod", "team": "sre"}
+
+	merged := mergeLabels(auto, cloud, local)
+	assert.Equal(t, []string{
+		"arch=amd64",
+		"env=prod", // local overrides cloud and auto
+		"k8s",      // plain cloud labels are kept verbatim
+		"os=linux",
+		"region=cn-beijing",
+		"team=sre",
+	}, merged)
+}
+
+func TestNormalizeCapabilities(t *testing.T) {
+	caps := NormalizeCapabilities([]string{"mysql", " kubectl ", "mysql", ""})
+	assert.Equal(t, []string{"kubectl", "mysql"}, caps)
+}
@@ -0,0 +1,128 @@
+package ws
+
+import (
+	"sync"
+
+	"github.com/flashcatcloud/flashduty-runner/diag"
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+	"github.com/flashcatcloud/flashduty-runner/workspace"
+)
+
+// metricsCollector samples host metrics for heartbeats.
+// CPU usage is computed from the delta between consecutive samples,
+// so the collector keeps the previous CPU snapshot.
+type metricsCollector struct {
+	workspaceRoot string
+
+	mu      sync.Mutex
+	prevCPU diag.CPUTimes
+	hasPrev bool
+	usage   func() workspace.Usage // Workspace disk usage, when set
+}
+
+// newMetricsCollector creates a collector and takes an initial CPU sample
+// so the first heartbeat reports usage since startup rather than since boot.
+func newMetricsCollector(workspaceRoot string) *metricsCollector {
+	m := &metricsCollector{workspaceRoot: workspaceRoot}
+	if cur, err := readCPUTimes(); err == nil {
+		m.prevCPU = cur
+		m.hasPrev = true
+	}
+	return m
+}
+
+// setUsage sets the source of the workspace disk usage.
+func (m *metricsCollector) setUsage(usage func() workspace.Usage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage = usage
+}
+
+// Collect samples current metrics. Returns nil when no metric is available
+// on this platform.
+func (m *metricsCollector) Collect() *protocol.HeartbeatMetrics {
+	metrics := &protocol.HeartbeatMetrics{}
+	available := false
+
+	if cur, err := readCPUTimes(); err == nil {
+		m.mu.Lock()
+		if m.hasPrev {
+			pct := cpuPercent(m.prevCPU, cur)
+			metrics.CPUPercent = &pct
+		}
+		m.prevCPU = cur
+		m.hasPrev = true
+		m.mu.Unlock()
+		available = true
+	}
+
+	if pct, err := readMemoryPercent(); err == nil {
+		metrics.MemoryPercent = &pct
+		available = true
+	}
+
+	if pct, err := readDiskPercent(m.workspaceRoot); err == nil {
+		metrics.DiskPercent = &pct
+		available = true
+	}
+
+	if load, err := readLoadAvg(); err == nil {
+		metrics.LoadAvg1, metrics.LoadAvg5, metrics.LoadAvg15 = load[0], load[1], load[2]
+		available = true
+	}
+
+	if rss, err := readProcessRSS(); err == nil {
+		metrics.ProcessRSSBytes = rss
+		available = true
+	}
+
+	m.mu.Lock()
+	usage := m.usage
+	m.mu.Unlock()
+	if usage != nil {
+		u := usage()
+		metrics.WorkspaceUsedBytes = u.Used
+		metrics.WorkspaceQuotaBytes = u.Quota
+		metrics.OutputsBytes = u.Outputs
+		available = true
+	}
+
+	if !available {
+		return nil
+	}
+	return metrics
+}
+
+// cpuPercent computes busy percentage between two CPU snapshots.
+func cpuPercent(prev, cur diag.CPUTimes) float64 {
+	if cur.Total <= prev.Total {
+		return 0
+	}
+	totalDelta := float64(cur.Total - prev.Total)
+	idleDelta := float64(cur.Idle - prev.Idle)
+	if cur.Idle < prev.Idle {
+		idleDelta = 0
+	}
+	return roundPercent((totalDelta - idleDelta) / totalDelta * 100)
+}
+
+// parseMeminfoPercent returns the percentage of memory in use, excluding
+// reclaimable cache, from /proc/meminfo.
+func parseMeminfoPercent(data string) (float64, error) {
+	mem, err := diag.ParseMeminfo(data)
+	if err != nil {
+		return 0, err
+	}
+	return roundPercent(float64(mem.UsedBytes) / float64(mem.TotalBytes) * 100), nil
+}
+
+// roundPercent rounds a percentage to two decimal places.
+func roundPercent(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 100 {
+		v = 100
+	}
+	return float64(int64(v*100+0.5)) / 100
+}
@@ -0,0 +1,94 @@
+//go:build linux
+
+package ws
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/flashcatcloud/flashduty-runner/diag"
+)
+
+// readCPUTimes reads aggregate CPU counters from /proc/stat.
+func readCPUTimes() (diag.CPUTimes, error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return diag.CPUTimes{}, err
+	}
+	return diag.ParseCPUTimes(string(data))
+}
+
+// readMemoryPercent returns the percentage of memory in use from /proc/meminfo.
+func readMemoryPercent() (float64, error) {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	return parseMeminfoPercent(string(data))
+}
+
+// readDiskPercent returns the usage percentage of the filesystem containing path.
+// Matches df: used / (used + available to unprivileged users).
+func readDiskPercent(path string) (float64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+
+	used := (st.Blocks - st.Bfree) * uint64(st.Bsize)
+	avail := st.Bavail * uint64(st.Bsize)
+	if used+avail == 0 {
+		return 0, fmt.Errorf("filesystem reports zero size")
+	}
+	return roundPercent(float64(used) / float64(used+avail) * 100), nil
+}
+
+// readLoadAvg reads 1, 5 and 15 minute load averages from /proc/loadavg.
+func readLoadAvg() ([3]float64, error) {
+	var load [3]float64
+
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return load, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return load, fmt.Errorf("unexpected /proc/loadavg format")
+	}
+	for i := range load {
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return load, fmt.Errorf("invalid load average %q: %w", fields[i], err)
+		}
+		load[i] = v
+	}
+	return load, nil
+}
+
+// readProcessRSS returns the resident set size of the runner process in bytes.
+func readProcessRSS() (int64, error) {
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "VmRSS:") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "VmRSS:"))
+		if len(fields) == 0 {
+			break
+		}
+		kb, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid VmRSS value %q: %w", fields[0], err)
+		}
+		return kb * 1024, nil
+	}
+	return 0, fmt.Errorf("VmRSS not found in /proc/self/status")
+}
@@ -0,0 +1,32 @@
+//go:build !linux
+
+package ws
+
+import (
+	"errors"
+
+	"github.com/flashcatcloud/flashduty-runner/diag"
+)
+
+// errMetricsUnsupported is returned by metric readers on platforms without /proc.
+var errMetricsUnsupported = errors.New("metrics not supported on this platform")
+
+func readCPUTimes() (diag.CPUTimes, error) {
+	return diag.CPUTimes{}, errMetricsUnsupported
+}
+
+func readMemoryPercent() (float64, error) {
+	return 0, errMetricsUnsupported
+}
+
+func readDiskPercent(string) (float64, error) {
+	return 0, errMetricsUnsupported
+}
+
+func readLoadAvg() ([3]float64, error) {
+	return [3]float64{}, errMetricsUnsupported
+}
+
+func readProcessRSS() (int64, error) {
+	return 0, errMetricsUnsupported
+}
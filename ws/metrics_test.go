@@ -0,0 +1,69 @@
+package ws
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flashcatcloud/flashduty-runner/diag"
+	"github.com/flashcatcloud/flashduty-runner/protocol"
+)
+
+func TestParseMeminfoPercent(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want float64
+	}{
+		{
+			name: "MemAvailable",
+			data: "MemTotal:        8000000 kB\nMemFree:          500000 kB\nMemAvailable:    2000000 kB\nBuffers:          100000 kB\nCached:          1800000 kB\n",
+			want: 75,
+		},
+		{
+			name: "kernel without MemAvailable",
+			data: "MemTotal: 3000 kB\nMemFree: 1000 kB\nBuffers: 0 kB\nCached: 1000 kB\n",
+			want: 33.33,
+		},
+		{
+			name: "all available",
+			data: "MemTotal: 1000 kB\nMemAvailable: 1000 kB\n",
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMeminfoPercent(tt.data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := parseMeminfoPercent("MemFree: 100 kB\n")
+	assert.Error(t, err)
+}
+
+func TestCPUPercent(t *testing.T) {
+	prev, err := diag.ParseCPUTimes("cpu  100 0 100 800 0 0 0 0 0 0\n")
+	require.NoError(t, err)
+	cur, err := diag.ParseCPUTimes("cpu  150 0 150 880 20 0 0 0 0 0\n")
+	require.NoError(t, err)
+
+	assert.Equal(t, 50.0, cpuPercent(prev, cur))
+	assert.Equal(t, 0.0, cpuPercent(cur, cur), "no ticks elapsed")
+	assert.Equal(t, 0.0, cpuPercent(cur, prev), "counters went backwards")
+}
+
+func TestHeartbeatMetricsKeepZeroPercent(t *testing.T) {
+	zero := 0.0
+	data, err := json.Marshal(protocol.HeartbeatMetrics{CPUPercent: &zero, MemoryPercent: &zero, DiskPercent: &zero})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"cpu_percent":0,"memory_percent":0,"disk_percent":0}`, string(data))
+
+	// Unsampled values are left out
+	data, err = json.Marshal(protocol.HeartbeatMetrics{})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{}`, string(data))
+}